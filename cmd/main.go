@@ -5,37 +5,116 @@ import (
     "os"
     "os/signal"
     "strconv"
+    "strings"
     "syscall"
     "time"
 
+    "github.com/walletera/payments-read-model/internal/adapters/input/http/public"
+    "github.com/walletera/payments-read-model/internal/adapters/ndjson"
+    "github.com/walletera/payments-read-model/internal/adapters/rabbitmq"
     "github.com/walletera/payments-read-model/internal/app"
+    "github.com/walletera/payments-read-model/internal/domain/payments"
+    "github.com/walletera/payments-read-model/internal/domain/webhooks"
 )
 
-const shutdownTimeout = 10 * time.Second
+const defaultShutdownTimeout = 10 * time.Second
 
 func main() {
     ctx, ctxCancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
     defer ctxCancel()
 
-    rabbitmqHost := mustGetEnv("RABBITMQ_HOST")
-    rabbitmqPort := mustGetIntEnv("RABBITMQ_PORT")
-    rabbitmqUser := mustGetEnv("RABBITMQ_USER")
-    rabbitmqPassword := mustGetEnv("RABBITMQ_PASSWORD")
     mongodbURL := mustGetEnv("MONGODB_URL")
     publicApiHttpServerPort := mustGetIntEnv("PUBLIC_API_HTTP_SERVER_PORT")
     base64AuthPubKey := mustGetEnv("BASE64_AUTH_PUB_KEY")
+    pendingUpdatesTTL := getDurationEnvOrDefault("PENDING_UPDATES_TTL", app.DefaultPendingUpdatesTTL)
 
-    app, err := app.NewApp(
-        app.WithRabbitmqHost(rabbitmqHost),
-        app.WithRabbitmqPort(rabbitmqPort),
-        app.WithRabbitmqUser(rabbitmqUser),
-        app.WithRabbitmqPassword(rabbitmqPassword),
+    opts := []app.Option{
         app.WithMongoDBURL(mongodbURL),
         app.WithPublicAPIConfig(app.PublicAPIConfig{
             PublicAPIHttpServerPort: publicApiHttpServerPort,
             AuthServiceBase64PubKey: base64AuthPubKey,
+            StreamHeartbeatInterval: getDurationEnvOrDefault("PUBLIC_API_STREAM_HEARTBEAT_INTERVAL", public.DefaultStreamHeartbeatInterval),
         }),
-    )
+        app.WithPendingUpdatesTTL(pendingUpdatesTTL),
+        app.WithRetryBackoff(
+            getDurationEnvOrDefault("RETRY_INITIAL_BACKOFF", app.DefaultRetryInitialBackoff),
+            getDurationEnvOrDefault("RETRY_MAX_BACKOFF", app.DefaultRetryMaxBackoff),
+        ),
+    }
+
+    dispatcherWorkers, found := lookupIntEnv("DISPATCHER_WORKERS")
+    if found {
+        opts = append(opts, app.WithDispatcherWorkers(dispatcherWorkers))
+    }
+
+    dispatcherWorkerQueueSize, found := lookupIntEnv("DISPATCHER_WORKER_QUEUE_SIZE")
+    if found {
+        opts = append(opts, app.WithDispatcherWorkerQueueSize(dispatcherWorkerQueueSize))
+    }
+
+    retryMaxAttempts, found := lookupIntEnv("RETRY_MAX_ATTEMPTS")
+    if found {
+        opts = append(opts, app.WithRetryMaxAttempts(retryMaxAttempts))
+    }
+
+    ingestionApiHttpServerPort, ingestionEnabled := lookupIntEnv("INGESTION_API_HTTP_SERVER_PORT")
+    if ingestionEnabled {
+        opts = append(opts, app.WithIngestionAPIConfig(app.IngestionAPIConfig{
+            IngestionAPIHttpServerPort: ingestionApiHttpServerPort,
+            AuthToken:                  mustGetEnv("INGESTION_API_AUTH_TOKEN"),
+        }))
+    }
+
+    eventsSourceFile, found := os.LookupEnv("EVENTS_SOURCE_FILE")
+    _, rabbitmqEnabled := os.LookupEnv("RABBITMQ_HOST")
+    switch {
+    case found:
+        opts = append(opts, app.WithFileEventsSource(ndjson.Config{
+            Path:           eventsSourceFile,
+            CheckpointPath: os.Getenv("EVENTS_SOURCE_CHECKPOINT_FILE"),
+            ReportPath:     os.Getenv("EVENTS_SOURCE_REPORT_FILE"),
+        }))
+    case rabbitmqEnabled || !ingestionEnabled:
+        opts = append(opts, rabbitMQOptionsFromEnv()...)
+    }
+
+    batchWritesMaxSize, found := lookupIntEnv("BATCH_WRITES_MAX_SIZE")
+    if found {
+        opts = append(opts, app.WithBatchWrites(app.BatchWritesConfig{
+            MaxBatchSize: batchWritesMaxSize,
+            Window:       getDurationEnvOrDefault("BATCH_WRITES_WINDOW", app.DefaultBatchWritesWindow),
+        }))
+    }
+
+    unknownEventsPolicy, found := os.LookupEnv("UNKNOWN_EVENTS_POLICY")
+    if found {
+        policy, err := app.ParseUnknownEventsPolicy(unknownEventsPolicy)
+        if err != nil {
+            panic(err)
+        }
+        opts = append(opts, app.WithUnknownEventsPolicy(policy))
+    }
+
+    statusTransitionPolicy, found := os.LookupEnv("STATUS_TRANSITION_POLICY")
+    if found {
+        policy, err := payments.ParseStatusTransitionPolicy(statusTransitionPolicy)
+        if err != nil {
+            panic(err)
+        }
+        opts = append(opts, app.WithStatusTransitionPolicy(policy))
+    }
+
+    adminApiHttpServerPort, found := lookupIntEnv("ADMIN_API_HTTP_SERVER_PORT")
+    if found {
+        opts = append(opts, app.WithAdminAPIConfig(app.AdminAPIConfig{
+            AdminAPIHttpServerPort: adminApiHttpServerPort,
+            AuthToken:              mustGetEnv("ADMIN_API_AUTH_TOKEN"),
+        }))
+    }
+
+    opts = append(opts, app.WithWebhookDeliveryConfig(webhookDeliveryConfigFromEnv()))
+
+    app, err := app.NewApp(opts...)
     if err != nil {
         panic(err)
     }
@@ -45,14 +124,86 @@ func main() {
         panic(err)
     }
 
-    <-ctx.Done()
+    // a file events source is done once all its events are handled
+    select {
+    case <-ctx.Done():
+    case <-app.Done():
+    }
 
+    shutdownTimeout := getDurationEnvOrDefault("SHUTDOWN_TIMEOUT", defaultShutdownTimeout)
     shutdownCtx, shutdownCtxCancel := context.WithTimeout(context.Background(), shutdownTimeout)
     defer shutdownCtxCancel()
 
     app.Stop(shutdownCtx)
 }
 
+func rabbitMQOptionsFromEnv() []app.Option {
+    return []app.Option{
+        app.WithRabbitmqHost(mustGetEnv("RABBITMQ_HOST")),
+        app.WithRabbitmqPort(mustGetIntEnv("RABBITMQ_PORT")),
+        app.WithRabbitmqUser(mustGetEnv("RABBITMQ_USER")),
+        app.WithRabbitmqPassword(mustGetEnv("RABBITMQ_PASSWORD")),
+        app.WithRabbitMQTopology(rabbitMQTopologyFromEnv()),
+        app.WithRabbitMQReconnectBackoff(
+            getDurationEnvOrDefault("RABBITMQ_RECONNECT_INITIAL_BACKOFF", rabbitmq.DefaultReconnectInitialBackoff),
+            getDurationEnvOrDefault("RABBITMQ_RECONNECT_MAX_BACKOFF", rabbitmq.DefaultReconnectMaxBackoff),
+        ),
+        app.WithProjectionUpdatesExchange(
+            getEnvOrDefault("PROJECTION_UPDATES_EXCHANGE_NAME", app.RabbitMQProjectionUpdatesExchangeName),
+        ),
+    }
+}
+
+// rabbitMQTopologyFromEnv returns the default topology overridden by the RABBITMQ_* env vars
+func rabbitMQTopologyFromEnv() rabbitmq.Topology {
+    topology := app.DefaultRabbitMQTopology()
+    topology.ExchangeName = getEnvOrDefault("RABBITMQ_EXCHANGE_NAME", topology.ExchangeName)
+    topology.ExchangeType = getEnvOrDefault("RABBITMQ_EXCHANGE_TYPE", topology.ExchangeType)
+    topology.QueueName = getEnvOrDefault("RABBITMQ_QUEUE_NAME", topology.QueueName)
+    routingKeys, found := os.LookupEnv("RABBITMQ_ROUTING_KEYS")
+    if found {
+        topology.RoutingKeys = strings.Split(routingKeys, ",")
+    }
+    topology.DeadLetterExchangeName = getEnvOrDefault("RABBITMQ_DEAD_LETTER_EXCHANGE_NAME", topology.DeadLetterExchangeName)
+    topology.DeadLetterQueueName = getEnvOrDefault("RABBITMQ_DEAD_LETTER_QUEUE_NAME", topology.DeadLetterQueueName)
+    topology.RetryQueueName = getEnvOrDefault("RABBITMQ_RETRY_QUEUE_NAME", topology.RetryQueueName)
+    topology.RetryDelay = getDurationEnvOrDefault("RABBITMQ_RETRY_DELAY", topology.RetryDelay)
+    prefetch, found := lookupIntEnv("RABBITMQ_PREFETCH")
+    if found {
+        topology.Prefetch = prefetch
+    }
+    return topology
+}
+
+// webhookDeliveryConfigFromEnv returns the default webhook delivery config overridden by the WEBHOOKS_* env vars
+func webhookDeliveryConfigFromEnv() webhooks.DeliveryConfig {
+    config := webhooks.DefaultDeliveryConfig()
+    maxAttempts, found := lookupIntEnv("WEBHOOKS_MAX_ATTEMPTS")
+    if found {
+        config.MaxAttempts = maxAttempts
+    }
+    config.InitialBackoff = getDurationEnvOrDefault("WEBHOOKS_INITIAL_BACKOFF", config.InitialBackoff)
+    config.MaxBackoff = getDurationEnvOrDefault("WEBHOOKS_MAX_BACKOFF", config.MaxBackoff)
+    config.RequestTimeout = getDurationEnvOrDefault("WEBHOOKS_REQUEST_TIMEOUT", config.RequestTimeout)
+    workers, found := lookupIntEnv("WEBHOOKS_WORKERS")
+    if found {
+        config.Workers = workers
+    }
+    allowPrivateTargets, found := lookupBoolEnv("WEBHOOKS_ALLOW_PRIVATE_TARGETS")
+    if found {
+        config.AllowPrivateTargets = allowPrivateTargets
+    }
+    return config
+}
+
+func getEnvOrDefault(envName string, defaultValue string) string {
+    value, found := os.LookupEnv(envName)
+    if !found {
+        return defaultValue
+    }
+    return value
+}
+
 func mustGetEnv(envName string) string {
     value, found := os.LookupEnv(envName)
     if !found {
@@ -69,3 +220,35 @@ func mustGetIntEnv(envName string) int {
     }
     return intEnvValue
 }
+
+func lookupIntEnv(envName string) (int, bool) {
+    _, found := os.LookupEnv(envName)
+    if !found {
+        return 0, false
+    }
+    return mustGetIntEnv(envName), true
+}
+
+func lookupBoolEnv(envName string) (bool, bool) {
+    strEnvValue, found := os.LookupEnv(envName)
+    if !found {
+        return false, false
+    }
+    boolEnvValue, err := strconv.ParseBool(strEnvValue)
+    if err != nil {
+        panic("env var is not a bool: " + envName)
+    }
+    return boolEnvValue, true
+}
+
+func getDurationEnvOrDefault(envName string, defaultValue time.Duration) time.Duration {
+    strEnvValue, found := os.LookupEnv(envName)
+    if !found {
+        return defaultValue
+    }
+    durationEnvValue, err := time.ParseDuration(strEnvValue)
+    if err != nil {
+        panic("env var is not a duration: " + envName)
+    }
+    return durationEnvValue
+}
@@ -0,0 +1,60 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+)
+
+type checkpoint struct {
+	EventId        uuid.UUID `json:"eventId"`
+	EventType      string    `json:"eventType"`
+	EventCreatedAt time.Time `json:"eventCreatedAt"`
+	AppliedAt      time.Time `json:"appliedAt"`
+	// LagMillis is the end-to-end lag of the last applied event
+	LagMillis int64 `json:"lagMillis"`
+	// IdleMillis is the time elapsed since the last event was applied
+	IdleMillis int64 `json:"idleMillis"`
+}
+
+// GetGlobalCheckpoint returns the last event applied to the read model and its lag
+func (h *Handler) GetGlobalCheckpoint(w http.ResponseWriter, r *http.Request) {
+	found, werr := h.checkpointsRepository.GetGlobalCheckpoint(r.Context())
+	h.writeCheckpoint(w, found, werr)
+}
+
+// GetPaymentCheckpoint returns the last event applied to the payment and its lag
+func (h *Handler) GetPaymentCheckpoint(w http.ResponseWriter, r *http.Request) {
+	paymentId, err := uuid.Parse(r.PathValue("paymentId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid paymentId")
+		return
+	}
+	found, werr := h.checkpointsRepository.GetCheckpoint(r.Context(), paymentId)
+	h.writeCheckpoint(w, found, werr)
+}
+
+func (h *Handler) writeCheckpoint(w http.ResponseWriter, found payments.Checkpoint, werr werrors.WError) {
+	if werr != nil {
+		if werr.Code() == werrors.ResourceNotFoundErrorCode {
+			writeError(w, http.StatusNotFound, "checkpoint not found")
+			return
+		}
+		h.logger.Error("failed getting checkpoint", logattr.Error(werr.Message()))
+		writeError(w, http.StatusInternalServerError, "unexpected internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, checkpoint{
+		EventId:        found.EventId,
+		EventType:      found.EventType,
+		EventCreatedAt: found.EventCreatedAt,
+		AppliedAt:      found.AppliedAt,
+		LagMillis:      found.Lag().Milliseconds(),
+		IdleMillis:     found.IdleAt(time.Now()).Milliseconds(),
+	})
+}
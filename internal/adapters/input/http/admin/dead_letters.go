@@ -0,0 +1,147 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/deadletters"
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+)
+
+type deadLetter struct {
+	ID            uuid.UUID       `json:"id"`
+	EventType     string          `json:"eventType"`
+	Payload       json.RawMessage `json:"payload,omitempty"`
+	RawPayload    string          `json:"rawPayload,omitempty"`
+	ErrorCode     int             `json:"errorCode"`
+	ErrorMessage  string          `json:"errorMessage"`
+	Attempts      int             `json:"attempts"`
+	FirstFailedAt time.Time       `json:"firstFailedAt"`
+	LastFailedAt  time.Time       `json:"lastFailedAt"`
+}
+
+type deadLettersList struct {
+	Items []deadLetter `json:"items"`
+	Total int          `json:"total"`
+}
+
+// ListDeadLetters returns the events in the dead letter store.
+// Supports filtering by eventType and errorCode query params.
+func (h *Handler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	var filter deadletters.Filter
+	filter.EventType = r.URL.Query().Get("eventType")
+	if errorCode := r.URL.Query().Get("errorCode"); errorCode != "" {
+		code, err := strconv.Atoi(errorCode)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid errorCode")
+			return
+		}
+		filter.ErrorCode = werrors.ErrorCode(code)
+	}
+
+	entries, werr := h.deadLetters.SearchEntries(r.Context(), filter)
+	if werr != nil {
+		h.logger.Error("failed listing dead letters", logattr.Error(werr.Message()))
+		writeError(w, http.StatusInternalServerError, "unexpected internal error")
+		return
+	}
+
+	list := deadLettersList{
+		Items: make([]deadLetter, 0, len(entries)),
+		Total: len(entries),
+	}
+	for _, entry := range entries {
+		list.Items = append(list.Items, buildDeadLetter(entry))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) GetDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := deadLetterIdFromPath(w, r)
+	if !ok {
+		return
+	}
+	entry, werr := h.deadLetters.GetEntry(r.Context(), id)
+	if werr != nil {
+		h.writeDeadLetterError(w, id, werr)
+		return
+	}
+	writeJSON(w, http.StatusOK, buildDeadLetter(entry))
+}
+
+// ReplayDeadLetter processes the event again through the payments events handler.
+// The entry is removed from the dead letter store if the processing succeeds.
+func (h *Handler) ReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := deadLetterIdFromPath(w, r)
+	if !ok {
+		return
+	}
+	werr := h.deadLetters.Replay(r.Context(), id)
+	if werr != nil {
+		h.writeDeadLetterError(w, id, werr)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DiscardDeadLetter removes the entry from the dead letter store without processing it
+func (h *Handler) DiscardDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := deadLetterIdFromPath(w, r)
+	if !ok {
+		return
+	}
+	werr := h.deadLetters.Discard(r.Context(), id)
+	if werr != nil {
+		h.writeDeadLetterError(w, id, werr)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) writeDeadLetterError(w http.ResponseWriter, id uuid.UUID, werr werrors.WError) {
+	if werr.Code() == werrors.ResourceNotFoundErrorCode {
+		writeError(w, http.StatusNotFound, "dead letter not found")
+		return
+	}
+	h.logger.Error(
+		"dead letter operation failed",
+		logattr.Error(werr.Message()),
+		logattr.EventId(id.String()),
+	)
+	writeJSON(w, http.StatusUnprocessableEntity, apiError{
+		ErrorMessage: werr.Message(),
+		ErrorCode:    strconv.Itoa(int(werr.Code())),
+	})
+}
+
+func deadLetterIdFromPath(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid dead letter id")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func buildDeadLetter(entry deadletters.Entry) deadLetter {
+	item := deadLetter{
+		ID:            entry.ID,
+		EventType:     entry.EventType,
+		ErrorCode:     int(entry.ErrorCode),
+		ErrorMessage:  entry.ErrorMessage,
+		Attempts:      entry.Attempts,
+		FirstFailedAt: entry.FirstFailedAt,
+		LastFailedAt:  entry.LastFailedAt,
+	}
+	if json.Valid(entry.RawPayload) {
+		item.Payload = entry.RawPayload
+	} else {
+		item.RawPayload = string(entry.RawPayload)
+	}
+	return item
+}
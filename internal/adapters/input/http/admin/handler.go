@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/walletera/payments-read-model/internal/domain/deadletters"
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+	"github.com/walletera/payments-read-model/internal/domain/rebuild"
+	"github.com/walletera/payments-read-model/internal/domain/webhooks"
+)
+
+// Handler serves the admin API, used by operators to inspect
+// and fix the state of the read model
+type Handler struct {
+	paymentsRepository         payments.Repository
+	pendingUpdatesRepository   payments.PendingUpdatesRepository
+	deadLetters                *deadletters.Service
+	rebuilder                  *rebuild.Rebuilder
+	checkpointsRepository      payments.CheckpointsRepository
+	statusViolationsRepository payments.StatusViolationsRepository
+	webhooks                   *webhooks.Service
+	consumer                   ConsumerStatus
+	logger                     *slog.Logger
+	mux                        *http.ServeMux
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+func NewHandler(
+	paymentsRepository payments.Repository,
+	pendingUpdatesRepository payments.PendingUpdatesRepository,
+	deadLetters *deadletters.Service,
+	rebuilder *rebuild.Rebuilder,
+	checkpointsRepository payments.CheckpointsRepository,
+	statusViolationsRepository payments.StatusViolationsRepository,
+	webhooksService *webhooks.Service,
+	consumer ConsumerStatus,
+	logger *slog.Logger,
+) *Handler {
+	h := &Handler{
+		paymentsRepository:         paymentsRepository,
+		pendingUpdatesRepository:   pendingUpdatesRepository,
+		deadLetters:                deadLetters,
+		rebuilder:                  rebuilder,
+		checkpointsRepository:      checkpointsRepository,
+		statusViolationsRepository: statusViolationsRepository,
+		webhooks:                   webhooksService,
+		consumer:                   consumer,
+		logger:                     logger,
+		mux:                        http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /health", h.GetHealth)
+	h.mux.HandleFunc("GET /payments/{paymentId}", h.GetPayment)
+	h.mux.HandleFunc("GET /pending-updates", h.ListPendingUpdates)
+	h.mux.HandleFunc("GET /dead-letters", h.ListDeadLetters)
+	h.mux.HandleFunc("GET /dead-letters/{id}", h.GetDeadLetter)
+	h.mux.HandleFunc("POST /dead-letters/{id}/replay", h.ReplayDeadLetter)
+	h.mux.HandleFunc("DELETE /dead-letters/{id}", h.DiscardDeadLetter)
+	h.mux.HandleFunc("POST /rebuilds", h.StartRebuild)
+	h.mux.HandleFunc("GET /rebuilds/{id}", h.GetRebuild)
+	h.mux.HandleFunc("GET /checkpoints", h.GetGlobalCheckpoint)
+	h.mux.HandleFunc("GET /checkpoints/{paymentId}", h.GetPaymentCheckpoint)
+	h.mux.HandleFunc("GET /status-violations", h.ListStatusViolations)
+	h.mux.HandleFunc("POST /webhooks/subscriptions", h.CreateWebhookSubscription)
+	h.mux.HandleFunc("GET /webhooks/subscriptions", h.ListWebhookSubscriptions)
+	h.mux.HandleFunc("GET /webhooks/subscriptions/{id}", h.GetWebhookSubscription)
+	h.mux.HandleFunc("DELETE /webhooks/subscriptions/{id}", h.DeleteWebhookSubscription)
+	h.mux.HandleFunc("GET /webhooks/deliveries", h.ListWebhookDeliveries)
+	h.mux.HandleFunc("GET /webhooks/deliveries/{id}", h.GetWebhookDelivery)
+	h.mux.HandleFunc("POST /webhooks/deliveries/{id}/retry", h.RetryWebhookDelivery)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
@@ -0,0 +1,33 @@
+package admin
+
+import "net/http"
+
+const (
+	healthStatusOK       = "ok"
+	healthStatusDegraded = "degraded"
+)
+
+// ConsumerStatus reports the state of the payments events consumer
+type ConsumerStatus interface {
+	// Connected is false while the consumer is reconnecting to the broker
+	Connected() bool
+}
+
+type health struct {
+	Status   string `json:"status"`
+	RabbitMQ string `json:"rabbitmq"`
+}
+
+// GetHealth reports the service as degraded, with a 503, while it can't consume events
+func (h *Handler) GetHealth(w http.ResponseWriter, _ *http.Request) {
+	if h.consumer == nil {
+		// the events are only pushed to the ingestion API
+		writeJSON(w, http.StatusOK, health{Status: healthStatusOK, RabbitMQ: "disabled"})
+		return
+	}
+	if !h.consumer.Connected() {
+		writeJSON(w, http.StatusServiceUnavailable, health{Status: healthStatusDegraded, RabbitMQ: "disconnected"})
+		return
+	}
+	writeJSON(w, http.StatusOK, health{Status: healthStatusOK, RabbitMQ: "connected"})
+}
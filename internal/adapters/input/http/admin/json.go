@@ -0,0 +1,21 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type apiError struct {
+	ErrorMessage string `json:"errorMessage"`
+	ErrorCode    string `json:"errorCode,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, errorMessage string) {
+	writeJSON(w, statusCode, apiError{ErrorMessage: errorMessage})
+}
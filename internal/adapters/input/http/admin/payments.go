@@ -0,0 +1,55 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+)
+
+// internalPayment is the payment as stored in the read model,
+// including the metadata of the last event applied to it
+type internalPayment struct {
+	ID                uuid.UUID `json:"id"`
+	AggregateVersion  uint64    `json:"aggregateVersion"`
+	Status            string    `json:"status"`
+	ExternalId        string    `json:"externalId,omitempty"`
+	CreatedAt         time.Time `json:"createdAt"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+	LastEventId       uuid.UUID `json:"lastEventId"`
+	LastCorrelationId string    `json:"lastCorrelationId,omitempty"`
+	LastEventAt       time.Time `json:"lastEventAt"`
+}
+
+// GetPayment returns the internal view of a payment
+func (h *Handler) GetPayment(w http.ResponseWriter, r *http.Request) {
+	paymentId, err := uuid.Parse(r.PathValue("paymentId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid paymentId")
+		return
+	}
+	payment, werr := h.paymentsRepository.GetPayment(r.Context(), paymentId)
+	if werr != nil {
+		if werr.Code() == werrors.ResourceNotFoundErrorCode {
+			writeError(w, http.StatusNotFound, "payment not found")
+			return
+		}
+		h.logger.Error("failed getting payment", logattr.Error(werr.Message()), logattr.PaymentId(paymentId.String()))
+		writeError(w, http.StatusInternalServerError, "unexpected internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, internalPayment{
+		ID:                payment.ID,
+		AggregateVersion:  payment.AggregateVersion,
+		Status:            string(payment.Data.Status),
+		ExternalId:        payment.Data.ExternalId.Value,
+		CreatedAt:         payment.Data.CreatedAt,
+		UpdatedAt:         payment.Data.UpdatedAt,
+		LastEventId:       payment.Metadata.LastEventId,
+		LastCorrelationId: payment.Metadata.LastCorrelationId,
+		LastEventAt:       payment.Metadata.LastEventAt,
+	})
+}
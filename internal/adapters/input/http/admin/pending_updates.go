@@ -0,0 +1,72 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+)
+
+type pendingUpdate struct {
+	PaymentId        uuid.UUID `json:"paymentId"`
+	AggregateVersion uint64    `json:"aggregateVersion"`
+	Status           string    `json:"status"`
+	ExternalId       *string   `json:"externalId,omitempty"`
+	Reason           string    `json:"reason"`
+	ParkedAt         time.Time `json:"parkedAt"`
+}
+
+type pendingUpdatesList struct {
+	Items []pendingUpdate `json:"items"`
+	Total int             `json:"total"`
+}
+
+// ListPendingUpdates returns the parked payment updates.
+// Supports filtering by paymentId and reason query params.
+func (h *Handler) ListPendingUpdates(w http.ResponseWriter, r *http.Request) {
+	var filter payments.PendingUpdatesFilter
+	if paymentId := r.URL.Query().Get("paymentId"); paymentId != "" {
+		id, err := uuid.Parse(paymentId)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid paymentId")
+			return
+		}
+		filter.PaymentId = id
+	}
+	switch reason := payments.PendingReason(r.URL.Query().Get("reason")); reason {
+	case "", payments.PendingReasonVersionGap, payments.PendingReasonPaymentNotCreated:
+		filter.Reason = reason
+	default:
+		writeError(w, http.StatusBadRequest, "invalid reason")
+		return
+	}
+
+	pendingUpdates, werr := h.pendingUpdatesRepository.SearchPendingUpdates(r.Context(), filter)
+	if werr != nil {
+		h.logger.Error("failed listing pending updates", logattr.Error(werr.Message()))
+		writeError(w, http.StatusInternalServerError, "unexpected internal error")
+		return
+	}
+
+	list := pendingUpdatesList{
+		Items: make([]pendingUpdate, 0, len(pendingUpdates)),
+		Total: len(pendingUpdates),
+	}
+	for _, p := range pendingUpdates {
+		item := pendingUpdate{
+			PaymentId:        p.Update.PaymentId,
+			AggregateVersion: p.Update.AggregateVersion,
+			Status:           string(p.Update.Status),
+			Reason:           string(p.Reason),
+			ParkedAt:         p.ParkedAt,
+		}
+		if p.Update.ExternalId.IsSet() {
+			item.ExternalId = &p.Update.ExternalId.Value
+		}
+		list.Items = append(list.Items, item)
+	}
+	writeJSON(w, http.StatusOK, list)
+}
@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/rebuild"
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+)
+
+type rebuildResponse struct {
+	ID                 uuid.UUID  `json:"id"`
+	Status             string     `json:"status"`
+	PreviousCollection string     `json:"previousCollection"`
+	ShadowCollection   string     `json:"shadowCollection"`
+	ReplayedEvents     int        `json:"replayedEvents"`
+	CatchUpRounds      int        `json:"catchUpRounds"`
+	StartedAt          time.Time  `json:"startedAt"`
+	SwitchedAt         *time.Time `json:"switchedAt,omitempty"`
+	FinishedAt         *time.Time `json:"finishedAt,omitempty"`
+	Error              string     `json:"error,omitempty"`
+}
+
+// StartRebuild launches a blue/green rebuild of the payments projection.
+// The rebuild runs in the background, its progress is available on GET /rebuilds/{id}.
+// It is refused when the projection holds payments missing from the event log.
+func (h *Handler) StartRebuild(w http.ResponseWriter, r *http.Request) {
+	// the rebuild outlives the request
+	started, werr := h.rebuilder.Start(context.WithoutCancel(r.Context()))
+	if werr != nil {
+		if werr.Code() == werrors.ResourceAlreadyExistErrorCode {
+			writeError(w, http.StatusConflict, werr.Message())
+			return
+		}
+		if werr.Code() == werrors.ValidationErrorCode {
+			writeError(w, http.StatusUnprocessableEntity, werr.Message())
+			return
+		}
+		h.logger.Error("failed starting projection rebuild", logattr.Error(werr.Message()))
+		writeError(w, http.StatusInternalServerError, "unexpected internal error")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, buildRebuildResponse(started))
+}
+
+func (h *Handler) GetRebuild(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid rebuild id")
+		return
+	}
+	found, werr := h.rebuilder.GetRebuild(r.Context(), id)
+	if werr != nil {
+		if werr.Code() == werrors.ResourceNotFoundErrorCode {
+			writeError(w, http.StatusNotFound, "rebuild not found")
+			return
+		}
+		h.logger.Error("failed getting projection rebuild", logattr.Error(werr.Message()))
+		writeError(w, http.StatusInternalServerError, "unexpected internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, buildRebuildResponse(found))
+}
+
+func buildRebuildResponse(r rebuild.Rebuild) rebuildResponse {
+	response := rebuildResponse{
+		ID:                 r.ID,
+		Status:             string(r.Status),
+		PreviousCollection: r.PreviousCollection,
+		ShadowCollection:   r.ShadowCollection,
+		ReplayedEvents:     r.ReplayedEvents,
+		CatchUpRounds:      r.CatchUpRounds,
+		StartedAt:          r.StartedAt,
+		Error:              r.Error,
+	}
+	if !r.SwitchedAt.IsZero() {
+		switchedAt := r.SwitchedAt
+		response.SwitchedAt = &switchedAt
+	}
+	if !r.FinishedAt.IsZero() {
+		finishedAt := r.FinishedAt
+		response.FinishedAt = &finishedAt
+	}
+	return response
+}
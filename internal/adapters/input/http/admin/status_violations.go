@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+)
+
+type statusViolation struct {
+	EventId          uuid.UUID `json:"eventId"`
+	PaymentId        uuid.UUID `json:"paymentId"`
+	AggregateVersion uint64    `json:"aggregateVersion"`
+	From             string    `json:"from"`
+	To               string    `json:"to"`
+	Action           string    `json:"action"`
+	DetectedAt       time.Time `json:"detectedAt"`
+}
+
+type statusViolationsList struct {
+	Items []statusViolation `json:"items"`
+	Total int               `json:"total"`
+}
+
+// ListStatusViolations returns the illegal status transitions detected, most recent first.
+// Supports filtering by the paymentId query param.
+func (h *Handler) ListStatusViolations(w http.ResponseWriter, r *http.Request) {
+	var paymentId uuid.UUID
+	if rawPaymentId := r.URL.Query().Get("paymentId"); rawPaymentId != "" {
+		var err error
+		paymentId, err = uuid.Parse(rawPaymentId)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid paymentId")
+			return
+		}
+	}
+
+	violations, werr := h.statusViolationsRepository.SearchViolations(r.Context(), paymentId)
+	if werr != nil {
+		h.logger.Error("failed listing status violations", logattr.Error(werr.Message()))
+		writeError(w, http.StatusInternalServerError, "unexpected internal error")
+		return
+	}
+
+	list := statusViolationsList{
+		Items: make([]statusViolation, 0, len(violations)),
+		Total: len(violations),
+	}
+	for _, violation := range violations {
+		list.Items = append(list.Items, statusViolation{
+			EventId:          violation.EventId,
+			PaymentId:        violation.PaymentId,
+			AggregateVersion: violation.AggregateVersion,
+			From:             string(violation.From),
+			To:               string(violation.To),
+			Action:           string(violation.Action),
+			DetectedAt:       violation.DetectedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
@@ -0,0 +1,280 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/webhooks"
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+)
+
+const maxSubscriptionBodyBytes = 64 << 10
+
+type webhookSubscriptionRequest struct {
+	CustomerId uuid.UUID `json:"customerId"`
+	URL        string    `json:"url"`
+	Statuses   []string  `json:"statuses"`
+	Secret     string    `json:"secret"`
+}
+
+type webhookSubscription struct {
+	ID         uuid.UUID `json:"id"`
+	CustomerId uuid.UUID `json:"customerId"`
+	URL        string    `json:"url"`
+	Statuses   []string  `json:"statuses"`
+	// Secret is only returned when the subscription is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type webhookSubscriptionsList struct {
+	Items []webhookSubscription `json:"items"`
+	Total int                   `json:"total"`
+}
+
+type webhookDelivery struct {
+	ID             uuid.UUID                `json:"id"`
+	SubscriptionId uuid.UUID                `json:"subscriptionId"`
+	CustomerId     uuid.UUID                `json:"customerId"`
+	PaymentId      uuid.UUID                `json:"paymentId"`
+	EventId        uuid.UUID                `json:"eventId"`
+	URL            string                   `json:"url"`
+	Payload        json.RawMessage          `json:"payload"`
+	State          string                   `json:"state"`
+	Attempts       []webhookDeliveryAttempt `json:"attempts"`
+	NextAttemptAt  *time.Time               `json:"nextAttemptAt,omitempty"`
+	CreatedAt      time.Time                `json:"createdAt"`
+	UpdatedAt      time.Time                `json:"updatedAt"`
+}
+
+type webhookDeliveryAttempt struct {
+	AttemptedAt time.Time `json:"attemptedAt"`
+	DurationMs  int64     `json:"durationMs"`
+	StatusCode  int       `json:"statusCode,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+type webhookDeliveriesList struct {
+	Items []webhookDelivery `json:"items"`
+	Total int               `json:"total"`
+}
+
+// CreateWebhookSubscription registers a URL the status changes of the payments of a
+// customer are delivered to. A secret is generated when none is given. The secret is
+// only returned in this response.
+func (h *Handler) CreateWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	var request webhookSubscriptionRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSubscriptionBodyBytes)).Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	statuses := make([]privateapi.PaymentStatus, 0, len(request.Statuses))
+	for _, status := range request.Statuses {
+		statuses = append(statuses, privateapi.PaymentStatus(status))
+	}
+	subscription, werr := h.webhooks.CreateSubscription(r.Context(), webhooks.Subscription{
+		CustomerId: request.CustomerId,
+		URL:        request.URL,
+		Statuses:   statuses,
+		Secret:     request.Secret,
+	})
+	if werr != nil {
+		h.writeWebhooksError(w, "webhook subscription", werr)
+		return
+	}
+	response := buildWebhookSubscription(subscription)
+	response.Secret = subscription.Secret
+	writeJSON(w, http.StatusCreated, response)
+}
+
+// ListWebhookSubscriptions returns the webhook subscriptions, oldest first.
+// Supports filtering by the customerId query param.
+func (h *Handler) ListWebhookSubscriptions(w http.ResponseWriter, r *http.Request) {
+	var filter webhooks.SubscriptionsFilter
+	var ok bool
+	filter.CustomerId, ok = uuidFromQuery(w, r, "customerId")
+	if !ok {
+		return
+	}
+	subscriptions, werr := h.webhooks.SearchSubscriptions(r.Context(), filter)
+	if werr != nil {
+		h.logger.Error("failed listing webhook subscriptions", logattr.Error(werr.Message()))
+		writeError(w, http.StatusInternalServerError, "unexpected internal error")
+		return
+	}
+	list := webhookSubscriptionsList{
+		Items: make([]webhookSubscription, 0, len(subscriptions)),
+		Total: len(subscriptions),
+	}
+	for _, subscription := range subscriptions {
+		list.Items = append(list.Items, buildWebhookSubscription(subscription))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) GetWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	id, ok := idFromPath(w, r, "webhook subscription")
+	if !ok {
+		return
+	}
+	subscription, werr := h.webhooks.GetSubscription(r.Context(), id)
+	if werr != nil {
+		h.writeWebhooksError(w, "webhook subscription", werr)
+		return
+	}
+	writeJSON(w, http.StatusOK, buildWebhookSubscription(subscription))
+}
+
+// DeleteWebhookSubscription removes the subscription. Its pending deliveries fail.
+func (h *Handler) DeleteWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	id, ok := idFromPath(w, r, "webhook subscription")
+	if !ok {
+		return
+	}
+	werr := h.webhooks.DeleteSubscription(r.Context(), id)
+	if werr != nil {
+		h.writeWebhooksError(w, "webhook subscription", werr)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries returns the webhook deliveries with their attempts, most recent
+// first. Supports filtering by the subscriptionId, paymentId and state query params.
+func (h *Handler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	var filter webhooks.DeliveriesFilter
+	var ok bool
+	filter.SubscriptionId, ok = uuidFromQuery(w, r, "subscriptionId")
+	if !ok {
+		return
+	}
+	filter.PaymentId, ok = uuidFromQuery(w, r, "paymentId")
+	if !ok {
+		return
+	}
+	filter.State = webhooks.DeliveryState(r.URL.Query().Get("state"))
+	deliveries, werr := h.webhooks.SearchDeliveries(r.Context(), filter)
+	if werr != nil {
+		h.logger.Error("failed listing webhook deliveries", logattr.Error(werr.Message()))
+		writeError(w, http.StatusInternalServerError, "unexpected internal error")
+		return
+	}
+	list := webhookDeliveriesList{
+		Items: make([]webhookDelivery, 0, len(deliveries)),
+		Total: len(deliveries),
+	}
+	for _, delivery := range deliveries {
+		list.Items = append(list.Items, buildWebhookDelivery(delivery))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) GetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, ok := idFromPath(w, r, "webhook delivery")
+	if !ok {
+		return
+	}
+	delivery, werr := h.webhooks.GetDelivery(r.Context(), id)
+	if werr != nil {
+		h.writeWebhooksError(w, "webhook delivery", werr)
+		return
+	}
+	writeJSON(w, http.StatusOK, buildWebhookDelivery(delivery))
+}
+
+// RetryWebhookDelivery schedules the delivery to be attempted right away, even if it failed or was delivered
+func (h *Handler) RetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, ok := idFromPath(w, r, "webhook delivery")
+	if !ok {
+		return
+	}
+	werr := h.webhooks.RetryDelivery(r.Context(), id)
+	if werr != nil {
+		h.writeWebhooksError(w, "webhook delivery", werr)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) writeWebhooksError(w http.ResponseWriter, resource string, werr werrors.WError) {
+	switch werr.Code() {
+	case werrors.ResourceNotFoundErrorCode:
+		writeError(w, http.StatusNotFound, resource+" not found")
+	case werrors.ValidationErrorCode:
+		writeError(w, http.StatusBadRequest, werr.Message())
+	default:
+		h.logger.Error(resource+" operation failed", logattr.Error(werr.Message()))
+		writeError(w, http.StatusInternalServerError, "unexpected internal error")
+	}
+}
+
+func idFromPath(w http.ResponseWriter, r *http.Request, resource string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid "+resource+" id")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// uuidFromQuery returns the value of the query param, uuid.Nil when it's missing
+func uuidFromQuery(w http.ResponseWriter, r *http.Request, param string) (uuid.UUID, bool) {
+	rawValue := r.URL.Query().Get(param)
+	if rawValue == "" {
+		return uuid.Nil, true
+	}
+	value, err := uuid.Parse(rawValue)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid "+param)
+		return uuid.Nil, false
+	}
+	return value, true
+}
+
+func buildWebhookSubscription(subscription webhooks.Subscription) webhookSubscription {
+	statuses := make([]string, 0, len(subscription.Statuses))
+	for _, status := range subscription.Statuses {
+		statuses = append(statuses, string(status))
+	}
+	return webhookSubscription{
+		ID:         subscription.ID,
+		CustomerId: subscription.CustomerId,
+		URL:        subscription.URL,
+		Statuses:   statuses,
+		CreatedAt:  subscription.CreatedAt,
+	}
+}
+
+func buildWebhookDelivery(delivery webhooks.Delivery) webhookDelivery {
+	item := webhookDelivery{
+		ID:             delivery.ID,
+		SubscriptionId: delivery.SubscriptionId,
+		CustomerId:     delivery.CustomerId,
+		PaymentId:      delivery.PaymentId,
+		EventId:        delivery.EventId,
+		URL:            delivery.URL,
+		Payload:        delivery.Payload,
+		State:          string(delivery.State),
+		Attempts:       make([]webhookDeliveryAttempt, 0, len(delivery.Attempts)),
+		CreatedAt:      delivery.CreatedAt,
+		UpdatedAt:      delivery.UpdatedAt,
+	}
+	if delivery.State == webhooks.DeliveryStatePending {
+		item.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	for _, attempt := range delivery.Attempts {
+		item.Attempts = append(item.Attempts, webhookDeliveryAttempt{
+			AttemptedAt: attempt.AttemptedAt,
+			DurationMs:  attempt.Duration.Milliseconds(),
+			StatusCode:  attempt.StatusCode,
+			Error:       attempt.Error,
+		})
+	}
+	return item
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type apiError struct {
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// RequireBearerToken rejects the requests that don't carry the given bearer token.
+// An empty token rejects every request, the check never fails open.
+func RequireBearerToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestToken, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || token == "" || subtle.ConstantTimeCompare([]byte(requestToken), []byte(token)) != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(apiError{ErrorMessage: "missing or invalid bearer token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
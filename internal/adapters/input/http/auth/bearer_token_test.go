@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireBearerToken(t *testing.T) {
+	tests := []struct {
+		name               string
+		token              string
+		authorization      string
+		expectedStatusCode int
+	}{
+		{name: "valid token", token: "secret", authorization: "Bearer secret", expectedStatusCode: http.StatusOK},
+		{name: "missing token", token: "secret", authorization: "", expectedStatusCode: http.StatusUnauthorized},
+		{name: "invalid token", token: "secret", authorization: "Bearer other", expectedStatusCode: http.StatusUnauthorized},
+		{name: "not a bearer token", token: "secret", authorization: "Basic secret", expectedStatusCode: http.StatusUnauthorized},
+		{name: "empty configured token", token: "", authorization: "Bearer ", expectedStatusCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RequireBearerToken(tt.token, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			request := httptest.NewRequest(http.MethodPost, "/events", nil)
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.expectedStatusCode {
+				t.Errorf("expected status code %d, but got %d", tt.expectedStatusCode, recorder.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package ingestion
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/walletera/werrors"
+)
+
+const (
+	// MaxBatchSize is the max number of events accepted by a request
+	MaxBatchSize = 100
+	maxBodyBytes = 10 << 20
+)
+
+// EventsDispatcher applies an event in order with the other events of its payment
+type EventsDispatcher interface {
+	// Apply returns the id of the event and the error of its single attempt
+	Apply(ctx context.Context, rawEvent []byte) (string, werrors.WError)
+}
+
+// Handler serves the private ingestion API, which hands the payments events pushed over
+// HTTP to the dispatcher of the consumed ones, so the events of a payment are applied in
+// order whatever their source. There is no retry nor dead letter store behind it: every
+// event gets its own result and the caller retries the ones failing with a retryable error.
+type Handler struct {
+	dispatcher EventsDispatcher
+	logger     *slog.Logger
+	mux        *http.ServeMux
+}
+
+type eventResult struct {
+	// Index is the position of the event in the request
+	Index        int    `json:"index"`
+	EventId      string `json:"eventId,omitempty"`
+	Status       int    `json:"status"`
+	ErrorCode    int    `json:"errorCode,omitempty"`
+	ErrorMessage string `json:"errorMessage,omitempty"`
+	Retryable    bool   `json:"retryable"`
+}
+
+type eventResults struct {
+	Results []eventResult `json:"results"`
+}
+
+type apiError struct {
+	ErrorMessage string `json:"errorMessage"`
+}
+
+func NewHandler(dispatcher EventsDispatcher, logger *slog.Logger) *Handler {
+	h := &Handler{
+		dispatcher: dispatcher,
+		logger:     logger,
+		mux:        http.NewServeMux(),
+	}
+	h.mux.HandleFunc("POST /events", h.PostEvents)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// PostEvents applies a single event envelope, or an array of them, in order. A single
+// event is answered with the status of its result. A batch is answered with 200 when
+// every event is applied and with 207 otherwise, the status of every event in its result.
+func (h *Handler) PostEvents(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, apiError{ErrorMessage: "request body too large"})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, apiError{ErrorMessage: "failed reading request body"})
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	batch := len(body) > 0 && body[0] == '['
+	rawEvents := []json.RawMessage{body}
+	if batch {
+		err = json.Unmarshal(body, &rawEvents)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{ErrorMessage: "invalid events array"})
+			return
+		}
+		if len(rawEvents) == 0 || len(rawEvents) > MaxBatchSize {
+			writeJSON(w, http.StatusBadRequest, apiError{
+				ErrorMessage: fmt.Sprintf("a batch must have between 1 and %d events", MaxBatchSize),
+			})
+			return
+		}
+	}
+
+	results := eventResults{Results: make([]eventResult, 0, len(rawEvents))}
+	allApplied := true
+	for i, rawEvent := range rawEvents {
+		result := h.applyEvent(r.Context(), i, rawEvent)
+		allApplied = allApplied && result.Status == http.StatusOK
+		results.Results = append(results.Results, result)
+	}
+
+	switch {
+	case !batch:
+		writeJSON(w, results.Results[0].Status, results)
+	case allApplied:
+		writeJSON(w, http.StatusOK, results)
+	default:
+		writeJSON(w, http.StatusMultiStatus, results)
+	}
+}
+
+func (h *Handler) applyEvent(ctx context.Context, index int, rawEvent []byte) eventResult {
+	eventId, werr := h.dispatcher.Apply(ctx, rawEvent)
+	result := eventResult{Index: index, EventId: eventId}
+	if werr == nil {
+		result.Status = http.StatusOK
+		return result
+	}
+	h.logger.Error(
+		"failed applying ingested event",
+		logattr.EventId(result.EventId),
+		logattr.Error(werr.Message()),
+	)
+	result.Status = httpStatus(werr)
+	result.ErrorCode = int(werr.Code())
+	result.ErrorMessage = werr.Message()
+	result.Retryable = werr.IsRetryable()
+	return result
+}
+
+// httpStatus maps the error of an event to the HTTP status of its result. The
+// retryable errors are mapped to 503 and 504, so the caller knows to retry them.
+func httpStatus(werr werrors.WError) int {
+	switch werr.Code() {
+	case werrors.ValidationErrorCode:
+		return http.StatusBadRequest
+	case werrors.ResourceNotFoundErrorCode:
+		return http.StatusNotFound
+	case werrors.UnprocessableMessageErrorCode:
+		return http.StatusUnprocessableEntity
+	case werrors.TimeoutErrorCode:
+		return http.StatusGatewayTimeout
+	case werrors.ResourceAlreadyExistErrorCode,
+		werrors.WrongResourceVersionErrorCode,
+		payments.PaymentContentConflictErrorCode,
+		payments.PaymentVersionMismatchErrorCode,
+		payments.IllegalStatusTransitionErrorCode:
+		return http.StatusConflict
+	}
+	if werr.IsRetryable() {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,118 @@
+package public
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+)
+
+type paymentHistory struct {
+	PaymentId uuid.UUID             `json:"paymentId"`
+	Items     []paymentHistoryEntry `json:"items"`
+	Total     int                   `json:"total"`
+}
+
+type paymentHistoryEntry struct {
+	AggregateVersion uint64            `json:"aggregateVersion"`
+	Status           string            `json:"status"`
+	ExternalId       *string           `json:"externalId,omitempty"`
+	ExternalIdChange *externalIdChange `json:"externalIdChange,omitempty"`
+	EventId          uuid.UUID         `json:"eventId"`
+	EventType        string            `json:"eventType"`
+	EventCreatedAt   time.Time         `json:"eventCreatedAt"`
+}
+
+// externalIdChange is present in the entries whose event set or replaced the payment externalId
+type externalIdChange struct {
+	From *string `json:"from"`
+	To   string  `json:"to"`
+}
+
+// HistoryHandler serves the status timeline of the payments, which is not part of the public api spec
+type HistoryHandler struct {
+	historyRepository  payments.HistoryRepository
+	paymentsRepository payments.Repository
+	logger             *slog.Logger
+}
+
+func NewHistoryHandler(historyRepository payments.HistoryRepository, paymentsRepository payments.Repository, logger *slog.Logger) *HistoryHandler {
+	return &HistoryHandler{
+		historyRepository:  historyRepository,
+		paymentsRepository: paymentsRepository,
+		logger:             logger,
+	}
+}
+
+func (h *HistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	paymentId, err := uuid.Parse(r.PathValue("paymentId"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{ErrorMessage: "invalid paymentId"})
+		return
+	}
+
+	history, werr := h.historyRepository.GetPaymentHistory(r.Context(), paymentId)
+	if werr != nil {
+		h.writeInternalError(w, "failed getting payment history", paymentId, werr)
+		return
+	}
+	if len(history) == 0 {
+		// payments processed before the history was introduced have no entries
+		_, werr = h.paymentsRepository.GetPayment(r.Context(), paymentId)
+		if werr != nil {
+			if werr.Code() == werrors.ResourceNotFoundErrorCode {
+				writeJSON(w, http.StatusNotFound, apiError{ErrorMessage: "payment not found"})
+				return
+			}
+			h.writeInternalError(w, "failed getting payment", paymentId, werr)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, buildPaymentHistory(paymentId, history))
+}
+
+func (h *HistoryHandler) writeInternalError(w http.ResponseWriter, msg string, paymentId uuid.UUID, werr werrors.WError) {
+	h.logger.Error(
+		msg,
+		logattr.Error(werr.Message()),
+		logattr.PaymentId(paymentId.String()),
+	)
+	writeJSON(w, http.StatusInternalServerError, apiError{ErrorMessage: "unexpected internal error"})
+}
+
+// buildPaymentHistory resolves the externalId of every entry. Updates that
+// don't carry an externalId keep the one set by the previous events.
+func buildPaymentHistory(paymentId uuid.UUID, history []payments.HistoryEntry) paymentHistory {
+	items := make([]paymentHistoryEntry, 0, len(history))
+	var currentExternalId *string
+	for _, entry := range history {
+		item := paymentHistoryEntry{
+			AggregateVersion: entry.AggregateVersion,
+			Status:           string(entry.Status),
+			EventId:          entry.EventId,
+			EventType:        entry.EventType,
+			EventCreatedAt:   entry.EventCreatedAt,
+		}
+		if entry.ExternalId.IsSet() && (currentExternalId == nil || *currentExternalId != entry.ExternalId.Value) {
+			item.ExternalIdChange = &externalIdChange{
+				From: currentExternalId,
+				To:   entry.ExternalId.Value,
+			}
+			externalId := entry.ExternalId.Value
+			currentExternalId = &externalId
+		}
+		item.ExternalId = currentExternalId
+		items = append(items, item)
+	}
+	return paymentHistory{
+		PaymentId: paymentId,
+		Items:     items,
+		Total:     len(items),
+	}
+}
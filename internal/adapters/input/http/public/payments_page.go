@@ -0,0 +1,263 @@
+package public
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/publicapi"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+const (
+	cursorDirectionNext = "next"
+	cursorDirectionPrev = "prev"
+)
+
+type paymentsPage struct {
+	Items      []publicapi.Payment `json:"items"`
+	NextCursor string              `json:"nextCursor,omitempty"`
+	PrevCursor string              `json:"prevCursor,omitempty"`
+}
+
+// pageCursorToken is encoded in the opaque cursors handed out to the clients
+type pageCursorToken struct {
+	Direction string    `json:"d"`
+	CreatedAt time.Time `json:"t"`
+	PaymentId uuid.UUID `json:"id"`
+	// FiltersHash is the hash of the filters of the page the cursor was handed out with,
+	// a cursor positions within the payments matching them only
+	FiltersHash string `json:"f"`
+}
+
+// PaymentsPageHandler adds the cursor pagination, which is not part of the public api spec,
+// to the ListPayments endpoint of the public api server. It serves the requests with a cursor
+// query param, left empty for the first page, and leaves the offset pagination to the public
+// api server. The payments are sorted from the newest to the oldest and are not counted.
+type PaymentsPageHandler struct {
+	apiServer          http.Handler
+	paymentsRepository payments.Repository
+	logger             *slog.Logger
+}
+
+func NewPaymentsPageHandler(apiServer http.Handler, paymentsRepository payments.Repository, logger *slog.Logger) *PaymentsPageHandler {
+	return &PaymentsPageHandler{
+		apiServer:          apiServer,
+		paymentsRepository: paymentsRepository,
+		logger:             logger,
+	}
+}
+
+func (h *PaymentsPageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.Query().Has("cursor") {
+		h.apiServer.ServeHTTP(w, r)
+		return
+	}
+	requireBearerAuth(http.HandlerFunc(h.servePage)).ServeHTTP(w, r)
+}
+
+func (h *PaymentsPageHandler) servePage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Has("offset") {
+		writeJSON(w, http.StatusBadRequest, apiError{ErrorMessage: "offset can't be combined with cursor"})
+		return
+	}
+	params, err := parseListPaymentsFilters(query)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{ErrorMessage: err.Error()})
+		return
+	}
+	pageRequest, err := parsePageRequest(query, params)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{ErrorMessage: err.Error()})
+		return
+	}
+
+	page, werr := h.paymentsRepository.SearchPaymentsPage(r.Context(), params, pageRequest)
+	if werr != nil {
+		h.logger.Error("failed listing payments page", logattr.Error(werr.Message()))
+		writeJSON(w, http.StatusInternalServerError, apiError{ErrorMessage: "unexpected internal error"})
+		return
+	}
+	response := paymentsPage{Items: make([]publicapi.Payment, 0, len(page.Payments))}
+	for _, payment := range page.Payments {
+		response.Items = append(response.Items, *buildPublicPaymentFromPrivatePayment(payment.Data))
+	}
+	if page.Next != nil {
+		response.NextCursor = encodePageCursor(cursorDirectionNext, *page.Next, params)
+	}
+	if page.Prev != nil {
+		response.PrevCursor = encodePageCursor(cursorDirectionPrev, *page.Prev, params)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func parsePageRequest(query url.Values, params publicapi.ListPaymentsParams) (payments.PageRequest, error) {
+	pageRequest := payments.PageRequest{Limit: DefaultPageLimit}
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			return payments.PageRequest{}, fmt.Errorf("limit must be between 1 and %d", MaxPageLimit)
+		}
+		pageRequest.Limit = limit
+	}
+	rawCursor := query.Get("cursor")
+	if rawCursor == "" {
+		return pageRequest, nil
+	}
+	direction, cursor, err := decodePageCursor(rawCursor, params)
+	if err != nil {
+		return payments.PageRequest{}, err
+	}
+	if direction == cursorDirectionNext {
+		pageRequest.After = &cursor
+	} else {
+		pageRequest.Before = &cursor
+	}
+	return pageRequest, nil
+}
+
+func encodePageCursor(direction string, cursor payments.PageCursor, params publicapi.ListPaymentsParams) string {
+	// the token fields can always be serialized
+	token, _ := json.Marshal(pageCursorToken{
+		Direction:   direction,
+		CreatedAt:   cursor.CreatedAt,
+		PaymentId:   cursor.PaymentId,
+		FiltersHash: listPaymentsFiltersHash(params),
+	})
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// decodePageCursor refuses the cursors handed out with other filters than params
+func decodePageCursor(rawCursor string, params publicapi.ListPaymentsParams) (string, payments.PageCursor, error) {
+	rawToken, err := base64.RawURLEncoding.DecodeString(rawCursor)
+	if err != nil {
+		return "", payments.PageCursor{}, fmt.Errorf("invalid cursor")
+	}
+	var token pageCursorToken
+	err = json.Unmarshal(rawToken, &token)
+	if err != nil || (token.Direction != cursorDirectionNext && token.Direction != cursorDirectionPrev) {
+		return "", payments.PageCursor{}, fmt.Errorf("invalid cursor")
+	}
+	if token.FiltersHash != listPaymentsFiltersHash(params) {
+		return "", payments.PageCursor{}, fmt.Errorf("cursor doesn't match the filters")
+	}
+	return token.Direction, payments.PageCursor{CreatedAt: token.CreatedAt, PaymentId: token.PaymentId}, nil
+}
+
+// listPaymentsFiltersHash hashes the filters read by parseListPaymentsFilters, encoded
+// with the keys sorted, so the same filters hash the same whatever their order in the query
+func listPaymentsFiltersHash(params publicapi.ListPaymentsParams) string {
+	filters := url.Values{}
+	if params.ID.Set {
+		filters.Set("id", params.ID.Value.String())
+	}
+	if params.CustomerId.Set {
+		filters.Set("customerId", params.CustomerId.Value.String())
+	}
+	if params.DateFrom.Set {
+		filters.Set("dateFrom", params.DateFrom.Value.Format(time.DateOnly))
+	}
+	if params.DateTo.Set {
+		filters.Set("dateTo", params.DateTo.Value.Format(time.DateOnly))
+	}
+	if params.Status.Set {
+		filters.Set("status", string(params.Status.Value))
+	}
+	if params.Gateway.Set {
+		filters.Set("gateway", string(params.Gateway.Value))
+	}
+	if params.ExternalId.Set {
+		filters.Set("externalId", params.ExternalId.Value)
+	}
+	if params.SchemeId.Set {
+		filters.Set("schemeId", params.SchemeId.Value)
+	}
+	if params.Amount.Set {
+		filters.Set("amount", strconv.FormatFloat(params.Amount.Value, 'g', -1, 64))
+	}
+	hash := sha256.Sum256([]byte(filters.Encode()))
+	return base64.RawURLEncoding.EncodeToString(hash[:12])
+}
+
+// parseListPaymentsFilters reads the filters of the ListPayments operation of the public api spec
+func parseListPaymentsFilters(query url.Values) (publicapi.ListPaymentsParams, error) {
+	var params publicapi.ListPaymentsParams
+	var err error
+	if params.ID, err = optUUIDFromQuery(query, "id"); err != nil {
+		return publicapi.ListPaymentsParams{}, err
+	}
+	if params.CustomerId, err = optUUIDFromQuery(query, "customerId"); err != nil {
+		return publicapi.ListPaymentsParams{}, err
+	}
+	if params.DateFrom, err = optDateFromQuery(query, "dateFrom"); err != nil {
+		return publicapi.ListPaymentsParams{}, err
+	}
+	if params.DateTo, err = optDateFromQuery(query, "dateTo"); err != nil {
+		return publicapi.ListPaymentsParams{}, err
+	}
+	if status := query.Get("status"); status != "" {
+		if publicapi.PaymentStatus(status).Validate() != nil {
+			return publicapi.ListPaymentsParams{}, fmt.Errorf("invalid status")
+		}
+		params.Status = publicapi.NewOptPaymentStatus(publicapi.PaymentStatus(status))
+	}
+	if gateway := query.Get("gateway"); gateway != "" {
+		if publicapi.Gateway(gateway).Validate() != nil {
+			return publicapi.ListPaymentsParams{}, fmt.Errorf("invalid gateway")
+		}
+		params.Gateway = publicapi.NewOptGateway(publicapi.Gateway(gateway))
+	}
+	if externalId := query.Get("externalId"); externalId != "" {
+		params.ExternalId = publicapi.NewOptString(externalId)
+	}
+	if schemeId := query.Get("schemeId"); schemeId != "" {
+		params.SchemeId = publicapi.NewOptString(schemeId)
+	}
+	if rawAmount := query.Get("amount"); rawAmount != "" {
+		amount, err := strconv.ParseFloat(rawAmount, 64)
+		if err != nil {
+			return publicapi.ListPaymentsParams{}, fmt.Errorf("invalid amount")
+		}
+		params.Amount = publicapi.NewOptFloat64(amount)
+	}
+	return params, nil
+}
+
+func optUUIDFromQuery(query url.Values, name string) (publicapi.OptUUID, error) {
+	rawValue := query.Get(name)
+	if rawValue == "" {
+		return publicapi.OptUUID{}, nil
+	}
+	value, err := uuid.Parse(rawValue)
+	if err != nil {
+		return publicapi.OptUUID{}, fmt.Errorf("invalid %s", name)
+	}
+	return publicapi.NewOptUUID(value), nil
+}
+
+func optDateFromQuery(query url.Values, name string) (publicapi.OptDate, error) {
+	rawValue := query.Get(name)
+	if rawValue == "" {
+		return publicapi.OptDate{}, nil
+	}
+	value, err := time.Parse(time.DateOnly, rawValue)
+	if err != nil {
+		return publicapi.OptDate{}, fmt.Errorf("invalid %s", name)
+	}
+	return publicapi.NewOptDate(value), nil
+}
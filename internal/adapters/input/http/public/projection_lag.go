@@ -0,0 +1,74 @@
+package public
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/walletera/werrors"
+)
+
+const (
+	ProjectionLagHeader  = "X-Projection-Lag"
+	ProjectionIdleHeader = "X-Projection-Idle"
+	// projectionLagCacheTTL bounds the checkpoint reads to one per second and instance
+	projectionLagCacheTTL = time.Second
+)
+
+// ProjectionLag adds to every response the X-Projection-Lag header, with the end-to-end lag
+// of the last event applied to the read model, from its creation to its application, and the
+// X-Projection-Idle header, with the time elapsed since it was applied, both in milliseconds.
+// The idle time grows while no event is applied, so a stuck consumer shows up.
+type ProjectionLag struct {
+	checkpointsRepository payments.CheckpointsRepository
+	logger                *slog.Logger
+
+	mutex     sync.Mutex
+	lag       string
+	idle      string
+	expiresAt time.Time
+}
+
+func NewProjectionLag(checkpointsRepository payments.CheckpointsRepository, logger *slog.Logger) *ProjectionLag {
+	return &ProjectionLag{checkpointsRepository: checkpointsRepository, logger: logger}
+}
+
+func (p *ProjectionLag) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lag, idle := p.currentLag(r.Context())
+		if lag != "" {
+			w.Header().Set(ProjectionLagHeader, lag)
+			w.Header().Set(ProjectionIdleHeader, idle)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// currentLag returns the lag and the idle time, empty when no event was applied yet
+func (p *ProjectionLag) currentLag(ctx context.Context) (string, string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if time.Now().Before(p.expiresAt) {
+		return p.lag, p.idle
+	}
+	checkpoint, werr := p.checkpointsRepository.GetGlobalCheckpoint(ctx)
+	if werr != nil {
+		// no event applied yet is not an error, the header is just omitted
+		p.lag = ""
+		p.idle = ""
+		if werr.Code() != werrors.ResourceNotFoundErrorCode {
+			p.logger.Error("failed getting global checkpoint", logattr.Error(werr.Message()))
+		}
+	} else {
+		p.lag = strconv.FormatInt(checkpoint.Lag().Milliseconds(), 10)
+		p.idle = strconv.FormatInt(checkpoint.IdleAt(time.Now()).Milliseconds(), 10)
+	}
+	p.expiresAt = time.Now().Add(projectionLagCacheTTL)
+	return p.lag, p.idle
+}
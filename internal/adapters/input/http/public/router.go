@@ -0,0 +1,49 @@
+package public
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type apiError struct {
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// NewHTTPHandler serves the payment history and payments stream endpoints, the GetPayment
+// endpoint waiting for a status and the ListPayments endpoint paged with a cursor, next to the
+// endpoints of the public api server, adding the projection lag header to the responses of all of them
+func NewHTTPHandler(
+	apiServer http.Handler,
+	historyHandler *HistoryHandler,
+	streamHandler *StreamHandler,
+	waitForStatusHandler *WaitForStatusHandler,
+	paymentsPageHandler *PaymentsPageHandler,
+	projectionLag *ProjectionLag,
+) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /payments", paymentsPageHandler)
+	mux.Handle("GET /payments/stream", requireBearerAuth(streamHandler))
+	mux.Handle("GET /payments/{paymentId}", waitForStatusHandler)
+	mux.Handle("GET /payments/{paymentId}/history", requireBearerAuth(historyHandler))
+	mux.Handle("/", apiServer)
+	return projectionLag.Middleware(mux)
+}
+
+// requireBearerAuth mirrors the bearer auth of the public api server, which only requires the token to be present
+func requireBearerAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || token == "" {
+			writeJSON(w, http.StatusUnauthorized, apiError{ErrorMessage: "missing bearer token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
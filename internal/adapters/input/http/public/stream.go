@@ -0,0 +1,521 @@
+package public
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/payments-types/publicapi"
+	"github.com/walletera/werrors"
+)
+
+const (
+	DefaultStreamHeartbeatInterval = 15 * time.Second
+	streamPollInterval             = 500 * time.Millisecond
+	// streamReorderWindow is how late an event can be logged compared to the events logged
+	// before it (e.g. by another instance) and still be streamed. Every poll reads the event
+	// log again from this far back, skipping the events already seen.
+	streamReorderWindow = 5 * time.Second
+	// streamRetryMillis is the delay the clients wait for before reconnecting
+	streamRetryMillis = 3000
+	// streamBufferSize is how many changes a stream can fall behind the tailer before being
+	// closed. Its client reconnects and catches up from the event log.
+	streamBufferSize = 256
+	// streamPaymentsCacheSize bounds the payments whose customer and gateway are kept
+	streamPaymentsCacheSize = 10000
+)
+
+// StreamHandler serves the Server-Sent Events stream of the payments created and updated,
+// read from the event log. A single tailer, run by Run, reads the events as they are logged
+// by every instance and fans them out to the open streams and to the projection changes the
+// requests waiting for a payment status are subscribed to. The stream of a client resumes
+// after the event sent in the Last-Event-ID header, catching up from the event log. Without
+// it the stream starts with the events logged from then on.
+type StreamHandler struct {
+	eventLog           payments.EventLog
+	paymentsRepository payments.Repository
+	projectionChanges  *payments.ProjectionChanges
+	heartbeatInterval  time.Duration
+	logger             *slog.Logger
+
+	streamsMu sync.Mutex
+	streams   map[*openStream]struct{}
+
+	// payments caches the attributes of the payments streamed, which no event changes
+	paymentsMu sync.Mutex
+	payments   map[uuid.UUID]paymentAttributes
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// streamFilter zero status and gateway match any payment
+type streamFilter struct {
+	customerId uuid.UUID
+	status     privateapi.PaymentStatus
+	gateway    privateapi.Gateway
+}
+
+type openStream struct {
+	filter  streamFilter
+	changes chan paymentChange
+	// behind is closed when the stream falls behind the tailer
+	behind chan struct{}
+}
+
+// streamPosition is the last event sent to a stream, the events logged at or before it,
+// ordered by logged time and id, are not sent
+type streamPosition struct {
+	loggedAt time.Time
+	id       uuid.UUID
+}
+
+// streamTail tracks the events of the log already seen by the tailer
+type streamTail struct {
+	// lastLoggedAt is the latest logged time seen
+	lastLoggedAt time.Time
+	// seen keeps the events logged within the reorder window before lastLoggedAt
+	seen map[uuid.UUID]time.Time
+}
+
+// paymentAttributes are the fields of a payment set on its creation
+type paymentAttributes struct {
+	CustomerId uuid.UUID          `json:"customerId"`
+	Gateway    privateapi.Gateway `json:"gateway"`
+}
+
+// paymentChange is the state the event left the payment in, like the entries of the payment history
+type paymentChange struct {
+	EventId          uuid.UUID                `json:"eventId"`
+	EventType        string                   `json:"eventType"`
+	EventCreatedAt   time.Time                `json:"eventCreatedAt"`
+	AggregateVersion uint64                   `json:"aggregateVersion"`
+	PaymentId        uuid.UUID                `json:"paymentId"`
+	CustomerId       uuid.UUID                `json:"customerId"`
+	Gateway          privateapi.Gateway       `json:"gateway"`
+	Status           privateapi.PaymentStatus `json:"status"`
+	// ExternalId is present when the event set it
+	ExternalId *string `json:"externalId,omitempty"`
+
+	eventName string
+	loggedAt  time.Time
+}
+
+func NewStreamHandler(
+	eventLog payments.EventLog,
+	paymentsRepository payments.Repository,
+	projectionChanges *payments.ProjectionChanges,
+	heartbeatInterval time.Duration,
+	logger *slog.Logger,
+) *StreamHandler {
+	if heartbeatInterval <= 0 {
+		heartbeatInterval = DefaultStreamHeartbeatInterval
+	}
+	return &StreamHandler{
+		eventLog:           eventLog,
+		paymentsRepository: paymentsRepository,
+		projectionChanges:  projectionChanges,
+		heartbeatInterval:  heartbeatInterval,
+		logger:             logger,
+		streams:            make(map[*openStream]struct{}),
+		payments:           make(map[uuid.UUID]paymentAttributes),
+		closed:             make(chan struct{}),
+	}
+}
+
+// Run tails the event log until ctx is done, fanning out the changes to the open streams
+// and to the subscribers of the projection changes
+func (h *StreamHandler) Run(ctx context.Context) {
+	tail := newStreamTail()
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !h.hasOpenStreams() && !h.projectionChanges.HasSubscribers() {
+				// the streams opened and the waits started later don't need the events logged until then
+				tail = newStreamTail()
+				continue
+			}
+			err := h.tailEvents(ctx, tail)
+			if err != nil {
+				// the events not fanned out yet are read again by the next poll
+				h.logger.Error("failed tailing the event log", logattr.Error(err.Error()))
+			}
+		}
+	}
+}
+
+// Close ends the open streams, so the http server can shut down
+func (h *StreamHandler) Close() {
+	h.closeOnce.Do(func() { close(h.closed) })
+}
+
+// ServeHTTP streams a payment.created or payment.updated event, carrying the state the event
+// left the payment in, for every event applied to a payment of the customerId query param
+// matching the status and gateway query params. A comment is sent as heartbeat when there are no events.
+func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseStreamFilter(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{ErrorMessage: err.Error()})
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, apiError{ErrorMessage: "streaming not supported"})
+		return
+	}
+	lastEventId := r.Header.Get("Last-Event-ID")
+	position, werr := h.startPosition(r.Context(), lastEventId)
+	if werr != nil {
+		if werr.Code() == werrors.ValidationErrorCode || werr.Code() == werrors.ResourceNotFoundErrorCode {
+			writeJSON(w, http.StatusBadRequest, apiError{ErrorMessage: "unknown Last-Event-ID"})
+			return
+		}
+		h.logger.Error("failed resuming payments stream", logattr.Error(werr.Message()))
+		writeJSON(w, http.StatusInternalServerError, apiError{ErrorMessage: "unexpected internal error"})
+		return
+	}
+	// opened before catching up, so the events logged meanwhile are not missed
+	stream := h.openStream(filter)
+	defer h.closeStream(stream)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// disables the buffering of the proxies supporting it
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	_, err = fmt.Fprintf(w, "retry: %d\n\n", streamRetryMillis)
+	if err != nil {
+		return
+	}
+	flusher.Flush()
+
+	var caughtUp map[uuid.UUID]time.Time
+	if lastEventId != "" {
+		caughtUp, err = h.catchUp(r.Context(), w, position, filter)
+		if err != nil {
+			// the client reconnects with the id of the last event received
+			h.logger.Error("failed catching up payments stream", logattr.Error(err.Error()))
+			return
+		}
+		flusher.Flush()
+	}
+
+	heartbeatTicker := time.NewTicker(h.heartbeatInterval)
+	defer heartbeatTicker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.closed:
+			return
+		case <-stream.behind:
+			h.logger.Warn("payments stream fell behind, closing it")
+			return
+		case change := <-stream.changes:
+			if _, sent := caughtUp[change.EventId]; sent || !position.precedes(change.loggedAt, change.EventId) {
+				continue
+			}
+			err = writeChange(w, change)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+			heartbeatTicker.Reset(h.heartbeatInterval)
+		case <-heartbeatTicker.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (h *StreamHandler) startPosition(ctx context.Context, lastEventId string) (streamPosition, werrors.WError) {
+	if lastEventId == "" {
+		return streamPosition{loggedAt: time.Now(), id: uuid.Max}, nil
+	}
+	id, err := uuid.Parse(lastEventId)
+	if err != nil {
+		return streamPosition{}, werrors.NewValidationError("invalid Last-Event-ID")
+	}
+	lastEvent, werr := h.eventLog.GetEvent(ctx, id)
+	if werr != nil {
+		return streamPosition{}, werr
+	}
+	return streamPosition{loggedAt: lastEvent.LoggedAt, id: lastEvent.ID}, nil
+}
+
+// catchUp writes the events logged after the position and returns the ones sent within
+// the reorder window of the last one, which the tailer may fan out again
+func (h *StreamHandler) catchUp(ctx context.Context, w http.ResponseWriter, position streamPosition, filter streamFilter) (map[uuid.UUID]time.Time, error) {
+	iterator, werr := h.eventLog.IterateEvents(ctx, position.loggedAt)
+	if werr != nil {
+		return nil, werr
+	}
+	defer iterator.Close()
+
+	sent := make(map[uuid.UUID]time.Time)
+	var lastLoggedAt time.Time
+	for {
+		ok, loggedEvent, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if !position.precedes(loggedEvent.LoggedAt, loggedEvent.ID) {
+			continue
+		}
+		change, ok, werr := h.paymentChange(ctx, loggedEvent)
+		if werr != nil {
+			return nil, werr
+		}
+		if !ok || !filter.matches(change) {
+			continue
+		}
+		err = writeChange(w, change)
+		if err != nil {
+			return nil, err
+		}
+		sent[change.EventId] = change.loggedAt
+		if change.loggedAt.After(lastLoggedAt) {
+			lastLoggedAt = change.loggedAt
+		}
+	}
+	for id, loggedAt := range sent {
+		if loggedAt.Before(lastLoggedAt.Add(-streamReorderWindow)) {
+			delete(sent, id)
+		}
+	}
+	return sent, nil
+}
+
+// tailEvents fans out the events logged since the last poll. It stops at the first event
+// it fails to build the change of, leaving it unseen so the next poll reads it again.
+func (h *StreamHandler) tailEvents(ctx context.Context, tail *streamTail) error {
+	iterator, werr := h.eventLog.IterateEvents(ctx, tail.lastLoggedAt.Add(-streamReorderWindow))
+	if werr != nil {
+		return werr
+	}
+	defer iterator.Close()
+
+	for {
+		ok, loggedEvent, err := iterator.Next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if _, seen := tail.seen[loggedEvent.ID]; seen {
+			continue
+		}
+		h.projectionChanges.ProjectionChanged(payments.ProjectionChange{
+			PaymentId:        loggedEvent.PaymentId,
+			AggregateVersion: loggedEvent.AggregateVersion,
+			Status:           loggedEvent.Status,
+		})
+		change, ok, werr := h.paymentChange(ctx, loggedEvent)
+		if werr != nil {
+			return werr
+		}
+		tail.seen[loggedEvent.ID] = loggedEvent.LoggedAt
+		if loggedEvent.LoggedAt.After(tail.lastLoggedAt) {
+			tail.lastLoggedAt = loggedEvent.LoggedAt
+		}
+		if ok {
+			h.fanOut(change)
+		}
+	}
+
+	for id, loggedAt := range tail.seen {
+		if loggedAt.Before(tail.lastLoggedAt.Add(-streamReorderWindow)) {
+			delete(tail.seen, id)
+		}
+	}
+	return nil
+}
+
+// fanOut hands the change to the matching streams. The streams whose buffer is full are
+// closed instead of blocking the others.
+func (h *StreamHandler) fanOut(change paymentChange) {
+	h.streamsMu.Lock()
+	defer h.streamsMu.Unlock()
+	for stream := range h.streams {
+		if !stream.filter.matches(change) {
+			continue
+		}
+		select {
+		case stream.changes <- change:
+		default:
+			delete(h.streams, stream)
+			close(stream.behind)
+		}
+	}
+}
+
+func (h *StreamHandler) openStream(filter streamFilter) *openStream {
+	stream := &openStream{
+		filter:  filter,
+		changes: make(chan paymentChange, streamBufferSize),
+		behind:  make(chan struct{}),
+	}
+	h.streamsMu.Lock()
+	defer h.streamsMu.Unlock()
+	h.streams[stream] = struct{}{}
+	return stream
+}
+
+func (h *StreamHandler) closeStream(stream *openStream) {
+	h.streamsMu.Lock()
+	defer h.streamsMu.Unlock()
+	delete(h.streams, stream)
+}
+
+func (h *StreamHandler) hasOpenStreams() bool {
+	h.streamsMu.Lock()
+	defer h.streamsMu.Unlock()
+	return len(h.streams) > 0
+}
+
+// paymentChange builds the change from the state the event left the payment in. It reports
+// false for the events not streamed and the events of the payments not found.
+func (h *StreamHandler) paymentChange(ctx context.Context, loggedEvent payments.LoggedEvent) (paymentChange, bool, werrors.WError) {
+	eventName, ok := streamEventNames[loggedEvent.Type]
+	if !ok {
+		return paymentChange{}, false, nil
+	}
+	attributes, found, werr := h.paymentAttributes(ctx, loggedEvent)
+	if werr != nil || !found {
+		return paymentChange{}, false, werr
+	}
+	change := paymentChange{
+		EventId:          loggedEvent.ID,
+		EventType:        loggedEvent.Type,
+		EventCreatedAt:   loggedEvent.CreatedAt,
+		AggregateVersion: loggedEvent.AggregateVersion,
+		PaymentId:        loggedEvent.PaymentId,
+		CustomerId:       attributes.CustomerId,
+		Gateway:          attributes.Gateway,
+		Status:           loggedEvent.Status,
+		eventName:        eventName,
+		loggedAt:         loggedEvent.LoggedAt,
+	}
+	if loggedEvent.ExternalId.IsSet() {
+		externalId := loggedEvent.ExternalId.Value
+		change.ExternalId = &externalId
+	}
+	return change, true, nil
+}
+
+// paymentAttributes takes the customer and the gateway of the payment from the data of the
+// PaymentCreated event, or from the payments repository for the other events, once per payment
+func (h *StreamHandler) paymentAttributes(ctx context.Context, loggedEvent payments.LoggedEvent) (paymentAttributes, bool, werrors.WError) {
+	h.paymentsMu.Lock()
+	attributes, found := h.payments[loggedEvent.PaymentId]
+	h.paymentsMu.Unlock()
+	if found {
+		return attributes, true, nil
+	}
+	if loggedEvent.Type == "PaymentCreated" {
+		// the event log keeps the payment the event created as its data
+		_ = json.Unmarshal(loggedEvent.Data, &attributes)
+	}
+	if attributes.CustomerId == uuid.Nil {
+		payment, werr := h.paymentsRepository.GetPayment(ctx, loggedEvent.PaymentId)
+		if werr != nil {
+			if werr.Code() == werrors.ResourceNotFoundErrorCode {
+				return paymentAttributes{}, false, nil
+			}
+			return paymentAttributes{}, false, werr
+		}
+		attributes = paymentAttributes{CustomerId: payment.Data.CustomerId, Gateway: payment.Data.Gateway}
+	}
+	h.paymentsMu.Lock()
+	defer h.paymentsMu.Unlock()
+	if len(h.payments) >= streamPaymentsCacheSize {
+		clear(h.payments)
+	}
+	h.payments[loggedEvent.PaymentId] = attributes
+	return attributes, true, nil
+}
+
+func writeChange(w http.ResponseWriter, change paymentChange) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("failed serializing payment change: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", change.EventId, change.eventName, data)
+	return err
+}
+
+var streamEventNames = map[string]string{
+	"PaymentCreated": "payment.created",
+	"PaymentUpdated": "payment.updated",
+}
+
+func newStreamTail() *streamTail {
+	return &streamTail{
+		lastLoggedAt: time.Now(),
+		seen:         make(map[uuid.UUID]time.Time),
+	}
+}
+
+// precedes reports whether the event logged at loggedAt with the given id comes after the position
+func (p streamPosition) precedes(loggedAt time.Time, id uuid.UUID) bool {
+	if !loggedAt.Equal(p.loggedAt) {
+		return loggedAt.After(p.loggedAt)
+	}
+	return bytes.Compare(id[:], p.id[:]) > 0
+}
+
+func (f streamFilter) matches(change paymentChange) bool {
+	return change.CustomerId == f.customerId &&
+		(f.status == "" || change.Status == f.status) &&
+		(f.gateway == "" || change.Gateway == f.gateway)
+}
+
+// parseStreamFilter requires the customerId, a stream only carries the payments of one customer
+func parseStreamFilter(r *http.Request) (streamFilter, error) {
+	var filter streamFilter
+	query := r.URL.Query()
+	customerId := query.Get("customerId")
+	if customerId == "" {
+		return streamFilter{}, fmt.Errorf("missing customerId")
+	}
+	id, err := uuid.Parse(customerId)
+	if err != nil {
+		return streamFilter{}, fmt.Errorf("invalid customerId")
+	}
+	filter.customerId = id
+	if status := query.Get("status"); status != "" {
+		if publicapi.PaymentStatus(status).Validate() != nil {
+			return streamFilter{}, fmt.Errorf("invalid status")
+		}
+		filter.status = privateapi.PaymentStatus(status)
+	}
+	if gateway := query.Get("gateway"); gateway != "" {
+		if publicapi.Gateway(gateway).Validate() != nil {
+			return streamFilter{}, fmt.Errorf("invalid gateway")
+		}
+		filter.gateway = privateapi.Gateway(gateway)
+	}
+	return filter, nil
+}
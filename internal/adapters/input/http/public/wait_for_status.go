@@ -0,0 +1,184 @@
+package public
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/payments-types/publicapi"
+	"github.com/walletera/werrors"
+)
+
+const (
+	// DefaultWaitTimeout is how long a GetPayment request with waitForStatus
+	// and without timeout waits for the payment
+	DefaultWaitTimeout = 10 * time.Second
+	// MaxWaitTimeout caps the timeout query param
+	MaxWaitTimeout = 30 * time.Second
+)
+
+// WaitForStatusHandler adds the waitForStatus and timeout query params, which are not part
+// of the public api spec, to the GetPayment endpoint of the public api server. With them the
+// request waits until the payment reaches one of the statuses, or any newer aggregate version,
+// before being served. The wait is woken up by the projection changes, notified by the events
+// handler of this instance and by the StreamHandler tailing the event log for the changes applied
+// by the other instances. The current state of the payment is served when the timeout expires.
+type WaitForStatusHandler struct {
+	apiServer          http.Handler
+	projectionChanges  *payments.ProjectionChanges
+	paymentsRepository payments.Repository
+	logger             *slog.Logger
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// waitCondition is met by a payment newer than the version read when the wait started, as
+// the payment wasn't in the statuses waited for then
+type waitCondition struct {
+	// found is false when the payment didn't exist yet, any version is newer
+	found   bool
+	version uint64
+}
+
+func NewWaitForStatusHandler(
+	apiServer http.Handler,
+	projectionChanges *payments.ProjectionChanges,
+	paymentsRepository payments.Repository,
+	logger *slog.Logger,
+) *WaitForStatusHandler {
+	return &WaitForStatusHandler{
+		apiServer:          apiServer,
+		projectionChanges:  projectionChanges,
+		paymentsRepository: paymentsRepository,
+		logger:             logger,
+		closed:             make(chan struct{}),
+	}
+}
+
+// Close ends the waits, so the http server can shut down
+func (h *WaitForStatusHandler) Close() {
+	h.closeOnce.Do(func() { close(h.closed) })
+}
+
+// ServeHTTP hands the requests without wait params straight to the public api server, the
+// others are authenticated before waiting, as the public api server only does it afterwards
+func (h *WaitForStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if !query.Has("waitForStatus") && !query.Has("timeout") {
+		h.apiServer.ServeHTTP(w, r)
+		return
+	}
+	requireBearerAuth(http.HandlerFunc(h.waitAndServe)).ServeHTTP(w, r)
+}
+
+func (h *WaitForStatusHandler) waitAndServe(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	paymentId, err := uuid.Parse(r.PathValue("paymentId"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{ErrorMessage: "invalid paymentId"})
+		return
+	}
+	statuses, err := parseWaitForStatus(query["waitForStatus"])
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{ErrorMessage: err.Error()})
+		return
+	}
+	timeout, err := parseWaitTimeout(query.Get("timeout"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{ErrorMessage: err.Error()})
+		return
+	}
+
+	h.waitForPayment(r.Context(), paymentId, statuses, timeout)
+	if r.Context().Err() != nil {
+		return
+	}
+	h.apiServer.ServeHTTP(w, r)
+}
+
+// waitForPayment returns once the payment meets the wait condition, the timeout expires
+// or ctx is done. The changes are subscribed before reading the payment, so none is missed.
+func (h *WaitForStatusHandler) waitForPayment(ctx context.Context, paymentId uuid.UUID, statuses []privateapi.PaymentStatus, timeout time.Duration) {
+	changes, unsubscribe := h.projectionChanges.Subscribe(paymentId)
+	defer unsubscribe()
+
+	var condition waitCondition
+	payment, werr := h.paymentsRepository.GetPayment(ctx, paymentId)
+	if werr != nil {
+		if werr.Code() != werrors.ResourceNotFoundErrorCode {
+			// the payment is served right away, failing the same way
+			h.logger.Error(
+				"failed getting payment to wait for",
+				logattr.Error(werr.Message()),
+				logattr.PaymentId(paymentId.String()),
+			)
+			return
+		}
+	} else {
+		if slices.Contains(statuses, payment.Data.Status) {
+			return
+		}
+		condition.found = true
+		condition.version = payment.AggregateVersion
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.closed:
+			return
+		case <-timer.C:
+			return
+		case change := <-changes:
+			if condition.isMetBy(change) {
+				return
+			}
+		}
+	}
+}
+
+// isMetBy ignores the changes up to the version read, which the tail of the event log
+// may notify late
+func (c waitCondition) isMetBy(change payments.ProjectionChange) bool {
+	return !c.found || change.AggregateVersion > c.version
+}
+
+// parseWaitForStatus accepts comma separated statuses, in one or many waitForStatus query params
+func parseWaitForStatus(rawValues []string) ([]privateapi.PaymentStatus, error) {
+	var statuses []privateapi.PaymentStatus
+	for _, rawValue := range rawValues {
+		for _, status := range strings.Split(rawValue, ",") {
+			if publicapi.PaymentStatus(status).Validate() != nil {
+				return nil, fmt.Errorf("invalid waitForStatus %s", status)
+			}
+			statuses = append(statuses, privateapi.PaymentStatus(status))
+		}
+	}
+	return statuses, nil
+}
+
+// parseWaitTimeout accepts a duration (e.g. 500ms or 20s), capped to MaxWaitTimeout
+func parseWaitTimeout(rawValue string) (time.Duration, error) {
+	if rawValue == "" {
+		return DefaultWaitTimeout, nil
+	}
+	timeout, err := time.ParseDuration(rawValue)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout %s", rawValue)
+	}
+	return min(timeout, MaxWaitTimeout), nil
+}
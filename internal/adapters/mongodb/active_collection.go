@@ -0,0 +1,178 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const paymentsProjectionId = "payments"
+
+type ProjectionMetadataBSON struct {
+	ID               string                            `bson:"_id"`
+	ActiveCollection string                            `bson:"activeCollection"`
+	SwitchedAt       time.Time                         `bson:"switchedAt,omitempty"`
+	Instances        map[string]ProjectionInstanceBSON `bson:"instances,omitempty"`
+}
+
+// ProjectionInstanceBSON is the heartbeat of a running instance of the service,
+// telling the collection it writes the payments to
+type ProjectionInstanceBSON struct {
+	ActiveCollection string    `bson:"activeCollection"`
+	ExpiresAt        time.Time `bson:"expiresAt"`
+}
+
+// ActiveCollection is the name of the collection holding the live payments projection.
+// The name is persisted in the projections metadata collection, so every instance
+// of the service moves to a rebuilt projection when the active collection is switched.
+// Every instance records the collection it uses on each load, so a switch is known
+// to be acknowledged once all the instances with a live heartbeat use the new collection.
+type ActiveCollection struct {
+	client                 *mongo.Client
+	dbName                 string
+	metadataCollectionName string
+	instanceId             string
+	heartbeatTTL           time.Duration
+	name                   atomic.Pointer[string]
+}
+
+// NewActiveCollection returns an ActiveCollection named defaultName until Load is called.
+// The heartbeat of the instance expires heartbeatTTL after every load, so it must be
+// longer than the interval the active collection is watched with.
+func NewActiveCollection(
+	client *mongo.Client,
+	dbName string,
+	metadataCollectionName string,
+	defaultName string,
+	heartbeatTTL time.Duration,
+) *ActiveCollection {
+	activeCollection := &ActiveCollection{
+		client:                 client,
+		dbName:                 dbName,
+		metadataCollectionName: metadataCollectionName,
+		instanceId:             uuid.NewString(),
+		heartbeatTTL:           heartbeatTTL,
+	}
+	activeCollection.name.Store(&defaultName)
+	return activeCollection
+}
+
+func (a *ActiveCollection) Name() string {
+	return *a.name.Load()
+}
+
+// Load reads the active collection from the metadata collection and records
+// the heartbeat of the instance. The current name is persisted if there is
+// no active collection yet. The expired heartbeats are removed.
+func (a *ActiveCollection) Load(ctx context.Context) error {
+	coll := a.client.Database(a.dbName).Collection(a.metadataCollectionName)
+	currentName := a.Name()
+	_, err := coll.UpdateOne(
+		ctx,
+		bson.M{"_id": paymentsProjectionId},
+		bson.M{"$setOnInsert": ProjectionMetadataBSON{ID: paymentsProjectionId, ActiveCollection: currentName}},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	var metadata ProjectionMetadataBSON
+	err = coll.FindOne(ctx, bson.M{"_id": paymentsProjectionId}).Decode(&metadata)
+	if err != nil {
+		return err
+	}
+	a.name.Store(&metadata.ActiveCollection)
+
+	update := bson.M{"$set": bson.M{"instances." + a.instanceId: a.heartbeat(metadata.ActiveCollection)}}
+	expired := bson.M{}
+	for instanceId, instance := range metadata.Instances {
+		if instanceId != a.instanceId && instance.ExpiresAt.Before(time.Now()) {
+			expired["instances."+instanceId] = ""
+		}
+	}
+	if len(expired) > 0 {
+		update["$unset"] = expired
+	}
+	_, err = coll.UpdateOne(ctx, bson.M{"_id": paymentsProjectionId}, update)
+	return err
+}
+
+// Switch atomically replaces the active collection, provided it is still from
+func (a *ActiveCollection) Switch(ctx context.Context, from string, to string) werrors.WError {
+	coll := a.client.Database(a.dbName).Collection(a.metadataCollectionName)
+	result, err := coll.UpdateOne(
+		ctx,
+		bson.M{"_id": paymentsProjectionId, "activeCollection": from},
+		bson.M{"$set": bson.M{
+			"activeCollection":          to,
+			"switchedAt":                time.Now(),
+			"instances." + a.instanceId: a.heartbeat(to),
+		}},
+	)
+	if err != nil {
+		return werrors.NewRetryableInternalError("failed switching active collection: %s", err.Error())
+	}
+	if result.MatchedCount == 0 {
+		return werrors.NewNonRetryableInternalError("active collection is not %s anymore", from)
+	}
+	a.name.Store(&to)
+	return nil
+}
+
+// SwitchAcknowledged tells whether every instance with a live heartbeat uses the collection
+func (a *ActiveCollection) SwitchAcknowledged(ctx context.Context, collection string) (bool, werrors.WError) {
+	coll := a.client.Database(a.dbName).Collection(a.metadataCollectionName)
+	var metadata ProjectionMetadataBSON
+	err := coll.FindOne(ctx, bson.M{"_id": paymentsProjectionId}).Decode(&metadata)
+	if err != nil {
+		return false, werrors.NewRetryableInternalError("failed finding projections metadata: %s", err.Error())
+	}
+	for _, instance := range metadata.Instances {
+		if instance.ExpiresAt.After(time.Now()) && instance.ActiveCollection != collection {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Watch reloads the active collection every interval, so a switch
+// made by another instance is picked up. It blocks until ctx is done.
+func (a *ActiveCollection) Watch(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			previousName := a.Name()
+			err := a.Load(ctx)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					logger.Error("failed reloading active collection", logattr.Error(err.Error()))
+				}
+				continue
+			}
+			if a.Name() != previousName {
+				logger.Info(
+					"active collection switched",
+					logattr.Collection(a.Name()),
+				)
+			}
+		}
+	}
+}
+
+func (a *ActiveCollection) heartbeat(collection string) ProjectionInstanceBSON {
+	return ProjectionInstanceBSON{ActiveCollection: collection, ExpiresAt: time.Now().Add(a.heartbeatTTL)}
+}
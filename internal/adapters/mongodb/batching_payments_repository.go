@@ -0,0 +1,302 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// BatchingPaymentsRepository accumulates the writes of the concurrent callers during
+// a short window, or up to a max batch size, and applies them in one ordered BulkWrite.
+// Every caller blocks until the batch including its write is applied and receives the
+// same result UpdatePayment or SavePayment would have returned, so each event is still
+// acknowledged on its own once handled. The reads go straight to the wrapped repository.
+type BatchingPaymentsRepository struct {
+	*PaymentsRepository
+	maxBatchSize int
+	window       time.Duration
+	writes       chan batchedWrite
+	logger       *slog.Logger
+}
+
+var _ payments.Repository = (*BatchingPaymentsRepository)(nil)
+
+type batchedWrite struct {
+	// either payment or paymentUpdate is set
+	payment       *payments.Payment
+	paymentUpdate *payments.PaymentUpdate
+	result        chan werrors.WError
+}
+
+func NewBatchingPaymentsRepository(
+	repository *PaymentsRepository,
+	maxBatchSize int,
+	window time.Duration,
+	logger *slog.Logger,
+) *BatchingPaymentsRepository {
+	return &BatchingPaymentsRepository{
+		PaymentsRepository: repository,
+		maxBatchSize:       maxBatchSize,
+		window:             window,
+		writes:             make(chan batchedWrite),
+		logger:             logger,
+	}
+}
+
+// Run collects and applies the batches until the ctx is done
+func (b *BatchingPaymentsRepository) Run(ctx context.Context) {
+	var (
+		batch  []batchedWrite
+		timer  = time.NewTimer(b.window)
+		timerC <-chan time.Time
+	)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			for _, write := range batch {
+				write.result <- werrors.NewRetryableInternalError("payments repository stopped before applying the write")
+			}
+			return
+		case write := <-b.writes:
+			batch = append(batch, write)
+			if len(batch) == 1 {
+				timer.Reset(b.window)
+				timerC = timer.C
+			}
+			if len(batch) < b.maxBatchSize {
+				continue
+			}
+			timer.Stop()
+		case <-timerC:
+		}
+		b.applyBatch(ctx, batch)
+		batch = nil
+		timerC = nil
+	}
+}
+
+func (b *BatchingPaymentsRepository) SavePayment(ctx context.Context, payment payments.Payment) werrors.WError {
+	return b.enqueue(ctx, batchedWrite{payment: &payment})
+}
+
+func (b *BatchingPaymentsRepository) UpdatePayment(ctx context.Context, paymentUpdate payments.PaymentUpdate) werrors.WError {
+	if paymentUpdate.AggregateVersion == 0 {
+		return werrors.NewNonRetryableInternalError("aggregate version cannot be 0 for a payment update")
+	}
+	if paymentUpdate.Metadata.LastEventId == uuid.Nil {
+		// without the event id the outcome of the update can't be told apart in the batch
+		return b.PaymentsRepository.UpdatePayment(ctx, paymentUpdate)
+	}
+	return b.enqueue(ctx, batchedWrite{paymentUpdate: &paymentUpdate})
+}
+
+func (b *BatchingPaymentsRepository) enqueue(ctx context.Context, write batchedWrite) werrors.WError {
+	// buffered, so the batch is never blocked by a caller that gave up waiting
+	write.result = make(chan werrors.WError, 1)
+	select {
+	case b.writes <- write:
+	case <-ctx.Done():
+		return werrors.NewTimeoutError("payment write not batched: " + ctx.Err().Error())
+	}
+	select {
+	case werr := <-write.result:
+		return werr
+	case <-ctx.Done():
+		// the write may still be applied, the redelivered event will be recognized as such
+		return werrors.NewTimeoutError("payment write batched but not applied yet: " + ctx.Err().Error())
+	}
+}
+
+// applyBatch writes the batch and sends every caller its result. The batch is applied in
+// rounds holding at most one write per payment, so the outcome of each update can be
+// told from the payment it leaves behind, and the writes of a payment keep their order.
+func (b *BatchingPaymentsRepository) applyBatch(ctx context.Context, batch []batchedWrite) {
+	coll := b.collection()
+	results := make([]werrors.WError, len(batch))
+	for _, round := range batchRounds(batch) {
+		b.applyRound(ctx, coll, batch, round, results)
+	}
+	for i, write := range batch {
+		write.result <- results[i]
+	}
+}
+
+// batchRounds splits the indexes of the batch writes in rounds, the nth write
+// of a payment going to the nth round
+func batchRounds(batch []batchedWrite) [][]int {
+	var rounds [][]int
+	writesPerPayment := make(map[uuid.UUID]int, len(batch))
+	for i, write := range batch {
+		paymentId := write.paymentId()
+		round := writesPerPayment[paymentId]
+		writesPerPayment[paymentId] = round + 1
+		if round == len(rounds) {
+			rounds = append(rounds, nil)
+		}
+		rounds[round] = append(rounds[round], i)
+	}
+	return rounds
+}
+
+// applyRound writes a round of the batch, sets the results of its writes and
+// checks which of its updates matched their payment
+func (b *BatchingPaymentsRepository) applyRound(
+	ctx context.Context,
+	coll *mongo.Collection,
+	batch []batchedWrite,
+	round []int,
+	results []werrors.WError,
+) {
+	writes := make([]batchedWrite, 0, len(round))
+	for _, i := range round {
+		writes = append(writes, batch[i])
+	}
+	bulkWrite := func(ctx context.Context, models []mongo.WriteModel) error {
+		_, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(true))
+		return err
+	}
+	roundResults, executed := applyOrdered(ctx, writes, bulkWrite, b.logger)
+
+	var executedUpdates []int
+	for j, i := range round {
+		results[i] = roundResults[j]
+		if executed[j] && batch[i].paymentUpdate != nil {
+			executedUpdates = append(executedUpdates, i)
+		}
+	}
+	if len(executedUpdates) > 0 {
+		b.checkAppliedUpdates(ctx, coll, batch, executedUpdates, results)
+	}
+}
+
+// applyOrdered applies the writes with ordered bulk writes and returns the result of each
+// write and whether it was executed. A write error stops an ordered bulk write, so the
+// writes following the failed one are resubmitted; the index of the write error is
+// relative to the writes of the bulk write reporting it.
+func applyOrdered(
+	ctx context.Context,
+	writes []batchedWrite,
+	bulkWrite func(ctx context.Context, models []mongo.WriteModel) error,
+	logger *slog.Logger,
+) ([]werrors.WError, []bool) {
+	models := make([]mongo.WriteModel, 0, len(writes))
+	for _, write := range writes {
+		models = append(models, writeModel(write))
+	}
+
+	results := make([]werrors.WError, len(writes))
+	executed := make([]bool, len(writes))
+	for start := 0; start < len(writes); {
+		err := bulkWrite(ctx, models[start:])
+		failedIndex := len(writes)
+		if err != nil {
+			var bulkWriteException mongo.BulkWriteException
+			if !errors.As(err, &bulkWriteException) || len(bulkWriteException.WriteErrors) == 0 {
+				logger.Error("failed applying payments batch", logattr.Error(err.Error()))
+				for i := start; i < len(writes); i++ {
+					results[i] = werrors.NewRetryableInternalError("failed applying payments batch: %s", err.Error())
+				}
+				break
+			}
+			writeError := bulkWriteException.WriteErrors[0]
+			failedIndex = start + writeError.Index
+			results[failedIndex] = writeErrorResult(writes[failedIndex], writeError.WriteError)
+		}
+		for i := start; i < failedIndex; i++ {
+			executed[i] = true
+		}
+		start = failedIndex + 1
+	}
+	return results, executed
+}
+
+// checkAppliedUpdates finds out, with a single query, which of the updates executed by
+// the BulkWrite of a round matched their payment, every payment having at most one
+// write per round.
+func (b *BatchingPaymentsRepository) checkAppliedUpdates(
+	ctx context.Context,
+	coll *mongo.Collection,
+	batch []batchedWrite,
+	appliedUpdates []int,
+	results []werrors.WError,
+) {
+	ids := make([]uuid.UUID, 0, len(appliedUpdates))
+	for _, i := range appliedUpdates {
+		ids = append(ids, batch[i].paymentUpdate.PaymentId)
+	}
+	retrievedPayments, werr := findPayments(ctx, coll, ids)
+	if werr != nil {
+		b.logger.Error("failed checking payments batch", logattr.Error(werr.Message()))
+		for _, i := range appliedUpdates {
+			results[i] = werr
+		}
+		return
+	}
+	for _, i := range appliedUpdates {
+		paymentUpdate := *batch[i].paymentUpdate
+		retrievedPayment, found := retrievedPayments[paymentUpdate.PaymentId]
+		switch {
+		case !found:
+			results[i] = payments.NewPaymentNotCreatedError("payment %s not found", paymentUpdate.PaymentId)
+		case retrievedPayment.AggregateVersion == paymentUpdate.AggregateVersion &&
+			retrievedPayment.Metadata.LastEventId == paymentUpdate.Metadata.LastEventId:
+			// applied by this batch or by a previous delivery of the same event
+			results[i] = nil
+		default:
+			results[i] = versionError(paymentUpdate, retrievedPayment)
+		}
+	}
+}
+
+func findPayments(ctx context.Context, coll *mongo.Collection, ids []uuid.UUID) (map[uuid.UUID]PaymentBSON, werrors.WError) {
+	cursor, err := coll.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, werrors.NewRetryableInternalError("failed finding payments: %s", err.Error())
+	}
+	var paymentsBSON []PaymentBSON
+	if err := cursor.All(ctx, &paymentsBSON); err != nil {
+		return nil, werrors.NewRetryableInternalError("failed decoding payments: %s", err.Error())
+	}
+	retrievedPayments := make(map[uuid.UUID]PaymentBSON, len(paymentsBSON))
+	for _, paymentBSON := range paymentsBSON {
+		retrievedPayments[paymentBSON.ID] = paymentBSON
+	}
+	return retrievedPayments, nil
+}
+
+func (w batchedWrite) paymentId() uuid.UUID {
+	if w.payment != nil {
+		return w.payment.ID
+	}
+	return w.paymentUpdate.PaymentId
+}
+
+func writeModel(write batchedWrite) mongo.WriteModel {
+	if write.payment != nil {
+		return mongo.NewInsertOneModel().SetDocument(newPaymentBSON(*write.payment))
+	}
+	filter, update := paymentUpdateFilterAndSet(*write.paymentUpdate)
+	return mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(bson.M{"$set": update})
+}
+
+func writeErrorResult(write batchedWrite, writeError mongo.WriteError) werrors.WError {
+	if write.payment != nil {
+		if mongo.IsDuplicateKeyError(writeError) {
+			return werrors.NewResourceAlreadyExistError("payment %s already exists", write.payment.ID)
+		}
+		return werrors.NewRetryableInternalError("failed to save payment: %s", writeError.Error())
+	}
+	return werrors.NewRetryableInternalError("failed to update payment: %s", writeError.Error())
+}
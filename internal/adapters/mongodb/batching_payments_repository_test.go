@@ -0,0 +1,113 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const duplicateKeyErrorCode = 11000
+
+func newBatchedSave(paymentId uuid.UUID) batchedWrite {
+	return batchedWrite{payment: &payments.Payment{ID: paymentId}}
+}
+
+func newBatchedUpdate(paymentId uuid.UUID, version uint64) batchedWrite {
+	return batchedWrite{paymentUpdate: &payments.PaymentUpdate{
+		PaymentId:        paymentId,
+		AggregateVersion: version,
+		Status:           "confirmed",
+		Metadata:         payments.EventMetadata{LastEventId: uuid.New()},
+	}}
+}
+
+func TestBatchRoundsHoldAtMostOneWritePerPayment(t *testing.T) {
+	first, second := uuid.New(), uuid.New()
+	batch := []batchedWrite{
+		newBatchedSave(first),
+		newBatchedUpdate(first, 1),
+		newBatchedSave(second),
+		newBatchedUpdate(first, 2),
+		newBatchedUpdate(second, 1),
+	}
+
+	rounds := batchRounds(batch)
+
+	expectedRounds := [][]int{{0, 2}, {1, 4}, {3}}
+	if !reflect.DeepEqual(rounds, expectedRounds) {
+		t.Errorf("expected the rounds %v, but got %v", expectedRounds, rounds)
+	}
+}
+
+func TestApplyOrderedResubmitsTheWritesFollowingAFailedOne(t *testing.T) {
+	writes := []batchedWrite{
+		newBatchedSave(uuid.New()),
+		newBatchedSave(uuid.New()),
+		newBatchedUpdate(uuid.New(), 1),
+		newBatchedSave(uuid.New()),
+		newBatchedUpdate(uuid.New(), 1),
+	}
+	// the indexes of the write errors are relative to the submitted writes,
+	// so the failures are the writes 1 and 3 of the batch
+	failures := []int{1, 1}
+	var submitted []int
+	bulkWrite := func(ctx context.Context, models []mongo.WriteModel) error {
+		submitted = append(submitted, len(models))
+		if len(failures) == 0 {
+			return nil
+		}
+		index := failures[0]
+		failures = failures[1:]
+		return mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+			{WriteError: mongo.WriteError{Index: index, Code: duplicateKeyErrorCode, Message: "duplicate key"}},
+		}}
+	}
+
+	results, executed := applyOrdered(context.Background(), writes, bulkWrite, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if expectedSubmitted := []int{5, 3, 1}; !reflect.DeepEqual(submitted, expectedSubmitted) {
+		t.Errorf("expected bulk writes of %v writes, but got %v", expectedSubmitted, submitted)
+	}
+	if expectedExecuted := []bool{true, false, true, false, true}; !reflect.DeepEqual(executed, expectedExecuted) {
+		t.Errorf("expected the executed writes %v, but got %v", expectedExecuted, executed)
+	}
+	for i, result := range results {
+		failed := i == 1 || i == 3
+		if failed && (result == nil || result.Code() != werrors.ResourceAlreadyExistErrorCode) {
+			t.Errorf("expected the write %d to fail with a resource already exist error, but got %v", i, result)
+		}
+		if !failed && result != nil {
+			t.Errorf("expected the write %d to succeed, but got %s", i, result.Message())
+		}
+	}
+}
+
+func TestApplyOrderedFailsTheRemainingWritesOnABulkWriteError(t *testing.T) {
+	writes := []batchedWrite{
+		newBatchedSave(uuid.New()),
+		newBatchedUpdate(uuid.New(), 1),
+	}
+	bulkWrite := func(ctx context.Context, models []mongo.WriteModel) error {
+		return errors.New("connection reset")
+	}
+
+	results, executed := applyOrdered(context.Background(), writes, bulkWrite, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	for i := range writes {
+		if executed[i] {
+			t.Errorf("expected the write %d not to be executed", i)
+		}
+		if results[i] == nil || !results[i].IsRetryable() {
+			t.Errorf("expected the write %d to fail with a retryable error, but got %v", i, results[i])
+		}
+	}
+}
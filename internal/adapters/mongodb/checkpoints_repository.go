@@ -0,0 +1,166 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// globalCheckpointId keys the global checkpoint, the
+	// checkpoints of the payments are keyed by payment id
+	globalCheckpointId = "global"
+	// globalCheckpointFlushInterval is how often the global checkpoint is written
+	globalCheckpointFlushInterval = time.Second
+	globalCheckpointFlushTimeout  = 5 * time.Second
+)
+
+type CheckpointBSON struct {
+	ID             string    `bson:"_id"`
+	EventId        uuid.UUID `bson:"eventId"`
+	EventType      string    `bson:"eventType"`
+	EventCreatedAt time.Time `bson:"eventCreatedAt"`
+	AppliedAt      time.Time `bson:"appliedAt"`
+}
+
+// CheckpointsRepository writes the checkpoints conditionally, so a checkpoint never moves back to an
+// older event. The global checkpoint is kept in memory and written every second by Run, instead of on
+// every event applied, so it doesn't become a write hotspot for all the instances.
+type CheckpointsRepository struct {
+	client         *mongo.Client
+	dbName         string
+	collectionName string
+
+	mutex sync.Mutex
+	// pendingGlobal is the newest checkpoint not written as the global one yet
+	pendingGlobal   *payments.Checkpoint
+	globalWrittenAt time.Time
+}
+
+var _ payments.CheckpointsRepository = (*CheckpointsRepository)(nil)
+
+func NewCheckpointsRepository(client *mongo.Client, dbName string, collectionName string) *CheckpointsRepository {
+	return &CheckpointsRepository{client: client, dbName: dbName, collectionName: collectionName}
+}
+
+func (c *CheckpointsRepository) SaveCheckpoint(ctx context.Context, paymentId uuid.UUID, checkpoint payments.Checkpoint) werrors.WError {
+	werr := c.saveIfNewer(ctx, paymentId.String(), checkpoint)
+	if werr != nil {
+		return werr
+	}
+	c.mutex.Lock()
+	if c.pendingGlobal == nil || checkpoint.EventCreatedAt.After(c.pendingGlobal.EventCreatedAt) {
+		c.pendingGlobal = &checkpoint
+	}
+	due := time.Since(c.globalWrittenAt) >= globalCheckpointFlushInterval
+	c.mutex.Unlock()
+	if !due {
+		return nil
+	}
+	return c.flushGlobal(ctx)
+}
+
+// Run writes the global checkpoint kept in memory every second, and a last time once ctx is done
+func (c *CheckpointsRepository) Run(ctx context.Context, logger *slog.Logger) {
+	ticker := time.NewTicker(globalCheckpointFlushInterval)
+	defer ticker.Stop()
+	for {
+		var werr werrors.WError
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), globalCheckpointFlushTimeout)
+			werr = c.flushGlobal(flushCtx)
+			cancel()
+		case <-ticker.C:
+			werr = c.flushGlobal(ctx)
+		}
+		if werr != nil {
+			logger.Error("failed saving global checkpoint", logattr.Error(werr.Message()))
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (c *CheckpointsRepository) flushGlobal(ctx context.Context) werrors.WError {
+	c.mutex.Lock()
+	checkpoint := c.pendingGlobal
+	c.pendingGlobal = nil
+	c.globalWrittenAt = time.Now()
+	c.mutex.Unlock()
+	if checkpoint == nil {
+		return nil
+	}
+	werr := c.saveIfNewer(ctx, globalCheckpointId, *checkpoint)
+	if werr != nil {
+		// kept for the next flush, unless a newer checkpoint arrived meanwhile
+		c.mutex.Lock()
+		if c.pendingGlobal == nil {
+			c.pendingGlobal = checkpoint
+		}
+		c.mutex.Unlock()
+		return werr
+	}
+	return nil
+}
+
+// saveIfNewer replaces the checkpoint only if its event is newer than the one of the stored
+// checkpoint. When the stored one is newer, the upsert fails with a duplicate key, which is ignored.
+func (c *CheckpointsRepository) saveIfNewer(ctx context.Context, id string, checkpoint payments.Checkpoint) werrors.WError {
+	coll := c.client.Database(c.dbName).Collection(c.collectionName)
+	checkpointBSON := CheckpointBSON{
+		ID:             id,
+		EventId:        checkpoint.EventId,
+		EventType:      checkpoint.EventType,
+		EventCreatedAt: checkpoint.EventCreatedAt,
+		AppliedAt:      checkpoint.AppliedAt,
+	}
+	_, err := coll.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "eventCreatedAt": bson.M{"$lt": checkpoint.EventCreatedAt}},
+		bson.M{"$set": checkpointBSON},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return werrors.NewRetryableInternalError("failed saving checkpoint: %s", err.Error())
+	}
+	return nil
+}
+
+func (c *CheckpointsRepository) GetCheckpoint(ctx context.Context, paymentId uuid.UUID) (payments.Checkpoint, werrors.WError) {
+	return c.getCheckpoint(ctx, paymentId.String())
+}
+
+func (c *CheckpointsRepository) GetGlobalCheckpoint(ctx context.Context) (payments.Checkpoint, werrors.WError) {
+	return c.getCheckpoint(ctx, globalCheckpointId)
+}
+
+func (c *CheckpointsRepository) getCheckpoint(ctx context.Context, id string) (payments.Checkpoint, werrors.WError) {
+	coll := c.client.Database(c.dbName).Collection(c.collectionName)
+	var checkpointBSON CheckpointBSON
+	err := coll.FindOne(ctx, bson.M{"_id": id}).Decode(&checkpointBSON)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return payments.Checkpoint{}, werrors.NewResourceNotFoundError("checkpoint not found")
+		}
+		return payments.Checkpoint{}, werrors.NewRetryableInternalError("failed to find checkpoint: %s", err.Error())
+	}
+	return payments.Checkpoint{
+		EventId:        checkpointBSON.EventId,
+		EventType:      checkpointBSON.EventType,
+		EventCreatedAt: checkpointBSON.EventCreatedAt,
+		AppliedAt:      checkpointBSON.AppliedAt,
+	}, nil
+}
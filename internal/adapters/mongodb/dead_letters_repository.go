@@ -0,0 +1,129 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/deadletters"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type DeadLetterBSON struct {
+	ID            uuid.UUID `bson:"_id"`
+	EventType     string    `bson:"eventType"`
+	RawPayload    string    `bson:"rawPayload"`
+	ErrorCode     int       `bson:"errorCode"`
+	ErrorMessage  string    `bson:"errorMessage"`
+	Attempts      int       `bson:"attempts"`
+	FirstFailedAt time.Time `bson:"firstFailedAt"`
+	LastFailedAt  time.Time `bson:"lastFailedAt"`
+}
+
+type DeadLettersRepository struct {
+	client         *mongo.Client
+	dbName         string
+	collectionName string
+}
+
+var _ deadletters.Repository = (*DeadLettersRepository)(nil)
+
+func NewDeadLettersRepository(client *mongo.Client, dbName string, collectionName string) *DeadLettersRepository {
+	return &DeadLettersRepository{client: client, dbName: dbName, collectionName: collectionName}
+}
+
+func (d *DeadLettersRepository) SaveEntry(ctx context.Context, entry deadletters.Entry) werrors.WError {
+	coll := d.client.Database(d.dbName).Collection(d.collectionName)
+	_, err := coll.UpdateOne(
+		ctx,
+		bson.M{"_id": entry.ID},
+		bson.M{
+			"$setOnInsert": bson.M{
+				"eventType":     entry.EventType,
+				"rawPayload":    string(entry.RawPayload),
+				"firstFailedAt": entry.FirstFailedAt,
+			},
+			"$set": bson.M{
+				"errorCode":    int(entry.ErrorCode),
+				"errorMessage": entry.ErrorMessage,
+				"lastFailedAt": entry.LastFailedAt,
+			},
+			"$inc": bson.M{
+				"attempts": entry.Attempts,
+			},
+		},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if err != nil {
+		return werrors.NewRetryableInternalError("failed to save dead letter: %s", err.Error())
+	}
+	return nil
+}
+
+func (d *DeadLettersRepository) GetEntry(ctx context.Context, id uuid.UUID) (deadletters.Entry, werrors.WError) {
+	coll := d.client.Database(d.dbName).Collection(d.collectionName)
+	result := coll.FindOne(ctx, bson.M{"_id": id})
+	if err := result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return deadletters.Entry{}, werrors.NewResourceNotFoundError("dead letter not found")
+		}
+		return deadletters.Entry{}, werrors.NewRetryableInternalError("failed to find dead letter: %s", err.Error())
+	}
+	var deadLetterBSON DeadLetterBSON
+	if err := result.Decode(&deadLetterBSON); err != nil {
+		return deadletters.Entry{}, werrors.NewNonRetryableInternalError("failed to decode dead letter: %s", err.Error())
+	}
+	return deadLetterFromBSON(deadLetterBSON), nil
+}
+
+func (d *DeadLettersRepository) SearchEntries(ctx context.Context, filter deadletters.Filter) ([]deadletters.Entry, werrors.WError) {
+	bsonFilter := bson.M{}
+	if filter.EventType != "" {
+		bsonFilter["eventType"] = filter.EventType
+	}
+	if filter.ErrorCode != 0 {
+		bsonFilter["errorCode"] = int(filter.ErrorCode)
+	}
+	coll := d.client.Database(d.dbName).Collection(d.collectionName)
+	sort := bson.D{{Key: "lastFailedAt", Value: -1}, {Key: "_id", Value: 1}}
+	cursor, err := coll.Find(ctx, bsonFilter, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to find dead letters: %s", err.Error())
+	}
+	var deadLettersBSON []DeadLetterBSON
+	if err := cursor.All(ctx, &deadLettersBSON); err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to decode dead letters: %s", err.Error())
+	}
+	entries := make([]deadletters.Entry, 0, len(deadLettersBSON))
+	for _, deadLetterBSON := range deadLettersBSON {
+		entries = append(entries, deadLetterFromBSON(deadLetterBSON))
+	}
+	return entries, nil
+}
+
+func (d *DeadLettersRepository) DeleteEntry(ctx context.Context, id uuid.UUID) werrors.WError {
+	coll := d.client.Database(d.dbName).Collection(d.collectionName)
+	_, err := coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return werrors.NewRetryableInternalError("failed to delete dead letter: %s", err.Error())
+	}
+	return nil
+}
+
+func deadLetterFromBSON(deadLetterBSON DeadLetterBSON) deadletters.Entry {
+	return deadletters.Entry{
+		ID:            deadLetterBSON.ID,
+		EventType:     deadLetterBSON.EventType,
+		RawPayload:    []byte(deadLetterBSON.RawPayload),
+		ErrorCode:     werrors.ErrorCode(deadLetterBSON.ErrorCode),
+		ErrorMessage:  deadLetterBSON.ErrorMessage,
+		Attempts:      deadLetterBSON.Attempts,
+		FirstFailedAt: deadLetterBSON.FirstFailedAt,
+		LastFailedAt:  deadLetterBSON.LastFailedAt,
+	}
+}
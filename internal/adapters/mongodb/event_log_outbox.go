@@ -0,0 +1,82 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// EventLogOutbox is an outbox derived from the event log. The events are appended
+// with the outboxes they are pending in, by the same write, and the relay of each
+// outbox removes its name once the event is published.
+type EventLogOutbox struct {
+	client         *mongo.Client
+	dbName         string
+	collectionName string
+	name           string
+}
+
+var _ payments.EventsOutbox = (*EventLogOutbox)(nil)
+
+// NewEventLogOutbox returns the outbox holding the events of the event log
+// collection pending in the outbox with the given name
+func NewEventLogOutbox(client *mongo.Client, dbName string, collectionName string, name string) *EventLogOutbox {
+	return &EventLogOutbox{client: client, dbName: dbName, collectionName: collectionName, name: name}
+}
+
+// EnsureIndexes creates the index the pending events are found with
+func (o *EventLogOutbox) EnsureIndexes(ctx context.Context) error {
+	coll := o.client.Database(o.dbName).Collection(o.collectionName)
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "outboxes", Value: 1}, {Key: "loggedAt", Value: 1}, {Key: "_id", Value: 1}},
+	})
+	return err
+}
+
+func (o *EventLogOutbox) PendingEvents(ctx context.Context, limit int) ([]payments.LoggedEvent, werrors.WError) {
+	coll := o.client.Database(o.dbName).Collection(o.collectionName)
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: "loggedAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := coll.Find(ctx, bson.M{"outboxes": o.name}, findOpts)
+	if err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to find pending events: %s", err.Error())
+	}
+	var loggedEventsBSON []LoggedEventBSON
+	if err := cursor.All(ctx, &loggedEventsBSON); err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to decode pending events: %s", err.Error())
+	}
+	loggedEvents := make([]payments.LoggedEvent, 0, len(loggedEventsBSON))
+	for _, loggedEventBSON := range loggedEventsBSON {
+		loggedEvent, werr := loggedEventFromBSON(loggedEventBSON)
+		if werr != nil {
+			return nil, werr
+		}
+		loggedEvents = append(loggedEvents, loggedEvent)
+	}
+	return loggedEvents, nil
+}
+
+func (o *EventLogOutbox) MarkPublished(ctx context.Context, eventId uuid.UUID) werrors.WError {
+	coll := o.client.Database(o.dbName).Collection(o.collectionName)
+	_, err := coll.UpdateOne(
+		ctx,
+		bson.M{"_id": eventId},
+		bson.M{
+			"$pull": bson.M{"outboxes": o.name},
+			"$set":  bson.M{fmt.Sprintf("publishedAt.%s", o.name): time.Now()},
+		},
+	)
+	if err != nil {
+		return werrors.NewRetryableInternalError("failed marking event as published: %s", err.Error())
+	}
+	return nil
+}
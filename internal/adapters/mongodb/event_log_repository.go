@@ -0,0 +1,192 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// LoggedEventBSON stores the event data as a document, so
+// the event log can be queried like the payments collection
+type LoggedEventBSON struct {
+	ID               uuid.UUID                `bson:"_id"`
+	Type             string                   `bson:"type"`
+	AggregateVersion uint64                   `bson:"aggregateVersion"`
+	CorrelationId    string                   `bson:"correlationId"`
+	CreatedAt        time.Time                `bson:"createdAt"`
+	PaymentId        uuid.UUID                `bson:"paymentId"`
+	Data             bson.Raw                 `bson:"data"`
+	Status           privateapi.PaymentStatus `bson:"status,omitempty"`
+	ExternalId       privateapi.OptString     `bson:"externalId"`
+	LoggedAt         time.Time                `bson:"loggedAt"`
+	// Outboxes are the outboxes the event is pending in, see EventLogOutbox
+	Outboxes []string `bson:"outboxes,omitempty"`
+	// PublishedAt keeps when the event was published, by outbox
+	PublishedAt map[string]time.Time `bson:"publishedAt,omitempty"`
+}
+
+type EventLogRepository struct {
+	client         *mongo.Client
+	dbName         string
+	collectionName string
+	// outboxes are the outboxes the appended events are pending in
+	outboxes []string
+}
+
+var _ payments.EventLog = (*EventLogRepository)(nil)
+
+// NewEventLogRepository returns the event log keeping the appended events pending in the given outboxes
+func NewEventLogRepository(client *mongo.Client, dbName string, collectionName string, outboxes ...string) *EventLogRepository {
+	return &EventLogRepository{client: client, dbName: dbName, collectionName: collectionName, outboxes: outboxes}
+}
+
+// EnsureIndexes creates the indexes used to list the events of a payment and to iterate
+// the events in the order they were logged. The event id is the document _id, so it is already unique.
+func (e *EventLogRepository) EnsureIndexes(ctx context.Context) error {
+	coll := e.client.Database(e.dbName).Collection(e.collectionName)
+	_, err := coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "paymentId", Value: 1}, {Key: "aggregateVersion", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "loggedAt", Value: 1}, {Key: "_id", Value: 1}},
+		},
+	})
+	return err
+}
+
+func (e *EventLogRepository) AppendEvent(ctx context.Context, event payments.LoggedEvent) werrors.WError {
+	loggedEventBSON, werr := loggedEventToBSON(event)
+	if werr != nil {
+		return werr
+	}
+	// the event is kept in the outboxes by the same write that logs it
+	loggedEventBSON.Outboxes = e.outboxes
+	coll := e.client.Database(e.dbName).Collection(e.collectionName)
+	_, err := coll.InsertOne(ctx, loggedEventBSON)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil
+		}
+		return werrors.NewRetryableInternalError("failed appending event to the event log: %s", err.Error())
+	}
+	return nil
+}
+
+func (e *EventLogRepository) GetEvent(ctx context.Context, id uuid.UUID) (payments.LoggedEvent, werrors.WError) {
+	coll := e.client.Database(e.dbName).Collection(e.collectionName)
+	var loggedEventBSON LoggedEventBSON
+	err := coll.FindOne(ctx, bson.M{"_id": id}).Decode(&loggedEventBSON)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return payments.LoggedEvent{}, werrors.NewResourceNotFoundError("logged event %s not found", id)
+		}
+		return payments.LoggedEvent{}, werrors.NewRetryableInternalError("failed to find logged event: %s", err.Error())
+	}
+	return loggedEventFromBSON(loggedEventBSON)
+}
+
+func (e *EventLogRepository) ListPaymentEvents(ctx context.Context, paymentId uuid.UUID) ([]payments.LoggedEvent, werrors.WError) {
+	coll := e.client.Database(e.dbName).Collection(e.collectionName)
+	sort := bson.D{{Key: "aggregateVersion", Value: 1}, {Key: "loggedAt", Value: 1}}
+	cursor, err := coll.Find(ctx, bson.M{"paymentId": paymentId}, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to find payment events: %s", err.Error())
+	}
+	var loggedEventsBSON []LoggedEventBSON
+	if err := cursor.All(ctx, &loggedEventsBSON); err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to decode payment events: %s", err.Error())
+	}
+	loggedEvents := make([]payments.LoggedEvent, 0, len(loggedEventsBSON))
+	for _, loggedEventBSON := range loggedEventsBSON {
+		loggedEvent, werr := loggedEventFromBSON(loggedEventBSON)
+		if werr != nil {
+			return nil, werr
+		}
+		loggedEvents = append(loggedEvents, loggedEvent)
+	}
+	return loggedEvents, nil
+}
+
+func (e *EventLogRepository) IterateEvents(ctx context.Context, loggedFrom time.Time) (payments.LoggedEventsIterator, werrors.WError) {
+	coll := e.client.Database(e.dbName).Collection(e.collectionName)
+	sort := bson.D{{Key: "loggedAt", Value: 1}, {Key: "_id", Value: 1}}
+	cursor, err := coll.Find(ctx, bson.M{"loggedAt": bson.M{"$gte": loggedFrom}}, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to iterate logged events: %s", err.Error())
+	}
+	return &LoggedEventsIterator{ctx: ctx, cursor: cursor}, nil
+}
+
+type LoggedEventsIterator struct {
+	ctx    context.Context
+	cursor *mongo.Cursor
+}
+
+func (l *LoggedEventsIterator) Next() (bool, payments.LoggedEvent, error) {
+	if !l.cursor.Next(l.ctx) {
+		return false, payments.LoggedEvent{}, l.cursor.Err()
+	}
+	var loggedEventBSON LoggedEventBSON
+	if err := l.cursor.Decode(&loggedEventBSON); err != nil {
+		return false, payments.LoggedEvent{}, err
+	}
+	loggedEvent, werr := loggedEventFromBSON(loggedEventBSON)
+	if werr != nil {
+		return false, payments.LoggedEvent{}, werr
+	}
+	return true, loggedEvent, nil
+}
+
+func (l *LoggedEventsIterator) Close() error {
+	return l.cursor.Close(context.WithoutCancel(l.ctx))
+}
+
+func loggedEventToBSON(event payments.LoggedEvent) (LoggedEventBSON, werrors.WError) {
+	var data bson.Raw
+	err := bson.UnmarshalExtJSON(event.Data, false, &data)
+	if err != nil {
+		return LoggedEventBSON{}, werrors.NewNonRetryableInternalError("failed converting event data to bson: %s", err.Error())
+	}
+	return LoggedEventBSON{
+		ID:               event.ID,
+		Type:             event.Type,
+		AggregateVersion: event.AggregateVersion,
+		CorrelationId:    event.CorrelationId,
+		CreatedAt:        event.CreatedAt,
+		PaymentId:        event.PaymentId,
+		Data:             data,
+		Status:           event.Status,
+		ExternalId:       event.ExternalId,
+		LoggedAt:         time.Now(),
+	}, nil
+}
+
+func loggedEventFromBSON(loggedEventBSON LoggedEventBSON) (payments.LoggedEvent, werrors.WError) {
+	data, err := bson.MarshalExtJSON(loggedEventBSON.Data, false, false)
+	if err != nil {
+		return payments.LoggedEvent{}, werrors.NewNonRetryableInternalError("failed converting event data to json: %s", err.Error())
+	}
+	return payments.LoggedEvent{
+		ID:               loggedEventBSON.ID,
+		Type:             loggedEventBSON.Type,
+		AggregateVersion: loggedEventBSON.AggregateVersion,
+		CorrelationId:    loggedEventBSON.CorrelationId,
+		CreatedAt:        loggedEventBSON.CreatedAt,
+		PaymentId:        loggedEventBSON.PaymentId,
+		Data:             json.RawMessage(data),
+		Status:           loggedEventBSON.Status,
+		ExternalId:       loggedEventBSON.ExternalId,
+		LoggedAt:         loggedEventBSON.LoggedAt,
+	}, nil
+}
@@ -0,0 +1,100 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type HistoryEntryBSON struct {
+	PaymentId        uuid.UUID                `bson:"paymentId"`
+	AggregateVersion uint64                   `bson:"version"`
+	Status           privateapi.PaymentStatus `bson:"status"`
+	ExternalId       privateapi.OptString     `bson:"externalId"`
+	EventId          uuid.UUID                `bson:"eventId"`
+	EventType        string                   `bson:"eventType"`
+	EventCreatedAt   time.Time                `bson:"eventCreatedAt"`
+}
+
+type HistoryRepository struct {
+	client         *mongo.Client
+	dbName         string
+	collectionName string
+}
+
+var _ payments.HistoryRepository = (*HistoryRepository)(nil)
+
+func NewHistoryRepository(client *mongo.Client, dbName string, collectionName string) *HistoryRepository {
+	return &HistoryRepository{client: client, dbName: dbName, collectionName: collectionName}
+}
+
+// EnsureIndexes creates the unique index that keys the history entries by payment id and aggregate version
+func (h *HistoryRepository) EnsureIndexes(ctx context.Context) error {
+	coll := h.client.Database(h.dbName).Collection(h.collectionName)
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "paymentId", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (h *HistoryRepository) AppendHistoryEntry(ctx context.Context, entry payments.HistoryEntry) werrors.WError {
+	historyEntryBSON := HistoryEntryBSON{
+		PaymentId:        entry.PaymentId,
+		AggregateVersion: entry.AggregateVersion,
+		Status:           entry.Status,
+		ExternalId:       entry.ExternalId,
+		EventId:          entry.EventId,
+		EventType:        entry.EventType,
+		EventCreatedAt:   entry.EventCreatedAt,
+	}
+	coll := h.client.Database(h.dbName).Collection(h.collectionName)
+	_, err := coll.UpdateOne(
+		ctx,
+		bson.M{"paymentId": entry.PaymentId, "version": entry.AggregateVersion},
+		bson.M{"$setOnInsert": historyEntryBSON},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			// a concurrent upsert appended the same entry
+			return nil
+		}
+		return werrors.NewRetryableInternalError("failed appending payment history entry: %s", err.Error())
+	}
+	return nil
+}
+
+func (h *HistoryRepository) GetPaymentHistory(ctx context.Context, paymentId uuid.UUID) ([]payments.HistoryEntry, werrors.WError) {
+	coll := h.client.Database(h.dbName).Collection(h.collectionName)
+	sort := bson.D{{Key: "version", Value: 1}}
+	cursor, err := coll.Find(ctx, bson.M{"paymentId": paymentId}, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to find payment history: %s", err.Error())
+	}
+	var historyEntriesBSON []HistoryEntryBSON
+	if err := cursor.All(ctx, &historyEntriesBSON); err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to decode payment history: %s", err.Error())
+	}
+	history := make([]payments.HistoryEntry, 0, len(historyEntriesBSON))
+	for _, historyEntryBSON := range historyEntriesBSON {
+		history = append(history, payments.HistoryEntry{
+			PaymentId:        historyEntryBSON.PaymentId,
+			AggregateVersion: historyEntryBSON.AggregateVersion,
+			Status:           historyEntryBSON.Status,
+			ExternalId:       historyEntryBSON.ExternalId,
+			EventId:          historyEntryBSON.EventId,
+			EventType:        historyEntryBSON.EventType,
+			EventCreatedAt:   historyEntryBSON.EventCreatedAt,
+		})
+	}
+	return history, nil
+}
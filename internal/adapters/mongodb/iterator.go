@@ -25,10 +25,5 @@ func (m *Iterator) Next() (bool, payments.Payment, error) {
         return false, payments.Payment{}, err
     }
 
-    payment := payments.Payment{
-        ID:               paymentBSON.ID,
-        AggregateVersion: paymentBSON.AggregateVersion,
-        Data:             paymentBSON.Data,
-    }
-    return true, payment, nil
+    return true, paymentBSON.toPayment(), nil
 }
@@ -0,0 +1,64 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+
+	"github.com/walletera/werrors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Lease is a document of the leases collection, keyed by the lease name,
+// held by its owner until claimedUntil
+type Lease struct {
+	client         *mongo.Client
+	dbName         string
+	collectionName string
+	name           string
+}
+
+var _ payments.Lease = (*Lease)(nil)
+
+func NewLease(client *mongo.Client, dbName string, collectionName string, name string) *Lease {
+	return &Lease{client: client, dbName: dbName, collectionName: collectionName, name: name}
+}
+
+// Claim updates the lease document when it's expired or already held by owner. When
+// another owner holds it the filter doesn't match and the upsert fails on the lease name.
+func (l *Lease) Claim(ctx context.Context, owner string, duration time.Duration) (bool, werrors.WError) {
+	coll := l.client.Database(l.dbName).Collection(l.collectionName)
+	now := time.Now()
+	err := coll.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"_id": l.name,
+			"$or": bson.A{
+				bson.M{"owner": owner},
+				bson.M{"claimedUntil": bson.M{"$lt": now}},
+			},
+		},
+		bson.M{"$set": bson.M{"owner": owner, "claimedUntil": now.Add(duration)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Err()
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, werrors.NewRetryableInternalError(fmt.Sprintf("failed claiming lease %s: %s", l.name, err.Error()))
+	}
+	return true, nil
+}
+
+func (l *Lease) Release(ctx context.Context, owner string) werrors.WError {
+	coll := l.client.Database(l.dbName).Collection(l.collectionName)
+	_, err := coll.DeleteOne(ctx, bson.M{"_id": l.name, "owner": owner})
+	if err != nil {
+		return werrors.NewRetryableInternalError(fmt.Sprintf("failed releasing lease %s: %s", l.name, err.Error()))
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package mongodb
 import (
 	"context"
 	"errors"
+	"slices"
+	"time"
 
 	"github.com/walletera/payments-read-model/internal/domain/payments"
 
@@ -19,20 +21,73 @@ type PaymentBSON struct {
 	ID               uuid.UUID          `bson:"_id"`
 	AggregateVersion uint64             `bson:"version"`
 	Data             privateapi.Payment `bson:"data"`
+	Metadata         EventMetadataBSON  `bson:"metadata"`
+}
+
+type EventMetadataBSON struct {
+	LastEventId       uuid.UUID `bson:"lastEventId"`
+	LastCorrelationId string    `bson:"lastCorrelationId"`
+	LastEventAt       time.Time `bson:"lastEventAt"`
+}
+
+func newPaymentBSON(payment payments.Payment) PaymentBSON {
+	return PaymentBSON{
+		ID:               payment.ID,
+		AggregateVersion: payment.AggregateVersion,
+		Data:             payment.Data,
+		Metadata:         EventMetadataBSON(payment.Metadata),
+	}
+}
+
+func (p PaymentBSON) toPayment() payments.Payment {
+	return payments.Payment{
+		ID:               p.ID,
+		AggregateVersion: p.AggregateVersion,
+		Data:             p.Data,
+		Metadata:         payments.EventMetadata(p.Metadata),
+	}
 }
 
 type PaymentsRepository struct {
-	client         *mongo.Client
-	dbName         string
-	collectionName string
+	client           *mongo.Client
+	dbName           string
+	collectionName   string
+	activeCollection *ActiveCollection
 }
 
 func NewPaymentsRepository(client *mongo.Client, dbName string, collectionName string) *PaymentsRepository {
 	return &PaymentsRepository{client: client, dbName: dbName, collectionName: collectionName}
 }
 
+// NewActivePaymentsRepository returns a repository that follows
+// the switches of the active payments collection
+func NewActivePaymentsRepository(client *mongo.Client, dbName string, activeCollection *ActiveCollection) *PaymentsRepository {
+	return &PaymentsRepository{client: client, dbName: dbName, activeCollection: activeCollection}
+}
+
+func (p *PaymentsRepository) collection() *mongo.Collection {
+	collectionName := p.collectionName
+	if p.activeCollection != nil {
+		collectionName = p.activeCollection.Name()
+	}
+	return p.client.Database(p.dbName).Collection(collectionName)
+}
+
+// EnsureIndexes creates the indexes the payments are paged with in the current collection
+func (p *PaymentsRepository) EnsureIndexes(ctx context.Context) error {
+	return ensurePaymentsIndexes(ctx, p.collection())
+}
+
+func ensurePaymentsIndexes(ctx context.Context, coll *mongo.Collection) error {
+	_, err := coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "data.createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "data.customerId", Value: 1}, {Key: "data.createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+	})
+	return err
+}
+
 func (p *PaymentsRepository) GetPayment(ctx context.Context, id uuid.UUID) (payments.Payment, werrors.WError) {
-	coll := p.client.Database(p.dbName).Collection(p.collectionName)
+	coll := p.collection()
 	result := coll.FindOne(ctx, bson.M{"_id": id})
 	if err := result.Err(); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
@@ -46,20 +101,16 @@ func (p *PaymentsRepository) GetPayment(ctx context.Context, id uuid.UUID) (paym
 		return payments.Payment{}, werrors.NewNonRetryableInternalError("failed to decode payment: %s", err.Error())
 	}
 
-	return payments.Payment{
-		ID:               paymentBSON.ID,
-		AggregateVersion: paymentBSON.AggregateVersion,
-		Data:             paymentBSON.Data,
-	}, nil
+	return paymentBSON.toPayment(), nil
 }
 
 func (p *PaymentsRepository) SavePayment(ctx context.Context, payment payments.Payment) werrors.WError {
-	paymentBSON := PaymentBSON(payment)
-	coll := p.client.Database(p.dbName).Collection(p.collectionName)
+	paymentBSON := newPaymentBSON(payment)
+	coll := p.collection()
 	_, err := coll.InsertOne(ctx, paymentBSON)
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
-			return werrors.NewNonRetryableInternalError("duplicate key error: %s", err.Error())
+			return werrors.NewResourceAlreadyExistError("payment %s already exists", payment.ID)
 		}
 		return werrors.NewRetryableInternalError("failed to save payment: %s", err.Error())
 	}
@@ -71,6 +122,27 @@ func (p *PaymentsRepository) UpdatePayment(ctx context.Context, paymentUpdate pa
 		return werrors.NewNonRetryableInternalError("aggregate version cannot be 0 for a payment update")
 	}
 
+	filter, update := paymentUpdateFilterAndSet(paymentUpdate)
+	coll := p.collection()
+	updateResult, err := coll.UpdateOne(ctx, filter,
+		bson.M{
+			"$set": update,
+		})
+
+	if err != nil {
+		return werrors.NewRetryableInternalError("failed to update payment: %s", err.Error())
+	}
+
+	if updateResult.MatchedCount == 0 {
+		return checkVersion(ctx, coll, paymentUpdate)
+	}
+
+	return nil
+}
+
+// paymentUpdateFilterAndSet returns the filter matching the payment the update can be
+// applied to (previous version and allowed status) and the fields the update sets
+func paymentUpdateFilterAndSet(paymentUpdate payments.PaymentUpdate) (bson.M, bson.M) {
 	update := bson.M{
 		"version":     paymentUpdate.AggregateVersion,
 		"data.status": paymentUpdate.Status,
@@ -80,24 +152,23 @@ func (p *PaymentsRepository) UpdatePayment(ctx context.Context, paymentUpdate pa
 		update["data.externalId"] = paymentUpdate.ExternalId
 	}
 
-	coll := p.client.Database(p.dbName).Collection(p.collectionName)
-	updateResult, err := coll.UpdateOne(ctx, bson.M{
-		"_id":     paymentUpdate.PaymentId,
-		"version": paymentUpdate.AggregateVersion - 1,
-	},
-		bson.M{
-			"$set": update,
-		})
+	if !paymentUpdate.UpdatedAt.IsZero() {
+		update["data.updatedAt"] = paymentUpdate.UpdatedAt
+	}
 
-	if err != nil {
-		return werrors.NewRetryableInternalError("failed to update payment: %s", err.Error())
+	if paymentUpdate.Metadata.LastEventId != uuid.Nil {
+		update["metadata"] = EventMetadataBSON(paymentUpdate.Metadata)
 	}
 
-	if updateResult.MatchedCount == 0 {
-		return checkVersion(ctx, coll, paymentUpdate)
+	filter := bson.M{
+		"_id":     paymentUpdate.PaymentId,
+		"version": paymentUpdate.AggregateVersion - 1,
+	}
+	if len(paymentUpdate.AllowedPreviousStatuses) > 0 {
+		filter["data.status"] = bson.M{"$in": paymentUpdate.AllowedPreviousStatuses}
 	}
 
-	return nil
+	return filter, update
 }
 
 func checkVersion(ctx context.Context, coll *mongo.Collection, paymentUpdate payments.PaymentUpdate) werrors.WError {
@@ -108,6 +179,9 @@ func checkVersion(ctx context.Context, coll *mongo.Collection, paymentUpdate pay
 		},
 	)
 	if resultErr := result.Err(); resultErr != nil {
+		if errors.Is(resultErr, mongo.ErrNoDocuments) {
+			return payments.NewPaymentNotCreatedError("payment %s not found", paymentUpdate.PaymentId)
+		}
 		return werrors.NewRetryableInternalError("failed finding payment with id: %s", paymentUpdate.PaymentId)
 	}
 	var retrievedPayment PaymentBSON
@@ -115,15 +189,126 @@ func checkVersion(ctx context.Context, coll *mongo.Collection, paymentUpdate pay
 	if decodeErr != nil {
 		return werrors.NewNonRetryableInternalError("failed decoding mongodb result: %s", decodeErr.Error())
 	}
+	return versionError(paymentUpdate, retrievedPayment)
+}
+
+// versionError explains why the update didn't match the retrieved payment
+func versionError(paymentUpdate payments.PaymentUpdate, retrievedPayment PaymentBSON) werrors.WError {
 	expectedUpdateVersion := retrievedPayment.AggregateVersion + 1
+	if paymentUpdate.AggregateVersion == expectedUpdateVersion {
+		// the version matched, so the update was filtered out by the payment status
+		return payments.NewIllegalStatusTransitionError("payment %s can't move from %s to %s", paymentUpdate.PaymentId, retrievedPayment.Data.Status, paymentUpdate.Status)
+	}
 	if paymentUpdate.AggregateVersion < expectedUpdateVersion {
-		return werrors.NewNonRetryableInternalError("version mismatch: update version %d, expected version %d - sending event to dlq", expectedUpdateVersion, paymentUpdate.AggregateVersion)
-	} else { // paymentUpdate.AggregateVersion >= expectedUpdateVersion
-		return werrors.NewRetryableInternalError("gap detected between update version %d and expected version %d, retrying...", retrievedPayment.AggregateVersion, expectedUpdateVersion)
+		return payments.NewPaymentVersionMismatchError("update version %d, expected version %d", paymentUpdate.AggregateVersion, expectedUpdateVersion)
+	} else { // paymentUpdate.AggregateVersion > expectedUpdateVersion
+		return payments.NewPaymentVersionGapError("update version %d, expected version %d", paymentUpdate.AggregateVersion, expectedUpdateVersion)
 	}
 }
 
 func (p *PaymentsRepository) SearchPayments(ctx context.Context, listPaymentsParams publicapi.ListPaymentsParams) (payments.QueryResult, werrors.WError) {
+	filter := searchPaymentsFilter(listPaymentsParams)
+
+	coll := p.collection()
+
+	total, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return payments.QueryResult{}, werrors.NewRetryableInternalError("failed to count payments: %s", err.Error())
+	}
+
+	sort := bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}
+	findOpts := options.Find().SetSort(sort)
+
+	limit := int64(50)
+	if listPaymentsParams.Limit.IsSet() {
+		limit = int64(listPaymentsParams.Limit.Value)
+		findOpts.SetLimit(limit)
+	}
+
+	offset := int64(0)
+	if listPaymentsParams.Offset.IsSet() {
+		offset = int64(listPaymentsParams.Offset.Value)
+		findOpts.SetSkip(offset)
+	}
+
+	cursor, err := coll.Find(ctx, filter, findOpts)
+	if err != nil {
+		return payments.QueryResult{}, werrors.NewRetryableInternalError("failed to find payments: %s", err.Error())
+	}
+
+	iterator := &Iterator{cursor: cursor}
+	return payments.QueryResult{
+		Iterator: iterator,
+		Total:    uint64(total),
+	}, nil
+}
+
+// SearchPaymentsPage reads one more payment than the limit, in the direction of the
+// page, to find out whether there are more. The payments of a page before the cursor
+// are read from the oldest to the newest and reversed.
+func (p *PaymentsRepository) SearchPaymentsPage(
+	ctx context.Context,
+	listPaymentsParams publicapi.ListPaymentsParams,
+	pageRequest payments.PageRequest,
+) (payments.Page, werrors.WError) {
+	filter := searchPaymentsFilter(listPaymentsParams)
+	order := -1
+	switch {
+	case pageRequest.After != nil:
+		filter = bson.M{"$and": bson.A{filter, cursorFilter("$lt", *pageRequest.After)}}
+	case pageRequest.Before != nil:
+		filter = bson.M{"$and": bson.A{filter, cursorFilter("$gt", *pageRequest.Before)}}
+		order = 1
+	}
+
+	sort := bson.D{{Key: "data.createdAt", Value: order}, {Key: "_id", Value: order}}
+	findOpts := options.Find().SetSort(sort).SetLimit(int64(pageRequest.Limit + 1))
+	cursor, err := p.collection().Find(ctx, filter, findOpts)
+	if err != nil {
+		return payments.Page{}, werrors.NewRetryableInternalError("failed to find payments: %s", err.Error())
+	}
+	var paymentsBSON []PaymentBSON
+	if err := cursor.All(ctx, &paymentsBSON); err != nil {
+		return payments.Page{}, werrors.NewRetryableInternalError("failed to decode payments: %s", err.Error())
+	}
+
+	more := len(paymentsBSON) > pageRequest.Limit
+	if more {
+		paymentsBSON = paymentsBSON[:pageRequest.Limit]
+	}
+	page := payments.Page{Payments: make([]payments.Payment, 0, len(paymentsBSON))}
+	for _, paymentBSON := range paymentsBSON {
+		page.Payments = append(page.Payments, paymentBSON.toPayment())
+	}
+	if pageRequest.Before != nil {
+		slices.Reverse(page.Payments)
+	}
+	if len(page.Payments) == 0 {
+		return page, nil
+	}
+
+	first := pageCursorOf(page.Payments[0])
+	last := pageCursorOf(page.Payments[len(page.Payments)-1])
+	switch {
+	case pageRequest.Before != nil:
+		// the payment at the cursor is older than the page
+		page.Next = &last
+		if more {
+			page.Prev = &first
+		}
+	default:
+		if more {
+			page.Next = &last
+		}
+		if pageRequest.After != nil {
+			// the payment at the cursor is newer than the page
+			page.Prev = &first
+		}
+	}
+	return page, nil
+}
+
+func searchPaymentsFilter(listPaymentsParams publicapi.ListPaymentsParams) bson.M {
 	filter := bson.M{}
 
 	if listPaymentsParams.ID.IsSet() {
@@ -157,37 +342,18 @@ func (p *PaymentsRepository) SearchPayments(ctx context.Context, listPaymentsPar
 		}
 		filter["data.createdAt"] = dateFilter
 	}
+	return filter
+}
 
-	coll := p.client.Database(p.dbName).Collection(p.collectionName)
-
-	total, err := coll.CountDocuments(ctx, filter)
-	if err != nil {
-		return payments.QueryResult{}, werrors.NewRetryableInternalError("failed to count payments: %s", err.Error())
-	}
-
-	sort := bson.D{{"createdAt", -1}, {"_id", -1}}
-	findOpts := options.Find().SetSort(sort)
-
-	limit := int64(50)
-	if listPaymentsParams.Limit.IsSet() {
-		limit = int64(listPaymentsParams.Limit.Value)
-		findOpts.SetLimit(limit)
-	}
-
-	offset := int64(0)
-	if listPaymentsParams.Offset.IsSet() {
-		offset = int64(listPaymentsParams.Offset.Value)
-		findOpts.SetSkip(offset)
-	}
-
-	cursor, err := coll.Find(ctx, filter, findOpts)
-	if err != nil {
-		return payments.QueryResult{}, werrors.NewRetryableInternalError("failed to find payments: %s", err.Error())
-	}
+// cursorFilter matches the payments created before ($lt) or after ($gt) the cursor,
+// the ones created at the same time being ordered by id
+func cursorFilter(operator string, cursor payments.PageCursor) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"data.createdAt": bson.M{operator: cursor.CreatedAt}},
+		bson.M{"data.createdAt": cursor.CreatedAt, "_id": bson.M{operator: cursor.PaymentId}},
+	}}
+}
 
-	iterator := &Iterator{cursor: cursor}
-	return payments.QueryResult{
-		Iterator: iterator,
-		Total:    uint64(total),
-	}, nil
+func pageCursorOf(payment payments.Payment) payments.PageCursor {
+	return payments.PageCursor{CreatedAt: payment.Data.CreatedAt, PaymentId: payment.ID}
 }
@@ -0,0 +1,179 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type PendingUpdateBSON struct {
+	PaymentId        uuid.UUID                `bson:"paymentId"`
+	AggregateVersion uint64                   `bson:"version"`
+	ExternalId       privateapi.OptString     `bson:"externalId"`
+	Status           privateapi.PaymentStatus `bson:"status"`
+	UpdatedAt        time.Time                `bson:"updatedAt"`
+	Reason           string                   `bson:"reason"`
+	ParkedAt         time.Time                `bson:"parkedAt"`
+	Event            *LoggedEventBSON         `bson:"event,omitempty"`
+}
+
+type PendingUpdatesRepository struct {
+	client         *mongo.Client
+	dbName         string
+	collectionName string
+}
+
+var _ payments.PendingUpdatesRepository = (*PendingUpdatesRepository)(nil)
+
+func NewPendingUpdatesRepository(client *mongo.Client, dbName string, collectionName string) *PendingUpdatesRepository {
+	return &PendingUpdatesRepository{client: client, dbName: dbName, collectionName: collectionName}
+}
+
+// EnsureIndexes creates the unique index that keys the pending updates by payment id and aggregate version
+func (p *PendingUpdatesRepository) EnsureIndexes(ctx context.Context) error {
+	coll := p.client.Database(p.dbName).Collection(p.collectionName)
+	_, err := coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "paymentId", Value: 1}, {Key: "version", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "parkedAt", Value: 1}},
+		},
+	})
+	return err
+}
+
+func (p *PendingUpdatesRepository) ParkUpdate(ctx context.Context, pendingUpdate payments.PendingUpdate) werrors.WError {
+	pendingUpdateBSON := PendingUpdateBSON{
+		PaymentId:        pendingUpdate.Update.PaymentId,
+		AggregateVersion: pendingUpdate.Update.AggregateVersion,
+		ExternalId:       pendingUpdate.Update.ExternalId,
+		Status:           pendingUpdate.Update.Status,
+		UpdatedAt:        pendingUpdate.Update.UpdatedAt,
+		Reason:           string(pendingUpdate.Reason),
+		ParkedAt:         pendingUpdate.ParkedAt,
+	}
+	if pendingUpdate.Event.ID != uuid.Nil {
+		loggedEventBSON, werr := loggedEventToBSON(pendingUpdate.Event)
+		if werr != nil {
+			return werr
+		}
+		pendingUpdateBSON.Event = &loggedEventBSON
+	}
+	coll := p.client.Database(p.dbName).Collection(p.collectionName)
+	_, err := coll.UpdateOne(
+		ctx,
+		pendingUpdateFilter(pendingUpdate.Update.PaymentId, pendingUpdate.Update.AggregateVersion),
+		bson.M{"$setOnInsert": pendingUpdateBSON},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			// a concurrent upsert parked the same update
+			return nil
+		}
+		return werrors.NewRetryableInternalError("failed parking payment update: %s", err.Error())
+	}
+	return nil
+}
+
+func (p *PendingUpdatesRepository) FindPendingUpdate(ctx context.Context, paymentId uuid.UUID, aggregateVersion uint64) (payments.PendingUpdate, werrors.WError) {
+	coll := p.client.Database(p.dbName).Collection(p.collectionName)
+	result := coll.FindOne(ctx, pendingUpdateFilter(paymentId, aggregateVersion))
+	if err := result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return payments.PendingUpdate{}, werrors.NewResourceNotFoundError("pending update not found")
+		}
+		return payments.PendingUpdate{}, werrors.NewRetryableInternalError("failed to find pending update: %s", err.Error())
+	}
+	var pendingUpdateBSON PendingUpdateBSON
+	if err := result.Decode(&pendingUpdateBSON); err != nil {
+		return payments.PendingUpdate{}, werrors.NewNonRetryableInternalError("failed to decode pending update: %s", err.Error())
+	}
+	return pendingUpdateFromBSON(pendingUpdateBSON)
+}
+
+func (p *PendingUpdatesRepository) DeletePendingUpdate(ctx context.Context, paymentId uuid.UUID, aggregateVersion uint64) werrors.WError {
+	coll := p.client.Database(p.dbName).Collection(p.collectionName)
+	_, err := coll.DeleteOne(ctx, pendingUpdateFilter(paymentId, aggregateVersion))
+	if err != nil {
+		return werrors.NewRetryableInternalError("failed to delete pending update: %s", err.Error())
+	}
+	return nil
+}
+
+func (p *PendingUpdatesRepository) FindPendingUpdatesParkedBefore(ctx context.Context, parkedBefore time.Time) ([]payments.PendingUpdate, werrors.WError) {
+	return p.findPendingUpdates(ctx, bson.M{"parkedAt": bson.M{"$lt": parkedBefore}})
+}
+
+func (p *PendingUpdatesRepository) SearchPendingUpdates(ctx context.Context, filter payments.PendingUpdatesFilter) ([]payments.PendingUpdate, werrors.WError) {
+	bsonFilter := bson.M{}
+	if filter.PaymentId != uuid.Nil {
+		bsonFilter["paymentId"] = filter.PaymentId
+	}
+	if filter.Reason != "" {
+		bsonFilter["reason"] = string(filter.Reason)
+	}
+	return p.findPendingUpdates(ctx, bsonFilter)
+}
+
+func (p *PendingUpdatesRepository) findPendingUpdates(ctx context.Context, filter bson.M) ([]payments.PendingUpdate, werrors.WError) {
+	coll := p.client.Database(p.dbName).Collection(p.collectionName)
+	sort := bson.D{{Key: "paymentId", Value: 1}, {Key: "version", Value: 1}}
+	cursor, err := coll.Find(ctx, filter, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to find pending updates: %s", err.Error())
+	}
+	var pendingUpdatesBSON []PendingUpdateBSON
+	if err := cursor.All(ctx, &pendingUpdatesBSON); err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to decode pending updates: %s", err.Error())
+	}
+	pendingUpdates := make([]payments.PendingUpdate, 0, len(pendingUpdatesBSON))
+	for _, pendingUpdateBSON := range pendingUpdatesBSON {
+		pendingUpdate, werr := pendingUpdateFromBSON(pendingUpdateBSON)
+		if werr != nil {
+			return nil, werr
+		}
+		pendingUpdates = append(pendingUpdates, pendingUpdate)
+	}
+	return pendingUpdates, nil
+}
+
+func pendingUpdateFilter(paymentId uuid.UUID, aggregateVersion uint64) bson.M {
+	return bson.M{
+		"paymentId": paymentId,
+		"version":   aggregateVersion,
+	}
+}
+
+func pendingUpdateFromBSON(pendingUpdateBSON PendingUpdateBSON) (payments.PendingUpdate, werrors.WError) {
+	pendingUpdate := payments.PendingUpdate{
+		Update: payments.PaymentUpdate{
+			PaymentId:        pendingUpdateBSON.PaymentId,
+			AggregateVersion: pendingUpdateBSON.AggregateVersion,
+			ExternalId:       pendingUpdateBSON.ExternalId,
+			Status:           pendingUpdateBSON.Status,
+			UpdatedAt:        pendingUpdateBSON.UpdatedAt,
+		},
+		Reason:   payments.PendingReason(pendingUpdateBSON.Reason),
+		ParkedAt: pendingUpdateBSON.ParkedAt,
+	}
+	if pendingUpdateBSON.Event != nil {
+		loggedEvent, werr := loggedEventFromBSON(*pendingUpdateBSON.Event)
+		if werr != nil {
+			return payments.PendingUpdate{}, werr
+		}
+		pendingUpdate.Event = loggedEvent
+	}
+	return pendingUpdate, nil
+}
@@ -0,0 +1,151 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/walletera/payments-read-model/internal/domain/rebuild"
+
+	"github.com/google/uuid"
+	paymentsevents "github.com/walletera/payments-types/events"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type paymentSummaryBSON struct {
+	ID               uuid.UUID `bson:"_id"`
+	AggregateVersion uint64    `bson:"version"`
+	Data             struct {
+		Status     privateapi.PaymentStatus `bson:"status"`
+		ExternalId privateapi.OptString     `bson:"externalId"`
+	} `bson:"data"`
+}
+
+type ProjectionsRepository struct {
+	client                 *mongo.Client
+	dbName                 string
+	eventLogCollectionName string
+	activeCollection       *ActiveCollection
+}
+
+var _ rebuild.Projections = (*ProjectionsRepository)(nil)
+
+func NewProjectionsRepository(
+	client *mongo.Client,
+	dbName string,
+	eventLogCollectionName string,
+	activeCollection *ActiveCollection,
+) *ProjectionsRepository {
+	return &ProjectionsRepository{
+		client:                 client,
+		dbName:                 dbName,
+		eventLogCollectionName: eventLogCollectionName,
+		activeCollection:       activeCollection,
+	}
+}
+
+func (p *ProjectionsRepository) ActiveCollection() string {
+	return p.activeCollection.Name()
+}
+
+// CreateCollection creates the collection along with the indexes of the payments
+func (p *ProjectionsRepository) CreateCollection(ctx context.Context, collection string) werrors.WError {
+	err := ensurePaymentsIndexes(ctx, p.client.Database(p.dbName).Collection(collection))
+	if err != nil {
+		return werrors.NewRetryableInternalError(fmt.Sprintf("failed creating the indexes of collection %s: %s", collection, err.Error()))
+	}
+	return nil
+}
+
+func (p *ProjectionsRepository) SwitchActiveCollection(ctx context.Context, from string, to string) werrors.WError {
+	return p.activeCollection.Switch(ctx, from, to)
+}
+
+func (p *ProjectionsRepository) SwitchAcknowledged(ctx context.Context, collection string) (bool, werrors.WError) {
+	return p.activeCollection.SwitchAcknowledged(ctx, collection)
+}
+
+// CountPaymentsMissingFromLog looks up the PaymentCreated event of every payment in the event log
+func (p *ProjectionsRepository) CountPaymentsMissingFromLog(ctx context.Context, collection string) (int64, werrors.WError) {
+	coll := p.client.Database(p.dbName).Collection(collection)
+	pipeline := mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{
+			"from": p.eventLogCollectionName,
+			"let":  bson.M{"paymentId": "$_id"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{
+					bson.M{"$eq": bson.A{"$paymentId", "$$paymentId"}},
+					bson.M{"$eq": bson.A{"$type", paymentsevents.PaymentCreatedType}},
+				}}}},
+				bson.M{"$limit": 1},
+				bson.M{"$project": bson.M{"_id": 1}},
+			},
+			"as": "created",
+		}}},
+		{{Key: "$match", Value: bson.M{"created": bson.M{"$size": 0}}}},
+		{{Key: "$count", Value: "missing"}},
+	}
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, werrors.NewRetryableInternalError("failed looking up the payments in the event log: %s", err.Error())
+	}
+	var results []struct {
+		Missing int64 `bson:"missing"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return 0, werrors.NewRetryableInternalError("failed decoding the payments missing from the event log: %s", err.Error())
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return results[0].Missing, nil
+}
+
+// Summaries hashes the id, version, status and externalId of every payment
+func (p *ProjectionsRepository) Summaries(ctx context.Context, collection string) (map[uuid.UUID]rebuild.PaymentSummary, werrors.WError) {
+	coll := p.client.Database(p.dbName).Collection(collection)
+	projection := bson.M{"_id": 1, "version": 1, "data.status": 1, "data.externalId": 1}
+	cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, werrors.NewRetryableInternalError(fmt.Sprintf("failed to find payments: %s", err.Error()))
+	}
+	defer cursor.Close(ctx)
+
+	summaries := make(map[uuid.UUID]rebuild.PaymentSummary)
+	for cursor.Next(ctx) {
+		var payment paymentSummaryBSON
+		if err := cursor.Decode(&payment); err != nil {
+			return nil, werrors.NewNonRetryableInternalError(fmt.Sprintf("failed to decode payment: %s", err.Error()))
+		}
+		hash := fnv.New64a()
+		_, _ = fmt.Fprintf(
+			hash,
+			"%s|%d|%s|%t|%s",
+			payment.ID,
+			payment.AggregateVersion,
+			payment.Data.Status,
+			payment.Data.ExternalId.Set,
+			payment.Data.ExternalId.Value,
+		)
+		summaries[payment.ID] = rebuild.PaymentSummary{
+			AggregateVersion: payment.AggregateVersion,
+			Checksum:         hash.Sum64(),
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, werrors.NewRetryableInternalError(fmt.Sprintf("failed iterating payments: %s", err.Error()))
+	}
+	return summaries, nil
+}
+
+func (p *ProjectionsRepository) DropCollection(ctx context.Context, collection string) werrors.WError {
+	err := p.client.Database(p.dbName).Collection(collection).Drop(ctx)
+	if err != nil {
+		return werrors.NewRetryableInternalError("failed dropping collection %s: %s", collection, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/rebuild"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type RebuildBSON struct {
+	ID                 uuid.UUID `bson:"_id"`
+	Status             string    `bson:"status"`
+	PreviousCollection string    `bson:"previousCollection"`
+	ShadowCollection   string    `bson:"shadowCollection"`
+	ReplayedEvents     int       `bson:"replayedEvents"`
+	CatchUpRounds      int       `bson:"catchUpRounds"`
+	StartedAt          time.Time `bson:"startedAt"`
+	SwitchedAt         time.Time `bson:"switchedAt,omitempty"`
+	FinishedAt         time.Time `bson:"finishedAt,omitempty"`
+	UpdatedAt          time.Time `bson:"updatedAt"`
+	Error              string    `bson:"error,omitempty"`
+}
+
+type RebuildsRepository struct {
+	client         *mongo.Client
+	dbName         string
+	collectionName string
+}
+
+var _ rebuild.Repository = (*RebuildsRepository)(nil)
+
+func NewRebuildsRepository(client *mongo.Client, dbName string, collectionName string) *RebuildsRepository {
+	return &RebuildsRepository{client: client, dbName: dbName, collectionName: collectionName}
+}
+
+// EnsureIndexes creates the partial unique index allowing a single running rebuild
+func (r *RebuildsRepository) EnsureIndexes(ctx context.Context) error {
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"status": string(rebuild.StatusRunning)}),
+	})
+	return err
+}
+
+func (r *RebuildsRepository) InsertRebuild(ctx context.Context, rb rebuild.Rebuild) werrors.WError {
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	_, err := coll.InsertOne(ctx, rebuildToBSON(rb))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return werrors.NewResourceAlreadyExistError("a projection rebuild is already running")
+		}
+		return werrors.NewRetryableInternalError("failed inserting rebuild: %s", err.Error())
+	}
+	return nil
+}
+
+func (r *RebuildsRepository) UpdateRebuild(ctx context.Context, rb rebuild.Rebuild) werrors.WError {
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	_, err := coll.ReplaceOne(ctx, bson.M{"_id": rb.ID}, rebuildToBSON(rb))
+	if err != nil {
+		return werrors.NewRetryableInternalError("failed updating rebuild: %s", err.Error())
+	}
+	return nil
+}
+
+func (r *RebuildsRepository) GetRebuild(ctx context.Context, id uuid.UUID) (rebuild.Rebuild, werrors.WError) {
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	var rebuildBSON RebuildBSON
+	err := coll.FindOne(ctx, bson.M{"_id": id}).Decode(&rebuildBSON)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return rebuild.Rebuild{}, werrors.NewResourceNotFoundError("rebuild %s not found", id)
+		}
+		return rebuild.Rebuild{}, werrors.NewRetryableInternalError("failed to find rebuild: %s", err.Error())
+	}
+	return rebuild.Rebuild{
+		ID:                 rebuildBSON.ID,
+		Status:             rebuild.Status(rebuildBSON.Status),
+		PreviousCollection: rebuildBSON.PreviousCollection,
+		ShadowCollection:   rebuildBSON.ShadowCollection,
+		ReplayedEvents:     rebuildBSON.ReplayedEvents,
+		CatchUpRounds:      rebuildBSON.CatchUpRounds,
+		StartedAt:          rebuildBSON.StartedAt,
+		SwitchedAt:         rebuildBSON.SwitchedAt,
+		FinishedAt:         rebuildBSON.FinishedAt,
+		UpdatedAt:          rebuildBSON.UpdatedAt,
+		Error:              rebuildBSON.Error,
+	}, nil
+}
+
+func (r *RebuildsRepository) FailStaleRebuilds(ctx context.Context, updatedBefore time.Time) werrors.WError {
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	now := time.Now()
+	_, err := coll.UpdateMany(
+		ctx,
+		bson.M{"status": string(rebuild.StatusRunning), "updatedAt": bson.M{"$lt": updatedBefore}},
+		bson.M{"$set": bson.M{
+			"status":     string(rebuild.StatusFailed),
+			"error":      "rebuild abandoned by the instance running it",
+			"finishedAt": now,
+			"updatedAt":  now,
+		}},
+	)
+	if err != nil {
+		return werrors.NewRetryableInternalError("failed failing stale rebuilds: %s", err.Error())
+	}
+	return nil
+}
+
+func rebuildToBSON(rb rebuild.Rebuild) RebuildBSON {
+	return RebuildBSON{
+		ID:                 rb.ID,
+		Status:             string(rb.Status),
+		PreviousCollection: rb.PreviousCollection,
+		ShadowCollection:   rb.ShadowCollection,
+		ReplayedEvents:     rb.ReplayedEvents,
+		CatchUpRounds:      rb.CatchUpRounds,
+		StartedAt:          rb.StartedAt,
+		SwitchedAt:         rb.SwitchedAt,
+		FinishedAt:         rb.FinishedAt,
+		UpdatedAt:          rb.UpdatedAt,
+		Error:              rb.Error,
+	}
+}
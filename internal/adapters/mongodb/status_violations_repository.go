@@ -0,0 +1,85 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type StatusViolationBSON struct {
+	EventId          uuid.UUID                `bson:"_id"`
+	PaymentId        uuid.UUID                `bson:"paymentId"`
+	AggregateVersion uint64                   `bson:"version"`
+	From             privateapi.PaymentStatus `bson:"from"`
+	To               privateapi.PaymentStatus `bson:"to"`
+	Action           string                   `bson:"action"`
+	DetectedAt       time.Time                `bson:"detectedAt"`
+}
+
+type StatusViolationsRepository struct {
+	client         *mongo.Client
+	dbName         string
+	collectionName string
+}
+
+var _ payments.StatusViolationsRepository = (*StatusViolationsRepository)(nil)
+
+func NewStatusViolationsRepository(client *mongo.Client, dbName string, collectionName string) *StatusViolationsRepository {
+	return &StatusViolationsRepository{client: client, dbName: dbName, collectionName: collectionName}
+}
+
+func (s *StatusViolationsRepository) RecordViolation(ctx context.Context, violation payments.StatusViolation) werrors.WError {
+	statusViolationBSON := StatusViolationBSON{
+		EventId:          violation.EventId,
+		PaymentId:        violation.PaymentId,
+		AggregateVersion: violation.AggregateVersion,
+		From:             violation.From,
+		To:               violation.To,
+		Action:           string(violation.Action),
+		DetectedAt:       violation.DetectedAt,
+	}
+	coll := s.client.Database(s.dbName).Collection(s.collectionName)
+	_, err := coll.ReplaceOne(ctx, bson.M{"_id": violation.EventId}, statusViolationBSON, options.Replace().SetUpsert(true))
+	if err != nil {
+		return werrors.NewRetryableInternalError("failed recording status violation: %s", err.Error())
+	}
+	return nil
+}
+
+func (s *StatusViolationsRepository) SearchViolations(ctx context.Context, paymentId uuid.UUID) ([]payments.StatusViolation, werrors.WError) {
+	filter := bson.M{}
+	if paymentId != uuid.Nil {
+		filter["paymentId"] = paymentId
+	}
+	coll := s.client.Database(s.dbName).Collection(s.collectionName)
+	sort := bson.D{{Key: "detectedAt", Value: -1}}
+	cursor, err := coll.Find(ctx, filter, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to find status violations: %s", err.Error())
+	}
+	var statusViolationsBSON []StatusViolationBSON
+	if err := cursor.All(ctx, &statusViolationsBSON); err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to decode status violations: %s", err.Error())
+	}
+	violations := make([]payments.StatusViolation, 0, len(statusViolationsBSON))
+	for _, statusViolationBSON := range statusViolationsBSON {
+		violations = append(violations, payments.StatusViolation{
+			EventId:          statusViolationBSON.EventId,
+			PaymentId:        statusViolationBSON.PaymentId,
+			AggregateVersion: statusViolationBSON.AggregateVersion,
+			From:             statusViolationBSON.From,
+			To:               statusViolationBSON.To,
+			Action:           payments.StatusTransitionPolicy(statusViolationBSON.Action),
+			DetectedAt:       statusViolationBSON.DetectedAt,
+		})
+	}
+	return violations, nil
+}
@@ -0,0 +1,239 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/webhooks"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type WebhookDeliveryBSON struct {
+	ID             uuid.UUID                    `bson:"_id"`
+	SubscriptionId uuid.UUID                    `bson:"subscriptionId"`
+	CustomerId     uuid.UUID                    `bson:"customerId"`
+	PaymentId      uuid.UUID                    `bson:"paymentId"`
+	EventId        uuid.UUID                    `bson:"eventId"`
+	URL            string                       `bson:"url"`
+	Payload        string                       `bson:"payload"`
+	State          string                       `bson:"state"`
+	Attempts       []WebhookDeliveryAttemptBSON `bson:"attempts"`
+	NextAttemptAt  time.Time                    `bson:"nextAttemptAt"`
+	CreatedAt      time.Time                    `bson:"createdAt"`
+	UpdatedAt      time.Time                    `bson:"updatedAt"`
+}
+
+type WebhookDeliveryAttemptBSON struct {
+	AttemptedAt time.Time `bson:"attemptedAt"`
+	DurationMs  int64     `bson:"durationMs"`
+	StatusCode  int       `bson:"statusCode"`
+	Error       string    `bson:"error,omitempty"`
+}
+
+type WebhookDeliveriesRepository struct {
+	client         *mongo.Client
+	dbName         string
+	collectionName string
+}
+
+var _ webhooks.DeliveriesRepository = (*WebhookDeliveriesRepository)(nil)
+
+func NewWebhookDeliveriesRepository(client *mongo.Client, dbName string, collectionName string) *WebhookDeliveriesRepository {
+	return &WebhookDeliveriesRepository{client: client, dbName: dbName, collectionName: collectionName}
+}
+
+// EnsureIndexes creates the index the due deliveries are claimed with and the ones used to list the deliveries
+func (r *WebhookDeliveriesRepository) EnsureIndexes(ctx context.Context) error {
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	_, err := coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "state", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+		{Keys: bson.D{{Key: "subscriptionId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "paymentId", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	return err
+}
+
+func (r *WebhookDeliveriesRepository) AddDelivery(ctx context.Context, delivery webhooks.Delivery) werrors.WError {
+	deliveryBSON := WebhookDeliveryBSON{
+		ID:             delivery.ID,
+		SubscriptionId: delivery.SubscriptionId,
+		CustomerId:     delivery.CustomerId,
+		PaymentId:      delivery.PaymentId,
+		EventId:        delivery.EventId,
+		URL:            delivery.URL,
+		Payload:        string(delivery.Payload),
+		State:          string(delivery.State),
+		Attempts:       []WebhookDeliveryAttemptBSON{},
+		NextAttemptAt:  delivery.NextAttemptAt,
+		CreatedAt:      delivery.CreatedAt,
+		UpdatedAt:      delivery.UpdatedAt,
+	}
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	_, err := coll.UpdateOne(
+		ctx,
+		bson.M{"_id": delivery.ID},
+		bson.M{"$setOnInsert": deliveryBSON},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			// a concurrent upsert added the same delivery
+			return nil
+		}
+		return werrors.NewRetryableInternalError("failed to add webhook delivery: %s", err.Error())
+	}
+	return nil
+}
+
+func (r *WebhookDeliveriesRepository) GetDelivery(ctx context.Context, id uuid.UUID) (webhooks.Delivery, werrors.WError) {
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	result := coll.FindOne(ctx, bson.M{"_id": id})
+	return decodeWebhookDelivery(result)
+}
+
+func (r *WebhookDeliveriesRepository) SearchDeliveries(ctx context.Context, filter webhooks.DeliveriesFilter) ([]webhooks.Delivery, werrors.WError) {
+	bsonFilter := bson.M{}
+	if filter.SubscriptionId != uuid.Nil {
+		bsonFilter["subscriptionId"] = filter.SubscriptionId
+	}
+	if filter.PaymentId != uuid.Nil {
+		bsonFilter["paymentId"] = filter.PaymentId
+	}
+	if filter.State != "" {
+		bsonFilter["state"] = string(filter.State)
+	}
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	sort := bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: 1}}
+	cursor, err := coll.Find(ctx, bsonFilter, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to find webhook deliveries: %s", err.Error())
+	}
+	var deliveriesBSON []WebhookDeliveryBSON
+	if err := cursor.All(ctx, &deliveriesBSON); err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to decode webhook deliveries: %s", err.Error())
+	}
+	deliveries := make([]webhooks.Delivery, 0, len(deliveriesBSON))
+	for _, deliveryBSON := range deliveriesBSON {
+		deliveries = append(deliveries, webhookDeliveryFromBSON(deliveryBSON))
+	}
+	return deliveries, nil
+}
+
+func (r *WebhookDeliveriesRepository) ClaimDueDelivery(
+	ctx context.Context,
+	now time.Time,
+	lease time.Duration,
+	excludedSubscriptions []uuid.UUID,
+) (webhooks.Delivery, werrors.WError) {
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	filter := bson.M{
+		"state":         string(webhooks.DeliveryStatePending),
+		"nextAttemptAt": bson.M{"$lte": now},
+	}
+	if len(excludedSubscriptions) > 0 {
+		filter["subscriptionId"] = bson.M{"$nin": excludedSubscriptions}
+	}
+	result := coll.FindOneAndUpdate(
+		ctx,
+		filter,
+		bson.M{"$set": bson.M{"nextAttemptAt": now.Add(lease)}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).
+			SetReturnDocument(options.Before),
+	)
+	return decodeWebhookDelivery(result)
+}
+
+func (r *WebhookDeliveriesRepository) RecordAttempt(
+	ctx context.Context,
+	id uuid.UUID,
+	attempt webhooks.DeliveryAttempt,
+	state webhooks.DeliveryState,
+	nextAttemptAt time.Time,
+) werrors.WError {
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	_, err := coll.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{
+			"$push": bson.M{"attempts": WebhookDeliveryAttemptBSON{
+				AttemptedAt: attempt.AttemptedAt,
+				DurationMs:  attempt.Duration.Milliseconds(),
+				StatusCode:  attempt.StatusCode,
+				Error:       attempt.Error,
+			}},
+			"$set": bson.M{
+				"state":         string(state),
+				"nextAttemptAt": nextAttemptAt,
+				"updatedAt":     time.Now(),
+			},
+		},
+	)
+	if err != nil {
+		return werrors.NewRetryableInternalError("failed to record webhook delivery attempt: %s", err.Error())
+	}
+	return nil
+}
+
+func (r *WebhookDeliveriesRepository) ScheduleDelivery(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time) werrors.WError {
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	_, err := coll.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"state":         string(webhooks.DeliveryStatePending),
+			"nextAttemptAt": nextAttemptAt,
+			"updatedAt":     time.Now(),
+		}},
+	)
+	if err != nil {
+		return werrors.NewRetryableInternalError("failed to schedule webhook delivery: %s", err.Error())
+	}
+	return nil
+}
+
+func decodeWebhookDelivery(result *mongo.SingleResult) (webhooks.Delivery, werrors.WError) {
+	if err := result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return webhooks.Delivery{}, werrors.NewResourceNotFoundError("webhook delivery not found")
+		}
+		return webhooks.Delivery{}, werrors.NewRetryableInternalError("failed to find webhook delivery: %s", err.Error())
+	}
+	var deliveryBSON WebhookDeliveryBSON
+	if err := result.Decode(&deliveryBSON); err != nil {
+		return webhooks.Delivery{}, werrors.NewNonRetryableInternalError("failed to decode webhook delivery: %s", err.Error())
+	}
+	return webhookDeliveryFromBSON(deliveryBSON), nil
+}
+
+func webhookDeliveryFromBSON(deliveryBSON WebhookDeliveryBSON) webhooks.Delivery {
+	attempts := make([]webhooks.DeliveryAttempt, 0, len(deliveryBSON.Attempts))
+	for _, attemptBSON := range deliveryBSON.Attempts {
+		attempts = append(attempts, webhooks.DeliveryAttempt{
+			AttemptedAt: attemptBSON.AttemptedAt,
+			Duration:    time.Duration(attemptBSON.DurationMs) * time.Millisecond,
+			StatusCode:  attemptBSON.StatusCode,
+			Error:       attemptBSON.Error,
+		})
+	}
+	return webhooks.Delivery{
+		ID:             deliveryBSON.ID,
+		SubscriptionId: deliveryBSON.SubscriptionId,
+		CustomerId:     deliveryBSON.CustomerId,
+		PaymentId:      deliveryBSON.PaymentId,
+		EventId:        deliveryBSON.EventId,
+		URL:            deliveryBSON.URL,
+		Payload:        []byte(deliveryBSON.Payload),
+		State:          webhooks.DeliveryState(deliveryBSON.State),
+		Attempts:       attempts,
+		NextAttemptAt:  deliveryBSON.NextAttemptAt,
+		CreatedAt:      deliveryBSON.CreatedAt,
+		UpdatedAt:      deliveryBSON.UpdatedAt,
+	}
+}
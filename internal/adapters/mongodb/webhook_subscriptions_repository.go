@@ -0,0 +1,123 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/webhooks"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type WebhookSubscriptionBSON struct {
+	ID         uuid.UUID                  `bson:"_id"`
+	CustomerId uuid.UUID                  `bson:"customerId"`
+	URL        string                     `bson:"url"`
+	Statuses   []privateapi.PaymentStatus `bson:"statuses"`
+	Secret     string                     `bson:"secret"`
+	CreatedAt  time.Time                  `bson:"createdAt"`
+}
+
+type WebhookSubscriptionsRepository struct {
+	client         *mongo.Client
+	dbName         string
+	collectionName string
+}
+
+var _ webhooks.SubscriptionsRepository = (*WebhookSubscriptionsRepository)(nil)
+
+func NewWebhookSubscriptionsRepository(client *mongo.Client, dbName string, collectionName string) *WebhookSubscriptionsRepository {
+	return &WebhookSubscriptionsRepository{client: client, dbName: dbName, collectionName: collectionName}
+}
+
+// EnsureIndexes creates the index the subscriptions of a customer are found with
+func (r *WebhookSubscriptionsRepository) EnsureIndexes(ctx context.Context) error {
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "customerId", Value: 1}},
+	})
+	return err
+}
+
+func (r *WebhookSubscriptionsRepository) SaveSubscription(ctx context.Context, subscription webhooks.Subscription) werrors.WError {
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	_, err := coll.InsertOne(ctx, WebhookSubscriptionBSON{
+		ID:         subscription.ID,
+		CustomerId: subscription.CustomerId,
+		URL:        subscription.URL,
+		Statuses:   subscription.Statuses,
+		Secret:     subscription.Secret,
+		CreatedAt:  subscription.CreatedAt,
+	})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return werrors.NewResourceAlreadyExistError("webhook subscription %s already exists", subscription.ID)
+		}
+		return werrors.NewRetryableInternalError("failed to save webhook subscription: %s", err.Error())
+	}
+	return nil
+}
+
+func (r *WebhookSubscriptionsRepository) GetSubscription(ctx context.Context, id uuid.UUID) (webhooks.Subscription, werrors.WError) {
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	result := coll.FindOne(ctx, bson.M{"_id": id})
+	if err := result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return webhooks.Subscription{}, werrors.NewResourceNotFoundError("webhook subscription not found")
+		}
+		return webhooks.Subscription{}, werrors.NewRetryableInternalError("failed to find webhook subscription: %s", err.Error())
+	}
+	var subscriptionBSON WebhookSubscriptionBSON
+	if err := result.Decode(&subscriptionBSON); err != nil {
+		return webhooks.Subscription{}, werrors.NewNonRetryableInternalError("failed to decode webhook subscription: %s", err.Error())
+	}
+	return webhookSubscriptionFromBSON(subscriptionBSON), nil
+}
+
+func (r *WebhookSubscriptionsRepository) SearchSubscriptions(ctx context.Context, filter webhooks.SubscriptionsFilter) ([]webhooks.Subscription, werrors.WError) {
+	bsonFilter := bson.M{}
+	if filter.CustomerId != uuid.Nil {
+		bsonFilter["customerId"] = filter.CustomerId
+	}
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	sort := bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}
+	cursor, err := coll.Find(ctx, bsonFilter, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to find webhook subscriptions: %s", err.Error())
+	}
+	var subscriptionsBSON []WebhookSubscriptionBSON
+	if err := cursor.All(ctx, &subscriptionsBSON); err != nil {
+		return nil, werrors.NewRetryableInternalError("failed to decode webhook subscriptions: %s", err.Error())
+	}
+	subscriptions := make([]webhooks.Subscription, 0, len(subscriptionsBSON))
+	for _, subscriptionBSON := range subscriptionsBSON {
+		subscriptions = append(subscriptions, webhookSubscriptionFromBSON(subscriptionBSON))
+	}
+	return subscriptions, nil
+}
+
+func (r *WebhookSubscriptionsRepository) DeleteSubscription(ctx context.Context, id uuid.UUID) werrors.WError {
+	coll := r.client.Database(r.dbName).Collection(r.collectionName)
+	_, err := coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return werrors.NewRetryableInternalError("failed to delete webhook subscription: %s", err.Error())
+	}
+	return nil
+}
+
+func webhookSubscriptionFromBSON(subscriptionBSON WebhookSubscriptionBSON) webhooks.Subscription {
+	return webhooks.Subscription{
+		ID:         subscriptionBSON.ID,
+		CustomerId: subscriptionBSON.CustomerId,
+		URL:        subscriptionBSON.URL,
+		Statuses:   subscriptionBSON.Statuses,
+		Secret:     subscriptionBSON.Secret,
+		CreatedAt:  subscriptionBSON.CreatedAt,
+	}
+}
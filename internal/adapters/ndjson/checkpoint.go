@@ -0,0 +1,93 @@
+package ndjson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkpoint keeps, for every file, the last line handled with all the preceding ones
+type checkpoint struct {
+	path  string
+	lines map[string]int
+	// handledAhead are the lines handled after a line still in flight
+	handledAhead map[string]map[int]bool
+	dirty        bool
+}
+
+type checkpointJSON struct {
+	Lines map[string]int `json:"lines"`
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	c := &checkpoint{
+		path:         path,
+		lines:        make(map[string]int),
+		handledAhead: make(map[string]map[int]bool),
+	}
+	if path == "" {
+		return c, nil
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed reading events source checkpoint: %w", err)
+	}
+	var saved checkpointJSON
+	err = json.Unmarshal(content, &saved)
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding events source checkpoint %s: %w", path, err)
+	}
+	for file, line := range saved.Lines {
+		c.lines[file] = line
+	}
+	return c, nil
+}
+
+func (c *checkpoint) line(file string) int {
+	return c.lines[file]
+}
+
+// handled records a handled line, moving the checkpoint of the file
+// forward if the lines preceding it are all handled
+func (c *checkpoint) handled(file string, line int) {
+	if line != c.lines[file]+1 {
+		if c.handledAhead[file] == nil {
+			c.handledAhead[file] = make(map[int]bool)
+		}
+		c.handledAhead[file][line] = true
+		return
+	}
+	c.lines[file] = line
+	for c.handledAhead[file][c.lines[file]+1] {
+		c.lines[file]++
+		delete(c.handledAhead[file], c.lines[file])
+	}
+	c.dirty = true
+}
+
+// save replaces the checkpoint file, through a temporary file so it's never left half written
+func (c *checkpoint) save() error {
+	if c.path == "" || !c.dirty {
+		return nil
+	}
+	content, err := json.Marshal(checkpointJSON{Lines: c.lines})
+	if err != nil {
+		return fmt.Errorf("failed encoding events source checkpoint: %w", err)
+	}
+	tmpPath := filepath.Join(filepath.Dir(c.path), "."+filepath.Base(c.path)+".tmp")
+	err = os.WriteFile(tmpPath, content, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed writing events source checkpoint: %w", err)
+	}
+	err = os.Rename(tmpPath, c.path)
+	if err != nil {
+		return fmt.Errorf("failed writing events source checkpoint: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
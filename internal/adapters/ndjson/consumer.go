@@ -0,0 +1,334 @@
+package ndjson
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/walletera/eventskit/messages"
+)
+
+// Stdin is the Config.Path reading the events from the standard input
+const Stdin = "-"
+
+const checkpointFlushInterval = time.Second
+
+var _ messages.Consumer = (*Consumer)(nil)
+
+// Config locates the events, the checkpoint and the report of a Consumer
+type Config struct {
+	// Path is a file, a directory whose *.ndjson and *.jsonl files are read
+	// in lexical order, or Stdin
+	Path string
+	// CheckpointPath, when set, is where the last handled line of every file is kept,
+	// so a new run skips the lines handled by the previous ones
+	CheckpointPath string
+	// ReportPath, when set, is where the lines that failed are appended
+	ReportPath string
+}
+
+// Consumer consumes the events.EventEnvelope JSON lines of a file, a directory or the
+// standard input. A line is handled once acked or nacked without requeue; the lines
+// nacked without requeue are written to the report. The checkpoint of a file is its
+// last line handled with all the preceding lines, the lines requeued and the ones
+// following them are consumed again by the next run.
+type Consumer struct {
+	config     Config
+	logger     *slog.Logger
+	checkpoint *checkpoint
+	report     *report
+
+	mutex sync.Mutex
+	// inFlight is the number of lines delivered and not acked or nacked yet
+	inFlight int
+	readDone bool
+	done     chan struct{}
+	doneOnce sync.Once
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func NewConsumer(config Config, logger *slog.Logger) (*Consumer, error) {
+	checkpoint, err := loadCheckpoint(config.CheckpointPath)
+	if err != nil {
+		return nil, err
+	}
+	report, err := openReport(config.ReportPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Consumer{
+		config:     config,
+		logger:     logger,
+		checkpoint: checkpoint,
+		report:     report,
+		done:       make(chan struct{}),
+		closed:     make(chan struct{}),
+	}, nil
+}
+
+// Connected is always true, the events source can't be disconnected
+func (c *Consumer) Connected() bool {
+	return true
+}
+
+// Done is closed once every line has been read and handled
+func (c *Consumer) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Consumer) Consume() (<-chan messages.Message, error) {
+	paths, err := c.paths()
+	if err != nil {
+		return nil, err
+	}
+	messagesCh := make(chan messages.Message)
+	go c.run(messagesCh, paths)
+	go c.flushCheckpoint()
+	return messagesCh, nil
+}
+
+// Close stops reading the lines and saves the checkpoint
+func (c *Consumer) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		err = errors.Join(c.checkpoint.save(), c.report.close())
+	})
+	return err
+}
+
+// paths lists the files to read
+func (c *Consumer) paths() ([]string, error) {
+	if c.config.Path == Stdin {
+		return []string{Stdin}, nil
+	}
+	info, err := os.Stat(c.config.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading events source: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{c.config.Path}, nil
+	}
+	entries, err := os.ReadDir(c.config.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading events source directory: %w", err)
+	}
+	var paths []string
+	for _, entry := range entries {
+		path := filepath.Join(c.config.Path, entry.Name())
+		ext := filepath.Ext(entry.Name())
+		if !entry.Type().IsRegular() || (ext != ".ndjson" && ext != ".jsonl") {
+			continue
+		}
+		if sameFile(path, c.config.ReportPath) || sameFile(path, c.config.CheckpointPath) {
+			// the report may be kept next to the events
+			continue
+		}
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+func (c *Consumer) run(messagesCh chan<- messages.Message, paths []string) {
+	defer close(messagesCh)
+	for _, path := range paths {
+		err := c.readFile(messagesCh, path)
+		if err != nil {
+			// the lines following the error are consumed by the next run
+			c.logger.Error("failed reading events file", logattr.File(path), logattr.Error(err.Error()))
+			break
+		}
+		if c.isClosed() {
+			return
+		}
+	}
+	c.mutex.Lock()
+	c.readDone = true
+	c.checkDone()
+	c.mutex.Unlock()
+}
+
+func (c *Consumer) readFile(messagesCh chan<- messages.Message, path string) error {
+	var file io.Reader = os.Stdin
+	if path != Stdin {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		file = f
+	}
+	c.mutex.Lock()
+	skipped := c.checkpoint.line(path)
+	c.mutex.Unlock()
+	if skipped > 0 {
+		c.logger.Info("skipping the lines handled by a previous run", logattr.File(path), logattr.Line(skipped))
+	}
+
+	reader := bufio.NewReader(file)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		eof := err != nil
+		line = bytes.TrimSpace(line)
+		switch {
+		case lineNumber <= skipped:
+		case len(line) == 0:
+			if !eof {
+				c.mutex.Lock()
+				c.checkpoint.handled(path, lineNumber)
+				c.mutex.Unlock()
+			}
+		default:
+			c.mutex.Lock()
+			c.inFlight++
+			c.mutex.Unlock()
+			acknowledger := &acknowledger{consumer: c, path: path, lineNumber: lineNumber, line: line}
+			select {
+			case messagesCh <- messages.NewMessage(line, acknowledger):
+			case <-c.closed:
+				return nil
+			}
+		}
+		if eof {
+			return nil
+		}
+	}
+}
+
+// finish records the outcome of a line, once acked or nacked
+func (c *Consumer) finish(path string, lineNumber int, handled bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if handled {
+		c.checkpoint.handled(path, lineNumber)
+	}
+	c.inFlight--
+	c.checkDone()
+}
+
+func (c *Consumer) checkDone() {
+	if c.readDone && c.inFlight == 0 {
+		c.doneOnce.Do(func() {
+			if err := c.checkpoint.save(); err != nil {
+				c.logger.Error("failed saving events source checkpoint", logattr.Error(err.Error()))
+			}
+			c.logger.Info("events source fully consumed", logattr.File(c.config.Path))
+			close(c.done)
+		})
+	}
+}
+
+// flushCheckpoint saves the checkpoint periodically, so a crash repeats a few lines at most
+func (c *Consumer) flushCheckpoint() {
+	ticker := time.NewTicker(checkpointFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.mutex.Lock()
+			err := c.checkpoint.save()
+			c.mutex.Unlock()
+			if err != nil {
+				c.logger.Error("failed saving events source checkpoint", logattr.Error(err.Error()))
+			}
+		}
+	}
+}
+
+func (c *Consumer) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+type acknowledger struct {
+	consumer   *Consumer
+	path       string
+	lineNumber int
+	line       []byte
+	once       sync.Once
+}
+
+func (a *acknowledger) Ack() error {
+	a.once.Do(func() {
+		a.consumer.finish(a.path, a.lineNumber, true)
+	})
+	return nil
+}
+
+// Nack reports the line when it's not requeued. A requeued line is consumed again by the next run.
+func (a *acknowledger) Nack(opts messages.NackOpts) error {
+	var err error
+	a.once.Do(func() {
+		if opts.Requeue {
+			a.consumer.finish(a.path, a.lineNumber, false)
+			return
+		}
+		a.consumer.mutex.Lock()
+		err = a.consumer.report.write(failedLine{
+			File:         displayPath(a.path),
+			Line:         a.lineNumber,
+			ErrorCode:    int(opts.ErrorCode),
+			ErrorMessage: opts.ErrorMessage,
+			Payload:      strings.ToValidUTF8(string(a.line), "�"),
+		})
+		a.consumer.mutex.Unlock()
+		a.consumer.logger.Warn(
+			"events source line failed",
+			logattr.File(a.path),
+			logattr.Line(a.lineNumber),
+			logattr.ErrorCode(int(opts.ErrorCode)),
+			logattr.Error(opts.ErrorMessage),
+		)
+		a.consumer.finish(a.path, a.lineNumber, true)
+	})
+	return err
+}
+
+func sameFile(path string, otherPath string) bool {
+	if otherPath == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	otherInfo, err := os.Stat(otherPath)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(info, otherInfo)
+}
+
+func displayPath(path string) string {
+	if path == Stdin {
+		return "stdin"
+	}
+	return path
+}
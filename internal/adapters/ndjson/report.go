@@ -0,0 +1,50 @@
+package ndjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// report appends the failed lines to a file, one JSON object per line
+type report struct {
+	file    *os.File
+	encoder *json.Encoder
+}
+
+type failedLine struct {
+	File         string `json:"file"`
+	Line         int    `json:"line"`
+	ErrorCode    int    `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+	Payload      string `json:"payload"`
+}
+
+func openReport(path string) (*report, error) {
+	if path == "" {
+		return &report{}, nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening events source report: %w", err)
+	}
+	return &report{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (r *report) write(line failedLine) error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.encoder.Encode(line)
+	if err != nil {
+		return fmt.Errorf("failed writing events source report: %w", err)
+	}
+	return nil
+}
+
+func (r *report) close() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,115 @@
+package rabbitmq
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/walletera/eventskit/messages"
+)
+
+const (
+	retryCountHeader = "x-retry-count"
+	publishTimeout   = 5 * time.Second
+)
+
+var _ messages.Acknowledger = (*acknowledger)(nil)
+
+// retryPublisher is the part of the amqp channel publishing the retried messages
+type retryPublisher interface {
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+type acknowledger struct {
+	channel  retryPublisher
+	topology Topology
+	delivery amqp.Delivery
+	logger   *slog.Logger
+}
+
+func newAcknowledger(channel retryPublisher, topology Topology, delivery amqp.Delivery, logger *slog.Logger) *acknowledger {
+	return &acknowledger{
+		channel:  channel,
+		topology: topology,
+		delivery: delivery,
+		logger:   logger,
+	}
+}
+
+func (a *acknowledger) Ack() error {
+	return a.delivery.Ack(false)
+}
+
+// AckDeadLettered acknowledges a message stored in the dead letter store, so it's
+// not dead lettered a second time by the broker
+func (a *acknowledger) AckDeadLettered() error {
+	return a.delivery.Ack(false)
+}
+
+// Nack rejects the message. A message rejected without requeue, or that was already
+// retried opts.MaxRetries times, is routed to the dead letter exchange. A failed message
+// is published again with its retry count, to the retry queue, where it waits for the
+// retry delay, or back to the queue when there is no retry queue. A message nacked
+// without an error (e.g. on shutdown) is requeued right away and doesn't count as a retry.
+func (a *acknowledger) Nack(opts messages.NackOpts) error {
+	if !opts.Requeue {
+		return a.delivery.Nack(false, false)
+	}
+	if opts.ErrorCode == 0 {
+		return a.delivery.Nack(false, true)
+	}
+	retries := a.retryCount()
+	if retries >= opts.MaxRetries {
+		return a.delivery.Nack(false, false)
+	}
+	err := a.publishRetry(retries + 1)
+	if err != nil {
+		a.logger.Error("failed publishing message to retry, requeueing it", logattr.Error(err.Error()))
+		return a.delivery.Nack(false, true)
+	}
+	return a.delivery.Ack(false)
+}
+
+// publishRetry publishes the message with its retry count to the retry queue or, without
+// retry queue, back to the queue, through the default exchange in both cases, so the
+// other consumers of the exchange don't receive it again
+func (a *acknowledger) publishRetry(retryCount int) error {
+	headers := amqp.Table{}
+	for key, value := range a.delivery.Headers {
+		headers[key] = value
+	}
+	headers[retryCountHeader] = int32(retryCount)
+	publishing := amqp.Publishing{
+		Headers:      headers,
+		ContentType:  a.delivery.ContentType,
+		DeliveryMode: amqp.Persistent,
+		Body:         a.delivery.Body,
+	}
+	queueName := a.topology.QueueName
+	if a.topology.RetryQueueName != "" {
+		queueName = a.topology.RetryQueueName
+		publishing.Expiration = strconv.FormatInt(a.topology.RetryDelay.Milliseconds(), 10)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	return a.channel.PublishWithContext(ctx, "", queueName, false, false, publishing)
+}
+
+// retryCount returns the times the message was retried, carried by its retry count
+// header. A message redelivered by the broker (e.g. after a consumer restart) wasn't
+// retried, so the redelivered flag doesn't count.
+func (a *acknowledger) retryCount() int {
+	switch count := a.delivery.Headers[retryCountHeader].(type) {
+	case int32:
+		return int(count)
+	case int64:
+		return int(count)
+	case int:
+		return count
+	}
+	return 0
+}
@@ -0,0 +1,183 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/walletera/eventskit/messages"
+	"github.com/walletera/werrors"
+)
+
+var testTopology = Topology{
+	QueueName:      "payments-read-model.queue",
+	RetryQueueName: "payments-read-model.retry",
+	RetryDelay:     30 * time.Second,
+}
+
+// failedNack is the nack of the dispatcher for an event it couldn't store in the dead letter store
+var failedNack = messages.NackOpts{
+	Requeue:      true,
+	MaxRetries:   1,
+	ErrorCode:    werrors.InternalErrorCode,
+	ErrorMessage: "mongo unavailable",
+}
+
+func TestAcknowledgerNack(t *testing.T) {
+	tests := []struct {
+		name             string
+		topology         Topology
+		delivery         amqp.Delivery
+		opts             messages.NackOpts
+		publishErr       error
+		expectedSettle   string
+		expectedQueue    string
+		expectedRetry    int32
+		expectExpiration bool
+	}{
+		{
+			name:           "without requeue is dead lettered by the broker",
+			topology:       testTopology,
+			opts:           messages.NackOpts{ErrorCode: werrors.UnprocessableMessageErrorCode},
+			expectedSettle: "nack",
+		},
+		{
+			name:           "without error is requeued right away",
+			topology:       testTopology,
+			opts:           messages.NackOpts{Requeue: true},
+			expectedSettle: "requeue",
+		},
+		{
+			name:             "on its first failure is published to the retry queue",
+			topology:         testTopology,
+			opts:             failedNack,
+			expectedSettle:   "ack",
+			expectedQueue:    testTopology.RetryQueueName,
+			expectedRetry:    1,
+			expectExpiration: true,
+		},
+		{
+			name:             "redelivered by the broker is not counted as retried",
+			topology:         testTopology,
+			delivery:         amqp.Delivery{Redelivered: true},
+			opts:             failedNack,
+			expectedSettle:   "ack",
+			expectedQueue:    testTopology.RetryQueueName,
+			expectedRetry:    1,
+			expectExpiration: true,
+		},
+		{
+			name:           "retried max retries times is dead lettered by the broker",
+			topology:       testTopology,
+			delivery:       amqp.Delivery{Headers: amqp.Table{retryCountHeader: int32(1)}},
+			opts:           failedNack,
+			expectedSettle: "nack",
+		},
+		{
+			name:           "without retry queue is published back to the queue",
+			topology:       Topology{QueueName: testTopology.QueueName},
+			opts:           failedNack,
+			expectedSettle: "ack",
+			expectedQueue:  testTopology.QueueName,
+			expectedRetry:  1,
+		},
+		{
+			name:             "not published to retry is requeued",
+			topology:         testTopology,
+			opts:             failedNack,
+			publishErr:       errors.New("channel closed"),
+			expectedSettle:   "requeue",
+			expectedQueue:    testTopology.RetryQueueName,
+			expectedRetry:    1,
+			expectExpiration: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delivery := tt.delivery
+			settler := &recordingDeliveryAcknowledger{}
+			delivery.Acknowledger = settler
+			delivery.Body = []byte("event")
+			publisher := &recordingPublisher{err: tt.publishErr}
+			acknowledger := newAcknowledger(publisher, tt.topology, delivery, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			err := acknowledger.Nack(tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if settler.settle != tt.expectedSettle {
+				t.Errorf("expected the delivery to be settled with %s, but got %q", tt.expectedSettle, settler.settle)
+			}
+			if tt.expectedQueue == "" {
+				if publisher.published {
+					t.Errorf("expected the message not to be published, but it was published to %s", publisher.key)
+				}
+				return
+			}
+			if !publisher.published || publisher.exchange != "" || publisher.key != tt.expectedQueue {
+				t.Fatalf("expected the message to be published to %s through the default exchange, but got %q/%q", tt.expectedQueue, publisher.exchange, publisher.key)
+			}
+			if retryCount := publisher.msg.Headers[retryCountHeader]; retryCount != tt.expectedRetry {
+				t.Errorf("expected the retry count %d, but got %v", tt.expectedRetry, retryCount)
+			}
+			if hasExpiration := publisher.msg.Expiration != ""; hasExpiration != tt.expectExpiration {
+				t.Errorf("expected the message expiration to be set %t, but got %q", tt.expectExpiration, publisher.msg.Expiration)
+			}
+		})
+	}
+}
+
+func TestAcknowledgerAckDeadLetteredAcknowledgesTheMessage(t *testing.T) {
+	settler := &recordingDeliveryAcknowledger{}
+	acknowledger := newAcknowledger(&recordingPublisher{}, testTopology, amqp.Delivery{Acknowledger: settler}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	err := acknowledger.AckDeadLettered()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if settler.settle != "ack" {
+		t.Errorf("expected the dead lettered message to be acknowledged, not dead lettered again, but got %q", settler.settle)
+	}
+}
+
+// recordingDeliveryAcknowledger records how the delivery was settled: ack, nack or requeue
+type recordingDeliveryAcknowledger struct {
+	settle string
+}
+
+func (a *recordingDeliveryAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.settle = "ack"
+	return nil
+}
+
+func (a *recordingDeliveryAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.settle = "nack"
+	if requeue {
+		a.settle = "requeue"
+	}
+	return nil
+}
+
+func (a *recordingDeliveryAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+type recordingPublisher struct {
+	err       error
+	published bool
+	exchange  string
+	key       string
+	msg       amqp.Publishing
+}
+
+func (p *recordingPublisher) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	p.published = true
+	p.exchange = exchange
+	p.key = key
+	p.msg = msg
+	return p.err
+}
@@ -0,0 +1,241 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/walletera/eventskit/messages"
+)
+
+const (
+	DefaultReconnectInitialBackoff = time.Second
+	DefaultReconnectMaxBackoff     = 30 * time.Second
+)
+
+var _ messages.Consumer = (*Consumer)(nil)
+
+// ReconnectConfig is the backoff between the attempts to reconnect to RabbitMQ
+type ReconnectConfig struct {
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Consumer consumes the payments events from the queue of its Topology, which is declared
+// when the Consumer is created. When the connection or the channel is closed by anything
+// but Close, it reconnects with backoff, declares the topology again and resumes consuming.
+type Consumer struct {
+	url       string
+	topology  Topology
+	reconnect ReconnectConfig
+	logger    *slog.Logger
+	metrics   metrics
+
+	mutex   sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+
+	connected atomic.Bool
+	// closed is closed by Close, to stop consuming and reconnecting
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func NewConsumer(url string, topology Topology, reconnect ReconnectConfig, logger *slog.Logger) (*Consumer, error) {
+	consumer := &Consumer{
+		url:       url,
+		topology:  topology,
+		reconnect: reconnect,
+		logger:    logger,
+		metrics:   newMetrics(),
+		closed:    make(chan struct{}),
+	}
+	err := consumer.connect()
+	if err != nil {
+		return nil, err
+	}
+	return consumer, nil
+}
+
+// URL returns the url of the RabbitMQ server
+func URL(host string, port int, user string, password string) string {
+	return fmt.Sprintf("amqp://%s:%s@%s:%d/", user, password, host, port)
+}
+
+// Connected reports whether the consumer is connected. It's degraded, consuming
+// nothing, while it's reconnecting.
+func (c *Consumer) Connected() bool {
+	return c.connected.Load()
+}
+
+// Consume returns the channel of the consumed messages. The channel is
+// kept open across reconnections, until the consumer is closed.
+func (c *Consumer) Consume() (<-chan messages.Message, error) {
+	deliveries, channel, err := c.consume()
+	if err != nil {
+		return nil, err
+	}
+	messagesCh := make(chan messages.Message)
+	go c.run(messagesCh, deliveries, channel)
+	return messagesCh, nil
+}
+
+func (c *Consumer) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.setConnected(false)
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if c.channel != nil && !c.channel.IsClosed() {
+			if closeErr := c.channel.Close(); closeErr != nil {
+				err = fmt.Errorf("failed to close rabbitmq channel: %w", closeErr)
+				return
+			}
+		}
+		if c.conn != nil && !c.conn.IsClosed() {
+			if closeErr := c.conn.Close(); closeErr != nil {
+				err = fmt.Errorf("failed to close rabbitmq connection: %w", closeErr)
+			}
+		}
+	})
+	return err
+}
+
+// run forwards the deliveries to messagesCh, reconnecting every time the deliveries channel is closed
+func (c *Consumer) run(messagesCh chan<- messages.Message, deliveries <-chan amqp.Delivery, channel *amqp.Channel) {
+	defer close(messagesCh)
+	for {
+		for delivery := range deliveries {
+			select {
+			case messagesCh <- messages.NewMessage(delivery.Body, newAcknowledger(channel, c.topology, delivery, c.logger)):
+			case <-c.closed:
+				return
+			}
+		}
+		if c.isClosed() {
+			return
+		}
+		c.setConnected(false)
+		c.logger.Error("rabbitmq connection lost, reconnecting")
+		var ok bool
+		deliveries, channel, ok = c.reconnectWithBackoff()
+		if !ok {
+			return
+		}
+		c.logger.Info("rabbitmq connection restored")
+	}
+}
+
+// reconnectWithBackoff reconnects until it succeeds or the consumer is closed
+func (c *Consumer) reconnectWithBackoff() (<-chan amqp.Delivery, *amqp.Channel, bool) {
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-c.closed:
+			return nil, nil, false
+		case <-time.After(c.backoff(attempt)):
+		}
+		c.metrics.reconnectionAttempts.Add(context.Background(), 1)
+		err := c.connect()
+		if err == nil {
+			var deliveries <-chan amqp.Delivery
+			var channel *amqp.Channel
+			deliveries, channel, err = c.consume()
+			if err == nil {
+				return deliveries, channel, true
+			}
+		}
+		c.logger.Error(
+			"failed reconnecting to rabbitmq",
+			logattr.Error(err.Error()),
+			logattr.Attempts(attempt),
+		)
+	}
+}
+
+// connect dials RabbitMQ, opens a channel and declares the topology
+func (c *Consumer) connect() error {
+	conn, err := amqp.Dial(c.url)
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+	err = c.topology.Declare(channel)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.isClosed() {
+		// closed while connecting
+		_ = conn.Close()
+		return fmt.Errorf("rabbitmq consumer closed")
+	}
+	c.conn = conn
+	c.channel = channel
+	return nil
+}
+
+func (c *Consumer) consume() (<-chan amqp.Delivery, *amqp.Channel, error) {
+	c.mutex.Lock()
+	channel := c.channel
+	c.mutex.Unlock()
+	deliveries, err := channel.Consume(
+		c.topology.QueueName,
+		"",    // consumer
+		false, // auto-ack
+		false, // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,   // args
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to register a consumer: %w", err)
+	}
+	c.setConnected(true)
+	return deliveries, channel, nil
+}
+
+func (c *Consumer) setConnected(connected bool) {
+	c.connected.Store(connected)
+	var value int64
+	if connected {
+		value = 1
+	}
+	c.metrics.connected.Record(context.Background(), value)
+}
+
+func (c *Consumer) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoff doubles the delay on every attempt, up to the max backoff, with a random jitter of up to half of it
+func (c *Consumer) backoff(attempt int) time.Duration {
+	backoff := c.reconnect.InitialBackoff
+	for i := 1; i < attempt && backoff < c.reconnect.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, c.reconnect.MaxBackoff)
+	if backoff <= 0 {
+		return 0
+	}
+	half := backoff / 2
+	return half + rand.N(backoff-half+1)
+}
@@ -0,0 +1,57 @@
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConsumerBackoff(t *testing.T) {
+	consumer := &Consumer{reconnect: ReconnectConfig{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	}}
+	tests := []struct {
+		attempt     int
+		expectedMax time.Duration
+	}{
+		{attempt: 1, expectedMax: 100 * time.Millisecond},
+		{attempt: 2, expectedMax: 200 * time.Millisecond},
+		{attempt: 3, expectedMax: 400 * time.Millisecond},
+		{attempt: 4, expectedMax: 800 * time.Millisecond},
+		{attempt: 5, expectedMax: time.Second},
+		{attempt: 50, expectedMax: time.Second},
+	}
+	for _, test := range tests {
+		// the backoff is jittered between half and the whole of the exponential backoff
+		for i := 0; i < 100; i++ {
+			backoff := consumer.backoff(test.attempt)
+			if backoff < test.expectedMax/2 || backoff > test.expectedMax {
+				t.Fatalf("expected the backoff of attempt %d to be between %s and %s, but got %s",
+					test.attempt, test.expectedMax/2, test.expectedMax, backoff)
+			}
+		}
+	}
+}
+
+func TestConsumerIsDisconnectedOnceClosed(t *testing.T) {
+	consumer := &Consumer{
+		reconnect: ReconnectConfig{InitialBackoff: time.Hour, MaxBackoff: time.Hour},
+		metrics:   newMetrics(),
+		closed:    make(chan struct{}),
+	}
+	consumer.setConnected(true)
+	if !consumer.Connected() {
+		t.Fatalf("expected the consumer to be connected")
+	}
+
+	err := consumer.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if consumer.Connected() {
+		t.Errorf("expected the closed consumer to be disconnected")
+	}
+	if _, _, ok := consumer.reconnectWithBackoff(); ok {
+		t.Errorf("expected the closed consumer not to reconnect")
+	}
+}
@@ -0,0 +1,35 @@
+package rabbitmq
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/walletera/payments-read-model/internal/adapters/rabbitmq"
+
+type metrics struct {
+	connected            metric.Int64Gauge
+	reconnectionAttempts metric.Int64Counter
+}
+
+func newMetrics() metrics {
+	meter := otel.Meter(meterName)
+	connected, err := meter.Int64Gauge(
+		"payments_read_model.rabbitmq.connected",
+		metric.WithDescription("1 while the payments events consumer is connected to RabbitMQ, 0 while it's reconnecting"),
+	)
+	if err != nil {
+		panic("failed creating gauge payments_read_model.rabbitmq.connected: " + err.Error())
+	}
+	reconnectionAttempts, err := meter.Int64Counter(
+		"payments_read_model.rabbitmq.reconnection_attempts",
+		metric.WithDescription("Attempts to reconnect the payments events consumer to RabbitMQ"),
+	)
+	if err != nil {
+		panic("failed creating counter payments_read_model.rabbitmq.reconnection_attempts: " + err.Error())
+	}
+	return metrics{
+		connected:            connected,
+		reconnectionAttempts: reconnectionAttempts,
+	}
+}
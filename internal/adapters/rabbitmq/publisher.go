@@ -0,0 +1,126 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/walletera/eventskit/events"
+)
+
+var _ events.Publisher = (*Publisher)(nil)
+
+// Publisher publishes persistent messages to the durable exchange it declares and waits
+// for the broker to confirm every one. When the connection or the channel is closed,
+// it reconnects on the next Publish.
+type Publisher struct {
+	url          string
+	exchangeName string
+	exchangeType string
+
+	mutex   sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+}
+
+func NewPublisher(url string, exchangeName string, exchangeType string) (*Publisher, error) {
+	publisher := &Publisher{
+		url:          url,
+		exchangeName: exchangeName,
+		exchangeType: exchangeType,
+	}
+	err := publisher.connect()
+	if err != nil {
+		return nil, err
+	}
+	return publisher, nil
+}
+
+// Publish publishes the event to routingInfo.Topic, the exchange, with routingInfo.RoutingKey
+func (p *Publisher) Publish(ctx context.Context, data events.EventData, routingInfo events.RoutingInfo) error {
+	body, err := data.Serialize()
+	if err != nil {
+		return fmt.Errorf("error serializing event: %w", err)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.channel == nil || p.channel.IsClosed() {
+		err = p.connect()
+		if err != nil {
+			return err
+		}
+	}
+
+	confirmation, err := p.channel.PublishWithDeferredConfirmWithContext(
+		ctx,
+		routingInfo.Topic,
+		routingInfo.RoutingKey,
+		false, // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType:   data.DataContentType(),
+			DeliveryMode:  amqp.Persistent,
+			MessageId:     data.ID(),
+			CorrelationId: data.CorrelationID(),
+			Type:          data.Type(),
+			Timestamp:     data.CreatedAt(),
+			Body:          body,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed publishing event %s: %w", data.ID(), err)
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed waiting for the confirmation of event %s: %w", data.ID(), err)
+	}
+	if !acked {
+		return fmt.Errorf("event %s nacked by the broker", data.ID())
+	}
+	return nil
+}
+
+func (p *Publisher) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.conn == nil || p.conn.IsClosed() {
+		return nil
+	}
+	err := p.conn.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close rabbitmq publisher connection: %w", err)
+	}
+	return nil
+}
+
+// connect dials RabbitMQ, declares the exchange and puts the channel in confirm mode.
+// It must be called with the mutex held, or before the Publisher is shared.
+func (p *Publisher) connect() error {
+	if p.conn != nil && !p.conn.IsClosed() {
+		_ = p.conn.Close()
+	}
+	conn, err := amqp.Dial(p.url)
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+	err = channel.ExchangeDeclare(p.exchangeName, p.exchangeType, true, false, false, false, nil)
+	if err != nil {
+		_ = conn.Close()
+		return declareError("exchange", p.exchangeName, err)
+	}
+	err = channel.Confirm(false)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to put the channel in confirm mode: %w", err)
+	}
+	p.conn = conn
+	p.channel = channel
+	return nil
+}
@@ -0,0 +1,102 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Topology describes the exchanges, queues and bindings the payments-read-model consumes from.
+// Everything is declared durable, so the pending events survive a broker restart.
+type Topology struct {
+	// ExchangeName is the exchange the payments events are published to
+	ExchangeName string
+	ExchangeType string
+	// QueueName is the queue consumed by the payments-read-model
+	QueueName   string
+	RoutingKeys []string
+	// DeadLetterExchangeName receives the messages rejected without requeue and not stored
+	// in the dead letter store, which are routed to the DeadLetterQueueName queue
+	DeadLetterExchangeName string
+	DeadLetterQueueName    string
+	// RetryQueueName, when set, holds the requeued messages for RetryDelay before they
+	// are routed back to the queue. Otherwise they are published back to the queue.
+	RetryQueueName string
+	RetryDelay     time.Duration
+	// Prefetch is the max number of unacknowledged messages delivered to the consumer, 0 means unlimited
+	Prefetch int
+}
+
+// topologyChannel is the part of the amqp channel declaring the topology
+type topologyChannel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	Qos(prefetchCount, prefetchSize int, global bool) error
+}
+
+// Declare declares the topology. An existing exchange or queue declared with
+// different arguments (e.g. non durable) is reported as an error instead of being changed.
+func (t Topology) Declare(ch topologyChannel) error {
+	err := ch.ExchangeDeclare(t.ExchangeName, t.ExchangeType, true, false, false, false, nil)
+	if err != nil {
+		return declareError("exchange", t.ExchangeName, err)
+	}
+
+	err = ch.ExchangeDeclare(t.DeadLetterExchangeName, amqp.ExchangeFanout, true, false, false, false, nil)
+	if err != nil {
+		return declareError("exchange", t.DeadLetterExchangeName, err)
+	}
+	_, err = ch.QueueDeclare(t.DeadLetterQueueName, true, false, false, false, nil)
+	if err != nil {
+		return declareError("queue", t.DeadLetterQueueName, err)
+	}
+	err = ch.QueueBind(t.DeadLetterQueueName, "", t.DeadLetterExchangeName, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed binding queue %s to exchange %s: %w", t.DeadLetterQueueName, t.DeadLetterExchangeName, err)
+	}
+
+	_, err = ch.QueueDeclare(t.QueueName, true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange": t.DeadLetterExchangeName,
+	})
+	if err != nil {
+		return declareError("queue", t.QueueName, err)
+	}
+	for _, routingKey := range t.RoutingKeys {
+		err = ch.QueueBind(t.QueueName, routingKey, t.ExchangeName, false, nil)
+		if err != nil {
+			return fmt.Errorf("failed binding queue %s to exchange %s with routing key %s: %w", t.QueueName, t.ExchangeName, routingKey, err)
+		}
+	}
+
+	if t.RetryQueueName != "" {
+		// the expired messages go straight back to the queue, through the default exchange,
+		// instead of being published again to the other consumers of the exchange
+		_, err = ch.QueueDeclare(t.RetryQueueName, true, false, false, false, amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": t.QueueName,
+		})
+		if err != nil {
+			return declareError("queue", t.RetryQueueName, err)
+		}
+	}
+
+	if t.Prefetch > 0 {
+		err = ch.Qos(t.Prefetch, 0, false)
+		if err != nil {
+			return fmt.Errorf("failed setting prefetch count %d: %w", t.Prefetch, err)
+		}
+	}
+
+	return nil
+}
+
+func declareError(kind string, name string, err error) error {
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		return fmt.Errorf("%s %s already exists with different arguments, it must be deleted to be declared again: %w", kind, name, err)
+	}
+	return fmt.Errorf("failed declaring %s %s: %w", kind, name, err)
+}
@@ -0,0 +1,154 @@
+package rabbitmq
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestTopologyDeclare(t *testing.T) {
+	topology := Topology{
+		ExchangeName:           "payments.events",
+		ExchangeType:           "topic",
+		QueueName:              "payments-read-model.queue",
+		RoutingKeys:            []string{"payment.created", "payment.updated"},
+		DeadLetterExchangeName: "payments-read-model.dlx",
+		DeadLetterQueueName:    "payments-read-model.dlq",
+		RetryQueueName:         "payments-read-model.retry",
+		RetryDelay:             30 * time.Second,
+		Prefetch:               20,
+	}
+	channel := newRecordingTopologyChannel()
+
+	err := topology.Declare(channel)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	expectedExchanges := map[string]string{
+		"payments.events":         "topic",
+		"payments-read-model.dlx": amqp.ExchangeFanout,
+	}
+	if !reflect.DeepEqual(channel.exchanges, expectedExchanges) {
+		t.Errorf("expected the exchanges %v, but got %v", expectedExchanges, channel.exchanges)
+	}
+	expectedQueues := map[string]amqp.Table{
+		"payments-read-model.dlq": nil,
+		"payments-read-model.queue": {
+			"x-dead-letter-exchange": "payments-read-model.dlx",
+		},
+		// the expired retries go back to the queue only, not to the exchange
+		"payments-read-model.retry": {
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": "payments-read-model.queue",
+		},
+	}
+	if !reflect.DeepEqual(channel.queues, expectedQueues) {
+		t.Errorf("expected the queues %v, but got %v", expectedQueues, channel.queues)
+	}
+	expectedBindings := []string{
+		"payments-read-model.dlq<-payments-read-model.dlx:",
+		"payments-read-model.queue<-payments.events:payment.created",
+		"payments-read-model.queue<-payments.events:payment.updated",
+	}
+	if !reflect.DeepEqual(channel.bindings, expectedBindings) {
+		t.Errorf("expected the bindings %v, but got %v", expectedBindings, channel.bindings)
+	}
+	if !channel.durable {
+		t.Errorf("expected every exchange and queue to be durable")
+	}
+	if channel.prefetch != 20 {
+		t.Errorf("expected a prefetch of 20, but got %d", channel.prefetch)
+	}
+}
+
+func TestTopologyDeclareWithoutRetryQueue(t *testing.T) {
+	topology := Topology{
+		ExchangeName:           "payments.events",
+		ExchangeType:           "topic",
+		QueueName:              "payments-read-model.queue",
+		DeadLetterExchangeName: "payments-read-model.dlx",
+		DeadLetterQueueName:    "payments-read-model.dlq",
+	}
+	channel := newRecordingTopologyChannel()
+
+	err := topology.Declare(channel)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if _, found := channel.queues["payments-read-model.retry"]; found || len(channel.queues) != 2 {
+		t.Errorf("expected only the queue and the dead letter queue to be declared, but got %v", channel.queues)
+	}
+	if channel.prefetch != 0 {
+		t.Errorf("expected the prefetch not to be set, but got %d", channel.prefetch)
+	}
+}
+
+func TestTopologyDeclareReportsTheQueuesDeclaredWithDifferentArguments(t *testing.T) {
+	topology := Topology{
+		ExchangeName:           "payments.events",
+		ExchangeType:           "topic",
+		QueueName:              "payments-read-model",
+		DeadLetterExchangeName: "payments-read-model.dlx",
+		DeadLetterQueueName:    "payments-read-model.dlq",
+	}
+	channel := newRecordingTopologyChannel()
+	channel.queueErrors["payments-read-model"] = &amqp.Error{
+		Code:   amqp.PreconditionFailed,
+		Reason: "PRECONDITION_FAILED - inequivalent arg 'x-dead-letter-exchange'",
+	}
+
+	err := topology.Declare(channel)
+
+	expectedMessage := "queue payments-read-model already exists with different arguments, it must be deleted to be declared again: " +
+		"Exception (406) Reason: \"PRECONDITION_FAILED - inequivalent arg 'x-dead-letter-exchange'\""
+	if err == nil || err.Error() != expectedMessage {
+		t.Errorf("expected the error %q, but got %v", expectedMessage, err)
+	}
+}
+
+type recordingTopologyChannel struct {
+	exchanges   map[string]string
+	queues      map[string]amqp.Table
+	queueErrors map[string]error
+	bindings    []string
+	durable     bool
+	prefetch    int
+}
+
+func newRecordingTopologyChannel() *recordingTopologyChannel {
+	return &recordingTopologyChannel{
+		exchanges:   make(map[string]string),
+		queues:      make(map[string]amqp.Table),
+		queueErrors: make(map[string]error),
+		durable:     true,
+	}
+}
+
+func (c *recordingTopologyChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	c.exchanges[name] = kind
+	c.durable = c.durable && durable
+	return nil
+}
+
+func (c *recordingTopologyChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	if err := c.queueErrors[name]; err != nil {
+		return amqp.Queue{}, err
+	}
+	c.queues[name] = args
+	c.durable = c.durable && durable
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *recordingTopologyChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	c.bindings = append(c.bindings, name+"<-"+exchange+":"+key)
+	return nil
+}
+
+func (c *recordingTopologyChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	c.prefetch = prefetchCount
+	return nil
+}
@@ -0,0 +1,7 @@
+package app
+
+type AdminAPIConfig struct {
+    AdminAPIHttpServerPort int
+    // AuthToken is the bearer token required by the admin endpoints
+    AuthToken string
+}
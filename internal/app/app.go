@@ -6,15 +6,25 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/walletera/payments-read-model/internal/adapters/input/http/admin"
+	"github.com/walletera/payments-read-model/internal/adapters/input/http/auth"
+	"github.com/walletera/payments-read-model/internal/adapters/input/http/ingestion"
 	"github.com/walletera/payments-read-model/internal/adapters/input/http/public"
 	"github.com/walletera/payments-read-model/internal/adapters/mongodb"
+	"github.com/walletera/payments-read-model/internal/adapters/ndjson"
+	"github.com/walletera/payments-read-model/internal/adapters/rabbitmq"
+	"github.com/walletera/payments-read-model/internal/domain/deadletters"
 	"github.com/walletera/payments-read-model/internal/domain/payments"
+	"github.com/walletera/payments-read-model/internal/domain/rebuild"
+	"github.com/walletera/payments-read-model/internal/domain/upcasting"
+	"github.com/walletera/payments-read-model/internal/domain/webhooks"
 	"github.com/walletera/payments-read-model/pkg/logattr"
 
+	"github.com/walletera/eventskit/events"
 	"github.com/walletera/eventskit/messages"
-	"github.com/walletera/eventskit/rabbitmq"
 	paymentsevents "github.com/walletera/payments-types/events"
 	"github.com/walletera/payments-types/publicapi"
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -29,20 +39,87 @@ const (
 	RabbitMQExchangeType             = "topic"
 	RabbitMQPaymentCreatedRoutingKey = "payment.created"
 	RabbitMQPaymentUpdatedRoutingKey = "payment.updated"
-	RabbitMQQueueName                = "payments-read-model"
+	// RabbitMQQueueName replaces the payments-read-model queue, declared without
+	// dead letter exchange by the previous versions (see the README migration)
+	RabbitMQQueueName              = "payments-read-model.queue"
+	RabbitMQDeadLetterExchangeName = "payments-read-model.dlx"
+	RabbitMQDeadLetterQueueName    = "payments-read-model.dlq"
+	DefaultRabbitMQRetryDelay      = 30 * time.Second
+	// the PaymentProjectionUpdated events are published to the own exchange of the payments-read-model
+	RabbitMQProjectionUpdatesExchangeName = "payments-read-model.events"
+	RabbitMQProjectionUpdatedRoutingKey   = "payment.projection.updated"
+
+	MongoDBDatabaseName                    = "payments"
+	MongoDBPaymentsCollectionName          = "payments"
+	MongoDBPendingUpdatesCollectionName    = "pending_payment_updates"
+	MongoDBDeadLettersCollectionName       = "payments_dlq"
+	MongoDBEventLogCollectionName          = "payment_events"
+	MongoDBHistoryCollectionName           = "payment_history"
+	MongoDBProjectionsCollectionName       = "projections"
+	MongoDBCheckpointsCollectionName       = "projection_checkpoints"
+	MongoDBStatusViolationsCollectionName  = "status_violations"
+	MongoDBWebhooksCollectionName          = "webhook_subscriptions"
+	MongoDBWebhookDeliveriesCollectionName = "webhook_deliveries"
+	MongoDBRebuildsCollectionName          = "projection_rebuilds"
+	MongoDBLeasesCollectionName            = "leases"
+	DefaultPendingUpdatesTTL               = 5 * time.Minute
+	DefaultStatusTransitionPolicy          = payments.StatusTransitionPolicyWarn
+	mongoDBEnsureIndexesTimeout            = 30 * time.Second
+	outboxRelaysInterval                   = time.Second
+	outboxRelaysLeaseDuration              = 15 * time.Second
+	// projectionUpdatesOutbox is the event log outbox the projection updates are published from
+	projectionUpdatesOutbox = "projectionUpdates"
+	// statusChangesOutbox is the event log outbox the webhook deliveries are derived from
+	statusChangesOutbox = "statusChanges"
 )
 
+// eventsConsumer is the source of the payments events
+type eventsConsumer interface {
+	messages.Consumer
+	Connected() bool
+}
+
 type App struct {
-	rabbitmqHost      string
-	rabbitmqPort      int
-	rabbitmqUser      string
-	rabbitmqPassword  string
-	mongodbURL        string
-	mongoClient       *mongo.Client
-	publicAPIConfig   Optional[PublicAPIConfig]
-	logHandler        slog.Handler
-	logger            *slog.Logger
-	httpServersToStop []*http.Server
+	rabbitmqHost           string
+	rabbitmqPort           int
+	rabbitmqUser           string
+	rabbitmqPassword       string
+	rabbitmqTopology       rabbitmq.Topology
+	rabbitmqReconnect      rabbitmq.ReconnectConfig
+	fileEventsSource       Optional[ndjson.Config]
+	eventsConsumer         eventsConsumer
+	mongodbURL             string
+	mongoClient            *mongo.Client
+	publicAPIConfig        Optional[PublicAPIConfig]
+	adminAPIConfig         Optional[AdminAPIConfig]
+	ingestionAPIConfig     Optional[IngestionAPIConfig]
+	pendingUpdatesTTL      time.Duration
+	statusTransitionPolicy payments.StatusTransitionPolicy
+	eventUpcasters         *upcasting.Registry
+	batchWritesConfig      Optional[BatchWritesConfig]
+	dispatcherConfig       DispatcherConfig
+	deadLetters            *deadletters.Service
+	activeCollection       *mongodb.ActiveCollection
+	checkpointsRepository  *mongodb.CheckpointsRepository
+	rebuilder              *rebuild.Rebuilder
+	logHandler             slog.Handler
+	logger                 *slog.Logger
+	httpServersToStop      []*http.Server
+	dispatcher             *Dispatcher
+	cancelBackground       context.CancelFunc
+	backgroundTasks        sync.WaitGroup
+
+	// projectionUpdatesExchangeName is the exchange the PaymentProjectionUpdated events are published to
+	projectionUpdatesExchangeName string
+	projectionUpdatesPublisher    *rabbitmq.Publisher
+	projectionUpdatesRelay        *payments.ProjectionUpdatesRelay
+
+	webhookDeliveryConfig webhooks.DeliveryConfig
+	webhooks              *webhooks.Service
+	webhookDeliveryWorker *webhooks.DeliveryWorker
+	statusChangesRelay    *payments.StatusChangesRelay
+
+	projectionChanges *payments.ProjectionChanges
 }
 
 func NewApp(opts ...Option) (*App, error) {
@@ -54,9 +131,39 @@ func NewApp(opts ...Option) (*App, error) {
 	for _, opt := range opts {
 		opt(app)
 	}
+	err = validateOpts(app)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
 	return app, nil
 }
 
+// validateOpts refuses the options the app must not start with
+func validateOpts(app *App) error {
+	if app.adminAPIConfig.Set && app.adminAPIConfig.Value.AuthToken == "" {
+		return fmt.Errorf("the admin api auth token can't be empty")
+	}
+	if app.ingestionAPIConfig.Set && app.ingestionAPIConfig.Value.AuthToken == "" {
+		return fmt.Errorf("the ingestion api auth token can't be empty")
+	}
+	if app.webhookDeliveryConfig.Workers < 1 {
+		return fmt.Errorf("the webhook delivery workers must be at least 1, got %d", app.webhookDeliveryConfig.Workers)
+	}
+	if app.fileEventsSource.Set && app.fileEventsSource.Value.Path == ndjson.Stdin && app.fileEventsSource.Value.CheckpointPath != "" {
+		// the standard input is read anew on every run, its lines can't be skipped
+		return fmt.Errorf("the events read from the standard input can't be checkpointed")
+	}
+	if app.batchWritesConfig.Set {
+		if app.batchWritesConfig.Value.MaxBatchSize < 2 {
+			return fmt.Errorf("the batch writes max size must be greater than 1, got %d", app.batchWritesConfig.Value.MaxBatchSize)
+		}
+		if app.batchWritesConfig.Value.Window <= 0 {
+			return fmt.Errorf("the batch writes window must be positive, got %s", app.batchWritesConfig.Value.Window)
+		}
+	}
+	return nil
+}
+
 func (app *App) Run(ctx context.Context) error {
 	app.logger = slog.
 		New(app.logHandler).
@@ -64,53 +171,189 @@ func (app *App) Run(ctx context.Context) error {
 
 	app.logger.Info("payments-read-model started")
 
-	processor, err := createPaymentsMessageProcessor(app)
+	// the dispatcher and the background tasks outlive ctx,
+	// so Stop can drain the in-flight events before stopping them
+	backgroundCtx, cancelBackground := context.WithCancel(context.WithoutCancel(ctx))
+	app.cancelBackground = cancelBackground
+
+	dispatcher, err := createPaymentsEventsDispatcher(backgroundCtx, app)
 	if err != nil {
-		return fmt.Errorf("error creating payments message processor: %w", err)
+		return fmt.Errorf("error creating payments events dispatcher: %w", err)
 	}
 
+	pendingUpdatesMonitor := payments.NewPendingUpdatesMonitor(
+		mongodb.NewPendingUpdatesRepository(app.mongoClient, MongoDBDatabaseName, MongoDBPendingUpdatesCollectionName),
+		app.pendingUpdatesTTL,
+		app.logger.With(logattr.Component("payments.PendingUpdatesMonitor")),
+	)
+	app.runInBackground(func() { pendingUpdatesMonitor.Run(backgroundCtx) })
+
+	if app.projectionUpdatesRelay != nil {
+		app.runInBackground(func() { app.projectionUpdatesRelay.Run(backgroundCtx) })
+	}
+
+	app.runInBackground(func() { app.statusChangesRelay.Run(backgroundCtx) })
+	app.runInBackground(func() { app.webhookDeliveryWorker.Run(backgroundCtx) })
+
+	app.runInBackground(func() {
+		app.checkpointsRepository.Run(
+			backgroundCtx,
+			app.logger.With(logattr.Component("mongodb.CheckpointsRepository")),
+		)
+	})
+
+	app.runInBackground(func() {
+		app.activeCollection.Watch(
+			backgroundCtx,
+			activeCollectionWatchInterval,
+			app.logger.With(logattr.Component("mongodb.ActiveCollection")),
+		)
+	})
+
 	var httpServersToStop []*http.Server
 
 	var publicApiHttpServer *http.Server
 	if app.publicAPIConfig.Set {
-		publicApiHttpServer, err = app.startPublicAPIHTTPServer(app.logger)
+		publicApiHttpServer, err = app.startPublicAPIHTTPServer(backgroundCtx, app.logger)
 		if err != nil {
 			return fmt.Errorf("failed starting public api http server: %w", err)
 		}
 
 		httpServersToStop = append(httpServersToStop, publicApiHttpServer)
 	}
+
+	if app.adminAPIConfig.Set {
+		adminApiHttpServer := app.startAdminAPIHTTPServer(app.logger)
+		httpServersToStop = append(httpServersToStop, adminApiHttpServer)
+	}
+
+	if app.ingestionAPIConfig.Set {
+		ingestionApiHttpServer := app.startIngestionAPIHTTPServer(dispatcher, app.logger)
+		httpServersToStop = append(httpServersToStop, ingestionApiHttpServer)
+	}
 	app.httpServersToStop = httpServersToStop
 
-	err = processor.Start(ctx)
+	err = dispatcher.Start(backgroundCtx)
 	if err != nil {
-		return fmt.Errorf("error starting payments message processor: %w", err)
+		return fmt.Errorf("error starting payments events dispatcher: %w", err)
 	}
+	app.dispatcher = dispatcher
 
 	return nil
 }
 
+// Done is closed once the events of a file events source have all been handled.
+// It's never closed when the events are consumed from RabbitMQ.
+func (app *App) Done() <-chan struct{} {
+	fileConsumer, ok := app.eventsConsumer.(*ndjson.Consumer)
+	if !ok {
+		return nil
+	}
+	return fileConsumer.Done()
+}
+
+// Stop shuts the app down in order: it stops consuming events and waits for the in-flight
+// ones until ctx is done (requeueing the unfinished ones), stops the http servers, stops
+// the background tasks, waiting for them to flush their state, closes the projection
+// updates publisher and finally disconnects from mongo, once nothing can be writing to it.
 func (app *App) Stop(ctx context.Context) {
-	// TODO implement processor gracefully shutdown
-	err := app.mongoClient.Disconnect(context.TODO())
-	if err != nil {
-		app.logger.Error("error disconnecting from mongo", logattr.Error(err.Error()))
+	// the events being handled are drained first, the ingestion requests arriving
+	// meanwhile are refused with a retryable error by the stopping dispatcher
+	if app.dispatcher != nil {
+		app.dispatcher.Stop(ctx)
 	}
 	for _, httpServer := range app.httpServersToStop {
 		err := httpServer.Shutdown(ctx)
 		if err != nil {
 			app.logger.Error("error stopping http server", logattr.Error(err.Error()))
+			// the deadline is over, the connections still open are closed right away
+			_ = httpServer.Close()
+		}
+	}
+	if app.cancelBackground != nil {
+		app.cancelBackground()
+	}
+	app.waitForBackgroundTasks(ctx)
+	if app.projectionUpdatesPublisher != nil {
+		// the updates not published yet stay in the outbox
+		err := app.projectionUpdatesPublisher.Close()
+		if err != nil {
+			app.logger.Error("error closing projection updates publisher", logattr.Error(err.Error()))
+		}
+	}
+	if app.mongoClient != nil {
+		// ctx may be done already, mongo must be disconnected anyway
+		err := app.mongoClient.Disconnect(context.WithoutCancel(ctx))
+		if err != nil {
+			app.logger.Error("error disconnecting from mongo", logattr.Error(err.Error()))
 		}
 	}
 	app.logger.Info("payments-read-model stopped")
 }
 
+// runInBackground runs a task Stop waits for once the background ctx is cancelled
+func (app *App) runInBackground(task func()) {
+	app.backgroundTasks.Add(1)
+	go func() {
+		defer app.backgroundTasks.Done()
+		task()
+	}()
+}
+
+// waitForBackgroundTasks waits for the background tasks to return, or for ctx to be done
+func (app *App) waitForBackgroundTasks(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		app.backgroundTasks.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		app.logger.Error("background tasks not stopped before the shutdown timeout")
+	}
+}
+
+// DefaultRabbitMQTopology returns the topology consumed by default, without retry queue
+func DefaultRabbitMQTopology() rabbitmq.Topology {
+	return rabbitmq.Topology{
+		ExchangeName:           RabbitMQPaymentsExchangeName,
+		ExchangeType:           RabbitMQExchangeType,
+		QueueName:              RabbitMQQueueName,
+		RoutingKeys:            []string{RabbitMQPaymentCreatedRoutingKey, RabbitMQPaymentUpdatedRoutingKey},
+		DeadLetterExchangeName: RabbitMQDeadLetterExchangeName,
+		DeadLetterQueueName:    RabbitMQDeadLetterQueueName,
+		RetryDelay:             DefaultRabbitMQRetryDelay,
+	}
+}
+
 func setDefaultOpts(app *App) error {
 	zapLogger, err := newZapLogger()
 	if err != nil {
 		return err
 	}
 	app.logHandler = zapslog.NewHandler(zapLogger.Core())
+	app.pendingUpdatesTTL = DefaultPendingUpdatesTTL
+	app.rabbitmqTopology = DefaultRabbitMQTopology()
+	app.projectionUpdatesExchangeName = RabbitMQProjectionUpdatesExchangeName
+	app.webhookDeliveryConfig = webhooks.DefaultDeliveryConfig()
+	app.rabbitmqReconnect = rabbitmq.ReconnectConfig{
+		InitialBackoff: rabbitmq.DefaultReconnectInitialBackoff,
+		MaxBackoff:     rabbitmq.DefaultReconnectMaxBackoff,
+	}
+	app.statusTransitionPolicy = DefaultStatusTransitionPolicy
+	app.eventUpcasters = upcasting.NewRegistry()
+	app.dispatcherConfig = DispatcherConfig{
+		Workers:           DefaultDispatcherWorkers,
+		WorkerQueueSize:   DefaultDispatcherWorkerQueueSize,
+		ProcessingTimeout: DefaultDispatcherProcessingTimeout,
+		Retry: RetryConfig{
+			MaxAttempts:    DefaultRetryMaxAttempts,
+			InitialBackoff: DefaultRetryInitialBackoff,
+			MaxBackoff:     DefaultRetryMaxBackoff,
+		},
+		UnknownEventsPolicy: DefaultUnknownEventsPolicy,
+	}
 	return nil
 }
 
@@ -133,21 +376,131 @@ func newZapLogger() (*zap.Logger, error) {
 	return zapConfig.Build()
 }
 
-func createPaymentsMessageProcessor(app *App) (*messages.Processor[paymentsevents.Handler], error) {
-	queueName := fmt.Sprintf(RabbitMQQueueName)
+// createEventsConsumer returns nil when the events are only pushed to the ingestion API
+func createEventsConsumer(app *App) (eventsConsumer, error) {
+	if app.rabbitmqHost == "" && !app.fileEventsSource.Set {
+		if !app.ingestionAPIConfig.Set {
+			return nil, fmt.Errorf("no events source configured")
+		}
+		return nil, nil
+	}
+	if app.fileEventsSource.Set {
+		fileConsumer, err := ndjson.NewConsumer(
+			app.fileEventsSource.Value,
+			app.logger.With(logattr.Component("ndjson.Consumer")),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("creating file events consumer: %w", err)
+		}
+		return fileConsumer, nil
+	}
+	topology := app.rabbitmqTopology
+	if topology.Prefetch == 0 {
+		// enough to keep every worker and its queue busy
+		topology.Prefetch = app.dispatcherConfig.Workers * (app.dispatcherConfig.WorkerQueueSize + 1)
+	}
+	rabbitMQConsumer, err := rabbitmq.NewConsumer(
+		rabbitmq.URL(app.rabbitmqHost, app.rabbitmqPort, app.rabbitmqUser, app.rabbitmqPassword),
+		topology,
+		app.rabbitmqReconnect,
+		app.logger.With(logattr.Component("rabbitmq.Consumer")),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating rabbitmq consumer: %w", err)
+	}
+	return rabbitMQConsumer, nil
+}
+
+// createProjectionUpdatesRelay sets up the relay publishing the PaymentProjectionUpdated
+// events from the event log outbox and returns the outboxes the logged events are kept
+// pending in. Without RabbitMQ nothing is published nor kept.
+func createProjectionUpdatesRelay(ctx context.Context, app *App) ([]string, error) {
+	if app.rabbitmqHost == "" {
+		return nil, nil
+	}
+	outbox := mongodb.NewEventLogOutbox(app.mongoClient, MongoDBDatabaseName, MongoDBEventLogCollectionName, projectionUpdatesOutbox)
+	err := outbox.EnsureIndexes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating projection updates outbox indexes: %w", err)
+	}
+	publisher, err := rabbitmq.NewPublisher(
+		rabbitmq.URL(app.rabbitmqHost, app.rabbitmqPort, app.rabbitmqUser, app.rabbitmqPassword),
+		app.projectionUpdatesExchangeName,
+		RabbitMQExchangeType,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating projection updates publisher: %w", err)
+	}
+	app.projectionUpdatesPublisher = publisher
+	app.projectionUpdatesRelay = payments.NewProjectionUpdatesRelay(
+		outbox,
+		mongodb.NewLease(app.mongoClient, MongoDBDatabaseName, MongoDBLeasesCollectionName, projectionUpdatesOutbox),
+		outboxRelaysLeaseDuration,
+		publisher,
+		events.RoutingInfo{
+			Topic:      app.projectionUpdatesExchangeName,
+			RoutingKey: RabbitMQProjectionUpdatedRoutingKey,
+		},
+		outboxRelaysInterval,
+		app.logger.With(logattr.Component("payments.ProjectionUpdatesRelay")),
+	)
+	return []string{projectionUpdatesOutbox}, nil
+}
 
-	rabbitMQClient, err := rabbitmq.NewClient(
-		rabbitmq.WithHost(app.rabbitmqHost),
-		rabbitmq.WithPort(uint(app.rabbitmqPort)),
-		rabbitmq.WithUser(app.rabbitmqUser),
-		rabbitmq.WithPassword(app.rabbitmqPassword),
-		rabbitmq.WithExchangeName(RabbitMQPaymentsExchangeName),
-		rabbitmq.WithExchangeType(RabbitMQExchangeType),
-		rabbitmq.WithConsumerRoutingKeys(RabbitMQPaymentCreatedRoutingKey, RabbitMQPaymentUpdatedRoutingKey),
-		rabbitmq.WithQueueName(queueName),
+// createWebhooks sets up the webhook subscriptions, the relay adding the deliveries of
+// the status changes pending in the event log outbox and the worker attempting them
+func createWebhooks(
+	ctx context.Context,
+	app *App,
+	repository payments.Repository,
+	historyRepository payments.HistoryRepository,
+) error {
+	subscriptionsRepository := mongodb.NewWebhookSubscriptionsRepository(app.mongoClient, MongoDBDatabaseName, MongoDBWebhooksCollectionName)
+	err := subscriptionsRepository.EnsureIndexes(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating webhook subscriptions indexes: %w", err)
+	}
+	deliveriesRepository := mongodb.NewWebhookDeliveriesRepository(app.mongoClient, MongoDBDatabaseName, MongoDBWebhookDeliveriesCollectionName)
+	err = deliveriesRepository.EnsureIndexes(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating webhook deliveries indexes: %w", err)
+	}
+	app.webhooks = webhooks.NewService(
+		subscriptionsRepository,
+		deliveriesRepository,
+		app.webhookDeliveryConfig,
+		app.logger.With(logattr.Component("webhooks.Service")),
 	)
+	outbox := mongodb.NewEventLogOutbox(app.mongoClient, MongoDBDatabaseName, MongoDBEventLogCollectionName, statusChangesOutbox)
+	err = outbox.EnsureIndexes(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("creating rabbitmq client: %w", err)
+		return fmt.Errorf("error creating status changes outbox indexes: %w", err)
+	}
+	app.statusChangesRelay = payments.NewStatusChangesRelay(
+		outbox,
+		mongodb.NewLease(app.mongoClient, MongoDBDatabaseName, MongoDBLeasesCollectionName, statusChangesOutbox),
+		outboxRelaysLeaseDuration,
+		repository,
+		historyRepository,
+		app.webhooks,
+		outboxRelaysInterval,
+		app.logger.With(logattr.Component("payments.StatusChangesRelay")),
+	)
+	app.webhookDeliveryWorker = webhooks.NewDeliveryWorker(
+		subscriptionsRepository,
+		deliveriesRepository,
+		app.webhookDeliveryConfig,
+		app.logger.With(logattr.Component("webhooks.DeliveryWorker")),
+	)
+	return nil
+}
+
+// createPaymentsEventsDispatcher sets up the events handling. The dispatcher is nil
+// when there is no events consumer, the events being pushed to the ingestion API.
+func createPaymentsEventsDispatcher(ctx context.Context, app *App) (*Dispatcher, error) {
+	consumer, err := createEventsConsumer(app)
+	if err != nil {
+		return nil, err
 	}
 
 	// Use the SetServerAPIOptions() method to set the Stable API version to 1
@@ -167,20 +520,137 @@ func createPaymentsMessageProcessor(app *App) (*messages.Processor[paymentsevent
 	}
 	app.mongoClient = client
 
-	repository := mongodb.NewPaymentsRepository(client, "payments", "payments")
-	paymentEventsHandler := payments.NewEventsHandler(repository, app.logger.With(logattr.Component("payments.events.Handler")))
+	ensureIndexesCtx, ensureIndexesCtxCancel := context.WithTimeout(ctx, mongoDBEnsureIndexesTimeout)
+	defer ensureIndexesCtxCancel()
+
+	app.activeCollection = mongodb.NewActiveCollection(
+		client,
+		MongoDBDatabaseName,
+		MongoDBProjectionsCollectionName,
+		MongoDBPaymentsCollectionName,
+		activeCollectionHeartbeatTTL,
+	)
+	err = app.activeCollection.Load(ensureIndexesCtx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading active payments collection: %w", err)
+	}
+
+	activePaymentsRepository := mongodb.NewActivePaymentsRepository(client, MongoDBDatabaseName, app.activeCollection)
+	err = activePaymentsRepository.EnsureIndexes(ensureIndexesCtx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating payments indexes: %w", err)
+	}
+	var repository payments.Repository = activePaymentsRepository
+	if app.batchWritesConfig.Set {
+		batchingRepository := mongodb.NewBatchingPaymentsRepository(
+			mongodb.NewActivePaymentsRepository(client, MongoDBDatabaseName, app.activeCollection),
+			app.batchWritesConfig.Value.MaxBatchSize,
+			app.batchWritesConfig.Value.Window,
+			app.logger.With(logattr.Component("mongodb.BatchingPaymentsRepository")),
+		)
+		app.runInBackground(func() { batchingRepository.Run(ctx) })
+		repository = batchingRepository
+	}
+	pendingUpdatesRepository := mongodb.NewPendingUpdatesRepository(client, MongoDBDatabaseName, MongoDBPendingUpdatesCollectionName)
+	err = pendingUpdatesRepository.EnsureIndexes(ensureIndexesCtx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating pending updates indexes: %w", err)
+	}
+	outboxes, err := createProjectionUpdatesRelay(ensureIndexesCtx, app)
+	if err != nil {
+		return nil, err
+	}
+	outboxes = append(outboxes, statusChangesOutbox)
+	eventLogRepository := mongodb.NewEventLogRepository(client, MongoDBDatabaseName, MongoDBEventLogCollectionName, outboxes...)
+	err = eventLogRepository.EnsureIndexes(ensureIndexesCtx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating event log indexes: %w", err)
+	}
+	historyRepository := mongodb.NewHistoryRepository(client, MongoDBDatabaseName, MongoDBHistoryCollectionName)
+	err = historyRepository.EnsureIndexes(ensureIndexesCtx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating payment history indexes: %w", err)
+	}
+
+	err = createWebhooks(ensureIndexesCtx, app, activePaymentsRepository, historyRepository)
+	if err != nil {
+		return nil, err
+	}
+
+	app.checkpointsRepository = mongodb.NewCheckpointsRepository(client, MongoDBDatabaseName, MongoDBCheckpointsCollectionName)
+
+	// feeds the GetPayment requests waiting for a status
+	app.projectionChanges = payments.NewProjectionChanges()
+
+	paymentEventsHandler := payments.NewEventsHandler(
+		repository,
+		pendingUpdatesRepository,
+		eventLogRepository,
+		historyRepository,
+		app.checkpointsRepository,
+		mongodb.NewStatusViolationsRepository(client, MongoDBDatabaseName, MongoDBStatusViolationsCollectionName),
+		app.statusTransitionPolicy,
+		app.projectionChanges,
+		app.logger.With(logattr.Component("payments.events.Handler")),
+	)
+
+	// the events are upcasted before reaching the handler, so the event log
+	// keeps them in the current schema and the rebuilds don't upcast them again
+	upcastingDeserializer := upcasting.NewDeserializer(
+		app.eventUpcasters,
+		paymentsevents.NewDeserializer(app.logger),
+		app.logger.With(logattr.Component("upcasting.Deserializer")),
+	)
+
+	app.deadLetters = deadletters.NewService(
+		mongodb.NewDeadLettersRepository(client, MongoDBDatabaseName, MongoDBDeadLettersCollectionName),
+		upcastingDeserializer,
+		paymentEventsHandler,
+		app.logger.With(logattr.Component("deadletters.Service")),
+	)
 
-	paymentsMessageProcessor := messages.NewProcessor[paymentsevents.Handler](
-		rabbitMQClient,
+	rebuildsRepository := mongodb.NewRebuildsRepository(client, MongoDBDatabaseName, MongoDBRebuildsCollectionName)
+	err = rebuildsRepository.EnsureIndexes(ensureIndexesCtx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating rebuilds indexes: %w", err)
+	}
+	app.rebuilder = rebuild.NewRebuilder(
+		eventLogRepository,
+		mongodb.NewProjectionsRepository(client, MongoDBDatabaseName, MongoDBEventLogCollectionName, app.activeCollection),
+		rebuildsRepository,
+		newRebuildEventsHandlerFactory(
+			client,
+			app.statusTransitionPolicy,
+			app.logger.With(logattr.Component("rebuild.EventsHandler")),
+		),
 		paymentsevents.NewDeserializer(app.logger),
+		// the events handled while an instance acknowledges the switch are done before timing out
+		app.dispatcherConfig.ProcessingTimeout,
+		app.logger.With(logattr.Component("rebuild.Rebuilder")),
+	)
+
+	// without consumer the dispatcher only applies the events of the ingestion api
+	var messageConsumer messages.Consumer
+	if consumer != nil {
+		// not set before, app.eventsConsumer must stay a nil interface without a consumer
+		app.eventsConsumer = consumer
+		messageConsumer = consumer
+	}
+
+	paymentsEventsDispatcher := NewDispatcher(
+		messageConsumer,
+		upcastingDeserializer,
 		paymentEventsHandler,
+		app.deadLetters,
+		app.dispatcherConfig,
+		app.logger.With(logattr.Component("app.Dispatcher")),
 	)
 
-	return paymentsMessageProcessor, nil
+	return paymentsEventsDispatcher, nil
 }
 
-func (app *App) startPublicAPIHTTPServer(appLogger *slog.Logger) (*http.Server, error) {
-	repository := mongodb.NewPaymentsRepository(app.mongoClient, "payments", "payments")
+func (app *App) startPublicAPIHTTPServer(ctx context.Context, appLogger *slog.Logger) (*http.Server, error) {
+	repository := mongodb.NewActivePaymentsRepository(app.mongoClient, MongoDBDatabaseName, app.activeCollection)
 
 	server, err := publicapi.NewServer(
 		public.NewHandler(
@@ -192,11 +662,48 @@ func (app *App) startPublicAPIHTTPServer(appLogger *slog.Logger) (*http.Server,
 	if err != nil {
 		panic(err)
 	}
+	historyHandler := public.NewHistoryHandler(
+		mongodb.NewHistoryRepository(app.mongoClient, MongoDBDatabaseName, MongoDBHistoryCollectionName),
+		repository,
+		appLogger.With(logattr.Component("http.PublicAPIHistoryHandler")),
+	)
+	streamHandler := public.NewStreamHandler(
+		mongodb.NewEventLogRepository(app.mongoClient, MongoDBDatabaseName, MongoDBEventLogCollectionName),
+		repository,
+		app.projectionChanges,
+		app.publicAPIConfig.Value.StreamHeartbeatInterval,
+		appLogger.With(logattr.Component("http.PublicAPIStreamHandler")),
+	)
+	app.runInBackground(func() { streamHandler.Run(ctx) })
+	waitForStatusHandler := public.NewWaitForStatusHandler(
+		server,
+		app.projectionChanges,
+		repository,
+		appLogger.With(logattr.Component("http.PublicAPIWaitForStatusHandler")),
+	)
 	httpServer := &http.Server{
-		Addr:    fmt.Sprintf("0.0.0.0:%d", app.publicAPIConfig.Value.PublicAPIHttpServerPort),
-		Handler: server,
+		Addr: fmt.Sprintf("0.0.0.0:%d", app.publicAPIConfig.Value.PublicAPIHttpServerPort),
+		Handler: public.NewHTTPHandler(
+			server,
+			historyHandler,
+			streamHandler,
+			waitForStatusHandler,
+			public.NewPaymentsPageHandler(
+				server,
+				repository,
+				appLogger.With(logattr.Component("http.PublicAPIPaymentsPageHandler")),
+			),
+			public.NewProjectionLag(
+				app.checkpointsRepository,
+				appLogger.With(logattr.Component("http.ProjectionLag")),
+			),
+		),
 	}
 
+	// the open streams and the waiting requests would keep the shutdown waiting
+	httpServer.RegisterOnShutdown(streamHandler.Close)
+	httpServer.RegisterOnShutdown(waitForStatusHandler.Close)
+
 	go func() {
 		defer appLogger.Info("http server stopped")
 		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -208,3 +715,54 @@ func (app *App) startPublicAPIHTTPServer(appLogger *slog.Logger) (*http.Server,
 
 	return httpServer, nil
 }
+
+func (app *App) startAdminAPIHTTPServer(appLogger *slog.Logger) *http.Server {
+	handler := admin.NewHandler(
+		mongodb.NewActivePaymentsRepository(app.mongoClient, MongoDBDatabaseName, app.activeCollection),
+		mongodb.NewPendingUpdatesRepository(app.mongoClient, MongoDBDatabaseName, MongoDBPendingUpdatesCollectionName),
+		app.deadLetters,
+		app.rebuilder,
+		app.checkpointsRepository,
+		mongodb.NewStatusViolationsRepository(app.mongoClient, MongoDBDatabaseName, MongoDBStatusViolationsCollectionName),
+		app.webhooks,
+		app.eventsConsumer,
+		appLogger.With(logattr.Component("http.AdminAPIHandler")),
+	)
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf("0.0.0.0:%d", app.adminAPIConfig.Value.AdminAPIHttpServerPort),
+		Handler: auth.RequireBearerToken(app.adminAPIConfig.Value.AuthToken, handler),
+	}
+
+	go func() {
+		defer appLogger.Info("admin http server stopped")
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			appLogger.Error("admin http server error", logattr.Error(err.Error()))
+		}
+	}()
+
+	appLogger.Info("admin http server started")
+
+	return httpServer
+}
+
+func (app *App) startIngestionAPIHTTPServer(dispatcher *Dispatcher, appLogger *slog.Logger) *http.Server {
+	handler := ingestion.NewHandler(
+		dispatcher,
+		appLogger.With(logattr.Component("http.IngestionAPIHandler")),
+	)
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf("0.0.0.0:%d", app.ingestionAPIConfig.Value.IngestionAPIHttpServerPort),
+		Handler: auth.RequireBearerToken(app.ingestionAPIConfig.Value.AuthToken, handler),
+	}
+
+	go func() {
+		defer appLogger.Info("ingestion http server stopped")
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			appLogger.Error("ingestion http server error", logattr.Error(err.Error()))
+		}
+	}()
+
+	appLogger.Info("ingestion http server started")
+
+	return httpServer
+}
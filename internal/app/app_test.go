@@ -0,0 +1,65 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/adapters/ndjson"
+	"github.com/walletera/payments-read-model/internal/domain/webhooks"
+)
+
+func TestNewAppRefusesInvalidBatchWrites(t *testing.T) {
+	tests := []struct {
+		name   string
+		config BatchWritesConfig
+	}{
+		{name: "batches of a single write", config: BatchWritesConfig{MaxBatchSize: 1, Window: DefaultBatchWritesWindow}},
+		{name: "negative max size", config: BatchWritesConfig{MaxBatchSize: -4, Window: DefaultBatchWritesWindow}},
+		{name: "zero window", config: BatchWritesConfig{MaxBatchSize: 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewApp(WithBatchWrites(tt.config))
+			if err == nil {
+				t.Errorf("expected the batch writes %+v to be refused", tt.config)
+			}
+		})
+	}
+}
+
+func TestNewAppAcceptsValidBatchWrites(t *testing.T) {
+	_, err := NewApp(WithBatchWrites(BatchWritesConfig{MaxBatchSize: 4, Window: 20 * time.Millisecond}))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+}
+
+func TestNewAppRefusesAnEmptyIngestionAPIAuthToken(t *testing.T) {
+	_, err := NewApp(WithIngestionAPIConfig(IngestionAPIConfig{IngestionAPIHttpServerPort: 8282}))
+	if err == nil {
+		t.Errorf("expected the ingestion api without auth token to be refused")
+	}
+}
+
+func TestNewAppRefusesWebhookDeliveriesWithoutWorkers(t *testing.T) {
+	config := webhooks.DefaultDeliveryConfig()
+	config.Workers = 0
+	_, err := NewApp(WithWebhookDeliveryConfig(config))
+	if err == nil {
+		t.Errorf("expected the webhook deliveries without workers to be refused")
+	}
+}
+
+func TestNewAppRefusesACheckpointOfTheStandardInput(t *testing.T) {
+	_, err := NewApp(WithFileEventsSource(ndjson.Config{Path: ndjson.Stdin, CheckpointPath: "checkpoint.json"}))
+	if err == nil {
+		t.Errorf("expected the checkpoint of the events read from the standard input to be refused")
+	}
+}
+
+func TestNewAppAcceptsACheckpointOfAFile(t *testing.T) {
+	_, err := NewApp(WithFileEventsSource(ndjson.Config{Path: "events.ndjson", CheckpointPath: "checkpoint.json"}))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+}
@@ -0,0 +1,13 @@
+package app
+
+import "time"
+
+const DefaultBatchWritesWindow = 10 * time.Millisecond
+
+type BatchWritesConfig struct {
+    // MaxBatchSize is the number of payment writes that triggers the BulkWrite.
+    // Each worker waits for its write, so it's bounded by the dispatcher workers.
+    MaxBatchSize int
+    // Window is the max time a payment write waits for the batch to fill up
+    Window time.Duration
+}
@@ -0,0 +1,403 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/deadletters"
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+	"github.com/walletera/eventskit/events"
+	"github.com/walletera/eventskit/messages"
+	paymentsevents "github.com/walletera/payments-types/events"
+	"github.com/walletera/werrors"
+)
+
+const (
+	DefaultDispatcherWorkers           = 8
+	DefaultDispatcherWorkerQueueSize   = 16
+	DefaultDispatcherProcessingTimeout = time.Minute
+)
+
+type DispatcherConfig struct {
+	// Workers is the number of events processed concurrently
+	Workers int
+	// WorkerQueueSize is the number of events that can be waiting for a busy worker.
+	// When the queue of a worker is full the dispatcher stops consuming messages.
+	WorkerQueueSize int
+	// ProcessingTimeout bounds the time spent on every attempt of handling an event
+	ProcessingTimeout time.Duration
+	Retry             RetryConfig
+	// UnknownEventsPolicy is applied to the events of a type the dispatcher doesn't handle
+	UnknownEventsPolicy UnknownEventsPolicy
+}
+
+// Dispatcher consumes the payments events and hands them to a fixed pool of workers.
+// Events are assigned to workers by hashing their payment id, so the events of a
+// payment are always handled by the same worker, one at a time and in arrival order.
+type Dispatcher struct {
+	messageConsumer    messages.Consumer
+	eventsDeserializer events.Deserializer[paymentsevents.Handler]
+	eventsHandler      paymentsevents.Handler
+	deadLetters        *deadletters.Service
+	config             DispatcherConfig
+	logger             *slog.Logger
+	metrics            dispatcherMetrics
+	// stopping is closed by Stop, to stop consuming messages
+	stopping chan struct{}
+	// cancelProcessing interrupts the events being handled
+	cancelProcessing context.CancelFunc
+	dispatchDone     chan struct{}
+	workers          sync.WaitGroup
+	msgCh            <-chan messages.Message
+	stopOnce         sync.Once
+	// applied receives the events handed over by Apply
+	applied chan dispatchedEvent
+}
+
+type dispatchedEvent struct {
+	message messages.Message
+	event   events.Event[paymentsevents.Handler]
+	// result, set for the events handed over by Apply, receives the outcome
+	// of the event instead of its message being acknowledged
+	result chan<- werrors.WError
+}
+
+func NewDispatcher(
+	messageConsumer messages.Consumer,
+	eventsDeserializer events.Deserializer[paymentsevents.Handler],
+	eventsHandler paymentsevents.Handler,
+	deadLetters *deadletters.Service,
+	config DispatcherConfig,
+	logger *slog.Logger,
+) *Dispatcher {
+	return &Dispatcher{
+		messageConsumer:    messageConsumer,
+		eventsDeserializer: eventsDeserializer,
+		eventsHandler:      eventsHandler,
+		deadLetters:        deadLetters,
+		config:             config,
+		logger:             logger,
+		metrics:            newDispatcherMetrics(),
+		stopping:           make(chan struct{}),
+		dispatchDone:       make(chan struct{}),
+		applied:            make(chan dispatchedEvent),
+	}
+}
+
+// Start consumes the messages until Stop is called. The events are handled with a
+// context that is not cancelled with ctx, so they can be drained by Stop.
+func (d *Dispatcher) Start(ctx context.Context) error {
+	if d.config.Workers < 1 {
+		return fmt.Errorf("invalid dispatcher workers count %d", d.config.Workers)
+	}
+
+	// without message consumer only the events handed over by Apply are dispatched
+	var msgCh <-chan messages.Message
+	if d.messageConsumer != nil {
+		var err error
+		msgCh, err = d.messageConsumer.Consume()
+		if err != nil {
+			return fmt.Errorf("failed consuming from message consumer: %w", err)
+		}
+	}
+
+	d.msgCh = msgCh
+	processingCtx, cancelProcessing := context.WithCancel(context.WithoutCancel(ctx))
+	d.cancelProcessing = cancelProcessing
+
+	workerQueues := make([]chan dispatchedEvent, d.config.Workers)
+	for i := range workerQueues {
+		workerQueues[i] = make(chan dispatchedEvent, d.config.WorkerQueueSize)
+		d.workers.Add(1)
+		go d.runWorker(processingCtx, workerQueues[i])
+	}
+
+	go d.dispatch(processingCtx, msgCh, workerQueues)
+
+	return nil
+}
+
+// Stop stops consuming messages and waits for the events being handled until ctx is
+// done. Then the events still being handled are interrupted. The events interrupted or
+// not handled yet are nacked with requeue, so they are delivered again after a restart.
+func (d *Dispatcher) Stop(ctx context.Context) {
+	if d.cancelProcessing == nil {
+		// never started
+		return
+	}
+	d.stopOnce.Do(func() { d.stop(ctx) })
+}
+
+func (d *Dispatcher) stop(ctx context.Context) {
+	d.logger.Info("stopping payments events dispatcher")
+	close(d.stopping)
+	<-d.dispatchDone
+
+	workersDone := make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+		d.logger.Info("in-flight events drained")
+	case <-ctx.Done():
+		d.logger.Warn("shutdown deadline exceeded, interrupting in-flight events")
+		d.cancelProcessing()
+		<-workersDone
+	}
+	d.cancelProcessing()
+
+	if d.messageConsumer == nil {
+		return
+	}
+	// the messages delivered but not dispatched are requeued by the broker when the consumer is closed
+	err := d.messageConsumer.Close()
+	if err != nil {
+		d.logger.Error("failed closing message consumer", logattr.Error(err.Error()))
+	}
+	// unblocks the consumer until it notices the close
+	go func() {
+		for range d.msgCh {
+		}
+	}()
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, msgCh <-chan messages.Message, workerQueues []chan dispatchedEvent) {
+	defer close(d.dispatchDone)
+	defer func() {
+		for _, workerQueue := range workerQueues {
+			close(workerQueue)
+		}
+	}()
+	for {
+		var dispatched dispatchedEvent
+		select {
+		case <-d.stopping:
+			return
+		case dispatched = <-d.applied:
+		case msg, ok := <-msgCh:
+			if !ok {
+				return
+			}
+			event, err := d.eventsDeserializer.Deserialize(msg.Payload())
+			if err != nil {
+				d.handleError(ctx, msg, werrors.NewUnprocessableMessageError(err.Error()), 1)
+				continue
+			}
+			if event == nil {
+				d.handleUnknownEvent(ctx, msg)
+				continue
+			}
+			dispatched = dispatchedEvent{message: msg, event: event}
+		}
+		// blocks while the worker queue is full, applying backpressure on the consumer
+		select {
+		case workerQueues[workerIndex(paymentIdOf(dispatched.event), len(workerQueues))] <- dispatched:
+		case <-d.stopping:
+			d.requeue(dispatched)
+			return
+		}
+	}
+}
+
+// Apply hands the event over to the worker of its payment, so it's handled in order with the
+// consumed events of the payment, and returns its id and the outcome of a single attempt.
+// It's neither retried nor sent to the dead letter store, the caller gets the error instead.
+func (d *Dispatcher) Apply(ctx context.Context, rawEvent []byte) (string, werrors.WError) {
+	event, err := d.eventsDeserializer.Deserialize(rawEvent)
+	if err != nil {
+		return "", werrors.NewUnprocessableMessageError(err.Error())
+	}
+	if event == nil {
+		// formatted here, werrors doesn't spread the format args
+		return "", werrors.NewUnprocessableMessageError(fmt.Sprintf("unknown event type %s", unknownEventType(rawEvent)))
+	}
+	// buffered, so the worker is never blocked by a caller that gave up waiting
+	result := make(chan werrors.WError, 1)
+	select {
+	case d.applied <- dispatchedEvent{event: event, result: result}:
+	case <-d.stopping:
+		return event.ID(), werrors.NewRetryableInternalError("payments events dispatcher stopping")
+	case <-d.dispatchDone:
+		return event.ID(), werrors.NewRetryableInternalError("payments events dispatcher stopped")
+	case <-ctx.Done():
+		return event.ID(), werrors.NewTimeoutError("event not dispatched: " + ctx.Err().Error())
+	}
+	select {
+	case werr := <-result:
+		return event.ID(), werr
+	case <-ctx.Done():
+		// the event may still be applied, applying it again is recognized as a redelivery
+		return event.ID(), werrors.NewTimeoutError("event dispatched but not applied yet: " + ctx.Err().Error())
+	}
+}
+
+func (d *Dispatcher) runWorker(ctx context.Context, workerQueue <-chan dispatchedEvent) {
+	defer d.workers.Done()
+	for dispatched := range workerQueue {
+		if d.isStopping() {
+			d.requeue(dispatched)
+			continue
+		}
+		if dispatched.result != nil {
+			dispatched.result <- d.processOnce(ctx, dispatched.event)
+			continue
+		}
+		d.process(ctx, dispatched)
+	}
+}
+
+func (d *Dispatcher) process(ctx context.Context, dispatched dispatchedEvent) {
+	attempts, werr := d.processWithRetries(ctx, dispatched.event)
+	if werr != nil {
+		if werr.IsRetryable() && d.isStopping() {
+			// the event may succeed after the restart, instead of ending in the dead letter store
+			d.requeue(dispatched)
+			return
+		}
+		d.handleError(ctx, dispatched.message, werr, attempts)
+		return
+	}
+	err := dispatched.message.Acknowledger().Ack()
+	if err != nil {
+		d.logger.Error(
+			"failed acknowledging message",
+			logattr.Error(err.Error()),
+			logattr.EventId(dispatched.event.ID()),
+		)
+	}
+}
+
+// processWithRetries handles the event, retrying it with a jittered exponential
+// backoff while it fails with a retryable error and the retry budget is not exhausted.
+// It returns the number of attempts made and the error of the last one.
+func (d *Dispatcher) processWithRetries(ctx context.Context, event events.Event[paymentsevents.Handler]) (int, werrors.WError) {
+	attempts := 0
+	for {
+		attempts++
+		werr := d.processOnce(ctx, event)
+		if werr == nil || !werr.IsRetryable() {
+			return attempts, werr
+		}
+		if attempts >= d.config.Retry.MaxAttempts {
+			d.metrics.retryBudgetsExhausted.Add(ctx, 1)
+			d.logger.Error(
+				"event retry budget exhausted",
+				logattr.EventId(event.ID()),
+				logattr.EventType(event.Type()),
+				logattr.Attempts(attempts),
+				logattr.Error(werr.Message()),
+			)
+			return attempts, werr
+		}
+		delay := d.config.Retry.backoff(attempts)
+		d.metrics.retries.Add(ctx, 1)
+		d.metrics.retryDelay.Record(ctx, delay.Milliseconds())
+		d.logger.Warn(
+			"retrying event processing",
+			logattr.EventId(event.ID()),
+			logattr.EventType(event.Type()),
+			logattr.Attempts(attempts),
+			logattr.RetryDelay(delay),
+			logattr.Error(werr.Message()),
+		)
+		select {
+		case <-ctx.Done():
+			return attempts, werrors.NewRetryableInternalError("event processing interrupted: %s", ctx.Err().Error())
+		case <-d.stopping:
+			return attempts, werrors.NewRetryableInternalError("event processing interrupted: dispatcher stopping")
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (d *Dispatcher) processOnce(ctx context.Context, event events.Event[paymentsevents.Handler]) werrors.WError {
+	ctxWithTimeout, cancelCtx := context.WithTimeout(ctx, d.config.ProcessingTimeout)
+	defer cancelCtx()
+	return event.Accept(ctxWithTimeout, d.eventsHandler)
+}
+
+// deadLetteredAcknowledger is implemented by the acknowledgers of the brokers dead lettering
+// the rejected messages on their own. The messages stored in the dead letter store are
+// acknowledged instead of rejected, so they are not dead lettered twice.
+type deadLetteredAcknowledger interface {
+	AckDeadLettered() error
+}
+
+// handleError sends the message to the dead letter store, so it can be
+// replayed later, and nacks it. The message is only requeued when it
+// couldn't be stored, to avoid losing it.
+func (d *Dispatcher) handleError(ctx context.Context, message messages.Message, werr werrors.WError, attempts int) {
+	d.logger.Error("failed processing message", logattr.Error(werr.Message()))
+	// the processing context may have timed out already
+	recordErr := d.deadLetters.Record(context.WithoutCancel(ctx), message.Payload(), werr, attempts)
+	requeue := recordErr != nil
+	if acknowledger, ok := message.Acknowledger().(deadLetteredAcknowledger); ok && !requeue {
+		err := acknowledger.AckDeadLettered()
+		if err != nil {
+			d.logger.Error("failed acknowledging dead lettered message", logattr.Error(err.Error()))
+		}
+		return
+	}
+	err := message.Acknowledger().Nack(messages.NackOpts{
+		Requeue:      requeue,
+		MaxRetries:   1,
+		ErrorCode:    werr.Code(),
+		ErrorMessage: werr.Message(),
+	})
+	if err != nil {
+		d.logger.Error("failed nacking message", logattr.Error(err.Error()))
+	}
+}
+
+// requeue nacks the message so the broker delivers it again. The caller of Apply
+// is answered with a retryable error instead.
+func (d *Dispatcher) requeue(dispatched dispatchedEvent) {
+	event := dispatched.event
+	if dispatched.result != nil {
+		dispatched.result <- werrors.NewRetryableInternalError("payments events dispatcher stopping")
+		return
+	}
+	err := dispatched.message.Acknowledger().Nack(messages.NackOpts{
+		Requeue:    true,
+		MaxRetries: 1,
+	})
+	if err != nil {
+		d.logger.Error("failed requeueing message", logattr.Error(err.Error()), logattr.EventId(event.ID()))
+		return
+	}
+	d.logger.Info("event requeued on shutdown", logattr.EventId(event.ID()), logattr.EventType(event.Type()))
+}
+
+func (d *Dispatcher) isStopping() bool {
+	select {
+	case <-d.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+func paymentIdOf(event events.Event[paymentsevents.Handler]) uuid.UUID {
+	switch e := event.(type) {
+	case paymentsevents.PaymentCreated:
+		return e.Data.ID
+	case paymentsevents.PaymentUpdated:
+		return e.Data.PaymentId
+	default:
+		return uuid.Nil
+	}
+}
+
+func workerIndex(paymentId uuid.UUID, workersCount int) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write(paymentId[:])
+	return int(hash.Sum32() % uint32(workersCount))
+}
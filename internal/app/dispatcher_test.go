@@ -0,0 +1,821 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/deadletters"
+
+	"github.com/google/uuid"
+	"github.com/walletera/eventskit/events"
+	"github.com/walletera/eventskit/messages"
+	paymentsevents "github.com/walletera/payments-types/events"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const settleTimeout = 5 * time.Second
+
+func TestDispatcherHandlesTheEventsOfEachPaymentInOrder(t *testing.T) {
+	const (
+		workers          = 3
+		eventsPerPayment = 5
+	)
+	handler := newRecordingHandler(2 * time.Millisecond)
+	test := newDispatcherTest(t, handler, DispatcherConfig{
+		Workers:           workers,
+		WorkerQueueSize:   2,
+		ProcessingTimeout: time.Second,
+		Retry:             RetryConfig{MaxAttempts: 1},
+	})
+
+	// two payments per worker, so the workers run concurrently
+	var paymentIds []uuid.UUID
+	paymentsPerWorker := make(map[int]int)
+	for len(paymentIds) < 2*workers {
+		paymentId := uuid.New()
+		index := workerIndex(paymentId, workers)
+		if paymentsPerWorker[index] < 2 {
+			paymentsPerWorker[index]++
+			paymentIds = append(paymentIds, paymentId)
+		}
+	}
+	// the events of the payments are interleaved
+	var acknowledgers []*fakeAcknowledger
+	for version := uint64(1); version <= eventsPerPayment; version++ {
+		for _, paymentId := range paymentIds {
+			acknowledgers = append(acknowledgers, test.publish(paymentUpdated(paymentId, version)))
+		}
+	}
+	test.waitSettled(acknowledgers)
+
+	for _, acknowledger := range acknowledgers {
+		if !acknowledger.isAcked() {
+			t.Fatalf("expected every event to be acknowledged")
+		}
+	}
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	for _, paymentId := range paymentIds {
+		expectedVersions := []uint64{1, 2, 3, 4, 5}
+		if !slices.Equal(handler.handledVersions[paymentId], expectedVersions) {
+			t.Errorf("expected payment %s versions to be handled in order %v, but got %v", paymentId, expectedVersions, handler.handledVersions[paymentId])
+		}
+	}
+	if handler.paymentOverlapped {
+		t.Errorf("expected the events of a payment to be handled one at a time")
+	}
+	if handler.maxActive > workers {
+		t.Errorf("expected at most %d events handled concurrently, but got %d", workers, handler.maxActive)
+	}
+	if handler.maxActive < 2 {
+		t.Errorf("expected the events of different payments to be handled concurrently")
+	}
+}
+
+func TestDispatcherRetriesRetryableFailuresWithBackoff(t *testing.T) {
+	handler := newRecordingHandler(0)
+	// the first attempt fails
+	handler.fail = func(attempt int) werrors.WError {
+		if attempt == 1 {
+			return werrors.NewRetryableInternalError("mongo unavailable")
+		}
+		return nil
+	}
+	test := newDispatcherTest(t, handler, retryingDispatcherConfig(3))
+
+	event := paymentUpdated(uuid.New(), 1)
+	acknowledger := test.publish(event)
+	test.waitSettled([]*fakeAcknowledger{acknowledger})
+
+	if !acknowledger.isAcked() {
+		t.Fatalf("expected the event to be acknowledged after being retried, but it was nacked %v", acknowledger.nacked())
+	}
+	if attempts := handler.attemptsOf(event.Id); attempts != 2 {
+		t.Errorf("expected 2 attempts, but got %d", attempts)
+	}
+	if retries := test.metrics.retries.total(); retries != 1 {
+		t.Errorf("expected 1 retry to be counted, but got %d", retries)
+	}
+	if delays := test.metrics.retryDelay.values(); len(delays) != 1 || delays[0] > retryTestMaxBackoff.Milliseconds() {
+		t.Errorf("expected 1 retry delay of at most %s to be recorded, but got %v", retryTestMaxBackoff, delays)
+	}
+	if exhausted := test.metrics.retryBudgetsExhausted.total(); exhausted != 0 {
+		t.Errorf("expected no retry budget to be exhausted, but got %d", exhausted)
+	}
+	if entries := test.deadLetterEntries(); len(entries) != 0 {
+		t.Errorf("expected no dead letter, but got %d", len(entries))
+	}
+}
+
+func TestDispatcherDeadLettersTheEventsExhaustingTheirRetryBudget(t *testing.T) {
+	const maxAttempts = 3
+	handler := newRecordingHandler(0)
+	handler.fail = func(int) werrors.WError {
+		return werrors.NewRetryableInternalError("mongo unavailable")
+	}
+	test := newDispatcherTest(t, handler, retryingDispatcherConfig(maxAttempts))
+
+	event := paymentUpdated(uuid.New(), 1)
+	acknowledger := test.publish(event)
+	test.waitSettled([]*fakeAcknowledger{acknowledger})
+
+	nacks := acknowledger.nacked()
+	if len(nacks) != 1 || nacks[0].Requeue {
+		t.Fatalf("expected the event to be nacked without requeue, but got %v", nacks)
+	}
+	if attempts := handler.attemptsOf(event.Id); attempts != maxAttempts {
+		t.Errorf("expected %d attempts, but got %d", maxAttempts, attempts)
+	}
+	if retries := test.metrics.retries.total(); retries != maxAttempts-1 {
+		t.Errorf("expected %d retries to be counted, but got %d", maxAttempts-1, retries)
+	}
+	if exhausted := test.metrics.retryBudgetsExhausted.total(); exhausted != 1 {
+		t.Errorf("expected 1 exhausted retry budget to be counted, but got %d", exhausted)
+	}
+	if !test.logs.contains("event retry budget exhausted") {
+		t.Errorf("expected the exhausted retry budget to be logged")
+	}
+	entries := test.deadLetterEntries()
+	if len(entries) != 1 || entries[0].Attempts != maxAttempts || entries[0].ErrorCode != werrors.InternalErrorCode {
+		t.Errorf("expected a dead letter with %d attempts, but got %+v", maxAttempts, entries)
+	}
+}
+
+func TestDispatcherDoesNotRetryNonRetryableFailures(t *testing.T) {
+	handler := newRecordingHandler(0)
+	handler.fail = func(int) werrors.WError {
+		return werrors.NewUnprocessableMessageError("invalid payment update")
+	}
+	test := newDispatcherTest(t, handler, retryingDispatcherConfig(3))
+
+	event := paymentUpdated(uuid.New(), 1)
+	acknowledger := test.publish(event)
+	test.waitSettled([]*fakeAcknowledger{acknowledger})
+
+	if attempts := handler.attemptsOf(event.Id); attempts != 1 {
+		t.Errorf("expected 1 attempt, but got %d", attempts)
+	}
+	if retries := test.metrics.retries.total(); retries != 0 {
+		t.Errorf("expected no retry to be counted, but got %d", retries)
+	}
+	if entries := test.deadLetterEntries(); len(entries) != 1 || entries[0].Attempts != 1 {
+		t.Errorf("expected a dead letter with 1 attempt, but got %+v", entries)
+	}
+}
+
+func TestDispatcherAcknowledgesTheDeadLetteredEventsOfABrokerDeadLetteringThem(t *testing.T) {
+	handler := newRecordingHandler(0)
+	handler.fail = func(int) werrors.WError {
+		return werrors.NewUnprocessableMessageError("invalid payment update")
+	}
+	test := newDispatcherTest(t, handler, retryingDispatcherConfig(3))
+
+	event := paymentUpdated(uuid.New(), 1)
+	test.deserializer.add(event)
+	acknowledger := &deadLetteringAcknowledger{fakeAcknowledger: newFakeAcknowledger()}
+	test.consumer.messages <- messages.NewMessage([]byte(event.ID()), acknowledger)
+	test.waitSettled([]*fakeAcknowledger{acknowledger.fakeAcknowledger})
+
+	if !acknowledger.isAcked() || len(acknowledger.nacked()) != 0 {
+		t.Errorf("expected the event to be acknowledged as dead lettered, not dead lettered again by the broker, but got nacks %v", acknowledger.nacked())
+	}
+	if entries := test.deadLetterEntries(); len(entries) != 1 {
+		t.Errorf("expected a dead letter, but got %d", len(entries))
+	}
+}
+
+func TestDispatcherCountsTheUnknownEventsByTypeAndPolicy(t *testing.T) {
+	tests := []struct {
+		policy             UnknownEventsPolicy
+		expectAck          bool
+		expectedDeadLetter int
+	}{
+		{policy: UnknownEventsPolicySkip, expectAck: true},
+		{policy: UnknownEventsPolicyDeadLetter, expectedDeadLetter: 1},
+		{policy: UnknownEventsPolicyFail},
+	}
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			config := retryingDispatcherConfig(1)
+			config.UnknownEventsPolicy = test.policy
+			dt := newDispatcherTest(t, newRecordingHandler(0), config)
+
+			acknowledger := dt.publishPayload([]byte(`{"id":"4d7e3c1c-6b1e-4e9e-9d7c-1f3f4b2b9a10","type":"PaymentRefunded"}`))
+			dt.waitSettled([]*fakeAcknowledger{acknowledger})
+
+			if acknowledger.isAcked() != test.expectAck {
+				t.Errorf("expected acked to be %t, but got nacks %v", test.expectAck, acknowledger.nacked())
+			}
+			for _, nack := range acknowledger.nacked() {
+				if nack.Requeue {
+					t.Errorf("expected the unknown event not to be requeued")
+				}
+			}
+			if entries := dt.deadLetterEntries(); len(entries) != test.expectedDeadLetter {
+				t.Errorf("expected %d dead letters, but got %d", test.expectedDeadLetter, len(entries))
+			}
+			attributes := dt.metrics.unknownEvents.recordedAttributes()
+			if dt.metrics.unknownEvents.total() != 1 || len(attributes) != 1 {
+				t.Fatalf("expected the unknown event to be counted once, but got %d", dt.metrics.unknownEvents.total())
+			}
+			eventType, _ := attributes[0].Value("event_type")
+			policy, _ := attributes[0].Value("policy")
+			if eventType.AsString() != "PaymentRefunded" || policy.AsString() != string(test.policy) {
+				t.Errorf("expected the unknown event to be counted with event_type PaymentRefunded and policy %s, but got %s",
+					test.policy, attributes[0].Encoded(attribute.DefaultEncoder()))
+			}
+		})
+	}
+}
+
+const retryTestMaxBackoff = 4 * time.Millisecond
+
+func retryingDispatcherConfig(maxAttempts int) DispatcherConfig {
+	return DispatcherConfig{
+		Workers:           1,
+		WorkerQueueSize:   1,
+		ProcessingTimeout: time.Second,
+		Retry: RetryConfig{
+			MaxAttempts:    maxAttempts,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     retryTestMaxBackoff,
+		},
+	}
+}
+
+// dispatcherTest runs a dispatcher consuming the messages published by the test
+func TestDispatcherAppliesTheEventsHandedOverInOrderWithTheConsumedOnes(t *testing.T) {
+	handler := newRecordingHandler(20 * time.Millisecond)
+	test := newDispatcherTest(t, handler, DispatcherConfig{
+		Workers:           3,
+		WorkerQueueSize:   2,
+		ProcessingTimeout: time.Second,
+		Retry:             RetryConfig{MaxAttempts: 1},
+	})
+	paymentId := uuid.New()
+	consumed := test.publish(paymentUpdated(paymentId, 1))
+	handler.waitActive(t, 1)
+
+	applied := paymentUpdated(paymentId, 2)
+	test.deserializer.add(applied)
+	eventId, werr := test.dispatcher.Apply(context.Background(), []byte(applied.ID()))
+	test.waitSettled([]*fakeAcknowledger{consumed})
+
+	if werr != nil {
+		t.Fatalf("unexpected error: %s", werr.Message())
+	}
+	if eventId != applied.ID() {
+		t.Errorf("expected the event id %s, but got %s", applied.ID(), eventId)
+	}
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if expectedVersions := []uint64{1, 2}; !slices.Equal(handler.handledVersions[paymentId], expectedVersions) {
+		t.Errorf("expected the versions to be handled in order %v, but got %v", expectedVersions, handler.handledVersions[paymentId])
+	}
+	if handler.paymentOverlapped {
+		t.Errorf("expected the events of the payment to be handled one at a time")
+	}
+}
+
+func TestDispatcherNeitherRetriesNorDeadLettersTheEventsHandedOver(t *testing.T) {
+	handler := newRecordingHandler(0)
+	handler.fail = func(int) werrors.WError {
+		return werrors.NewRetryableInternalError("mongo unavailable")
+	}
+	test := newDispatcherTest(t, handler, retryingDispatcherConfig(3))
+
+	event := paymentUpdated(uuid.New(), 1)
+	test.deserializer.add(event)
+	_, werr := test.dispatcher.Apply(context.Background(), []byte(event.ID()))
+
+	if werr == nil || !werr.IsRetryable() {
+		t.Fatalf("expected the retryable error of the event, but got %v", werr)
+	}
+	if attempts := handler.attemptsOf(event.Id); attempts != 1 {
+		t.Errorf("expected 1 attempt, but got %d", attempts)
+	}
+	if entries := test.deadLetterEntries(); len(entries) != 0 {
+		t.Errorf("expected no dead letter, but got %d", len(entries))
+	}
+}
+
+func TestDispatcherRefusesTheUnknownEventsHandedOver(t *testing.T) {
+	test := newDispatcherTest(t, newRecordingHandler(0), retryingDispatcherConfig(3))
+
+	_, werr := test.dispatcher.Apply(context.Background(), []byte(`{"type":"PaymentRefunded"}`))
+
+	if werr == nil || werr.Code() != werrors.UnprocessableMessageErrorCode || werr.Message() != "unprocessable message: unknown event type PaymentRefunded" {
+		t.Errorf("expected an unknown event type error, but got %v", werr)
+	}
+}
+
+func TestDispatcherStopDrainsTheInFlightEvents(t *testing.T) {
+	handler := newRecordingHandler(200 * time.Millisecond)
+	test := newDispatcherTest(t, handler, DispatcherConfig{
+		Workers:           2,
+		WorkerQueueSize:   2,
+		ProcessingTimeout: time.Second,
+		Retry:             RetryConfig{MaxAttempts: 1},
+	})
+	// one payment per worker, so both events are in flight, the queued ones being requeued
+	first, second := uuid.New(), uuid.New()
+	for workerIndex(second, 2) == workerIndex(first, 2) {
+		second = uuid.New()
+	}
+	acknowledgers := []*fakeAcknowledger{
+		test.publish(paymentUpdated(first, 1)),
+		test.publish(paymentUpdated(second, 1)),
+	}
+	handler.waitActive(t, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+	defer cancel()
+	test.dispatcher.Stop(ctx)
+
+	for _, acknowledger := range acknowledgers {
+		if !acknowledger.isAcked() {
+			t.Errorf("expected the in-flight event to be drained and acknowledged, but it was nacked %v", acknowledger.nacked())
+		}
+	}
+}
+
+func TestDispatcherStopRequeuesTheEventsNotHandledBeforeTheDeadline(t *testing.T) {
+	// the events are never handled before the shutdown deadline
+	handler := newRecordingHandler(time.Hour)
+	test := newDispatcherTest(t, handler, DispatcherConfig{
+		Workers:           1,
+		WorkerQueueSize:   5,
+		ProcessingTimeout: time.Hour,
+		Retry:             RetryConfig{MaxAttempts: 1},
+	})
+	// the first event is interrupted, the others are still queued
+	paymentId := uuid.New()
+	var acknowledgers []*fakeAcknowledger
+	for version := uint64(1); version <= 3; version++ {
+		acknowledgers = append(acknowledgers, test.publish(paymentUpdated(paymentId, version)))
+	}
+	handler.waitActive(t, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	test.dispatcher.Stop(ctx)
+	test.waitSettled(acknowledgers)
+
+	for i, acknowledger := range acknowledgers {
+		nacks := acknowledger.nacked()
+		if acknowledger.isAcked() || len(nacks) != 1 || !nacks[0].Requeue {
+			t.Errorf("expected the event %d to be nacked with requeue, but got acked %t and nacks %v", i, acknowledger.isAcked(), nacks)
+		}
+	}
+	if entries := test.deadLetterEntries(); len(entries) != 0 {
+		t.Errorf("expected no dead letter, but got %d", len(entries))
+	}
+}
+
+func TestDispatcherRefusesTheEventsHandedOverOnceStopping(t *testing.T) {
+	handler := newRecordingHandler(200 * time.Millisecond)
+	test := newDispatcherTest(t, handler, DispatcherConfig{
+		Workers:           1,
+		WorkerQueueSize:   2,
+		ProcessingTimeout: time.Second,
+		Retry:             RetryConfig{MaxAttempts: 1},
+	})
+	inFlight := test.publish(paymentUpdated(uuid.New(), 1))
+	handler.waitActive(t, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		test.dispatcher.Stop(ctx)
+	}()
+	// the http servers are still up while the in-flight events are drained
+	applied := paymentUpdated(uuid.New(), 1)
+	test.deserializer.add(applied)
+	var werr werrors.WError
+	for werr == nil {
+		_, werr = test.dispatcher.Apply(context.Background(), []byte(applied.ID()))
+	}
+	<-stopped
+
+	if !werr.IsRetryable() {
+		t.Errorf("expected a retryable error, but got %s", werr.Message())
+	}
+	if !inFlight.isAcked() {
+		t.Errorf("expected the in-flight event to be drained and acknowledged, but it was nacked %v", inFlight.nacked())
+	}
+}
+
+type dispatcherTest struct {
+	t            *testing.T
+	dispatcher   *Dispatcher
+	consumer     *fakeConsumer
+	deadLetters  *fakeDeadLettersRepository
+	deserializer fakeDeserializer
+	metrics      recordingDispatcherMetrics
+	logs         *lockedBuffer
+}
+
+func newDispatcherTest(t *testing.T, handler paymentsevents.Handler, config DispatcherConfig) *dispatcherTest {
+	t.Helper()
+	logs := &lockedBuffer{}
+	logger := slog.New(slog.NewTextHandler(logs, nil))
+	consumer := newFakeConsumer()
+	deserializer := fakeDeserializer{
+		mu:     &sync.Mutex{},
+		events: make(map[string]events.Event[paymentsevents.Handler]),
+	}
+	deadLettersRepository := newFakeDeadLettersRepository()
+	dispatcher := NewDispatcher(
+		consumer,
+		deserializer,
+		handler,
+		deadletters.NewService(deadLettersRepository, deserializer, handler, logger),
+		config,
+		logger,
+	)
+	metrics := newRecordingDispatcherMetrics()
+	dispatcher.metrics = metrics.dispatcherMetrics()
+	err := dispatcher.Start(context.Background())
+	if err != nil {
+		t.Fatalf("failed starting dispatcher: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+		defer cancel()
+		dispatcher.Stop(ctx)
+	})
+	return &dispatcherTest{
+		t:            t,
+		dispatcher:   dispatcher,
+		consumer:     consumer,
+		deadLetters:  deadLettersRepository,
+		deserializer: deserializer,
+		metrics:      metrics,
+		logs:         logs,
+	}
+}
+
+// publish delivers the event to the dispatcher and returns the acknowledger of its message
+func (dt *dispatcherTest) publish(event events.Event[paymentsevents.Handler]) *fakeAcknowledger {
+	dt.deserializer.add(event)
+	return dt.publishPayload([]byte(event.ID()))
+}
+
+func (dt *dispatcherTest) publishPayload(payload []byte) *fakeAcknowledger {
+	acknowledger := newFakeAcknowledger()
+	dt.consumer.messages <- messages.NewMessage(payload, acknowledger)
+	return acknowledger
+}
+
+func (dt *dispatcherTest) deadLetterEntries() []deadletters.Entry {
+	entries, _ := dt.deadLetters.SearchEntries(context.Background(), deadletters.Filter{})
+	return entries
+}
+
+// waitSettled waits until every message is acked or nacked
+func (dt *dispatcherTest) waitSettled(acknowledgers []*fakeAcknowledger) {
+	dt.t.Helper()
+	timeout := time.After(settleTimeout)
+	for _, acknowledger := range acknowledgers {
+		select {
+		case <-acknowledger.settled:
+		case <-timeout:
+			dt.t.Fatalf("the messages were not acked nor nacked after %s", settleTimeout)
+		}
+	}
+}
+
+func paymentUpdated(paymentId uuid.UUID, version uint64) paymentsevents.PaymentUpdated {
+	return paymentsevents.PaymentUpdated{
+		Id:                    uuid.New(),
+		EventType:             paymentsevents.PaymentUpdatedType,
+		EventAggregateVersion: version,
+		EventCreatedAt:        time.Now(),
+		Data: privateapi.PaymentUpdate{
+			PaymentId: paymentId,
+			Status:    privateapi.PaymentStatusConfirmed,
+		},
+	}
+}
+
+type fakeConsumer struct {
+	messages  chan messages.Message
+	closeOnce sync.Once
+}
+
+func newFakeConsumer() *fakeConsumer {
+	return &fakeConsumer{messages: make(chan messages.Message, 100)}
+}
+
+func (c *fakeConsumer) Consume() (<-chan messages.Message, error) {
+	return c.messages, nil
+}
+
+func (c *fakeConsumer) Close() error {
+	c.closeOnce.Do(func() { close(c.messages) })
+	return nil
+}
+
+type fakeAcknowledger struct {
+	mu      sync.Mutex
+	acked   bool
+	nacks   []messages.NackOpts
+	settled chan struct{}
+}
+
+func newFakeAcknowledger() *fakeAcknowledger {
+	return &fakeAcknowledger{settled: make(chan struct{})}
+}
+
+func (a *fakeAcknowledger) Ack() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acked = true
+	close(a.settled)
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(opts messages.NackOpts) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.nacks = append(a.nacks, opts)
+	close(a.settled)
+	return nil
+}
+
+// deadLetteringAcknowledger is the acknowledger of a broker dead lettering the rejected messages
+type deadLetteringAcknowledger struct {
+	*fakeAcknowledger
+}
+
+func (a *deadLetteringAcknowledger) AckDeadLettered() error {
+	return a.Ack()
+}
+
+func (a *fakeAcknowledger) isAcked() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.acked
+}
+
+func (a *fakeAcknowledger) nacked() []messages.NackOpts {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return slices.Clone(a.nacks)
+}
+
+// fakeDeserializer returns the event whose id is the payload, nil when the id is unknown
+type fakeDeserializer struct {
+	mu     *sync.Mutex
+	events map[string]events.Event[paymentsevents.Handler]
+}
+
+func (d fakeDeserializer) add(event events.Event[paymentsevents.Handler]) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.events[event.ID()] = event
+}
+
+func (d fakeDeserializer) Deserialize(rawEvent []byte) (events.Event[paymentsevents.Handler], error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.events[string(rawEvent)], nil
+}
+
+// recordingHandler records the versions handled for each payment and how many events
+// are handled concurrently. fail, when set, decides the result of every attempt.
+type recordingHandler struct {
+	mu                sync.Mutex
+	delay             time.Duration
+	fail              func(attempt int) werrors.WError
+	attempts          map[uuid.UUID]int
+	handledVersions   map[uuid.UUID][]uint64
+	activePayments    map[uuid.UUID]bool
+	active            int
+	maxActive         int
+	paymentOverlapped bool
+}
+
+func newRecordingHandler(delay time.Duration) *recordingHandler {
+	return &recordingHandler{
+		delay:           delay,
+		attempts:        make(map[uuid.UUID]int),
+		handledVersions: make(map[uuid.UUID][]uint64),
+		activePayments:  make(map[uuid.UUID]bool),
+	}
+}
+
+func (h *recordingHandler) HandlePaymentCreated(ctx context.Context, event paymentsevents.PaymentCreated) werrors.WError {
+	return h.handle(ctx, event.Id, event.Data.ID, event.AggregateVersion())
+}
+
+func (h *recordingHandler) HandlePaymentUpdated(ctx context.Context, event paymentsevents.PaymentUpdated) werrors.WError {
+	return h.handle(ctx, event.Id, event.Data.PaymentId, event.AggregateVersion())
+}
+
+func (h *recordingHandler) handle(ctx context.Context, eventId uuid.UUID, paymentId uuid.UUID, version uint64) werrors.WError {
+	h.mu.Lock()
+	h.attempts[eventId]++
+	attempt := h.attempts[eventId]
+	if h.activePayments[paymentId] {
+		h.paymentOverlapped = true
+	}
+	h.activePayments[paymentId] = true
+	h.active++
+	h.maxActive = max(h.maxActive, h.active)
+	h.mu.Unlock()
+
+	select {
+	case <-time.After(h.delay):
+	case <-ctx.Done():
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.active--
+	delete(h.activePayments, paymentId)
+	if ctx.Err() != nil {
+		return werrors.NewRetryableInternalError("event handling interrupted")
+	}
+	if h.fail != nil {
+		if werr := h.fail(attempt); werr != nil {
+			return werr
+		}
+	}
+	h.handledVersions[paymentId] = append(h.handledVersions[paymentId], version)
+	return nil
+}
+
+// waitActive waits until the given number of events are being handled
+func (h *recordingHandler) waitActive(t *testing.T, events int) {
+	t.Helper()
+	deadline := time.Now().Add(settleTimeout)
+	for time.Now().Before(deadline) {
+		h.mu.Lock()
+		active := h.active
+		h.mu.Unlock()
+		if active >= events {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("%d events not handled after %s", events, settleTimeout)
+}
+
+func (h *recordingHandler) attemptsOf(eventId uuid.UUID) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.attempts[eventId]
+}
+
+type fakeDeadLettersRepository struct {
+	mu      sync.Mutex
+	entries map[uuid.UUID]deadletters.Entry
+}
+
+func newFakeDeadLettersRepository() *fakeDeadLettersRepository {
+	return &fakeDeadLettersRepository{entries: make(map[uuid.UUID]deadletters.Entry)}
+}
+
+func (r *fakeDeadLettersRepository) SaveEntry(_ context.Context, entry deadletters.Entry) werrors.WError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.entries[entry.ID]; ok {
+		entry.Attempts += existing.Attempts
+		entry.FirstFailedAt = existing.FirstFailedAt
+	}
+	r.entries[entry.ID] = entry
+	return nil
+}
+
+func (r *fakeDeadLettersRepository) GetEntry(_ context.Context, id uuid.UUID) (deadletters.Entry, werrors.WError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.entries[id]
+	if !ok {
+		return deadletters.Entry{}, werrors.NewResourceNotFoundError("dead letter %s not found", id)
+	}
+	return entry, nil
+}
+
+func (r *fakeDeadLettersRepository) SearchEntries(_ context.Context, _ deadletters.Filter) ([]deadletters.Entry, werrors.WError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var entries []deadletters.Entry
+	for _, entry := range r.entries {
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (r *fakeDeadLettersRepository) DeleteEntry(_ context.Context, id uuid.UUID) werrors.WError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, id)
+	return nil
+}
+
+type recordingDispatcherMetrics struct {
+	retries               *recordingCounter
+	retryDelay            *recordingHistogram
+	retryBudgetsExhausted *recordingCounter
+	unknownEvents         *recordingCounter
+}
+
+func newRecordingDispatcherMetrics() recordingDispatcherMetrics {
+	return recordingDispatcherMetrics{
+		retries:               &recordingCounter{},
+		retryDelay:            &recordingHistogram{},
+		retryBudgetsExhausted: &recordingCounter{},
+		unknownEvents:         &recordingCounter{},
+	}
+}
+
+func (m recordingDispatcherMetrics) dispatcherMetrics() dispatcherMetrics {
+	return dispatcherMetrics{
+		retries:               m.retries,
+		retryDelay:            m.retryDelay,
+		retryBudgetsExhausted: m.retryBudgetsExhausted,
+		unknownEvents:         m.unknownEvents,
+	}
+}
+
+// recordingCounter records the increments and their attributes,
+// the methods it doesn't override panic
+type recordingCounter struct {
+	metric.Int64Counter
+	mu         sync.Mutex
+	increments []int64
+	attributes []attribute.Set
+}
+
+func (c *recordingCounter) Add(_ context.Context, increment int64, opts ...metric.AddOption) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.increments = append(c.increments, increment)
+	c.attributes = append(c.attributes, metric.NewAddConfig(opts).Attributes())
+}
+
+func (c *recordingCounter) total() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var total int64
+	for _, increment := range c.increments {
+		total += increment
+	}
+	return total
+}
+
+func (c *recordingCounter) recordedAttributes() []attribute.Set {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.attributes)
+}
+
+// recordingHistogram records the values, the methods it doesn't override panic
+type recordingHistogram struct {
+	metric.Int64Histogram
+	mu       sync.Mutex
+	recorded []int64
+}
+
+func (h *recordingHistogram) Record(_ context.Context, value int64, _ ...metric.RecordOption) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.recorded = append(h.recorded, value)
+}
+
+func (h *recordingHistogram) values() []int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.recorded)
+}
+
+// lockedBuffer keeps the logs written concurrently by the workers
+type lockedBuffer struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) contains(text string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Contains(b.buffer.String(), text)
+}
@@ -0,0 +1,7 @@
+package app
+
+type IngestionAPIConfig struct {
+    IngestionAPIHttpServerPort int
+    // AuthToken is the bearer token required by the ingestion endpoint
+    AuthToken string
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/walletera/payments-read-model/internal/app"
+
+type dispatcherMetrics struct {
+	retries               metric.Int64Counter
+	retryDelay            metric.Int64Histogram
+	retryBudgetsExhausted metric.Int64Counter
+	unknownEvents         metric.Int64Counter
+}
+
+func newDispatcherMetrics() dispatcherMetrics {
+	meter := otel.Meter(meterName)
+	return dispatcherMetrics{
+		retries: mustInt64Counter(
+			meter,
+			"payments_read_model.events.retries",
+			"Retries of events that failed with a retryable error",
+		),
+		retryDelay: mustInt64Histogram(
+			meter,
+			"payments_read_model.events.retry_delay",
+			"Delay applied before retrying an event",
+			"ms",
+		),
+		retryBudgetsExhausted: mustInt64Counter(
+			meter,
+			"payments_read_model.events.retry_budget_exhausted",
+			"Events sent to the dead letter store after exhausting their retry budget",
+		),
+		unknownEvents: mustInt64Counter(
+			meter,
+			"payments_read_model.events.unknown",
+			"Events of a type the payments-read-model doesn't handle, by event type",
+		),
+	}
+}
+
+func mustInt64Counter(meter metric.Meter, name string, description string) metric.Int64Counter {
+	counter, err := meter.Int64Counter(name, metric.WithDescription(description))
+	if err != nil {
+		panic("failed creating counter " + name + ": " + err.Error())
+	}
+	return counter
+}
+
+func mustInt64Histogram(meter metric.Meter, name string, description string, unit string) metric.Int64Histogram {
+	histogram, err := meter.Int64Histogram(name, metric.WithDescription(description), metric.WithUnit(unit))
+	if err != nil {
+		panic("failed creating histogram " + name + ": " + err.Error())
+	}
+	return histogram
+}
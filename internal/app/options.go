@@ -1,6 +1,15 @@
 package app
 
-import "log/slog"
+import (
+    "log/slog"
+    "time"
+
+    "github.com/walletera/payments-read-model/internal/adapters/ndjson"
+    "github.com/walletera/payments-read-model/internal/adapters/rabbitmq"
+    "github.com/walletera/payments-read-model/internal/domain/payments"
+    "github.com/walletera/payments-read-model/internal/domain/upcasting"
+    "github.com/walletera/payments-read-model/internal/domain/webhooks"
+)
 
 type Option func(app *App)
 
@@ -10,18 +19,124 @@ func WithPublicAPIConfig(config PublicAPIConfig) func(a *App) {
     }
 }
 
+func WithAdminAPIConfig(config AdminAPIConfig) func(a *App) {
+    return func(a *App) {
+        a.adminAPIConfig = NewOptional[AdminAPIConfig](config)
+    }
+}
+
+// WithIngestionAPIConfig enables the HTTP endpoint the payments events can be pushed to.
+// Without a RabbitMQ host nor a file events source, it's the only source of events.
+func WithIngestionAPIConfig(config IngestionAPIConfig) func(a *App) {
+    return func(a *App) {
+        a.ingestionAPIConfig = NewOptional[IngestionAPIConfig](config)
+    }
+}
+
 func WithRabbitmqHost(host string) func(a *App) { return func(a *App) { a.rabbitmqHost = host } }
 
 func WithRabbitmqPort(port int) func(a *App) { return func(a *App) { a.rabbitmqPort = port } }
 
+// WithProjectionUpdatesExchange sets the exchange the PaymentProjectionUpdated events are published to
+func WithProjectionUpdatesExchange(exchangeName string) func(a *App) {
+    return func(a *App) {
+        a.projectionUpdatesExchangeName = exchangeName
+    }
+}
+
+// WithWebhookDeliveryConfig sets the retries and the timeout of the webhook deliveries
+func WithWebhookDeliveryConfig(config webhooks.DeliveryConfig) func(a *App) {
+    return func(a *App) {
+        a.webhookDeliveryConfig = config
+    }
+}
+
+// WithRabbitMQReconnectBackoff sets the backoff between the attempts to reconnect to RabbitMQ
+func WithRabbitMQReconnectBackoff(initial time.Duration, max time.Duration) func(a *App) {
+    return func(a *App) {
+        a.rabbitmqReconnect = rabbitmq.ReconnectConfig{
+            InitialBackoff: initial,
+            MaxBackoff:     max,
+        }
+    }
+}
+
+// WithFileEventsSource consumes the payments events from NDJSON files, or the
+// standard input, instead of RabbitMQ
+func WithFileEventsSource(config ndjson.Config) func(a *App) {
+    return func(a *App) {
+        a.fileEventsSource = NewOptional[ndjson.Config](config)
+    }
+}
+
 func WithRabbitmqUser(user string) func(a *App) { return func(a *App) { a.rabbitmqUser = user } }
 
 func WithRabbitmqPassword(password string) func(a *App) {
     return func(a *App) { a.rabbitmqPassword = password }
 }
 
+// WithRabbitMQTopology sets the exchanges, queues and bindings declared and consumed by the app
+func WithRabbitMQTopology(topology rabbitmq.Topology) func(a *App) {
+    return func(a *App) { a.rabbitmqTopology = topology }
+}
+
 func WithMongoDBURL(url string) func(a *App) { return func(a *App) { a.mongodbURL = url } }
 
 func WithLogHandler(handler slog.Handler) func(app *App) {
     return func(app *App) { app.logHandler = handler }
 }
+
+// WithPendingUpdatesTTL sets how long a payment update can stay parked
+// waiting for the updates preceding it before being reported
+func WithPendingUpdatesTTL(ttl time.Duration) func(app *App) {
+    return func(app *App) { app.pendingUpdatesTTL = ttl }
+}
+
+// WithDispatcherWorkers sets the number of workers processing the payments events concurrently
+func WithDispatcherWorkers(workers int) func(app *App) {
+    return func(app *App) { app.dispatcherConfig.Workers = workers }
+}
+
+// WithDispatcherWorkerQueueSize sets the number of events that can be waiting for a busy worker
+func WithDispatcherWorkerQueueSize(queueSize int) func(app *App) {
+    return func(app *App) { app.dispatcherConfig.WorkerQueueSize = queueSize }
+}
+
+// WithDispatcherProcessingTimeout bounds the time spent on every attempt of handling an event
+func WithDispatcherProcessingTimeout(timeout time.Duration) func(app *App) {
+    return func(app *App) { app.dispatcherConfig.ProcessingTimeout = timeout }
+}
+
+// WithRetryMaxAttempts sets the retry budget of the events failing with a retryable error
+func WithRetryMaxAttempts(maxAttempts int) func(app *App) {
+    return func(app *App) { app.dispatcherConfig.Retry.MaxAttempts = maxAttempts }
+}
+
+// WithRetryBackoff sets the delay before the first retry of an event and the max delay between retries
+func WithRetryBackoff(initialBackoff time.Duration, maxBackoff time.Duration) func(app *App) {
+    return func(app *App) {
+        app.dispatcherConfig.Retry.InitialBackoff = initialBackoff
+        app.dispatcherConfig.Retry.MaxBackoff = maxBackoff
+    }
+}
+
+// WithUnknownEventsPolicy sets what to do with the events of a type the payments-read-model doesn't handle
+func WithUnknownEventsPolicy(policy UnknownEventsPolicy) func(app *App) {
+    return func(app *App) { app.dispatcherConfig.UnknownEventsPolicy = policy }
+}
+
+// WithStatusTransitionPolicy sets what to do with the payment updates making an illegal status transition
+func WithStatusTransitionPolicy(policy payments.StatusTransitionPolicy) func(app *App) {
+    return func(app *App) { app.statusTransitionPolicy = policy }
+}
+
+// WithEventUpcasters sets the upcasters migrating the events published with
+// an older schema before they are handled
+func WithEventUpcasters(registry *upcasting.Registry) func(app *App) {
+    return func(app *App) { app.eventUpcasters = registry }
+}
+
+// WithBatchWrites makes the payments events handler apply the payment writes in batches
+func WithBatchWrites(config BatchWritesConfig) func(app *App) {
+    return func(app *App) { app.batchWritesConfig = NewOptional[BatchWritesConfig](config) }
+}
@@ -1,6 +1,11 @@
 package app
 
+import "time"
+
 type PublicAPIConfig struct {
     PublicAPIHttpServerPort int
     AuthServiceBase64PubKey string
+    // StreamHeartbeatInterval is how often the payments stream sends a heartbeat,
+    // public.DefaultStreamHeartbeatInterval when zero
+    StreamHeartbeatInterval time.Duration
 }
@@ -0,0 +1,103 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/adapters/mongodb"
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+	"github.com/walletera/payments-read-model/internal/domain/rebuild"
+
+	"github.com/google/uuid"
+	paymentsevents "github.com/walletera/payments-types/events"
+	"github.com/walletera/werrors"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const (
+	activeCollectionWatchInterval = 10 * time.Second
+	// the heartbeat of an instance outlives a couple of failed reloads of the active collection
+	activeCollectionHeartbeatTTL = 3 * activeCollectionWatchInterval
+)
+
+// newRebuildEventsHandlerFactory builds the events handlers used to replay the event log.
+// The replayed events are already in the event log and in the payments history, so
+// the handlers don't append them again, nor move the checkpoints of the live consumer.
+// The status violations were recorded, and the projection updates and status
+// changes published, when the events were first applied.
+func newRebuildEventsHandlerFactory(
+	client *mongo.Client,
+	statusTransitionPolicy payments.StatusTransitionPolicy,
+	logger *slog.Logger,
+) rebuild.EventsHandlerFactory {
+	return func(collection string, pendingUpdatesCollection string) paymentsevents.Handler {
+		return payments.NewEventsHandler(
+			mongodb.NewPaymentsRepository(client, MongoDBDatabaseName, collection),
+			mongodb.NewPendingUpdatesRepository(client, MongoDBDatabaseName, pendingUpdatesCollection),
+			discardEventLog{},
+			discardHistory{},
+			discardCheckpoints{},
+			discardStatusViolations{},
+			statusTransitionPolicy,
+			discardProjectionChanges{},
+			logger,
+		)
+	}
+}
+
+type discardEventLog struct{}
+
+func (discardEventLog) AppendEvent(context.Context, payments.LoggedEvent) werrors.WError {
+	return nil
+}
+
+func (discardEventLog) GetEvent(context.Context, uuid.UUID) (payments.LoggedEvent, werrors.WError) {
+	return payments.LoggedEvent{}, werrors.NewResourceNotFoundError("the discard event log keeps no events")
+}
+
+func (discardEventLog) ListPaymentEvents(context.Context, uuid.UUID) ([]payments.LoggedEvent, werrors.WError) {
+	return nil, nil
+}
+
+func (discardEventLog) IterateEvents(context.Context, time.Time) (payments.LoggedEventsIterator, werrors.WError) {
+	return nil, werrors.NewNonRetryableInternalError("the discard event log can't be iterated")
+}
+
+type discardHistory struct{}
+
+func (discardHistory) AppendHistoryEntry(context.Context, payments.HistoryEntry) werrors.WError {
+	return nil
+}
+
+func (discardHistory) GetPaymentHistory(context.Context, uuid.UUID) ([]payments.HistoryEntry, werrors.WError) {
+	return nil, nil
+}
+
+type discardCheckpoints struct{}
+
+func (discardCheckpoints) SaveCheckpoint(context.Context, uuid.UUID, payments.Checkpoint) werrors.WError {
+	return nil
+}
+
+func (discardCheckpoints) GetCheckpoint(context.Context, uuid.UUID) (payments.Checkpoint, werrors.WError) {
+	return payments.Checkpoint{}, werrors.NewResourceNotFoundError("checkpoint not found")
+}
+
+func (discardCheckpoints) GetGlobalCheckpoint(context.Context) (payments.Checkpoint, werrors.WError) {
+	return payments.Checkpoint{}, werrors.NewResourceNotFoundError("checkpoint not found")
+}
+
+type discardStatusViolations struct{}
+
+func (discardStatusViolations) RecordViolation(context.Context, payments.StatusViolation) werrors.WError {
+	return nil
+}
+
+func (discardStatusViolations) SearchViolations(context.Context, uuid.UUID) ([]payments.StatusViolation, werrors.WError) {
+	return nil, nil
+}
+
+type discardProjectionChanges struct{}
+
+func (discardProjectionChanges) ProjectionChanged(payments.ProjectionChange) {}
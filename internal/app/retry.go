@@ -0,0 +1,39 @@
+package app
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	DefaultRetryMaxAttempts    = 5
+	DefaultRetryInitialBackoff = 100 * time.Millisecond
+	DefaultRetryMaxBackoff     = 10 * time.Second
+)
+
+// RetryConfig is the policy applied to events failing with a retryable error
+type RetryConfig struct {
+	// MaxAttempts is the retry budget of an event, including its first processing.
+	// The event is sent to the dead letter store when the budget is exhausted.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. It doubles on every retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two retries
+	MaxBackoff time.Duration
+}
+
+// backoff returns the delay before retrying an event that failed the given number of attempts.
+// The delay is picked randomly between half and the whole of the exponential backoff, so the
+// retries of events that failed at the same time don't hit the database together again.
+func (c RetryConfig) backoff(failedAttempts int) time.Duration {
+	backoff := c.InitialBackoff
+	for i := 1; i < failedAttempts && backoff < c.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, c.MaxBackoff)
+	if backoff <= 0 {
+		return 0
+	}
+	half := backoff / 2
+	return half + rand.N(backoff-half+1)
+}
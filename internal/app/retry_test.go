@@ -0,0 +1,42 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryConfigBackoff(t *testing.T) {
+	config := RetryConfig{
+		MaxAttempts:    10,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	}
+	tests := []struct {
+		failedAttempts int
+		expectedMax    time.Duration
+	}{
+		{failedAttempts: 1, expectedMax: 100 * time.Millisecond},
+		{failedAttempts: 2, expectedMax: 200 * time.Millisecond},
+		{failedAttempts: 3, expectedMax: 400 * time.Millisecond},
+		{failedAttempts: 4, expectedMax: 800 * time.Millisecond},
+		{failedAttempts: 5, expectedMax: time.Second},
+		{failedAttempts: 9, expectedMax: time.Second},
+	}
+	for _, test := range tests {
+		// the delay is jittered between half and the whole of the exponential backoff
+		for i := 0; i < 100; i++ {
+			delay := config.backoff(test.failedAttempts)
+			if delay < test.expectedMax/2 || delay > test.expectedMax {
+				t.Fatalf("expected the delay after %d failed attempts to be between %s and %s, but got %s",
+					test.failedAttempts, test.expectedMax/2, test.expectedMax, delay)
+			}
+		}
+	}
+}
+
+func TestRetryConfigBackoffWithoutDelay(t *testing.T) {
+	config := RetryConfig{MaxAttempts: 3}
+	if delay := config.backoff(1); delay != 0 {
+		t.Fatalf("expected no delay without backoff, but got %s", delay)
+	}
+}
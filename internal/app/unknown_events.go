@@ -0,0 +1,83 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/walletera/eventskit/events"
+	"github.com/walletera/eventskit/messages"
+	"github.com/walletera/werrors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// UnknownEventsPolicy defines what the dispatcher does with
+// events of a type the payments-read-model doesn't handle
+type UnknownEventsPolicy string
+
+const (
+	// UnknownEventsPolicySkip acknowledges the event without processing it
+	UnknownEventsPolicySkip UnknownEventsPolicy = "skip"
+	// UnknownEventsPolicyDeadLetter sends the event to the dead letter store,
+	// so it can be replayed once the payments-read-model handles it
+	UnknownEventsPolicyDeadLetter UnknownEventsPolicy = "dead_letter"
+	// UnknownEventsPolicyFail nacks the event without requeueing it
+	UnknownEventsPolicyFail UnknownEventsPolicy = "fail"
+
+	DefaultUnknownEventsPolicy = UnknownEventsPolicySkip
+)
+
+func ParseUnknownEventsPolicy(policy string) (UnknownEventsPolicy, error) {
+	switch UnknownEventsPolicy(policy) {
+	case UnknownEventsPolicySkip, UnknownEventsPolicyDeadLetter, UnknownEventsPolicyFail:
+		return UnknownEventsPolicy(policy), nil
+	default:
+		return "", fmt.Errorf("invalid unknown events policy %q", policy)
+	}
+}
+
+// handleUnknownEvent applies the configured policy to a message whose event type is not handled
+func (d *Dispatcher) handleUnknownEvent(ctx context.Context, message messages.Message) {
+	eventType := unknownEventType(message.Payload())
+	d.metrics.unknownEvents.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("event_type", eventType),
+		attribute.String("policy", string(d.config.UnknownEventsPolicy)),
+	))
+	d.logger.Warn(
+		"unknown event type received",
+		logattr.EventType(eventType),
+		logattr.UnknownEventsPolicy(string(d.config.UnknownEventsPolicy)),
+	)
+
+	werr := werrors.NewUnprocessableMessageError("unknown event type %s", eventType)
+	switch d.config.UnknownEventsPolicy {
+	case UnknownEventsPolicyDeadLetter:
+		d.handleError(ctx, message, werr, 1)
+	case UnknownEventsPolicyFail:
+		err := message.Acknowledger().Nack(messages.NackOpts{
+			Requeue:      false,
+			ErrorCode:    werr.Code(),
+			ErrorMessage: werr.Message(),
+		})
+		if err != nil {
+			d.logger.Error("failed nacking message", logattr.Error(err.Error()))
+		}
+	default:
+		err := message.Acknowledger().Ack()
+		if err != nil {
+			d.logger.Error("failed acknowledging message", logattr.Error(err.Error()))
+		}
+	}
+}
+
+func unknownEventType(rawPayload []byte) string {
+	var eventEnvelope events.EventEnvelope
+	err := json.Unmarshal(rawPayload, &eventEnvelope)
+	if err != nil || eventEnvelope.Type == "" {
+		return "unknown"
+	}
+	return eventEnvelope.Type
+}
@@ -0,0 +1,40 @@
+package deadletters
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+)
+
+// Entry is an event that couldn't be processed and
+// was removed from the stream without being applied
+type Entry struct {
+	// ID is the id of the event envelope, or a generated one
+	// when the payload can't be decoded into an envelope
+	ID            uuid.UUID
+	EventType     string
+	RawPayload    []byte
+	ErrorCode     werrors.ErrorCode
+	ErrorMessage  string
+	Attempts      int
+	FirstFailedAt time.Time
+	LastFailedAt  time.Time
+}
+
+// Filter zero values match any entry
+type Filter struct {
+	EventType string
+	ErrorCode werrors.ErrorCode
+}
+
+type Repository interface {
+	// SaveEntry stores the entry. If an entry with the same id already exists
+	// its error and last failure time are replaced and its attempts are
+	// incremented by the attempts of the given entry.
+	SaveEntry(ctx context.Context, entry Entry) werrors.WError
+	GetEntry(ctx context.Context, id uuid.UUID) (Entry, werrors.WError)
+	SearchEntries(ctx context.Context, filter Filter) ([]Entry, werrors.WError)
+	DeleteEntry(ctx context.Context, id uuid.UUID) werrors.WError
+}
@@ -0,0 +1,134 @@
+package deadletters
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/walletera/payments-read-model/pkg/logattr"
+	"github.com/walletera/payments-read-model/pkg/wuuid"
+
+	"github.com/google/uuid"
+	"github.com/walletera/eventskit/events"
+	paymentsevents "github.com/walletera/payments-types/events"
+	"github.com/walletera/werrors"
+)
+
+// Service records the events that can't be processed and
+// allows replaying them through the payments events handler
+type Service struct {
+	repository         Repository
+	eventsDeserializer events.Deserializer[paymentsevents.Handler]
+	eventsHandler      paymentsevents.Handler
+	logger             *slog.Logger
+}
+
+func NewService(
+	repository Repository,
+	eventsDeserializer events.Deserializer[paymentsevents.Handler],
+	eventsHandler paymentsevents.Handler,
+	logger *slog.Logger,
+) *Service {
+	return &Service{
+		repository:         repository,
+		eventsDeserializer: eventsDeserializer,
+		eventsHandler:      eventsHandler,
+		logger:             logger,
+	}
+}
+
+// Record stores the raw payload of an event that failed after the given number of attempts
+func (s *Service) Record(ctx context.Context, rawPayload []byte, processingErr werrors.WError, attempts int) werrors.WError {
+	now := time.Now()
+	entry := Entry{
+		ID:            wuuid.NewUUID(),
+		RawPayload:    rawPayload,
+		ErrorCode:     processingErr.Code(),
+		ErrorMessage:  processingErr.Message(),
+		Attempts:      attempts,
+		FirstFailedAt: now,
+		LastFailedAt:  now,
+	}
+	var eventEnvelope events.EventEnvelope
+	if err := json.Unmarshal(rawPayload, &eventEnvelope); err == nil {
+		if eventEnvelope.Id != uuid.Nil {
+			entry.ID = eventEnvelope.Id
+		}
+		entry.EventType = eventEnvelope.Type
+	}
+	werr := s.repository.SaveEntry(ctx, entry)
+	if werr != nil {
+		s.logger.Error(
+			"failed saving dead letter",
+			logattr.Error(werr.Message()),
+			logattr.EventId(entry.ID.String()),
+		)
+		return werr
+	}
+	s.logger.Warn(
+		"event sent to dead letter store",
+		logattr.EventId(entry.ID.String()),
+		logattr.EventType(entry.EventType),
+		logattr.Error(processingErr.Message()),
+		logattr.Attempts(attempts),
+	)
+	return nil
+}
+
+// Replay processes the entry through the payments events handler.
+// The entry is deleted if the processing succeeds and updated otherwise.
+func (s *Service) Replay(ctx context.Context, id uuid.UUID) werrors.WError {
+	entry, werr := s.repository.GetEntry(ctx, id)
+	if werr != nil {
+		return werr
+	}
+	processingErr := s.process(ctx, entry.RawPayload)
+	if processingErr != nil {
+		s.logger.Error(
+			"dead letter replay failed",
+			logattr.EventId(id.String()),
+			logattr.Error(processingErr.Message()),
+		)
+		recordErr := s.Record(ctx, entry.RawPayload, processingErr, 1)
+		if recordErr != nil {
+			return recordErr
+		}
+		return processingErr
+	}
+	s.logger.Info("dead letter replayed", logattr.EventId(id.String()))
+	return s.repository.DeleteEntry(ctx, id)
+}
+
+// Discard deletes the entry without processing it
+func (s *Service) Discard(ctx context.Context, id uuid.UUID) werrors.WError {
+	_, werr := s.repository.GetEntry(ctx, id)
+	if werr != nil {
+		return werr
+	}
+	werr = s.repository.DeleteEntry(ctx, id)
+	if werr != nil {
+		return werr
+	}
+	s.logger.Info("dead letter discarded", logattr.EventId(id.String()))
+	return nil
+}
+
+func (s *Service) GetEntry(ctx context.Context, id uuid.UUID) (Entry, werrors.WError) {
+	return s.repository.GetEntry(ctx, id)
+}
+
+func (s *Service) SearchEntries(ctx context.Context, filter Filter) ([]Entry, werrors.WError) {
+	return s.repository.SearchEntries(ctx, filter)
+}
+
+func (s *Service) process(ctx context.Context, rawPayload []byte) werrors.WError {
+	event, err := s.eventsDeserializer.Deserialize(rawPayload)
+	if err != nil {
+		return werrors.NewUnprocessableMessageError(err.Error())
+	}
+	if event == nil {
+		return werrors.NewUnprocessableMessageError("unsupported event type")
+	}
+	return event.Accept(ctx, s.eventsHandler)
+}
@@ -0,0 +1,38 @@
+package payments
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+)
+
+// Checkpoint records the last event applied to the read model, or to one of its payments
+type Checkpoint struct {
+	EventId        uuid.UUID
+	EventType      string
+	EventCreatedAt time.Time
+	AppliedAt      time.Time
+}
+
+// Lag is the end-to-end delay between the creation of the event and its application
+func (c Checkpoint) Lag() time.Duration {
+	return c.AppliedAt.Sub(c.EventCreatedAt)
+}
+
+// IdleAt is the time elapsed at now since the event was applied. When the checkpoint is the
+// last event applied to the read model, it grows while no event is applied.
+func (c Checkpoint) IdleAt(now time.Time) time.Duration {
+	return now.Sub(c.AppliedAt)
+}
+
+type CheckpointsRepository interface {
+	// SaveCheckpoint records the checkpoint of the payment and as the global checkpoint,
+	// unless they already record a newer event. The global checkpoint may be saved later.
+	SaveCheckpoint(ctx context.Context, paymentId uuid.UUID, checkpoint Checkpoint) werrors.WError
+	// GetCheckpoint returns a ResourceNotFoundError if no event of the payment was applied
+	GetCheckpoint(ctx context.Context, paymentId uuid.UUID) (Checkpoint, werrors.WError)
+	// GetGlobalCheckpoint returns a ResourceNotFoundError if no event was applied
+	GetGlobalCheckpoint(ctx context.Context) (Checkpoint, werrors.WError)
+}
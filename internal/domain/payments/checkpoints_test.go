@@ -0,0 +1,22 @@
+package payments
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckpointLagAndIdleTime(t *testing.T) {
+	createdAt := time.Date(2024, 10, 4, 0, 0, 0, 0, time.UTC)
+	checkpoint := Checkpoint{
+		EventCreatedAt: createdAt,
+		AppliedAt:      createdAt.Add(200 * time.Millisecond),
+	}
+
+	if checkpoint.Lag() != 200*time.Millisecond {
+		t.Errorf("expected a lag of 200ms, but got %s", checkpoint.Lag())
+	}
+	idleAt := checkpoint.IdleAt(createdAt.Add(5 * time.Second))
+	if idleAt != 4800*time.Millisecond {
+		t.Errorf("expected an idle time of 4.8s five seconds after the event creation, but got %s", idleAt)
+	}
+}
@@ -0,0 +1,93 @@
+package payments
+
+import (
+	"fmt"
+
+	"github.com/walletera/werrors"
+)
+
+// Error codes for failures that are specific to the payments read model.
+// They start at 2000 to stay clear of the codes defined by werrors.
+const (
+	PaymentContentConflictErrorCode werrors.ErrorCode = iota + 2000
+	PaymentVersionGapErrorCode
+	PaymentVersionMismatchErrorCode
+	PaymentNotCreatedErrorCode
+	IllegalStatusTransitionErrorCode
+)
+
+// Error is a werrors.WError carrying one of the payments read model error codes
+type Error struct {
+	code      werrors.ErrorCode
+	retryable bool
+	message   string
+}
+
+var _ werrors.WError = Error{}
+
+func (e Error) Error() string {
+	return e.message
+}
+
+func (e Error) IsRetryable() bool {
+	return e.retryable
+}
+
+func (e Error) Code() werrors.ErrorCode {
+	return e.code
+}
+
+func (e Error) Message() string {
+	return e.message
+}
+
+// NewPaymentContentConflictError returns a non-retryable error signaling that
+// a PaymentCreated event references an already existing payment but carries
+// different content than the one stored in the read model
+func NewPaymentContentConflictError(msgf string, args ...any) Error {
+	return Error{
+		code:      PaymentContentConflictErrorCode,
+		retryable: false,
+		message:   fmt.Sprintf("payment content conflict: %s", fmt.Sprintf(msgf, args...)),
+	}
+}
+
+// NewPaymentVersionGapError returns a retryable error signaling that a payment
+// update can't be applied yet because one or more previous updates are missing
+func NewPaymentVersionGapError(msgf string, args ...any) Error {
+	return Error{
+		code:      PaymentVersionGapErrorCode,
+		retryable: true,
+		message:   fmt.Sprintf("payment version gap: %s", fmt.Sprintf(msgf, args...)),
+	}
+}
+
+// NewPaymentVersionMismatchError returns a non-retryable error signaling that a
+// payment update is older than the version already stored in the read model
+func NewPaymentVersionMismatchError(msgf string, args ...any) Error {
+	return Error{
+		code:      PaymentVersionMismatchErrorCode,
+		retryable: false,
+		message:   fmt.Sprintf("payment version mismatch: %s", fmt.Sprintf(msgf, args...)),
+	}
+}
+
+// NewPaymentNotCreatedError returns a retryable error signaling that a payment
+// update references a payment whose PaymentCreated event hasn't been processed yet
+func NewPaymentNotCreatedError(msgf string, args ...any) Error {
+	return Error{
+		code:      PaymentNotCreatedErrorCode,
+		retryable: true,
+		message:   fmt.Sprintf("payment not created yet: %s", fmt.Sprintf(msgf, args...)),
+	}
+}
+
+// NewIllegalStatusTransitionError returns a non-retryable error signaling that a
+// payment update moves the payment to a status it can't reach from its current one
+func NewIllegalStatusTransitionError(msgf string, args ...any) Error {
+	return Error{
+		code:      IllegalStatusTransitionErrorCode,
+		retryable: false,
+		message:   fmt.Sprintf("illegal status transition: %s", fmt.Sprintf(msgf, args...)),
+	}
+}
@@ -0,0 +1,80 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+)
+
+// LoggedEvent is the envelope of a payment event applied to the read model
+type LoggedEvent struct {
+	ID               uuid.UUID
+	Type             string
+	AggregateVersion uint64
+	CorrelationId    string
+	CreatedAt        time.Time
+	PaymentId        uuid.UUID
+	Data             json.RawMessage
+	// Status and ExternalId are the state the event left the payment in
+	Status     privateapi.PaymentStatus
+	ExternalId privateapi.OptString
+	// LoggedAt is set by the event log when the event is appended
+	LoggedAt time.Time
+}
+
+type LoggedEventsIterator interface {
+	Next() (bool, LoggedEvent, error)
+	Close() error
+}
+
+type EventLog interface {
+	// AppendEvent stores the event, pending in the outboxes of the log. Appending
+	// an event already present in the log (same event id) is a no-op.
+	AppendEvent(ctx context.Context, event LoggedEvent) werrors.WError
+	// GetEvent returns the logged event with the given id
+	GetEvent(ctx context.Context, id uuid.UUID) (LoggedEvent, werrors.WError)
+	// ListPaymentEvents returns the events of the payment sorted by aggregate version
+	ListPaymentEvents(ctx context.Context, paymentId uuid.UUID) ([]LoggedEvent, werrors.WError)
+	// IterateEvents returns the events logged at or after loggedFrom, in the order they were logged
+	IterateEvents(ctx context.Context, loggedFrom time.Time) (LoggedEventsIterator, werrors.WError)
+}
+
+// eventEnvelope is the part of the payments events used to build the logged events.
+// Their ID() is prefixed with the event type, so the event id is taken apart.
+type eventEnvelope interface {
+	Type() string
+	AggregateVersion() uint64
+	CorrelationID() string
+	CreatedAt() time.Time
+}
+
+func newLoggedEvent(envelope eventEnvelope, id uuid.UUID, paymentId uuid.UUID, data any) (LoggedEvent, werrors.WError) {
+	if id == uuid.Nil {
+		return LoggedEvent{}, werrors.NewUnprocessableMessageError("missing event id")
+	}
+	rawData, err := json.Marshal(data)
+	if err != nil {
+		return LoggedEvent{}, werrors.NewNonRetryableInternalError("failed serializing event data: %s", err.Error())
+	}
+	return LoggedEvent{
+		ID:               id,
+		Type:             envelope.Type(),
+		AggregateVersion: envelope.AggregateVersion(),
+		CorrelationId:    envelope.CorrelationID(),
+		CreatedAt:        envelope.CreatedAt(),
+		PaymentId:        paymentId,
+		Data:             rawData,
+	}, nil
+}
+
+func newEventMetadata(loggedEvent LoggedEvent) EventMetadata {
+	return EventMetadata{
+		LastEventId:       loggedEvent.ID,
+		LastCorrelationId: loggedEvent.CorrelationId,
+		LastEventAt:       loggedEvent.CreatedAt,
+	}
+}
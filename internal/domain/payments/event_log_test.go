@@ -0,0 +1,35 @@
+package payments
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/events"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+)
+
+func TestNewLoggedEventKeepsTheEventId(t *testing.T) {
+	paymentId := uuid.New()
+	event := events.NewPaymentUpdated("a-correlation-id", privateapi.PaymentUpdate{
+		PaymentId: paymentId,
+		Status:    privateapi.PaymentStatusConfirmed,
+	})
+
+	loggedEvent, werr := newLoggedEvent(event, event.Id, paymentId, &event.Data)
+	if werr != nil {
+		t.Fatalf("unexpected error %s", werr.Message())
+	}
+	if loggedEvent.ID != event.Id || loggedEvent.PaymentId != paymentId || loggedEvent.Type != events.PaymentUpdatedType {
+		t.Errorf("unexpected logged event %+v", loggedEvent)
+	}
+}
+
+func TestNewLoggedEventRejectsTheEventsWithoutId(t *testing.T) {
+	event := events.PaymentUpdated{}
+
+	_, werr := newLoggedEvent(event, event.Id, uuid.New(), &event.Data)
+	if werr == nil || werr.Code() != werrors.UnprocessableMessageErrorCode {
+		t.Fatalf("expected an unprocessable message error, but got %v", werr)
+	}
+}
@@ -2,34 +2,77 @@ package payments
 
 import (
 	"context"
+	"encoding/json"
 	"log/slog"
+	"time"
 
 	"github.com/walletera/payments-read-model/pkg/logattr"
 
+	"github.com/google/uuid"
 	"github.com/walletera/payments-types/events"
+	"github.com/walletera/payments-types/privateapi"
 	"github.com/walletera/werrors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 )
 
 type EventsHandler struct {
-	repository Repository
-	logger     *slog.Logger
+	repository               Repository
+	pendingUpdatesRepository PendingUpdatesRepository
+	eventLog                 EventLog
+	historyRepository        HistoryRepository
+	checkpointsRepository    CheckpointsRepository
+	// statusViolationsRepository records the illegal status transitions
+	// handled according to statusTransitionPolicy
+	statusViolationsRepository StatusViolationsRepository
+	statusTransitionPolicy     StatusTransitionPolicy
+	// projectionChangeListener is notified of every event applied, once recorded
+	projectionChangeListener ProjectionChangeListener
+	logger                   *slog.Logger
+	metrics                  metrics
 }
 
-func NewEventsHandler(repository Repository, logger *slog.Logger) *EventsHandler {
+func NewEventsHandler(
+	repository Repository,
+	pendingUpdatesRepository PendingUpdatesRepository,
+	eventLog EventLog,
+	historyRepository HistoryRepository,
+	checkpointsRepository CheckpointsRepository,
+	statusViolationsRepository StatusViolationsRepository,
+	statusTransitionPolicy StatusTransitionPolicy,
+	projectionChangeListener ProjectionChangeListener,
+	logger *slog.Logger,
+) *EventsHandler {
 	return &EventsHandler{
-		repository: repository,
-		logger:     logger,
+		repository:                 repository,
+		pendingUpdatesRepository:   pendingUpdatesRepository,
+		eventLog:                   eventLog,
+		historyRepository:          historyRepository,
+		checkpointsRepository:      checkpointsRepository,
+		statusViolationsRepository: statusViolationsRepository,
+		statusTransitionPolicy:     statusTransitionPolicy,
+		projectionChangeListener:   projectionChangeListener,
+		logger:                     logger,
+		metrics:                    newMetrics(),
 	}
 }
 
 func (e *EventsHandler) HandlePaymentCreated(ctx context.Context, paymentCreatedEvent events.PaymentCreated) werrors.WError {
+	loggedEvent, werr := newLoggedEvent(paymentCreatedEvent, paymentCreatedEvent.Id, paymentCreatedEvent.Data.ID, &paymentCreatedEvent.Data)
+	if werr != nil {
+		return werr
+	}
 	payment := Payment{
 		ID:               paymentCreatedEvent.Data.ID,
 		AggregateVersion: paymentCreatedEvent.AggregateVersion(),
 		Data:             paymentCreatedEvent.Data,
+		Metadata:         newEventMetadata(loggedEvent),
 	}
-	werr := e.repository.SavePayment(ctx, payment)
+	werr = e.repository.SavePayment(ctx, payment)
 	if werr != nil {
+		if werr.Code() == werrors.ResourceAlreadyExistErrorCode {
+			return e.handleDuplicatedPaymentCreated(ctx, paymentCreatedEvent, payment, loggedEvent)
+		}
 		e.logger.Error(
 			"failed saving payment",
 			logattr.Error(werr.Message()),
@@ -44,18 +87,52 @@ func (e *EventsHandler) HandlePaymentCreated(ctx context.Context, paymentCreated
 		logattr.ExternalId(paymentCreatedEvent.Data.ExternalId.Value),
 		logattr.CorrelationId(paymentCreatedEvent.CorrelationID()),
 	)
-	return nil
+	werr = e.recordAppliedEvent(ctx, loggedEvent, payment.Data.Status, payment.Data.ExternalId)
+	if werr != nil {
+		return werr
+	}
+	return e.applyPendingUpdates(ctx, payment.ID, payment.AggregateVersion+1)
 }
 
 func (e *EventsHandler) HandlePaymentUpdated(ctx context.Context, paymentUpdated events.PaymentUpdated) werrors.WError {
+	loggedEvent, werr := newLoggedEvent(paymentUpdated, paymentUpdated.Id, paymentUpdated.Data.PaymentId, &paymentUpdated.Data)
+	if werr != nil {
+		return werr
+	}
 	paymentUpdate := PaymentUpdate{
 		PaymentId:        paymentUpdated.Data.PaymentId,
 		AggregateVersion: paymentUpdated.AggregateVersion(),
 		Status:           paymentUpdated.Data.Status,
 		ExternalId:       paymentUpdated.Data.ExternalId,
 	}
-	werr := e.repository.UpdatePayment(ctx, paymentUpdate)
+	appliedUpdate, werr := e.applyUpdate(ctx, paymentUpdate, loggedEvent)
 	if werr != nil {
+		switch werr.Code() {
+		case PaymentVersionGapErrorCode:
+			return e.parkPaymentUpdate(ctx, paymentUpdate, loggedEvent, PendingReasonVersionGap)
+		case PaymentNotCreatedErrorCode:
+			return e.parkPaymentUpdate(ctx, paymentUpdate, loggedEvent, PendingReasonPaymentNotCreated)
+		case PaymentVersionMismatchErrorCode:
+			applied, appliedUpdate, appliedWErr := e.alreadyApplied(ctx, paymentUpdate, loggedEvent)
+			if appliedWErr != nil {
+				return appliedWErr
+			}
+			if applied {
+				// a previous delivery applied the update but failed recording the event,
+				// or recording the parked updates applied after it
+				e.logger.Info(
+					"payment update already applied",
+					logattr.PaymentId(paymentUpdated.Data.PaymentId.String()),
+					logattr.EventId(loggedEvent.ID.String()),
+					logattr.CorrelationId(paymentUpdated.CorrelationID()),
+				)
+				werr = e.recordAppliedEvent(ctx, loggedEvent, appliedUpdate.Status, appliedUpdate.ExternalId)
+				if werr != nil {
+					return werr
+				}
+				return e.applyPendingUpdates(ctx, paymentUpdate.PaymentId, paymentUpdate.AggregateVersion+1)
+			}
+		}
 		e.logger.Error(
 			"failed updating payment",
 			logattr.Error(werr.Message()),
@@ -69,5 +146,392 @@ func (e *EventsHandler) HandlePaymentUpdated(ctx context.Context, paymentUpdated
 		logattr.PaymentId(paymentUpdated.Data.PaymentId.String()),
 		logattr.CorrelationId(paymentUpdated.CorrelationID()),
 	)
+	werr = e.recordAppliedEvent(ctx, loggedEvent, appliedUpdate.Status, appliedUpdate.ExternalId)
+	if werr != nil {
+		return werr
+	}
+	return e.applyPendingUpdates(ctx, paymentUpdate.PaymentId, paymentUpdate.AggregateVersion+1)
+}
+
+// parkPaymentUpdate stores an update that can't be applied yet. Once parked the
+// event is acknowledged, the update will be applied when the gap is filled.
+func (e *EventsHandler) parkPaymentUpdate(ctx context.Context, paymentUpdate PaymentUpdate, loggedEvent LoggedEvent, reason PendingReason) werrors.WError {
+	correlationId := loggedEvent.CorrelationId
+	werr := e.pendingUpdatesRepository.ParkUpdate(ctx, PendingUpdate{
+		Update:   paymentUpdate,
+		Event:    loggedEvent,
+		Reason:   reason,
+		ParkedAt: time.Now(),
+	})
+	if werr != nil {
+		e.logger.Error(
+			"failed parking payment update",
+			logattr.Error(werr.Message()),
+			logattr.PaymentId(paymentUpdate.PaymentId.String()),
+			logattr.AggregateVersion(paymentUpdate.AggregateVersion),
+			logattr.CorrelationId(correlationId),
+		)
+		return werr
+	}
+	e.metrics.parkedPaymentUpdates.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("reason", string(reason)),
+	))
+	e.logger.Info(
+		"payment update parked",
+		logattr.PaymentId(paymentUpdate.PaymentId.String()),
+		logattr.AggregateVersion(paymentUpdate.AggregateVersion),
+		logattr.PendingReason(string(reason)),
+		logattr.CorrelationId(correlationId),
+	)
+
+	// the missing update may have been applied while this one was being parked
+	payment, werr := e.repository.GetPayment(ctx, paymentUpdate.PaymentId)
+	if werr != nil {
+		return nil
+	}
+	return e.applyPendingUpdates(ctx, paymentUpdate.PaymentId, payment.AggregateVersion+1)
+}
+
+// applyPendingUpdates applies, in order, the parked updates of the payment
+// starting at nextVersion until it finds a version that hasn't arrived yet.
+// Failures leave the remaining updates parked. A failure recording an applied
+// update is returned, so the event that triggered it is processed again and the
+// update, still parked, is recognized as applied. The other failures are logged.
+func (e *EventsHandler) applyPendingUpdates(ctx context.Context, paymentId uuid.UUID, nextVersion uint64) werrors.WError {
+	for {
+		pendingUpdate, werr := e.pendingUpdatesRepository.FindPendingUpdate(ctx, paymentId, nextVersion)
+		if werr != nil {
+			if werr.Code() != werrors.ResourceNotFoundErrorCode {
+				e.logger.Error(
+					"failed retrieving pending payment update",
+					logattr.Error(werr.Message()),
+					logattr.PaymentId(paymentId.String()),
+					logattr.AggregateVersion(nextVersion),
+				)
+			}
+			return nil
+		}
+		appliedUpdate, updateWErr := e.applyUpdate(ctx, pendingUpdate.Update, pendingUpdate.Event)
+		applied := updateWErr == nil
+		// updates parked before the events were kept with them can't be recognized
+		if updateWErr != nil && updateWErr.Code() == PaymentVersionMismatchErrorCode && pendingUpdate.Event.ID != uuid.Nil {
+			var appliedWErr werrors.WError
+			applied, appliedUpdate, appliedWErr = e.alreadyApplied(ctx, pendingUpdate.Update, pendingUpdate.Event)
+			if appliedWErr != nil {
+				e.logger.Error(
+					"failed checking parked payment update",
+					logattr.Error(appliedWErr.Message()),
+					logattr.PaymentId(paymentId.String()),
+					logattr.AggregateVersion(nextVersion),
+				)
+				return nil
+			}
+		}
+		if !applied &&
+			updateWErr.Code() != PaymentVersionMismatchErrorCode &&
+			updateWErr.Code() != IllegalStatusTransitionErrorCode {
+			e.logger.Error(
+				"failed applying parked payment update",
+				logattr.Error(updateWErr.Message()),
+				logattr.PaymentId(paymentId.String()),
+				logattr.AggregateVersion(nextVersion),
+			)
+			return nil
+		}
+		if applied && pendingUpdate.Event.ID != uuid.Nil {
+			// recorded before deleting the parked update, which is kept when the recording fails
+			werr = e.recordAppliedEvent(ctx, pendingUpdate.Event, appliedUpdate.Status, appliedUpdate.ExternalId)
+			if werr != nil {
+				return werr
+			}
+		}
+		werr = e.pendingUpdatesRepository.DeletePendingUpdate(ctx, paymentId, nextVersion)
+		if werr != nil {
+			e.logger.Error(
+				"failed deleting applied pending payment update",
+				logattr.Error(werr.Message()),
+				logattr.PaymentId(paymentId.String()),
+				logattr.AggregateVersion(nextVersion),
+			)
+			return nil
+		}
+		switch {
+		case applied:
+			e.logger.Info(
+				"parked payment update applied",
+				logattr.PaymentId(paymentId.String()),
+				logattr.AggregateVersion(nextVersion),
+				logattr.PendingReason(string(pendingUpdate.Reason)),
+			)
+		case updateWErr.Code() == IllegalStatusTransitionErrorCode:
+			e.logger.Warn(
+				"rejected parked payment update discarded",
+				logattr.Error(updateWErr.Message()),
+				logattr.PaymentId(paymentId.String()),
+				logattr.AggregateVersion(nextVersion),
+			)
+		default:
+			e.logger.Warn(
+				"stale parked payment update discarded",
+				logattr.Error(updateWErr.Message()),
+				logattr.PaymentId(paymentId.String()),
+				logattr.AggregateVersion(nextVersion),
+			)
+		}
+		nextVersion++
+	}
+}
+
+// handleDuplicatedPaymentCreated decides whether a PaymentCreated event for an already
+// existing payment is a redelivery (acknowledged as a success) or a real conflict
+func (e *EventsHandler) handleDuplicatedPaymentCreated(
+	ctx context.Context,
+	paymentCreatedEvent events.PaymentCreated,
+	payment Payment,
+	loggedEvent LoggedEvent,
+) werrors.WError {
+	storedPayment, werr := e.repository.GetPayment(ctx, payment.ID)
+	if werr != nil {
+		e.logger.Error(
+			"failed retrieving existing payment",
+			logattr.Error(werr.Message()),
+			logattr.PaymentId(payment.ID.String()),
+			logattr.CorrelationId(paymentCreatedEvent.CorrelationID()),
+		)
+		return werr
+	}
+	if !sameCreationContent(storedPayment, payment) {
+		e.metrics.paymentCreatedConflicts.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("gateway", string(payment.Data.Gateway)),
+		))
+		e.logger.Error(
+			"conflicting PaymentCreated event",
+			logattr.PaymentId(payment.ID.String()),
+			logattr.EventId(paymentCreatedEvent.Id.String()),
+			logattr.AggregateVersion(payment.AggregateVersion),
+			logattr.CorrelationId(paymentCreatedEvent.CorrelationID()),
+		)
+		return NewPaymentContentConflictError(
+			"payment %s already exists with different content",
+			payment.ID,
+		)
+	}
+	e.logger.Info(
+		"payment already saved, duplicated event ignored",
+		logattr.PaymentId(payment.ID.String()),
+		logattr.EventId(paymentCreatedEvent.Id.String()),
+		logattr.CorrelationId(paymentCreatedEvent.CorrelationID()),
+	)
+	// a previous delivery may have crashed before logging the event
+	// or applying the updates parked in the meantime
+	werr = e.recordAppliedEvent(ctx, loggedEvent, payment.Data.Status, payment.Data.ExternalId)
+	if werr != nil {
+		return werr
+	}
+	return e.applyPendingUpdates(ctx, payment.ID, payment.AggregateVersion+1)
+}
+
+// applyUpdate updates the payment enforcing the status transitions table according to
+// the status transition policy. It returns the update actually applied to the payment.
+func (e *EventsHandler) applyUpdate(ctx context.Context, paymentUpdate PaymentUpdate, loggedEvent LoggedEvent) (PaymentUpdate, werrors.WError) {
+	// updates parked before the events were kept with them have no event to take the metadata from
+	if loggedEvent.ID != uuid.Nil {
+		paymentUpdate.Metadata = newEventMetadata(loggedEvent)
+		paymentUpdate.UpdatedAt = loggedEvent.CreatedAt
+	}
+	paymentUpdate.AllowedPreviousStatuses = allowedPreviousStatuses(paymentUpdate.Status)
+	werr := e.repository.UpdatePayment(ctx, paymentUpdate)
+	if werr == nil || werr.Code() != IllegalStatusTransitionErrorCode {
+		return paymentUpdate, werr
+	}
+
+	storedPayment, getWErr := e.repository.GetPayment(ctx, paymentUpdate.PaymentId)
+	if getWErr != nil {
+		return paymentUpdate, getWErr
+	}
+	violation := StatusViolation{
+		EventId:          loggedEvent.ID,
+		PaymentId:        paymentUpdate.PaymentId,
+		AggregateVersion: paymentUpdate.AggregateVersion,
+		From:             storedPayment.Data.Status,
+		To:               paymentUpdate.Status,
+		Action:           e.statusTransitionPolicy,
+		DetectedAt:       time.Now(),
+	}
+	recordWErr := e.recordStatusViolation(ctx, violation, loggedEvent.CorrelationId)
+	if recordWErr != nil {
+		return paymentUpdate, recordWErr
+	}
+
+	switch e.statusTransitionPolicy {
+	case StatusTransitionPolicyReject:
+		return paymentUpdate, werr
+	case StatusTransitionPolicyQuarantine:
+		paymentUpdate.Status = storedPayment.Data.Status
+	}
+	// pinning the status read above, the update can't overwrite a concurrent change
+	paymentUpdate.AllowedPreviousStatuses = []privateapi.PaymentStatus{storedPayment.Data.Status}
+	return paymentUpdate, e.repository.UpdatePayment(ctx, paymentUpdate)
+}
+
+func (e *EventsHandler) recordStatusViolation(ctx context.Context, violation StatusViolation, correlationId string) werrors.WError {
+	e.metrics.statusViolations.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("from", string(violation.From)),
+		attribute.String("to", string(violation.To)),
+		attribute.String("action", string(violation.Action)),
+	))
+	e.logger.Warn(
+		"illegal payment status transition",
+		logattr.PaymentId(violation.PaymentId.String()),
+		logattr.EventId(violation.EventId.String()),
+		logattr.AggregateVersion(violation.AggregateVersion),
+		logattr.StatusTransition(string(violation.From), string(violation.To)),
+		logattr.StatusTransitionPolicy(string(violation.Action)),
+		logattr.CorrelationId(correlationId),
+	)
+	werr := e.statusViolationsRepository.RecordViolation(ctx, violation)
+	if werr != nil {
+		e.logger.Error(
+			"failed recording status violation",
+			logattr.Error(werr.Message()),
+			logattr.PaymentId(violation.PaymentId.String()),
+			logattr.EventId(violation.EventId.String()),
+			logattr.CorrelationId(correlationId),
+		)
+		return werr
+	}
+	return nil
+}
+
+// alreadyApplied reports whether the update, rejected with a version mismatch, was applied
+// by a previous delivery of the event, along with the update as it was applied. A payment
+// at the version of the update was last updated by the event when it records its id, even
+// when a status transition policy changed the update. The versions of a payment are applied
+// in sequence, so a payment past the version of the update went through it: the update was
+// applied unless the event log holds another event with that version.
+func (e *EventsHandler) alreadyApplied(ctx context.Context, paymentUpdate PaymentUpdate, loggedEvent LoggedEvent) (bool, PaymentUpdate, werrors.WError) {
+	storedPayment, werr := e.repository.GetPayment(ctx, paymentUpdate.PaymentId)
+	if werr != nil {
+		return false, paymentUpdate, werr
+	}
+	if storedPayment.AggregateVersion < paymentUpdate.AggregateVersion {
+		return false, paymentUpdate, nil
+	}
+	if storedPayment.AggregateVersion == paymentUpdate.AggregateVersion {
+		appliedUpdate := paymentUpdate
+		appliedUpdate.Status = storedPayment.Data.Status
+		appliedUpdate.ExternalId = storedPayment.Data.ExternalId
+		if storedPayment.Metadata.LastEventId != uuid.Nil {
+			return storedPayment.Metadata.LastEventId == loggedEvent.ID, appliedUpdate, nil
+		}
+		// the payments updated before the event metadata was recorded can only be compared by content
+		if storedPayment.Data.Status != paymentUpdate.Status {
+			return false, paymentUpdate, nil
+		}
+		return !paymentUpdate.ExternalId.IsSet() || storedPayment.Data.ExternalId == paymentUpdate.ExternalId, appliedUpdate, nil
+	}
+	loggedEvents, werr := e.eventLog.ListPaymentEvents(ctx, paymentUpdate.PaymentId)
+	if werr != nil {
+		return false, paymentUpdate, werr
+	}
+	for _, paymentEvent := range loggedEvents {
+		if paymentEvent.AggregateVersion == paymentUpdate.AggregateVersion {
+			return paymentEvent.ID == loggedEvent.ID, paymentUpdate, nil
+		}
+	}
+	return true, paymentUpdate, nil
+}
+
+// recordAppliedEvent adds the applied event, with the resulting state of the payment, to
+// the event log, which keeps it pending in the outboxes the projection updates and the
+// status changes are published from, and to the payment history. A failure is returned
+// as is, so the event is processed again. The appends are idempotent and the redelivered event is recognized
+// as already applied. Once recorded, the change is notified to the in-process listener.
+func (e *EventsHandler) recordAppliedEvent(
+	ctx context.Context,
+	loggedEvent LoggedEvent,
+	status privateapi.PaymentStatus,
+	externalId privateapi.OptString,
+) werrors.WError {
+	loggedEvent.Status = status
+	loggedEvent.ExternalId = externalId
+	werr := e.eventLog.AppendEvent(ctx, loggedEvent)
+	if werr != nil {
+		e.logAppliedEventRecordingFailure("failed appending event to the event log", loggedEvent, werr)
+		return werr
+	}
+	werr = e.historyRepository.AppendHistoryEntry(ctx, newHistoryEntry(loggedEvent, status, externalId))
+	if werr != nil {
+		e.logAppliedEventRecordingFailure("failed appending event to the payment history", loggedEvent, werr)
+		return werr
+	}
+	e.saveCheckpoint(ctx, loggedEvent)
+	e.projectionChangeListener.ProjectionChanged(ProjectionChange{
+		PaymentId:        loggedEvent.PaymentId,
+		AggregateVersion: loggedEvent.AggregateVersion,
+		Status:           status,
+	})
 	return nil
 }
+
+// saveCheckpoint records the event as the last one applied. Checkpoints only
+// feed the lag monitoring, so a failure is logged but the event is not retried.
+func (e *EventsHandler) saveCheckpoint(ctx context.Context, loggedEvent LoggedEvent) {
+	checkpoint := Checkpoint{
+		EventId:        loggedEvent.ID,
+		EventType:      loggedEvent.Type,
+		EventCreatedAt: loggedEvent.CreatedAt,
+		AppliedAt:      time.Now(),
+	}
+	e.metrics.projectionLag.Record(ctx, checkpoint.Lag().Milliseconds(), metric.WithAttributes(
+		attribute.String("event_type", loggedEvent.Type),
+	))
+	werr := e.checkpointsRepository.SaveCheckpoint(ctx, loggedEvent.PaymentId, checkpoint)
+	if werr != nil {
+		e.logAppliedEventRecordingFailure("failed saving checkpoint", loggedEvent, werr)
+	}
+}
+
+func (e *EventsHandler) logAppliedEventRecordingFailure(msg string, loggedEvent LoggedEvent, werr werrors.WError) {
+	e.logger.Error(
+		msg,
+		logattr.Error(werr.Message()),
+		logattr.EventId(loggedEvent.ID.String()),
+		logattr.PaymentId(loggedEvent.PaymentId.String()),
+		logattr.AggregateVersion(loggedEvent.AggregateVersion),
+		logattr.CorrelationId(loggedEvent.CorrelationId),
+	)
+}
+
+// sameCreationContent reports whether stored is the projection of a PaymentCreated
+// event carrying created. If the stored payment was already updated by later events
+// only the fields that can't be changed by a PaymentUpdated are compared.
+func sameCreationContent(stored Payment, created Payment) bool {
+	if stored.AggregateVersion < created.AggregateVersion {
+		return false
+	}
+	storedData := normalizePaymentData(stored.Data)
+	createdData := normalizePaymentData(created.Data)
+	if stored.AggregateVersion > created.AggregateVersion {
+		storedData.Status = createdData.Status
+		storedData.ExternalId = createdData.ExternalId
+		storedData.UpdatedAt = createdData.UpdatedAt
+	}
+	storedJSON, err := json.Marshal(&storedData)
+	if err != nil {
+		return false
+	}
+	createdJSON, err := json.Marshal(&createdData)
+	if err != nil {
+		return false
+	}
+	return string(storedJSON) == string(createdJSON)
+}
+
+// normalizePaymentData removes the differences introduced by the
+// mongodb round trip (time zone and millisecond precision)
+func normalizePaymentData(data privateapi.Payment) privateapi.Payment {
+	data.CreatedAt = data.CreatedAt.UTC().Truncate(time.Millisecond)
+	data.UpdatedAt = data.UpdatedAt.UTC().Truncate(time.Millisecond)
+	return data
+}
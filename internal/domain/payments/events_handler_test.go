@@ -0,0 +1,359 @@
+package payments
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/events"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/payments-types/publicapi"
+	"github.com/walletera/werrors"
+)
+
+func TestHandlePaymentUpdatedRecordsARedeliveryAppliedBeforeALaterVersion(t *testing.T) {
+	handler, repository, eventLog, _ := newTestEventsHandler()
+	paymentId := repository.add(privateapi.PaymentStatusPending)
+	delivered := newPaymentUpdated(paymentId, 1, privateapi.PaymentStatusDelivered)
+	confirmed := newPaymentUpdated(paymentId, 2, privateapi.PaymentStatusConfirmed)
+
+	// the first delivery applies the update but fails recording it
+	eventLog.failAppending(delivered.Id)
+	werr := handler.HandlePaymentUpdated(context.Background(), delivered)
+	if werr == nil {
+		t.Fatalf("expected the recording failure to be returned")
+	}
+	eventLog.failAppending(uuid.Nil)
+	werr = handler.HandlePaymentUpdated(context.Background(), confirmed)
+	if werr != nil {
+		t.Fatalf("unexpected error %s", werr.Message())
+	}
+
+	werr = handler.HandlePaymentUpdated(context.Background(), delivered)
+	if werr != nil {
+		t.Fatalf("expected the redelivery to be recognized as applied, but got %s", werr.Message())
+	}
+	loggedEvent, found := eventLog.event(delivered.Id)
+	if !found {
+		t.Fatalf("expected the redelivered event to be logged, pending in the outboxes")
+	}
+	if loggedEvent.Status != privateapi.PaymentStatusDelivered {
+		t.Errorf("expected the logged event to keep status delivered, but got %s", loggedEvent.Status)
+	}
+}
+
+func TestHandlePaymentUpdatedRejectsAnotherEventWithAnAppliedVersion(t *testing.T) {
+	handler, repository, _, _ := newTestEventsHandler()
+	paymentId := repository.add(privateapi.PaymentStatusPending)
+	werr := handler.HandlePaymentUpdated(context.Background(), newPaymentUpdated(paymentId, 1, privateapi.PaymentStatusDelivered))
+	if werr != nil {
+		t.Fatalf("unexpected error %s", werr.Message())
+	}
+	werr = handler.HandlePaymentUpdated(context.Background(), newPaymentUpdated(paymentId, 2, privateapi.PaymentStatusConfirmed))
+	if werr != nil {
+		t.Fatalf("unexpected error %s", werr.Message())
+	}
+
+	werr = handler.HandlePaymentUpdated(context.Background(), newPaymentUpdated(paymentId, 1, privateapi.PaymentStatusDelivered))
+	if werr == nil || werr.Code() != PaymentVersionMismatchErrorCode {
+		t.Fatalf("expected a version mismatch error, but got %v", werr)
+	}
+}
+
+func TestHandlePaymentUpdatedRecordsAQuarantinedRedeliveryAsApplied(t *testing.T) {
+	handler, repository, eventLog, _ := newTestEventsHandlerWithPolicy(StatusTransitionPolicyQuarantine)
+	paymentId := repository.add(privateapi.PaymentStatusConfirmed)
+	delivered := newPaymentUpdated(paymentId, 1, privateapi.PaymentStatusDelivered)
+
+	// the first delivery quarantines the update but fails recording it
+	eventLog.failAppending(delivered.Id)
+	werr := handler.HandlePaymentUpdated(context.Background(), delivered)
+	if werr == nil {
+		t.Fatalf("expected the recording failure to be returned")
+	}
+	eventLog.failAppending(uuid.Nil)
+
+	werr = handler.HandlePaymentUpdated(context.Background(), delivered)
+	if werr != nil {
+		t.Fatalf("expected the redelivery to be recognized as applied, but got %s", werr.Message())
+	}
+	loggedEvent, found := eventLog.event(delivered.Id)
+	if !found {
+		t.Fatalf("expected the redelivered event to be logged, pending in the outboxes")
+	}
+	if loggedEvent.Status != privateapi.PaymentStatusConfirmed {
+		t.Errorf("expected the logged event to keep the quarantined status confirmed, but got %s", loggedEvent.Status)
+	}
+	if payment := repository.payments[paymentId]; payment.AggregateVersion != 1 || payment.Data.Status != privateapi.PaymentStatusConfirmed {
+		t.Errorf("expected the payment confirmed at version 1, but got %s at version %d", payment.Data.Status, payment.AggregateVersion)
+	}
+}
+
+func TestHandlePaymentUpdatedKeepsTheParkedUpdateWhenRecordingItFails(t *testing.T) {
+	handler, repository, eventLog, pendingUpdates := newTestEventsHandler()
+	paymentId := repository.add(privateapi.PaymentStatusPending)
+	delivered := newPaymentUpdated(paymentId, 1, privateapi.PaymentStatusDelivered)
+	confirmed := newPaymentUpdated(paymentId, 2, privateapi.PaymentStatusConfirmed)
+
+	werr := handler.HandlePaymentUpdated(context.Background(), confirmed)
+	if werr != nil {
+		t.Fatalf("unexpected error %s", werr.Message())
+	}
+	if !pendingUpdates.parked(paymentId, 2) {
+		t.Fatalf("expected the update with a version gap to be parked")
+	}
+
+	eventLog.failAppending(confirmed.Id)
+	werr = handler.HandlePaymentUpdated(context.Background(), delivered)
+	if werr == nil {
+		t.Fatalf("expected the failure recording the parked update to be returned")
+	}
+	if !pendingUpdates.parked(paymentId, 2) {
+		t.Fatalf("expected the update failing to be recorded to stay parked")
+	}
+
+	eventLog.failAppending(uuid.Nil)
+	werr = handler.HandlePaymentUpdated(context.Background(), delivered)
+	if werr != nil {
+		t.Fatalf("unexpected error %s", werr.Message())
+	}
+	if pendingUpdates.parked(paymentId, 2) {
+		t.Errorf("expected the parked update to be deleted once recorded")
+	}
+	loggedEvent, found := eventLog.event(confirmed.Id)
+	if !found || loggedEvent.Status != privateapi.PaymentStatusConfirmed {
+		t.Errorf("expected the parked update to be logged with status confirmed, but got %+v", loggedEvent)
+	}
+}
+
+func newTestEventsHandler() (*EventsHandler, *fakeRepository, *fakeEventLog, *fakePendingUpdates) {
+	return newTestEventsHandlerWithPolicy(StatusTransitionPolicyReject)
+}
+
+func newTestEventsHandlerWithPolicy(statusTransitionPolicy StatusTransitionPolicy) (*EventsHandler, *fakeRepository, *fakeEventLog, *fakePendingUpdates) {
+	repository := &fakeRepository{payments: map[uuid.UUID]Payment{}}
+	eventLog := &fakeEventLog{}
+	pendingUpdates := &fakePendingUpdates{updates: map[pendingUpdateKey]PendingUpdate{}}
+	handler := NewEventsHandler(
+		repository,
+		pendingUpdates,
+		eventLog,
+		&fakeHistory{},
+		noopCheckpoints{},
+		noopStatusViolations{},
+		statusTransitionPolicy,
+		noopProjectionChanges{},
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	return handler, repository, eventLog, pendingUpdates
+}
+
+func newPaymentUpdated(paymentId uuid.UUID, version uint64, status privateapi.PaymentStatus) events.PaymentUpdated {
+	event := events.NewPaymentUpdated("a-correlation-id", privateapi.PaymentUpdate{
+		PaymentId: paymentId,
+		Status:    status,
+	})
+	event.EventAggregateVersion = version
+	return event
+}
+
+// fakeRepository applies the updates in sequence, like the mongodb repository
+type fakeRepository struct {
+	payments map[uuid.UUID]Payment
+}
+
+func (f *fakeRepository) add(status privateapi.PaymentStatus) uuid.UUID {
+	paymentId := uuid.New()
+	f.payments[paymentId] = Payment{ID: paymentId, Data: privateapi.Payment{ID: paymentId, Status: status}}
+	return paymentId
+}
+
+func (f *fakeRepository) GetPayment(_ context.Context, id uuid.UUID) (Payment, werrors.WError) {
+	payment, found := f.payments[id]
+	if !found {
+		return Payment{}, werrors.NewResourceNotFoundError("payment not found")
+	}
+	return payment, nil
+}
+
+func (f *fakeRepository) SavePayment(_ context.Context, payment Payment) werrors.WError {
+	f.payments[payment.ID] = payment
+	return nil
+}
+
+func (f *fakeRepository) UpdatePayment(_ context.Context, update PaymentUpdate) werrors.WError {
+	payment, found := f.payments[update.PaymentId]
+	switch {
+	case !found:
+		return NewPaymentNotCreatedError("payment %s not created", update.PaymentId)
+	case update.AggregateVersion > payment.AggregateVersion+1:
+		return NewPaymentVersionGapError("payment %s version gap", update.PaymentId)
+	case update.AggregateVersion <= payment.AggregateVersion:
+		return NewPaymentVersionMismatchError("payment %s version mismatch", update.PaymentId)
+	case len(update.AllowedPreviousStatuses) > 0 && !slices.Contains(update.AllowedPreviousStatuses, payment.Data.Status):
+		return NewIllegalStatusTransitionError("payment %s illegal transition", update.PaymentId)
+	}
+	payment.AggregateVersion = update.AggregateVersion
+	payment.Data.Status = update.Status
+	if update.Metadata.LastEventId != uuid.Nil {
+		payment.Metadata = update.Metadata
+	}
+	f.payments[update.PaymentId] = payment
+	return nil
+}
+
+func (f *fakeRepository) SearchPayments(context.Context, publicapi.ListPaymentsParams) (QueryResult, werrors.WError) {
+	return QueryResult{}, nil
+}
+
+func (f *fakeRepository) SearchPaymentsPage(context.Context, publicapi.ListPaymentsParams, PageRequest) (Page, werrors.WError) {
+	return Page{}, nil
+}
+
+// fakeEventLog fails appending the event with failingEventId, when set
+type fakeEventLog struct {
+	events         []LoggedEvent
+	failingEventId uuid.UUID
+}
+
+func (f *fakeEventLog) failAppending(eventId uuid.UUID) {
+	f.failingEventId = eventId
+}
+
+func (f *fakeEventLog) event(id uuid.UUID) (LoggedEvent, bool) {
+	for _, event := range f.events {
+		if event.ID == id {
+			return event, true
+		}
+	}
+	return LoggedEvent{}, false
+}
+
+func (f *fakeEventLog) AppendEvent(_ context.Context, event LoggedEvent) werrors.WError {
+	if event.ID == f.failingEventId {
+		return werrors.NewRetryableInternalError("event log unavailable")
+	}
+	if _, found := f.event(event.ID); !found {
+		f.events = append(f.events, event)
+	}
+	return nil
+}
+
+func (f *fakeEventLog) GetEvent(_ context.Context, id uuid.UUID) (LoggedEvent, werrors.WError) {
+	event, found := f.event(id)
+	if !found {
+		return LoggedEvent{}, werrors.NewResourceNotFoundError("event not found")
+	}
+	return event, nil
+}
+
+func (f *fakeEventLog) ListPaymentEvents(_ context.Context, paymentId uuid.UUID) ([]LoggedEvent, werrors.WError) {
+	var paymentEvents []LoggedEvent
+	for _, event := range f.events {
+		if event.PaymentId == paymentId {
+			paymentEvents = append(paymentEvents, event)
+		}
+	}
+	return paymentEvents, nil
+}
+
+func (f *fakeEventLog) IterateEvents(context.Context, time.Time) (LoggedEventsIterator, werrors.WError) {
+	return nil, werrors.NewNonRetryableInternalError("not implemented")
+}
+
+type pendingUpdateKey struct {
+	paymentId uuid.UUID
+	version   uint64
+}
+
+type fakePendingUpdates struct {
+	updates map[pendingUpdateKey]PendingUpdate
+}
+
+func (f *fakePendingUpdates) parked(paymentId uuid.UUID, version uint64) bool {
+	_, found := f.updates[pendingUpdateKey{paymentId, version}]
+	return found
+}
+
+func (f *fakePendingUpdates) ParkUpdate(_ context.Context, pendingUpdate PendingUpdate) werrors.WError {
+	f.updates[pendingUpdateKey{pendingUpdate.Update.PaymentId, pendingUpdate.Update.AggregateVersion}] = pendingUpdate
+	return nil
+}
+
+func (f *fakePendingUpdates) FindPendingUpdate(_ context.Context, paymentId uuid.UUID, version uint64) (PendingUpdate, werrors.WError) {
+	pendingUpdate, found := f.updates[pendingUpdateKey{paymentId, version}]
+	if !found {
+		return PendingUpdate{}, werrors.NewResourceNotFoundError("pending update not found")
+	}
+	return pendingUpdate, nil
+}
+
+func (f *fakePendingUpdates) DeletePendingUpdate(_ context.Context, paymentId uuid.UUID, version uint64) werrors.WError {
+	delete(f.updates, pendingUpdateKey{paymentId, version})
+	return nil
+}
+
+func (f *fakePendingUpdates) FindPendingUpdatesParkedBefore(context.Context, time.Time) ([]PendingUpdate, werrors.WError) {
+	return nil, nil
+}
+
+func (f *fakePendingUpdates) SearchPendingUpdates(context.Context, PendingUpdatesFilter) ([]PendingUpdate, werrors.WError) {
+	return nil, nil
+}
+
+type fakeHistory struct {
+	entries []HistoryEntry
+}
+
+func (f *fakeHistory) AppendHistoryEntry(_ context.Context, entry HistoryEntry) werrors.WError {
+	for _, existing := range f.entries {
+		if existing.PaymentId == entry.PaymentId && existing.AggregateVersion == entry.AggregateVersion {
+			return nil
+		}
+	}
+	f.entries = append(f.entries, entry)
+	return nil
+}
+
+func (f *fakeHistory) GetPaymentHistory(_ context.Context, paymentId uuid.UUID) ([]HistoryEntry, werrors.WError) {
+	var history []HistoryEntry
+	for _, entry := range f.entries {
+		if entry.PaymentId == paymentId {
+			history = append(history, entry)
+		}
+	}
+	slices.SortFunc(history, func(a, b HistoryEntry) int { return int(a.AggregateVersion) - int(b.AggregateVersion) })
+	return history, nil
+}
+
+type noopCheckpoints struct{}
+
+func (noopCheckpoints) SaveCheckpoint(context.Context, uuid.UUID, Checkpoint) werrors.WError {
+	return nil
+}
+
+func (noopCheckpoints) GetCheckpoint(context.Context, uuid.UUID) (Checkpoint, werrors.WError) {
+	return Checkpoint{}, werrors.NewResourceNotFoundError("checkpoint not found")
+}
+
+func (noopCheckpoints) GetGlobalCheckpoint(context.Context) (Checkpoint, werrors.WError) {
+	return Checkpoint{}, werrors.NewResourceNotFoundError("checkpoint not found")
+}
+
+type noopStatusViolations struct{}
+
+func (noopStatusViolations) RecordViolation(context.Context, StatusViolation) werrors.WError {
+	return nil
+}
+
+func (noopStatusViolations) SearchViolations(context.Context, uuid.UUID) ([]StatusViolation, werrors.WError) {
+	return nil, nil
+}
+
+type noopProjectionChanges struct{}
+
+func (noopProjectionChanges) ProjectionChanged(ProjectionChange) {}
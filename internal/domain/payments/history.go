@@ -0,0 +1,41 @@
+package payments
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+)
+
+// HistoryEntry is the state of a payment after applying the event with the given aggregate version
+type HistoryEntry struct {
+	PaymentId        uuid.UUID
+	AggregateVersion uint64
+	Status           privateapi.PaymentStatus
+	ExternalId       privateapi.OptString
+	EventId          uuid.UUID
+	EventType        string
+	EventCreatedAt   time.Time
+}
+
+type HistoryRepository interface {
+	// AppendHistoryEntry stores the entry. Appending an entry for an aggregate
+	// version already present in the payment history is a no-op.
+	AppendHistoryEntry(ctx context.Context, entry HistoryEntry) werrors.WError
+	// GetPaymentHistory returns the history of the payment sorted by aggregate version
+	GetPaymentHistory(ctx context.Context, paymentId uuid.UUID) ([]HistoryEntry, werrors.WError)
+}
+
+func newHistoryEntry(loggedEvent LoggedEvent, status privateapi.PaymentStatus, externalId privateapi.OptString) HistoryEntry {
+	return HistoryEntry{
+		PaymentId:        loggedEvent.PaymentId,
+		AggregateVersion: loggedEvent.AggregateVersion,
+		Status:           status,
+		ExternalId:       externalId,
+		EventId:          loggedEvent.ID,
+		EventType:        loggedEvent.Type,
+		EventCreatedAt:   loggedEvent.CreatedAt,
+	}
+}
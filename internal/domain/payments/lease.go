@@ -0,0 +1,19 @@
+package payments
+
+import (
+	"context"
+	"time"
+
+	"github.com/walletera/werrors"
+)
+
+// Lease elects the instance running a task that must not run concurrently,
+// like the relays publishing the outboxes in order. An instance stopping
+// without releasing the lease is replaced once the lease expires.
+type Lease interface {
+	// Claim acquires the lease for owner, or extends it when owner already holds it,
+	// for the given duration. It reports false while another owner holds the lease.
+	Claim(ctx context.Context, owner string, duration time.Duration) (bool, werrors.WError)
+	// Release gives up the lease if owner holds it
+	Release(ctx context.Context, owner string) werrors.WError
+}
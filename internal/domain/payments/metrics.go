@@ -0,0 +1,84 @@
+package payments
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/walletera/payments-read-model/internal/domain/payments"
+
+type metrics struct {
+	paymentCreatedConflicts          metric.Int64Counter
+	parkedPaymentUpdates             metric.Int64Counter
+	expiredPendingUpdates            metric.Int64Gauge
+	projectionLag                    metric.Int64Histogram
+	statusViolations                 metric.Int64Counter
+	projectionUpdatesPublished       metric.Int64Counter
+	projectionUpdatesPublishFailures metric.Int64Counter
+}
+
+func newMetrics() metrics {
+	meter := otel.Meter(meterName)
+	return metrics{
+		paymentCreatedConflicts: mustInt64Counter(
+			meter,
+			"payments_read_model.payment_created.conflicts",
+			"PaymentCreated events referencing an existing payment with different content",
+		),
+		parkedPaymentUpdates: mustInt64Counter(
+			meter,
+			"payments_read_model.payment_updates.parked",
+			"PaymentUpdated events parked until the updates preceding them are applied",
+		),
+		expiredPendingUpdates: mustInt64Gauge(
+			meter,
+			"payments_read_model.pending_updates.expired",
+			"Payment updates parked for longer than the configured TTL",
+		),
+		projectionLag: mustInt64Histogram(
+			meter,
+			"payments_read_model.projection.lag",
+			"Delay between the creation of an event and its application to the read model",
+			"ms",
+		),
+		statusViolations: mustInt64Counter(
+			meter,
+			"payments_read_model.status_transitions.violations",
+			"Payment updates making an illegal status transition, by transition and action taken",
+		),
+		projectionUpdatesPublished: mustInt64Counter(
+			meter,
+			"payments_read_model.projection_updates.published",
+			"PaymentProjectionUpdated events published from the outbox",
+		),
+		projectionUpdatesPublishFailures: mustInt64Counter(
+			meter,
+			"payments_read_model.projection_updates.publish_failures",
+			"Failed attempts to publish a PaymentProjectionUpdated event from the outbox",
+		),
+	}
+}
+
+func mustInt64Counter(meter metric.Meter, name string, description string) metric.Int64Counter {
+	counter, err := meter.Int64Counter(name, metric.WithDescription(description))
+	if err != nil {
+		panic("failed creating counter " + name + ": " + err.Error())
+	}
+	return counter
+}
+
+func mustInt64Gauge(meter metric.Meter, name string, description string) metric.Int64Gauge {
+	gauge, err := meter.Int64Gauge(name, metric.WithDescription(description))
+	if err != nil {
+		panic("failed creating gauge " + name + ": " + err.Error())
+	}
+	return gauge
+}
+
+func mustInt64Histogram(meter metric.Meter, name string, description string, unit string) metric.Int64Histogram {
+	histogram, err := meter.Int64Histogram(name, metric.WithDescription(description), metric.WithUnit(unit))
+	if err != nil {
+		panic("failed creating histogram " + name + ": " + err.Error())
+	}
+	return histogram
+}
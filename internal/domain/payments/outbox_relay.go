@@ -0,0 +1,113 @@
+package payments
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+)
+
+const outboxRelayBatchSize = 100
+
+// outboxRelay hands the events pending in an outbox, in the order they were logged, to
+// relayEvent and marks the ones it relays as published. An event is relayed at least
+// once: the ones relayed but not marked yet are relayed again after a failure or restart.
+// Only the instance holding the lease relays, so the instances don't relay the same
+// events concurrently nor out of order.
+type outboxRelay struct {
+	outbox        EventsOutbox
+	lease         Lease
+	leaseDuration time.Duration
+	// owner identifies the relay claiming the lease
+	owner    string
+	interval time.Duration
+	// relayEvent reports whether the event was relayed, the relay stops at the first one that isn't
+	relayEvent func(ctx context.Context, loggedEvent LoggedEvent) bool
+	logger     *slog.Logger
+}
+
+func newOutboxRelay(
+	outbox EventsOutbox,
+	lease Lease,
+	leaseDuration time.Duration,
+	interval time.Duration,
+	relayEvent func(ctx context.Context, loggedEvent LoggedEvent) bool,
+	logger *slog.Logger,
+) outboxRelay {
+	return outboxRelay{
+		outbox:        outbox,
+		lease:         lease,
+		leaseDuration: leaseDuration,
+		owner:         uuid.NewString(),
+		interval:      interval,
+		relayEvent:    relayEvent,
+		logger:        logger,
+	}
+}
+
+// Run blocks until ctx is done. The lease is released on return,
+// so another instance takes over without waiting for it to expire.
+func (r *outboxRelay) Run(ctx context.Context) {
+	defer r.releaseLease(context.WithoutCancel(ctx))
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.relayPendingEvents(ctx)
+		}
+	}
+}
+
+// relayPendingEvents relays the pending events until the outbox is empty, claiming the
+// lease before each batch. It stops at the first failure, so the events of a payment
+// are never relayed out of order.
+func (r *outboxRelay) relayPendingEvents(ctx context.Context) {
+	for ctx.Err() == nil && r.claimLease(ctx) {
+		pendingEvents, werr := r.outbox.PendingEvents(ctx, outboxRelayBatchSize)
+		if werr != nil {
+			r.logger.Error("failed retrieving pending events", logattr.Error(werr.Message()))
+			return
+		}
+		for _, pendingEvent := range pendingEvents {
+			if !r.relayEvent(ctx, pendingEvent) {
+				return
+			}
+			werr = r.outbox.MarkPublished(ctx, pendingEvent.ID)
+			if werr != nil {
+				// the event will be relayed again
+				r.logger.Error(
+					"failed marking event as published",
+					logattr.Error(werr.Message()),
+					logattr.EventId(pendingEvent.ID.String()),
+					logattr.PaymentId(pendingEvent.PaymentId.String()),
+				)
+				return
+			}
+		}
+		if len(pendingEvents) < outboxRelayBatchSize {
+			return
+		}
+	}
+}
+
+func (r *outboxRelay) claimLease(ctx context.Context) bool {
+	claimed, werr := r.lease.Claim(ctx, r.owner, r.leaseDuration)
+	if werr != nil {
+		r.logger.Error("failed claiming relay lease", logattr.Error(werr.Message()))
+		return false
+	}
+	return claimed
+}
+
+func (r *outboxRelay) releaseLease(ctx context.Context) {
+	werr := r.lease.Release(ctx, r.owner)
+	if werr != nil {
+		r.logger.Error("failed releasing relay lease", logattr.Error(werr.Message()))
+	}
+}
@@ -0,0 +1,48 @@
+package payments
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+)
+
+type PendingReason string
+
+const (
+	// PendingReasonVersionGap is used for updates arriving before
+	// one or more of the updates that precede them
+	PendingReasonVersionGap PendingReason = "version_gap"
+	// PendingReasonPaymentNotCreated is used for updates arriving
+	// before the PaymentCreated event of the payment
+	PendingReasonPaymentNotCreated PendingReason = "payment_not_created"
+)
+
+// PendingUpdate is a payment update parked until the
+// updates preceding it have been applied to the payment
+type PendingUpdate struct {
+	Update PaymentUpdate
+	// Event is appended to the event log once the update is applied
+	Event    LoggedEvent
+	Reason   PendingReason
+	ParkedAt time.Time
+}
+
+// PendingUpdatesFilter zero values match any pending update
+type PendingUpdatesFilter struct {
+	PaymentId uuid.UUID
+	Reason    PendingReason
+}
+
+type PendingUpdatesRepository interface {
+	// ParkUpdate stores the pending update. Parking the same update
+	// (same payment id and aggregate version) twice is a no-op.
+	ParkUpdate(ctx context.Context, pendingUpdate PendingUpdate) werrors.WError
+	// FindPendingUpdate returns a ResourceNotFoundError if there is no update
+	// parked for the given payment id and aggregate version
+	FindPendingUpdate(ctx context.Context, paymentId uuid.UUID, aggregateVersion uint64) (PendingUpdate, werrors.WError)
+	DeletePendingUpdate(ctx context.Context, paymentId uuid.UUID, aggregateVersion uint64) werrors.WError
+	FindPendingUpdatesParkedBefore(ctx context.Context, parkedBefore time.Time) ([]PendingUpdate, werrors.WError)
+	SearchPendingUpdates(ctx context.Context, filter PendingUpdatesFilter) ([]PendingUpdate, werrors.WError)
+}
@@ -0,0 +1,61 @@
+package payments
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/walletera/payments-read-model/pkg/logattr"
+)
+
+const maxPendingUpdatesCheckInterval = time.Minute
+
+// PendingUpdatesMonitor periodically reports the payment updates
+// that have been parked for longer than the configured TTL
+type PendingUpdatesMonitor struct {
+	repository PendingUpdatesRepository
+	ttl        time.Duration
+	logger     *slog.Logger
+	metrics    metrics
+}
+
+func NewPendingUpdatesMonitor(repository PendingUpdatesRepository, ttl time.Duration, logger *slog.Logger) *PendingUpdatesMonitor {
+	return &PendingUpdatesMonitor{
+		repository: repository,
+		ttl:        ttl,
+		logger:     logger,
+		metrics:    newMetrics(),
+	}
+}
+
+// Run blocks until ctx is done
+func (m *PendingUpdatesMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(min(m.ttl, maxPendingUpdatesCheckInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.reportExpiredUpdates(ctx)
+		}
+	}
+}
+
+func (m *PendingUpdatesMonitor) reportExpiredUpdates(ctx context.Context) {
+	expiredUpdates, werr := m.repository.FindPendingUpdatesParkedBefore(ctx, time.Now().Add(-m.ttl))
+	if werr != nil {
+		m.logger.Error("failed retrieving expired pending updates", logattr.Error(werr.Message()))
+		return
+	}
+	m.metrics.expiredPendingUpdates.Record(ctx, int64(len(expiredUpdates)))
+	for _, expiredUpdate := range expiredUpdates {
+		m.logger.Warn(
+			"parked payment update expired",
+			logattr.PaymentId(expiredUpdate.Update.PaymentId.String()),
+			logattr.AggregateVersion(expiredUpdate.Update.AggregateVersion),
+			logattr.PendingReason(string(expiredUpdate.Reason)),
+			logattr.ParkedAt(expiredUpdate.ParkedAt),
+		)
+	}
+}
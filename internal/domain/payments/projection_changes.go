@@ -0,0 +1,79 @@
+package payments
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/privateapi"
+)
+
+// ProjectionChange is the state of a payment after an event was applied to the projection
+type ProjectionChange struct {
+	PaymentId        uuid.UUID
+	AggregateVersion uint64
+	Status           privateapi.PaymentStatus
+}
+
+// ProjectionChangeListener is notified, in process, of the events applied to the projection
+type ProjectionChangeListener interface {
+	ProjectionChanged(change ProjectionChange)
+}
+
+// projectionChangesBufferSize is how many changes a subscriber can be behind
+// before the next ones are dropped
+const projectionChangesBufferSize = 8
+
+// ProjectionChanges fans out the changes of the projection to the subscribers of
+// each payment. A change may be notified more than once, e.g. by the events handler
+// of this instance and by the tail of the event log catching the other instances.
+type ProjectionChanges struct {
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan ProjectionChange]struct{}
+}
+
+var _ ProjectionChangeListener = (*ProjectionChanges)(nil)
+
+func NewProjectionChanges() *ProjectionChanges {
+	return &ProjectionChanges{subscribers: make(map[uuid.UUID]map[chan ProjectionChange]struct{})}
+}
+
+// Subscribe returns the changes of the payment applied from now on. The
+// returned func must be called once the changes are not needed anymore.
+func (p *ProjectionChanges) Subscribe(paymentId uuid.UUID) (<-chan ProjectionChange, func()) {
+	changes := make(chan ProjectionChange, projectionChangesBufferSize)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.subscribers[paymentId] == nil {
+		p.subscribers[paymentId] = make(map[chan ProjectionChange]struct{})
+	}
+	p.subscribers[paymentId][changes] = struct{}{}
+	unsubscribe := func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.subscribers[paymentId], changes)
+		if len(p.subscribers[paymentId]) == 0 {
+			delete(p.subscribers, paymentId)
+		}
+	}
+	return changes, unsubscribe
+}
+
+// HasSubscribers reports whether any payment is subscribed to
+func (p *ProjectionChanges) HasSubscribers() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.subscribers) > 0
+}
+
+// ProjectionChanged notifies the subscribers of the payment without blocking,
+// a subscriber not keeping up misses the change
+func (p *ProjectionChanges) ProjectionChanged(change ProjectionChange) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for changes := range p.subscribers[change.PaymentId] {
+		select {
+		case changes <- change:
+		default:
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/walletera/eventskit/events"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+)
+
+const PaymentProjectionUpdatedType = "PaymentProjectionUpdated"
+
+// projectionUpdatedNamespace derives the id of the PaymentProjectionUpdated events from
+// the id of the applied event, so an update published again keeps the same event id
+var projectionUpdatedNamespace = uuid.MustParse("0c1b4f7e-5d7a-4a44-9f6e-2b8d3c6a9e15")
+
+// ProjectionUpdate is the state of a payment after applying an event to the projection,
+// published as a PaymentProjectionUpdated event
+type ProjectionUpdate struct {
+	// ID is the id of the PaymentProjectionUpdated event
+	ID uuid.UUID
+	// SourceEventId is the id of the event applied to the payment
+	SourceEventId    uuid.UUID
+	PaymentId        uuid.UUID
+	AggregateVersion uint64
+	Status           privateapi.PaymentStatus
+	ExternalId       privateapi.OptString
+	CorrelationId    string
+	UpdatedAt        time.Time
+	RecordedAt       time.Time
+}
+
+// EventsOutbox keeps the events appended to the event log until a relay publishes them.
+// The outbox is derived from the event log, an event is pending from the moment it's
+// logged, so an applied event can't be recorded without being kept for the relay.
+type EventsOutbox interface {
+	// PendingEvents returns the oldest events not published yet, in the order they were logged
+	PendingEvents(ctx context.Context, limit int) ([]LoggedEvent, werrors.WError)
+	// MarkPublished records the event as published, it's not pending anymore
+	MarkPublished(ctx context.Context, eventId uuid.UUID) werrors.WError
+}
+
+func newProjectionUpdate(loggedEvent LoggedEvent) ProjectionUpdate {
+	return ProjectionUpdate{
+		ID:               uuid.NewSHA1(projectionUpdatedNamespace, loggedEvent.ID[:]),
+		SourceEventId:    loggedEvent.ID,
+		PaymentId:        loggedEvent.PaymentId,
+		AggregateVersion: loggedEvent.AggregateVersion,
+		Status:           loggedEvent.Status,
+		ExternalId:       loggedEvent.ExternalId,
+		CorrelationId:    loggedEvent.CorrelationId,
+		UpdatedAt:        loggedEvent.CreatedAt,
+		RecordedAt:       loggedEvent.LoggedAt,
+	}
+}
+
+var _ events.EventData = PaymentProjectionUpdated{}
+
+// PaymentProjectionUpdated notifies the downstream services that a payment
+// of the read model was saved or updated, with its new version and status
+type PaymentProjectionUpdated struct {
+	Id                    uuid.UUID                    `json:"id"`
+	EventType             string                       `json:"type"`
+	EventAggregateVersion uint64                       `json:"aggregateVersion"`
+	EventCorrelationId    string                       `json:"correlationId"`
+	EventCreatedAt        time.Time                    `json:"createdAt"`
+	Data                  PaymentProjectionUpdatedData `json:"data"`
+}
+
+type PaymentProjectionUpdatedData struct {
+	PaymentId        uuid.UUID                `json:"paymentId"`
+	AggregateVersion uint64                   `json:"aggregateVersion"`
+	Status           privateapi.PaymentStatus `json:"status"`
+	ExternalId       string                   `json:"externalId,omitempty"`
+	UpdatedAt        time.Time                `json:"updatedAt"`
+}
+
+func NewPaymentProjectionUpdated(update ProjectionUpdate) PaymentProjectionUpdated {
+	return PaymentProjectionUpdated{
+		Id:                    update.ID,
+		EventType:             PaymentProjectionUpdatedType,
+		EventAggregateVersion: update.AggregateVersion,
+		EventCorrelationId:    update.CorrelationId,
+		EventCreatedAt:        update.RecordedAt,
+		Data: PaymentProjectionUpdatedData{
+			PaymentId:        update.PaymentId,
+			AggregateVersion: update.AggregateVersion,
+			Status:           update.Status,
+			ExternalId:       update.ExternalId.Value,
+			UpdatedAt:        update.UpdatedAt,
+		},
+	}
+}
+
+func (p PaymentProjectionUpdated) ID() string {
+	return fmt.Sprintf("%s-%s", p.Type(), p.Id)
+}
+
+func (p PaymentProjectionUpdated) Type() string {
+	return PaymentProjectionUpdatedType
+}
+
+func (p PaymentProjectionUpdated) AggregateVersion() uint64 { return p.EventAggregateVersion }
+
+func (p PaymentProjectionUpdated) CorrelationID() string {
+	return p.EventCorrelationId
+}
+
+func (p PaymentProjectionUpdated) DataContentType() string {
+	return "application/json"
+}
+
+func (p PaymentProjectionUpdated) CreatedAt() time.Time { return p.EventCreatedAt }
+
+func (p PaymentProjectionUpdated) Serialize() ([]byte, error) {
+	return json.Marshal(p)
+}
@@ -0,0 +1,66 @@
+package payments
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/walletera/eventskit/events"
+)
+
+// ProjectionUpdatesRelay publishes the projection updates of the events pending in the
+// outbox, in the order they were logged, waiting for the broker confirmation of each one
+type ProjectionUpdatesRelay struct {
+	outboxRelay
+	publisher   events.Publisher
+	routingInfo events.RoutingInfo
+	logger      *slog.Logger
+	metrics     metrics
+}
+
+func NewProjectionUpdatesRelay(
+	outbox EventsOutbox,
+	lease Lease,
+	leaseDuration time.Duration,
+	publisher events.Publisher,
+	routingInfo events.RoutingInfo,
+	interval time.Duration,
+	logger *slog.Logger,
+) *ProjectionUpdatesRelay {
+	relay := &ProjectionUpdatesRelay{
+		publisher:   publisher,
+		routingInfo: routingInfo,
+		logger:      logger,
+		metrics:     newMetrics(),
+	}
+	relay.outboxRelay = newOutboxRelay(outbox, lease, leaseDuration, interval, relay.publish, logger)
+	return relay
+}
+
+func (r *ProjectionUpdatesRelay) publish(ctx context.Context, loggedEvent LoggedEvent) bool {
+	update := newProjectionUpdate(loggedEvent)
+	event := NewPaymentProjectionUpdated(update)
+	err := r.publisher.Publish(ctx, event, r.routingInfo)
+	if err != nil {
+		r.metrics.projectionUpdatesPublishFailures.Add(ctx, 1)
+		r.logger.Error(
+			"failed publishing projection update",
+			logattr.Error(err.Error()),
+			logattr.EventId(event.ID()),
+			logattr.PaymentId(update.PaymentId.String()),
+			logattr.AggregateVersion(update.AggregateVersion),
+		)
+		return false
+	}
+	r.metrics.projectionUpdatesPublished.Add(ctx, 1)
+	r.logger.Debug(
+		"projection update published",
+		logattr.EventId(event.ID()),
+		logattr.PaymentId(update.PaymentId.String()),
+		logattr.AggregateVersion(update.AggregateVersion),
+		logattr.CorrelationId(update.CorrelationId),
+	)
+	return true
+}
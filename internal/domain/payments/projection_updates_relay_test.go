@@ -0,0 +1,172 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/walletera/eventskit/events"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+)
+
+func TestProjectionUpdatesRelayPublishesThePendingEventsInOrder(t *testing.T) {
+	outbox := newFakeOutbox(3)
+	publisher := &recordingPublisher{}
+	relay := newTestRelay(outbox, &fakeLease{}, publisher)
+
+	relay.relayPendingEvents(context.Background())
+
+	if len(publisher.published) != 3 {
+		t.Fatalf("expected 3 published events, but got %d", len(publisher.published))
+	}
+	for i, event := range publisher.published {
+		update := event.(PaymentProjectionUpdated)
+		if update.Data.AggregateVersion != uint64(i) || update.Data.Status != privateapi.PaymentStatusPending {
+			t.Errorf("unexpected event %d published %+v", i, update)
+		}
+	}
+	if len(outbox.pending) != 0 {
+		t.Errorf("expected the published events to be marked, but %d are pending", len(outbox.pending))
+	}
+}
+
+func TestProjectionUpdatesRelayPublishesAnUpdateAgainWithTheSameId(t *testing.T) {
+	outbox := newFakeOutbox(1)
+	outbox.failMarking = true
+	publisher := &recordingPublisher{}
+	relay := newTestRelay(outbox, &fakeLease{}, publisher)
+
+	relay.relayPendingEvents(context.Background())
+	relay.relayPendingEvents(context.Background())
+
+	if len(publisher.published) != 2 {
+		t.Fatalf("expected the update not marked as published to be published again, but got %d events", len(publisher.published))
+	}
+	if publisher.published[0].ID() != publisher.published[1].ID() {
+		t.Errorf("expected the same event id, but got %s and %s", publisher.published[0].ID(), publisher.published[1].ID())
+	}
+}
+
+func TestProjectionUpdatesRelayStopsAtTheFirstPublishFailure(t *testing.T) {
+	outbox := newFakeOutbox(3)
+	publisher := &recordingPublisher{failures: 1}
+	relay := newTestRelay(outbox, &fakeLease{}, publisher)
+
+	relay.relayPendingEvents(context.Background())
+
+	if len(publisher.published) != 0 || len(outbox.pending) != 3 {
+		t.Errorf("expected nothing published after the failure, but got %d published and %d pending", len(publisher.published), len(outbox.pending))
+	}
+}
+
+func TestProjectionUpdatesRelayDoesNotPublishWithoutTheLease(t *testing.T) {
+	outbox := newFakeOutbox(1)
+	lease := &fakeLease{owner: "another-instance", claimedUntil: time.Now().Add(time.Minute)}
+	publisher := &recordingPublisher{}
+	relay := newTestRelay(outbox, lease, publisher)
+
+	relay.relayPendingEvents(context.Background())
+	if len(publisher.published) != 0 {
+		t.Fatalf("expected nothing published while another instance holds the lease")
+	}
+
+	lease.claimedUntil = time.Now().Add(-time.Second)
+	relay.relayPendingEvents(context.Background())
+	if len(publisher.published) != 1 {
+		t.Errorf("expected the relay to take over the expired lease and publish, but got %d events", len(publisher.published))
+	}
+	if lease.owner != relay.owner {
+		t.Errorf("expected the relay to hold the lease")
+	}
+}
+
+func newTestRelay(outbox EventsOutbox, lease Lease, publisher events.Publisher) *ProjectionUpdatesRelay {
+	return NewProjectionUpdatesRelay(
+		outbox,
+		lease,
+		time.Minute,
+		publisher,
+		events.RoutingInfo{Topic: "payments-read-model.events", RoutingKey: "payment.projection.updated"},
+		time.Second,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+}
+
+// fakeOutbox holds events of a single payment, one per version
+type fakeOutbox struct {
+	pending     []LoggedEvent
+	failMarking bool
+}
+
+func newFakeOutbox(count int) *fakeOutbox {
+	outbox := &fakeOutbox{}
+	paymentId := uuid.New()
+	for i := 0; i < count; i++ {
+		outbox.pending = append(outbox.pending, LoggedEvent{
+			ID:               uuid.New(),
+			AggregateVersion: uint64(i),
+			PaymentId:        paymentId,
+			Status:           privateapi.PaymentStatusPending,
+			LoggedAt:         time.Now(),
+		})
+	}
+	return outbox
+}
+
+func (f *fakeOutbox) PendingEvents(_ context.Context, limit int) ([]LoggedEvent, werrors.WError) {
+	return f.pending[:min(limit, len(f.pending))], nil
+}
+
+func (f *fakeOutbox) MarkPublished(_ context.Context, eventId uuid.UUID) werrors.WError {
+	if f.failMarking {
+		return werrors.NewRetryableInternalError("outbox unavailable")
+	}
+	for i, event := range f.pending {
+		if event.ID == eventId {
+			f.pending = append(f.pending[:i:i], f.pending[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+type fakeLease struct {
+	owner        string
+	claimedUntil time.Time
+}
+
+func (f *fakeLease) Claim(_ context.Context, owner string, duration time.Duration) (bool, werrors.WError) {
+	if f.owner != owner && time.Now().Before(f.claimedUntil) {
+		return false, nil
+	}
+	f.owner = owner
+	f.claimedUntil = time.Now().Add(duration)
+	return true, nil
+}
+
+func (f *fakeLease) Release(_ context.Context, owner string) werrors.WError {
+	if f.owner == owner {
+		f.claimedUntil = time.Time{}
+	}
+	return nil
+}
+
+// recordingPublisher fails the first failures publications
+type recordingPublisher struct {
+	published []events.EventData
+	failures  int
+}
+
+func (r *recordingPublisher) Publish(_ context.Context, data events.EventData, _ events.RoutingInfo) error {
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("broker unavailable")
+	}
+	r.published = append(r.published, data)
+	return nil
+}
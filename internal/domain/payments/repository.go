@@ -14,6 +14,14 @@ type Payment struct {
     ID               uuid.UUID
     AggregateVersion uint64
     Data             privateapi.Payment
+    Metadata         EventMetadata
+}
+
+// EventMetadata identifies the last event applied to a payment
+type EventMetadata struct {
+    LastEventId       uuid.UUID
+    LastCorrelationId string
+    LastEventAt       time.Time
 }
 
 type PaymentUpdate struct {
@@ -21,7 +29,13 @@ type PaymentUpdate struct {
     AggregateVersion uint64
     ExternalId       privateapi.OptString
     Status           privateapi.PaymentStatus
-    UpdatedAt        time.Time
+    // UpdatedAt, when set, replaces the payment updatedAt
+    UpdatedAt time.Time
+    // Metadata, when set, replaces the payment event metadata
+    Metadata EventMetadata
+    // AllowedPreviousStatuses, when not empty, restricts the update to the payments in one
+    // of these statuses. Otherwise UpdatePayment returns an IllegalStatusTransitionError.
+    AllowedPreviousStatuses []privateapi.PaymentStatus
 }
 
 type Iterator interface {
@@ -33,9 +47,36 @@ type QueryResult struct {
     Total    uint64
 }
 
+// PageCursor is the position of a payment in the payments sorted by creation time and id
+type PageCursor struct {
+    CreatedAt time.Time
+    PaymentId uuid.UUID
+}
+
+// PageRequest asks for the payments older than After or newer than Before, at most
+// one of them is set. Without them the page starts with the newest payment.
+type PageRequest struct {
+    After  *PageCursor
+    Before *PageCursor
+    Limit  int
+}
+
+// Page holds the payments sorted from the newest to the oldest
+type Page struct {
+    Payments []Payment
+    // Next is the position of the last payment when there are older ones
+    Next *PageCursor
+    // Prev is the position of the first payment when there are newer ones
+    Prev *PageCursor
+}
+
 type Repository interface {
     GetPayment(ctx context.Context, id uuid.UUID) (Payment, werrors.WError)
     SavePayment(ctx context.Context, payment Payment) werrors.WError
     UpdatePayment(ctx context.Context, payment PaymentUpdate) werrors.WError
+    // SearchPayments pages the payments with an offset and counts all the payments matching the params
     SearchPayments(ctx context.Context, listPaymentsParams publicapi.ListPaymentsParams) (QueryResult, werrors.WError)
+    // SearchPaymentsPage pages the payments matching the params, ignoring their offset, from a
+    // cursor. The pages don't shift when new payments are added and nothing is counted.
+    SearchPaymentsPage(ctx context.Context, listPaymentsParams publicapi.ListPaymentsParams, pageRequest PageRequest) (Page, werrors.WError)
 }
@@ -0,0 +1,118 @@
+package payments
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+)
+
+// StatusChange is a payment moving from one status to another after applying an event
+type StatusChange struct {
+	// EventId is the id of the event applied to the payment
+	EventId          uuid.UUID
+	PaymentId        uuid.UUID
+	CustomerId       uuid.UUID
+	AggregateVersion uint64
+	PreviousStatus   privateapi.PaymentStatus
+	Status           privateapi.PaymentStatus
+	ExternalId       privateapi.OptString
+	CorrelationId    string
+	ChangedAt        time.Time
+}
+
+type StatusChangeNotifier interface {
+	// NotifyStatusChange is called once the event changing the status is recorded.
+	// A change is notified at least once, so it must be idempotent.
+	NotifyStatusChange(ctx context.Context, change StatusChange) werrors.WError
+}
+
+// StatusChangesRelay notifies the status changes of the events pending in the outbox, in
+// the order they were logged. The notifications are recorded asynchronously to the events
+// processing, a failing notifier delays them without failing the events.
+type StatusChangesRelay struct {
+	outboxRelay
+	repository        Repository
+	historyRepository HistoryRepository
+	notifier          StatusChangeNotifier
+	logger            *slog.Logger
+}
+
+func NewStatusChangesRelay(
+	outbox EventsOutbox,
+	lease Lease,
+	leaseDuration time.Duration,
+	repository Repository,
+	historyRepository HistoryRepository,
+	notifier StatusChangeNotifier,
+	interval time.Duration,
+	logger *slog.Logger,
+) *StatusChangesRelay {
+	relay := &StatusChangesRelay{
+		repository:        repository,
+		historyRepository: historyRepository,
+		notifier:          notifier,
+		logger:            logger,
+	}
+	relay.outboxRelay = newOutboxRelay(outbox, lease, leaseDuration, interval, relay.notify, logger)
+	return relay
+}
+
+func (r *StatusChangesRelay) notify(ctx context.Context, loggedEvent LoggedEvent) bool {
+	change, changed, werr := r.statusChange(ctx, loggedEvent)
+	if werr == nil && changed {
+		werr = r.notifier.NotifyStatusChange(ctx, change)
+	}
+	if werr != nil {
+		r.logger.Error(
+			"failed notifying payment status change",
+			logattr.Error(werr.Message()),
+			logattr.EventId(loggedEvent.ID.String()),
+			logattr.PaymentId(loggedEvent.PaymentId.String()),
+			logattr.AggregateVersion(loggedEvent.AggregateVersion),
+			logattr.CorrelationId(loggedEvent.CorrelationId),
+		)
+		return false
+	}
+	return true
+}
+
+// statusChange reports whether the status the event left the payment in differs from the
+// one it had before the event, found in the payment history. The creation of a payment,
+// the first entry of its history, is not a status change.
+func (r *StatusChangesRelay) statusChange(ctx context.Context, loggedEvent LoggedEvent) (StatusChange, bool, werrors.WError) {
+	history, werr := r.historyRepository.GetPaymentHistory(ctx, loggedEvent.PaymentId)
+	if werr != nil {
+		return StatusChange{}, false, werr
+	}
+	var previousEntry *HistoryEntry
+	for i := range history {
+		if history[i].AggregateVersion >= loggedEvent.AggregateVersion {
+			break
+		}
+		previousEntry = &history[i]
+	}
+	if previousEntry == nil || previousEntry.Status == loggedEvent.Status {
+		return StatusChange{}, false, nil
+	}
+	payment, werr := r.repository.GetPayment(ctx, loggedEvent.PaymentId)
+	if werr != nil {
+		return StatusChange{}, false, werr
+	}
+	return StatusChange{
+		EventId:          loggedEvent.ID,
+		PaymentId:        loggedEvent.PaymentId,
+		CustomerId:       payment.Data.CustomerId,
+		AggregateVersion: loggedEvent.AggregateVersion,
+		PreviousStatus:   previousEntry.Status,
+		Status:           loggedEvent.Status,
+		ExternalId:       loggedEvent.ExternalId,
+		CorrelationId:    loggedEvent.CorrelationId,
+		ChangedAt:        loggedEvent.CreatedAt,
+	}, true, nil
+}
@@ -0,0 +1,107 @@
+package payments
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+)
+
+func TestStatusChangesRelayNotifiesOnlyTheStatusChanges(t *testing.T) {
+	outbox, repository, history := newStatusChangesFixture(
+		privateapi.PaymentStatusPending,
+		privateapi.PaymentStatusDelivered,
+		privateapi.PaymentStatusDelivered,
+	)
+	notifier := &recordingNotifier{}
+	relay := newTestStatusChangesRelay(outbox, repository, history, notifier)
+
+	relay.relayPendingEvents(context.Background())
+
+	if len(notifier.changes) != 1 {
+		t.Fatalf("expected 1 status change notified, but got %d", len(notifier.changes))
+	}
+	change := notifier.changes[0]
+	if change.AggregateVersion != 1 ||
+		change.PreviousStatus != privateapi.PaymentStatusPending ||
+		change.Status != privateapi.PaymentStatusDelivered ||
+		change.CustomerId != repository.payments[change.PaymentId].Data.CustomerId {
+		t.Errorf("unexpected status change notified %+v", change)
+	}
+	if len(outbox.pending) != 0 {
+		t.Errorf("expected the events to be marked as published, but %d are pending", len(outbox.pending))
+	}
+}
+
+func TestStatusChangesRelayKeepsTheChangePendingWhenNotifyingItFails(t *testing.T) {
+	outbox, repository, history := newStatusChangesFixture(
+		privateapi.PaymentStatusPending,
+		privateapi.PaymentStatusDelivered,
+		privateapi.PaymentStatusConfirmed,
+	)
+	notifier := &recordingNotifier{failures: 1}
+	relay := newTestStatusChangesRelay(outbox, repository, history, notifier)
+
+	relay.relayPendingEvents(context.Background())
+	if len(notifier.changes) != 0 || len(outbox.pending) != 2 {
+		t.Fatalf("expected the relay to stop at the failed change, but got %d notified and %d pending", len(notifier.changes), len(outbox.pending))
+	}
+
+	relay.relayPendingEvents(context.Background())
+	if len(notifier.changes) != 2 || notifier.changes[0].AggregateVersion != 1 || notifier.changes[1].AggregateVersion != 2 {
+		t.Errorf("expected the changes to be notified in order once the notifier recovers, but got %+v", notifier.changes)
+	}
+}
+
+// newStatusChangesFixture logs one event per status of a single payment, the first one creating it
+func newStatusChangesFixture(statuses ...privateapi.PaymentStatus) (*fakeOutbox, *fakeRepository, *fakeHistory) {
+	outbox := newFakeOutbox(len(statuses))
+	history := &fakeHistory{}
+	paymentId := outbox.pending[0].PaymentId
+	for i, status := range statuses {
+		outbox.pending[i].Status = status
+		history.AppendHistoryEntry(context.Background(), HistoryEntry{
+			PaymentId:        paymentId,
+			AggregateVersion: outbox.pending[i].AggregateVersion,
+			Status:           status,
+			EventId:          outbox.pending[i].ID,
+		})
+	}
+	repository := &fakeRepository{payments: map[uuid.UUID]Payment{
+		paymentId: {ID: paymentId, Data: privateapi.Payment{ID: paymentId, CustomerId: uuid.New(), Status: statuses[len(statuses)-1]}},
+	}}
+	return outbox, repository, history
+}
+
+func newTestStatusChangesRelay(outbox EventsOutbox, repository Repository, history HistoryRepository, notifier StatusChangeNotifier) *StatusChangesRelay {
+	return NewStatusChangesRelay(
+		outbox,
+		&fakeLease{},
+		time.Minute,
+		repository,
+		history,
+		notifier,
+		time.Second,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+}
+
+// recordingNotifier fails the first failures notifications
+type recordingNotifier struct {
+	changes  []StatusChange
+	failures int
+}
+
+func (r *recordingNotifier) NotifyStatusChange(_ context.Context, change StatusChange) werrors.WError {
+	if r.failures > 0 {
+		r.failures--
+		return werrors.NewRetryableInternalError("notifier unavailable")
+	}
+	r.changes = append(r.changes, change)
+	return nil
+}
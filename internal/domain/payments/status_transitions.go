@@ -0,0 +1,101 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+)
+
+// statusTransitions lists the statuses a payment can move to from each status.
+// Confirmed, failed and rejected are final. Moving to the current status is always
+// legal, as updates may only change the externalId.
+var statusTransitions = map[privateapi.PaymentStatus][]privateapi.PaymentStatus{
+	privateapi.PaymentStatusPending: {
+		privateapi.PaymentStatusDelivered,
+		privateapi.PaymentStatusConfirmed,
+		privateapi.PaymentStatusFailed,
+		privateapi.PaymentStatusRejected,
+	},
+	privateapi.PaymentStatusDelivered: {
+		privateapi.PaymentStatusConfirmed,
+		privateapi.PaymentStatusFailed,
+		privateapi.PaymentStatusRejected,
+	},
+	privateapi.PaymentStatusConfirmed: {},
+	privateapi.PaymentStatusFailed:    {},
+	privateapi.PaymentStatusRejected:  {},
+}
+
+// IsLegalStatusTransition reports whether a payment can move from one status to another
+func IsLegalStatusTransition(from privateapi.PaymentStatus, to privateapi.PaymentStatus) bool {
+	if from == to {
+		return true
+	}
+	for _, status := range statusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedPreviousStatuses returns the statuses a payment can move to the given status from.
+// It returns nil, meaning any status, for the statuses unknown to the transition table.
+func allowedPreviousStatuses(to privateapi.PaymentStatus) []privateapi.PaymentStatus {
+	if _, known := statusTransitions[to]; !known {
+		return nil
+	}
+	previousStatuses := []privateapi.PaymentStatus{to}
+	for from, toStatuses := range statusTransitions {
+		for _, status := range toStatuses {
+			if status == to {
+				previousStatuses = append(previousStatuses, from)
+			}
+		}
+	}
+	return previousStatuses
+}
+
+// StatusTransitionPolicy defines what to do with the updates making an illegal status transition
+type StatusTransitionPolicy string
+
+const (
+	// StatusTransitionPolicyReject fails the update, so the event is sent to the dead letter store
+	StatusTransitionPolicyReject StatusTransitionPolicy = "reject"
+	// StatusTransitionPolicyQuarantine applies the update but keeps the current status of the payment
+	StatusTransitionPolicyQuarantine StatusTransitionPolicy = "quarantine"
+	// StatusTransitionPolicyWarn applies the update as is
+	StatusTransitionPolicyWarn StatusTransitionPolicy = "warn"
+)
+
+func ParseStatusTransitionPolicy(policy string) (StatusTransitionPolicy, error) {
+	switch StatusTransitionPolicy(policy) {
+	case StatusTransitionPolicyReject, StatusTransitionPolicyQuarantine, StatusTransitionPolicyWarn:
+		return StatusTransitionPolicy(policy), nil
+	default:
+		return "", fmt.Errorf("invalid status transition policy %q", policy)
+	}
+}
+
+// StatusViolation records an illegal status transition and the action taken on it
+type StatusViolation struct {
+	EventId          uuid.UUID
+	PaymentId        uuid.UUID
+	AggregateVersion uint64
+	From             privateapi.PaymentStatus
+	To               privateapi.PaymentStatus
+	Action           StatusTransitionPolicy
+	DetectedAt       time.Time
+}
+
+type StatusViolationsRepository interface {
+	// RecordViolation stores the violation. Recording again a
+	// violation of the same event replaces the previous one.
+	RecordViolation(ctx context.Context, violation StatusViolation) werrors.WError
+	// SearchViolations returns the violations of the payment, or all of them if paymentId is uuid.Nil
+	SearchViolations(ctx context.Context, paymentId uuid.UUID) ([]StatusViolation, werrors.WError)
+}
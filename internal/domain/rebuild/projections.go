@@ -0,0 +1,39 @@
+package rebuild
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	paymentsevents "github.com/walletera/payments-types/events"
+	"github.com/walletera/werrors"
+)
+
+// PaymentSummary condenses a payment, so its copies in two collections can be compared
+type PaymentSummary struct {
+	AggregateVersion uint64
+	// Checksum hashes the id, the version, the status and the externalId of the payment
+	Checksum uint64
+}
+
+// Projections manages the collections holding the payments projection
+type Projections interface {
+	// ActiveCollection returns the collection the payments are read from and written to
+	ActiveCollection() string
+	// CreateCollection creates the collection with the indexes of the payments, so they
+	// are built while the collection is filled and are ready when the reads move to it
+	CreateCollection(ctx context.Context, collection string) werrors.WError
+	// SwitchActiveCollection atomically replaces the active collection, provided it is still from
+	SwitchActiveCollection(ctx context.Context, from string, to string) werrors.WError
+	// SwitchAcknowledged tells whether every running instance of the service writes to the collection
+	SwitchAcknowledged(ctx context.Context, collection string) (bool, werrors.WError)
+	// CountPaymentsMissingFromLog counts the payments of the collection whose PaymentCreated
+	// event is not in the event log, like the ones projected before the log was introduced
+	CountPaymentsMissingFromLog(ctx context.Context, collection string) (int64, werrors.WError)
+	// Summaries returns the summary of every payment of the collection, by payment id
+	Summaries(ctx context.Context, collection string) (map[uuid.UUID]PaymentSummary, werrors.WError)
+	DropCollection(ctx context.Context, collection string) werrors.WError
+}
+
+// EventsHandlerFactory builds an events handler projecting the payments into the
+// given collection, parking the out of order updates in pendingUpdatesCollection
+type EventsHandlerFactory func(collection string, pendingUpdatesCollection string) paymentsevents.Handler
@@ -0,0 +1,387 @@
+package rebuild
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+	"github.com/walletera/eventskit/events"
+	paymentsevents "github.com/walletera/payments-types/events"
+	"github.com/walletera/werrors"
+)
+
+const (
+	// catchUpOverlap is replayed again on every replay after the first one, so events
+	// applied to the live collection but logged a bit later than others are not missed.
+	// Replaying an event already applied to the shadow collection is a no-op.
+	catchUpOverlap = time.Minute
+	// the shadow collection is compared with the previous one once a catch up round replays
+	// at most caughtUpEvents new events. The rebuild fails when they still don't match after
+	// maxCatchUpRounds, e.g. under a traffic the replay can't keep up with.
+	caughtUpEvents   = 100
+	maxCatchUpRounds = 5
+	// progressSaveInterval is how often the progress of a running rebuild is saved.
+	// A running rebuild not saved for staleRebuildTimeout was abandoned by its instance.
+	progressSaveInterval    = 5 * time.Second
+	staleRebuildTimeout     = 5 * time.Minute
+	defaultSwitchPollPeriod = time.Second
+)
+
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+type Rebuild struct {
+	ID                 uuid.UUID
+	Status             Status
+	PreviousCollection string
+	ShadowCollection   string
+	ReplayedEvents     int
+	CatchUpRounds      int
+	StartedAt          time.Time
+	SwitchedAt         time.Time
+	FinishedAt         time.Time
+	UpdatedAt          time.Time
+	Error              string
+}
+
+// Rebuilder rebuilds the payments projection into a shadow collection replaying
+// the event log through the payments events handler. The live consumers keep
+// projecting the new events into the active collection meanwhile. Once the shadow
+// collection caught up with the active one and holds the same payments, it becomes
+// the active collection, and the replay goes on until every instance of the service
+// writes to it, so the events projected into the previous collection by the instances
+// not switched yet are not lost.
+type Rebuilder struct {
+	eventLog             payments.EventLog
+	projections          Projections
+	repository           Repository
+	eventsHandlerFactory EventsHandlerFactory
+	eventsDeserializer   events.Deserializer[paymentsevents.Handler]
+	// switchSettleDelay bounds the handling of an event, so the events being
+	// handled by an instance while it acknowledged the switch are logged after it
+	switchSettleDelay time.Duration
+	switchPollPeriod  time.Duration
+	logger            *slog.Logger
+}
+
+func NewRebuilder(
+	eventLog payments.EventLog,
+	projections Projections,
+	repository Repository,
+	eventsHandlerFactory EventsHandlerFactory,
+	eventsDeserializer events.Deserializer[paymentsevents.Handler],
+	switchSettleDelay time.Duration,
+	logger *slog.Logger,
+) *Rebuilder {
+	return &Rebuilder{
+		eventLog:             eventLog,
+		projections:          projections,
+		repository:           repository,
+		eventsHandlerFactory: eventsHandlerFactory,
+		eventsDeserializer:   eventsDeserializer,
+		switchSettleDelay:    switchSettleDelay,
+		switchPollPeriod:     defaultSwitchPollPeriod,
+		logger:               logger,
+	}
+}
+
+// Start launches a rebuild in the background and returns it. Only one rebuild can run at a time.
+// The rebuild is refused when the active collection holds payments missing from the event log,
+// as it would drop them. The rebuild is bound to ctx, so it must not be a request scoped context.
+func (r *Rebuilder) Start(ctx context.Context) (Rebuild, werrors.WError) {
+	activeCollection := r.projections.ActiveCollection()
+	missingPayments, werr := r.projections.CountPaymentsMissingFromLog(ctx, activeCollection)
+	if werr != nil {
+		return Rebuild{}, werr
+	}
+	if missingPayments > 0 {
+		return Rebuild{}, werrors.NewValidationError(
+			"%d payments of %s are missing from the event log, a rebuild would drop them",
+			missingPayments,
+			activeCollection,
+		)
+	}
+	werr = r.repository.FailStaleRebuilds(ctx, time.Now().Add(-staleRebuildTimeout))
+	if werr != nil {
+		return Rebuild{}, werr
+	}
+	now := time.Now()
+	rebuild := &Rebuild{
+		ID:                 uuid.New(),
+		Status:             StatusRunning,
+		PreviousCollection: activeCollection,
+		ShadowCollection:   fmt.Sprintf("%s_%s", activeCollection, now.UTC().Format("20060102150405")),
+		StartedAt:          now,
+		UpdatedAt:          now,
+	}
+	werr = r.repository.InsertRebuild(ctx, *rebuild)
+	if werr != nil {
+		return Rebuild{}, werr
+	}
+	started := *rebuild
+	go r.run(ctx, rebuild)
+	return started, nil
+}
+
+func (r *Rebuilder) GetRebuild(ctx context.Context, id uuid.UUID) (Rebuild, werrors.WError) {
+	return r.repository.GetRebuild(ctx, id)
+}
+
+func (r *Rebuilder) run(ctx context.Context, rebuild *Rebuild) {
+	logger := r.logger.With(
+		logattr.RebuildId(rebuild.ID.String()),
+		logattr.Collection(rebuild.ShadowCollection),
+	)
+	logger.Info("projection rebuild started")
+
+	werr := r.rebuild(ctx, rebuild, logger)
+
+	rebuild.FinishedAt = time.Now()
+	if werr != nil {
+		rebuild.Status = StatusFailed
+		rebuild.Error = werr.Message()
+		logger.Error("projection rebuild failed", logattr.Error(werr.Message()))
+	} else {
+		rebuild.Status = StatusCompleted
+		logger.Info("projection rebuild completed", logattr.ReplayedEvents(rebuild.ReplayedEvents))
+	}
+	r.saveProgress(context.WithoutCancel(ctx), rebuild, logger)
+}
+
+func (r *Rebuilder) rebuild(ctx context.Context, rebuild *Rebuild, logger *slog.Logger) werrors.WError {
+	werr := r.projections.CreateCollection(ctx, rebuild.ShadowCollection)
+	if werr != nil {
+		return werr
+	}
+	pendingUpdatesCollection := rebuild.ShadowCollection + "_pending_updates"
+	defer func() {
+		werr := r.projections.DropCollection(context.WithoutCancel(ctx), pendingUpdatesCollection)
+		if werr != nil {
+			logger.Error("failed dropping rebuild pending updates collection", logattr.Error(werr.Message()))
+		}
+	}()
+	eventsHandler := r.eventsHandlerFactory(rebuild.ShadowCollection, pendingUpdatesCollection)
+
+	replayedUntil, _, werr := r.replay(ctx, rebuild, eventsHandler, time.Time{}, logger)
+	if werr != nil {
+		return werr
+	}
+
+	// a partial or corrupt shadow collection must not become active
+	for {
+		if rebuild.CatchUpRounds >= maxCatchUpRounds {
+			return werrors.NewNonRetryableInternalError(fmt.Sprintf(
+				"shadow collection %s doesn't match %s after %d catch up rounds",
+				rebuild.ShadowCollection,
+				rebuild.PreviousCollection,
+				maxCatchUpRounds,
+			))
+		}
+		rebuild.CatchUpRounds++
+		var newEvents int
+		replayedUntil, newEvents, werr = r.replay(ctx, rebuild, eventsHandler, replayedUntil, logger)
+		if werr != nil {
+			return werr
+		}
+		if newEvents > caughtUpEvents {
+			continue
+		}
+		var matching bool
+		replayedUntil, matching, werr = r.matchPreviousCollection(ctx, rebuild, eventsHandler, replayedUntil, logger)
+		if werr != nil {
+			return werr
+		}
+		if matching {
+			break
+		}
+	}
+
+	werr = r.projections.SwitchActiveCollection(ctx, rebuild.PreviousCollection, rebuild.ShadowCollection)
+	if werr != nil {
+		return werr
+	}
+	rebuild.SwitchedAt = time.Now()
+	r.saveProgress(ctx, rebuild, logger)
+	logger.Info("active collection switched", logattr.Collection(rebuild.ShadowCollection))
+
+	// the instances not switched yet keep projecting the events into the previous collection
+	for {
+		replayedUntil, _, werr = r.replay(ctx, rebuild, eventsHandler, replayedUntil, logger)
+		if werr != nil {
+			return werr
+		}
+		acknowledged, werr := r.projections.SwitchAcknowledged(ctx, rebuild.ShadowCollection)
+		if werr != nil {
+			return werr
+		}
+		if acknowledged {
+			break
+		}
+		r.saveProgress(ctx, rebuild, logger)
+		werr = sleep(ctx, r.switchPollPeriod)
+		if werr != nil {
+			return werr
+		}
+	}
+
+	// the events handled by an instance while it acknowledged the switch
+	// may have been projected into the previous collection, they are
+	// logged before the handling of an event times out
+	werr = sleep(ctx, r.switchSettleDelay)
+	if werr != nil {
+		return werr
+	}
+	_, _, werr = r.replay(ctx, rebuild, eventsHandler, replayedUntil, logger)
+	return werr
+}
+
+// replay applies the events logged from replayedUntil on, going catchUpOverlap back, and returns
+// the log time of the last one and how many of the events replayed were logged after replayedUntil
+func (r *Rebuilder) replay(
+	ctx context.Context,
+	rebuild *Rebuild,
+	eventsHandler paymentsevents.Handler,
+	replayedUntil time.Time,
+	logger *slog.Logger,
+) (time.Time, int, werrors.WError) {
+	loggedFrom := replayedUntil
+	if !replayedUntil.IsZero() {
+		loggedFrom = replayedUntil.Add(-catchUpOverlap)
+	}
+	iterator, werr := r.eventLog.IterateEvents(ctx, loggedFrom)
+	if werr != nil {
+		return time.Time{}, 0, werr
+	}
+	defer iterator.Close()
+
+	lastLoggedAt := replayedUntil
+	newEvents := 0
+	for {
+		ok, loggedEvent, err := iterator.Next()
+		if err != nil {
+			return time.Time{}, 0, werrors.NewRetryableInternalError("failed iterating event log: %s", err.Error())
+		}
+		if !ok {
+			return lastLoggedAt, newEvents, nil
+		}
+		werr := r.apply(ctx, eventsHandler, loggedEvent)
+		if werr != nil {
+			return time.Time{}, 0, werr
+		}
+		if loggedEvent.LoggedAt.After(replayedUntil) {
+			newEvents++
+		}
+		if loggedEvent.LoggedAt.After(lastLoggedAt) {
+			lastLoggedAt = loggedEvent.LoggedAt
+		}
+		rebuild.ReplayedEvents++
+		if time.Since(rebuild.UpdatedAt) > progressSaveInterval {
+			r.saveProgress(ctx, rebuild, logger)
+		}
+	}
+}
+
+// matchPreviousCollection compares the count and the checksums of the payments of the shadow
+// collection with the previous one. The previous collection is read first and the events applied
+// to it meanwhile are replayed before reading the shadow one, so the shadow collection must hold
+// every payment of the previous one, at the same version with the same checksum, or at a later
+// version when it changed in between. It returns the log time of the last event replayed.
+func (r *Rebuilder) matchPreviousCollection(
+	ctx context.Context,
+	rebuild *Rebuild,
+	eventsHandler paymentsevents.Handler,
+	replayedUntil time.Time,
+	logger *slog.Logger,
+) (time.Time, bool, werrors.WError) {
+	previousSummaries, werr := r.projections.Summaries(ctx, rebuild.PreviousCollection)
+	if werr != nil {
+		return time.Time{}, false, werr
+	}
+	replayedUntil, _, werr = r.replay(ctx, rebuild, eventsHandler, replayedUntil, logger)
+	if werr != nil {
+		return time.Time{}, false, werr
+	}
+	shadowSummaries, werr := r.projections.Summaries(ctx, rebuild.ShadowCollection)
+	if werr != nil {
+		return time.Time{}, false, werr
+	}
+	mismatched := 0
+	for paymentId, previous := range previousSummaries {
+		shadow, found := shadowSummaries[paymentId]
+		if !found ||
+			shadow.AggregateVersion < previous.AggregateVersion ||
+			(shadow.AggregateVersion == previous.AggregateVersion && shadow.Checksum != previous.Checksum) {
+			mismatched++
+		}
+	}
+	if mismatched > 0 || len(shadowSummaries) < len(previousSummaries) {
+		logger.Warn(
+			"shadow collection doesn't match the previous collection",
+			logattr.PreviousCount(len(previousSummaries)),
+			logattr.ShadowCount(len(shadowSummaries)),
+			logattr.MismatchedPayments(mismatched),
+		)
+		return replayedUntil, false, nil
+	}
+	return replayedUntil, true, nil
+}
+
+func (r *Rebuilder) apply(ctx context.Context, eventsHandler paymentsevents.Handler, loggedEvent payments.LoggedEvent) werrors.WError {
+	rawEvent, err := json.Marshal(events.EventEnvelope{
+		Id:               loggedEvent.ID,
+		Type:             loggedEvent.Type,
+		AggregateVersion: loggedEvent.AggregateVersion,
+		CorrelationId:    loggedEvent.CorrelationId,
+		CreatedAt:        loggedEvent.CreatedAt,
+		Data:             loggedEvent.Data,
+	})
+	if err != nil {
+		return werrors.NewNonRetryableInternalError("failed serializing logged event %s: %s", loggedEvent.ID, err.Error())
+	}
+	event, err := r.eventsDeserializer.Deserialize(rawEvent)
+	if err != nil {
+		return werrors.NewUnprocessableMessageError(fmt.Sprintf("failed deserializing logged event %s: %s", loggedEvent.ID, err.Error()))
+	}
+	if event == nil {
+		// the event log only holds applied events, so this is an event type removed since
+		return nil
+	}
+	werr := event.Accept(ctx, eventsHandler)
+	if werr != nil && werr.Code() != payments.PaymentVersionMismatchErrorCode {
+		return werr
+	}
+	// a version mismatch means a later update of the payment was already replayed
+	return nil
+}
+
+// saveProgress persists the rebuild. The failures are only logged,
+// the progress is saved again a few seconds later.
+func (r *Rebuilder) saveProgress(ctx context.Context, rebuild *Rebuild, logger *slog.Logger) {
+	rebuild.UpdatedAt = time.Now()
+	werr := r.repository.UpdateRebuild(ctx, *rebuild)
+	if werr != nil {
+		logger.Error("failed saving projection rebuild", logattr.Error(werr.Message()))
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) werrors.WError {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return werrors.NewNonRetryableInternalError("projection rebuild interrupted: %s", ctx.Err().Error())
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,518 @@
+package rebuild
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+
+	"github.com/google/uuid"
+	paymentsevents "github.com/walletera/payments-types/events"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+)
+
+const (
+	activeCollection = "payments"
+	rebuildTimeout   = 10 * time.Second
+	// the instance not switched yet writes this many events to the previous collection
+	// after the switch, before picking it up
+	lateWrites        = 50
+	switchSettleDelay = 20 * time.Millisecond
+)
+
+// TestRebuildKeepsTheEventsPublishedDuringTheRebuild runs a rebuild while another instance keeps
+// projecting events, into the previous collection until it picks up the switch, and checks the
+// rebuilt collection ends up with the latest version of every payment
+func TestRebuildKeepsTheEventsPublishedDuringTheRebuild(t *testing.T) {
+	test := newRebuilderTest()
+	instance := test.startInstance(20)
+	instance.waitForEvents(t, 200)
+
+	started, werr := test.rebuilder.Start(context.Background())
+	if werr != nil {
+		t.Fatalf("failed starting rebuild: %s", werr.Message())
+	}
+	finished := test.waitForRebuild(t, started.ID)
+	instance.stop()
+
+	if finished.Status != StatusCompleted {
+		t.Fatalf("expected the rebuild to complete, but it finished %s: %s", finished.Status, finished.Error)
+	}
+	if finished.SwitchedAt.IsZero() {
+		t.Error("expected the rebuild to record the switch")
+	}
+	if test.projections.ActiveCollection() != started.ShadowCollection {
+		t.Fatalf("expected the active collection to be %s, but got %s", started.ShadowCollection, test.projections.ActiveCollection())
+	}
+	if test.projections.writesAfterSwitch() == 0 {
+		t.Fatal("expected the instance to write to the previous collection after the switch")
+	}
+	expected := test.eventLog.latestVersions()
+	rebuilt := test.projections.collection(started.ShadowCollection)
+	for paymentId, version := range expected {
+		if rebuilt[paymentId] != version {
+			t.Errorf("expected payment %s at version %d in the rebuilt collection, but got %d", paymentId, version, rebuilt[paymentId])
+		}
+	}
+	if len(rebuilt) != len(expected) {
+		t.Errorf("expected %d payments in the rebuilt collection, but got %d", len(expected), len(rebuilt))
+	}
+	if test.projections.writesToMissing != 0 {
+		t.Errorf("expected the shadow collection to be created with its indexes before being written, but got %d writes before", test.projections.writesToMissing)
+	}
+	if !slices.Contains(test.projections.dropped, started.ShadowCollection+"_pending_updates") {
+		t.Error("expected the pending updates collection of the rebuild to be dropped")
+	}
+}
+
+func TestRebuildFailsWhenTheShadowCollectionDoesNotMatchThePreviousOne(t *testing.T) {
+	test := newRebuilderTest()
+	instance := test.startInstance(20)
+	instance.waitForEvents(t, 200)
+	instance.stop()
+	corruptedPayment := slices.Collect(maps.Keys(test.eventLog.latestVersions()))[0]
+	test.projections.corrupted[activeCollection] = corruptedPayment
+
+	started, werr := test.rebuilder.Start(context.Background())
+	if werr != nil {
+		t.Fatalf("failed starting rebuild: %s", werr.Message())
+	}
+	finished := test.waitForRebuild(t, started.ID)
+
+	if finished.Status != StatusFailed {
+		t.Fatalf("expected the rebuild to fail, but it finished %s", finished.Status)
+	}
+	if finished.CatchUpRounds != maxCatchUpRounds {
+		t.Errorf("expected the rebuild to fail after %d catch up rounds, but got %d", maxCatchUpRounds, finished.CatchUpRounds)
+	}
+	if test.projections.ActiveCollection() != activeCollection {
+		t.Errorf("expected the active collection to remain %s, but got %s", activeCollection, test.projections.ActiveCollection())
+	}
+}
+
+func TestRebuildIsRefusedWhenPaymentsAreMissingFromTheEventLog(t *testing.T) {
+	test := newRebuilderTest()
+	test.projections.missingFromLog = 3
+
+	_, werr := test.rebuilder.Start(context.Background())
+	if werr == nil || werr.Code() != werrors.ValidationErrorCode {
+		t.Fatalf("expected a validation error, but got %v", werr)
+	}
+	if len(test.repository.rebuilds) != 0 {
+		t.Errorf("expected no rebuild to be saved, but got %d", len(test.repository.rebuilds))
+	}
+}
+
+func TestRebuildIsRefusedWhileAnotherRebuildIsRunning(t *testing.T) {
+	test := newRebuilderTest()
+	running := Rebuild{ID: uuid.New(), Status: StatusRunning, UpdatedAt: time.Now()}
+	test.repository.rebuilds[running.ID] = running
+
+	_, werr := test.rebuilder.Start(context.Background())
+	if werr == nil || werr.Code() != werrors.ResourceAlreadyExistErrorCode {
+		t.Fatalf("expected a resource already exist error, but got %v", werr)
+	}
+}
+
+func TestRebuildFailsTheRebuildsAbandonedByAStoppedInstance(t *testing.T) {
+	test := newRebuilderTest()
+	abandoned := Rebuild{ID: uuid.New(), Status: StatusRunning, UpdatedAt: time.Now().Add(-2 * staleRebuildTimeout)}
+	test.repository.rebuilds[abandoned.ID] = abandoned
+
+	started, werr := test.rebuilder.Start(context.Background())
+	if werr != nil {
+		t.Fatalf("failed starting rebuild: %s", werr.Message())
+	}
+	test.waitForRebuild(t, started.ID)
+
+	found, werr := test.rebuilder.GetRebuild(context.Background(), abandoned.ID)
+	if werr != nil {
+		t.Fatalf("failed getting the abandoned rebuild: %s", werr.Message())
+	}
+	if found.Status != StatusFailed {
+		t.Errorf("expected the abandoned rebuild to be failed, but got %s", found.Status)
+	}
+}
+
+type rebuilderTest struct {
+	eventLog    *fakeEventLog
+	projections *fakeProjections
+	repository  *fakeRepository
+	rebuilder   *Rebuilder
+}
+
+func newRebuilderTest() *rebuilderTest {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	eventLog := &fakeEventLog{}
+	projections := newFakeProjections()
+	repository := &fakeRepository{rebuilds: make(map[uuid.UUID]Rebuild)}
+	rebuilder := NewRebuilder(
+		eventLog,
+		projections,
+		repository,
+		func(collection string, _ string) paymentsevents.Handler {
+			return &fakeEventsHandler{projections: projections, collection: collection}
+		},
+		paymentsevents.NewDeserializer(logger),
+		switchSettleDelay,
+		logger,
+	)
+	rebuilder.switchPollPeriod = 5 * time.Millisecond
+	return &rebuilderTest{
+		eventLog:    eventLog,
+		projections: projections,
+		repository:  repository,
+		rebuilder:   rebuilder,
+	}
+}
+
+func (r *rebuilderTest) waitForRebuild(t *testing.T, id uuid.UUID) Rebuild {
+	t.Helper()
+	deadline := time.Now().Add(rebuildTimeout)
+	for time.Now().Before(deadline) {
+		rebuild, werr := r.rebuilder.GetRebuild(context.Background(), id)
+		if werr != nil {
+			t.Fatalf("failed getting rebuild: %s", werr.Message())
+		}
+		if rebuild.Status != StatusRunning {
+			return rebuild
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("rebuild didn't finish after %s", rebuildTimeout)
+	return Rebuild{}
+}
+
+// startInstance simulates another instance of the service consuming the events of the
+// payments, projecting them into the collection it last loaded and then logging them
+func (r *rebuilderTest) startInstance(paymentsCount int) *fakeInstance {
+	ctx, cancel := context.WithCancel(context.Background())
+	instance := &fakeInstance{cancel: cancel, done: make(chan struct{}), eventLog: r.eventLog}
+	paymentIds := make([]uuid.UUID, paymentsCount)
+	for i := range paymentIds {
+		paymentIds[i] = uuid.New()
+	}
+	r.projections.mutex.Lock()
+	r.projections.instanceLive = true
+	r.projections.mutex.Unlock()
+	go func() {
+		defer close(instance.done)
+		versions := make(map[uuid.UUID]uint64)
+		for i := 0; ctx.Err() == nil; i++ {
+			r.projections.reloadInstance()
+			paymentId := paymentIds[i%len(paymentIds)]
+			version := versions[paymentId]
+			versions[paymentId]++
+			r.projections.applyFromInstance(paymentId, version)
+			r.eventLog.append(paymentUpdated(paymentId, version))
+			time.Sleep(200 * time.Microsecond)
+		}
+	}()
+	return instance
+}
+
+type fakeInstance struct {
+	cancel   context.CancelFunc
+	done     chan struct{}
+	eventLog *fakeEventLog
+}
+
+func (f *fakeInstance) waitForEvents(t *testing.T, count int) {
+	t.Helper()
+	for f.eventLog.count() < count {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (f *fakeInstance) stop() {
+	f.cancel()
+	<-f.done
+}
+
+func paymentUpdated(paymentId uuid.UUID, version uint64) payments.LoggedEvent {
+	data, _ := json.Marshal(&privateapi.PaymentUpdate{PaymentId: paymentId, Status: privateapi.PaymentStatusConfirmed})
+	return payments.LoggedEvent{
+		ID:               uuid.New(),
+		Type:             paymentsevents.PaymentUpdatedType,
+		AggregateVersion: version,
+		CorrelationId:    "a-correlation-id",
+		CreatedAt:        time.Now(),
+		PaymentId:        paymentId,
+		Data:             data,
+	}
+}
+
+type fakeEventLog struct {
+	mutex  sync.Mutex
+	events []payments.LoggedEvent
+}
+
+func (f *fakeEventLog) append(event payments.LoggedEvent) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	event.LoggedAt = time.Now()
+	f.events = append(f.events, event)
+}
+
+func (f *fakeEventLog) count() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.events)
+}
+
+func (f *fakeEventLog) latestVersions() map[uuid.UUID]uint64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	versions := make(map[uuid.UUID]uint64)
+	for _, event := range f.events {
+		versions[event.PaymentId] = max(versions[event.PaymentId], event.AggregateVersion)
+	}
+	return versions
+}
+
+func (f *fakeEventLog) AppendEvent(_ context.Context, event payments.LoggedEvent) werrors.WError {
+	f.append(event)
+	return nil
+}
+
+func (f *fakeEventLog) GetEvent(context.Context, uuid.UUID) (payments.LoggedEvent, werrors.WError) {
+	return payments.LoggedEvent{}, werrors.NewResourceNotFoundError("logged event not found")
+}
+
+func (f *fakeEventLog) ListPaymentEvents(context.Context, uuid.UUID) ([]payments.LoggedEvent, werrors.WError) {
+	return nil, nil
+}
+
+func (f *fakeEventLog) IterateEvents(_ context.Context, loggedFrom time.Time) (payments.LoggedEventsIterator, werrors.WError) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var loggedEvents []payments.LoggedEvent
+	for _, event := range f.events {
+		if !event.LoggedAt.Before(loggedFrom) {
+			loggedEvents = append(loggedEvents, event)
+		}
+	}
+	return &fakeIterator{events: loggedEvents}, nil
+}
+
+type fakeIterator struct {
+	events []payments.LoggedEvent
+}
+
+func (f *fakeIterator) Next() (bool, payments.LoggedEvent, error) {
+	if len(f.events) == 0 {
+		return false, payments.LoggedEvent{}, nil
+	}
+	event := f.events[0]
+	f.events = f.events[1:]
+	return true, event, nil
+}
+
+func (f *fakeIterator) Close() error {
+	return nil
+}
+
+// fakeProjections keeps the version of every payment by collection. The active collection
+// is the one of the rebuilding instance, the other instance uses the one it last reloaded.
+type fakeProjections struct {
+	mutex              sync.Mutex
+	active             string
+	instanceLive       bool
+	instanceCollection string
+	collections        map[string]map[uuid.UUID]uint64
+	switched           bool
+	writesAfterSwitchN int
+	missingFromLog     int64
+	dropped            []string
+	created            []string
+	// writesToMissing counts the writes to the collections not created
+	writesToMissing int
+	// corrupted is the payment of every collection whose content differs from its version
+	corrupted map[string]uuid.UUID
+}
+
+func newFakeProjections() *fakeProjections {
+	return &fakeProjections{
+		active:             activeCollection,
+		instanceCollection: activeCollection,
+		collections:        make(map[string]map[uuid.UUID]uint64),
+		created:            []string{activeCollection},
+		corrupted:          make(map[string]uuid.UUID),
+	}
+}
+
+func (f *fakeProjections) apply(collection string, paymentId uuid.UUID, version uint64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.applyLocked(collection, paymentId, version)
+}
+
+func (f *fakeProjections) applyLocked(collection string, paymentId uuid.UUID, version uint64) {
+	if !slices.Contains(f.created, collection) {
+		f.writesToMissing++
+	}
+	versions, ok := f.collections[collection]
+	if !ok {
+		versions = make(map[uuid.UUID]uint64)
+		f.collections[collection] = versions
+	}
+	if current, found := versions[paymentId]; !found || version > current {
+		versions[paymentId] = version
+	}
+}
+
+func (f *fakeProjections) applyFromInstance(paymentId uuid.UUID, version uint64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.switched && f.instanceCollection != f.active {
+		f.writesAfterSwitchN++
+	}
+	f.applyLocked(f.instanceCollection, paymentId, version)
+}
+
+// reloadInstance picks up the active collection, lateWrites writes after the switch
+func (f *fakeProjections) reloadInstance() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.switched && f.writesAfterSwitchN < lateWrites {
+		return
+	}
+	f.instanceCollection = f.active
+}
+
+func (f *fakeProjections) writesAfterSwitch() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.writesAfterSwitchN
+}
+
+func (f *fakeProjections) collection(name string) map[uuid.UUID]uint64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return maps.Clone(f.collections[name])
+}
+
+func (f *fakeProjections) ActiveCollection() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.active
+}
+
+func (f *fakeProjections) CreateCollection(_ context.Context, collection string) werrors.WError {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.created = append(f.created, collection)
+	return nil
+}
+
+func (f *fakeProjections) SwitchActiveCollection(_ context.Context, from string, to string) werrors.WError {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.active != from {
+		return werrors.NewNonRetryableInternalError("active collection is not %s anymore", from)
+	}
+	f.active = to
+	f.switched = true
+	return nil
+}
+
+func (f *fakeProjections) SwitchAcknowledged(_ context.Context, collection string) (bool, werrors.WError) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return !f.instanceLive || f.instanceCollection == collection, nil
+}
+
+func (f *fakeProjections) CountPaymentsMissingFromLog(context.Context, string) (int64, werrors.WError) {
+	return f.missingFromLog, nil
+}
+
+// Summaries derives the checksum of a payment from its version, unless it is corrupted
+func (f *fakeProjections) Summaries(_ context.Context, collection string) (map[uuid.UUID]PaymentSummary, werrors.WError) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	summaries := make(map[uuid.UUID]PaymentSummary)
+	for paymentId, version := range f.collections[collection] {
+		checksum := version
+		if f.corrupted[collection] == paymentId {
+			checksum++
+		}
+		summaries[paymentId] = PaymentSummary{AggregateVersion: version, Checksum: checksum}
+	}
+	return summaries, nil
+}
+
+func (f *fakeProjections) DropCollection(_ context.Context, collection string) werrors.WError {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.dropped = append(f.dropped, collection)
+	return nil
+}
+
+type fakeEventsHandler struct {
+	projections *fakeProjections
+	collection  string
+}
+
+func (f *fakeEventsHandler) HandlePaymentCreated(_ context.Context, event paymentsevents.PaymentCreated) werrors.WError {
+	f.projections.apply(f.collection, event.Data.ID, event.AggregateVersion())
+	return nil
+}
+
+func (f *fakeEventsHandler) HandlePaymentUpdated(_ context.Context, event paymentsevents.PaymentUpdated) werrors.WError {
+	f.projections.apply(f.collection, event.Data.PaymentId, event.AggregateVersion())
+	return nil
+}
+
+type fakeRepository struct {
+	mutex    sync.Mutex
+	rebuilds map[uuid.UUID]Rebuild
+}
+
+func (f *fakeRepository) InsertRebuild(_ context.Context, rebuild Rebuild) werrors.WError {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, existing := range f.rebuilds {
+		if existing.Status == StatusRunning {
+			return werrors.NewResourceAlreadyExistError("a projection rebuild is already running")
+		}
+	}
+	f.rebuilds[rebuild.ID] = rebuild
+	return nil
+}
+
+func (f *fakeRepository) UpdateRebuild(_ context.Context, rebuild Rebuild) werrors.WError {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.rebuilds[rebuild.ID] = rebuild
+	return nil
+}
+
+func (f *fakeRepository) GetRebuild(_ context.Context, id uuid.UUID) (Rebuild, werrors.WError) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	rebuild, ok := f.rebuilds[id]
+	if !ok {
+		return Rebuild{}, werrors.NewResourceNotFoundError("rebuild %s not found", id)
+	}
+	return rebuild, nil
+}
+
+func (f *fakeRepository) FailStaleRebuilds(_ context.Context, updatedBefore time.Time) werrors.WError {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for id, rebuild := range f.rebuilds {
+		if rebuild.Status == StatusRunning && rebuild.UpdatedAt.Before(updatedBefore) {
+			rebuild.Status = StatusFailed
+			f.rebuilds[id] = rebuild
+		}
+	}
+	return nil
+}
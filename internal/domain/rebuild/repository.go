@@ -0,0 +1,22 @@
+package rebuild
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+)
+
+// Repository persists the rebuilds, so their progress is available
+// from every instance and survives the instance running them
+type Repository interface {
+	// InsertRebuild saves a new running rebuild. It fails with
+	// a ResourceAlreadyExist error when another rebuild is running.
+	InsertRebuild(ctx context.Context, rebuild Rebuild) werrors.WError
+	UpdateRebuild(ctx context.Context, rebuild Rebuild) werrors.WError
+	GetRebuild(ctx context.Context, id uuid.UUID) (Rebuild, werrors.WError)
+	// FailStaleRebuilds fails the running rebuilds not updated since updatedBefore,
+	// which were left behind by an instance stopped in the middle of the rebuild
+	FailStaleRebuilds(ctx context.Context, updatedBefore time.Time) werrors.WError
+}
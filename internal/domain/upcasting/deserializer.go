@@ -0,0 +1,60 @@
+package upcasting
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/walletera/eventskit/events"
+	paymentsevents "github.com/walletera/payments-types/events"
+)
+
+var _ events.Deserializer[paymentsevents.Handler] = (*Deserializer)(nil)
+
+// Deserializer migrates the events published with an older schema to the
+// current one before passing them to the wrapped deserializer
+type Deserializer struct {
+	registry     *Registry
+	deserializer events.Deserializer[paymentsevents.Handler]
+	logger       *slog.Logger
+}
+
+func NewDeserializer(registry *Registry, deserializer events.Deserializer[paymentsevents.Handler], logger *slog.Logger) *Deserializer {
+	return &Deserializer{
+		registry:     registry,
+		deserializer: deserializer,
+		logger:       logger,
+	}
+}
+
+func (d *Deserializer) Deserialize(rawPayload []byte) (events.Event[paymentsevents.Handler], error) {
+	var envelope Envelope
+	err := json.Unmarshal(rawPayload, &envelope)
+	if err != nil {
+		return nil, fmt.Errorf("error deserializing message with payload %s: %w", rawPayload, err)
+	}
+	if envelope.SchemaVersion == 0 && d.registry.CurrentVersion(envelope.Type) == InitialSchemaVersion {
+		return d.deserializer.Deserialize(rawPayload)
+	}
+
+	fromVersion := max(envelope.SchemaVersion, InitialSchemaVersion)
+	upcasted, err := d.registry.Upcast(envelope)
+	if err != nil {
+		return nil, err
+	}
+	upcastedPayload, err := json.Marshal(upcasted)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing upcasted event %s: %w", envelope.Id, err)
+	}
+	if upcasted.SchemaVersion != fromVersion {
+		d.logger.Debug(
+			"event upcasted",
+			logattr.EventId(envelope.Id.String()),
+			logattr.EventType(upcasted.Type),
+			logattr.SchemaVersion(fromVersion, upcasted.SchemaVersion),
+		)
+	}
+	return d.deserializer.Deserialize(upcastedPayload)
+}
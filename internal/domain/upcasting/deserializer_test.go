@@ -0,0 +1,94 @@
+package upcasting
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+
+	paymentsevents "github.com/walletera/payments-types/events"
+)
+
+const legacyPaymentCreated = `{
+  "id": "4d7a2c1e-5b3f-4e6a-8c9d-0e1f2a3b4c5d",
+  "type": "PaymentCreated",
+  "aggregateVersion": 0,
+  "data": {
+    "id": "7b2e4f1a-3c5d-4a6b-9e8f-1a2b3c4d5e6f",
+    "amount": 100,
+    "currency": "USD",
+    "direction": "outbound",
+    "gateway": "dinopay",
+    "customerId": "2432318c-4ff3-4ac0-b734-9b61779e2e46",
+    "externalId": "asdfasdfasdf",
+    "state": "pending",
+    "debtor": {
+      "institutionName": "Lemon Cash",
+      "currency": "USD",
+      "accountDetails": {
+        "accountType": "cvu",
+        "cuit": "23112223339",
+        "routingInfo": {
+          "cvuRoutingInfoType": "cvu",
+          "cvu": "0003252627188236545234"
+        }
+      }
+    },
+    "beneficiary": {
+      "institutionName": "LetsBit",
+      "currency": "USD",
+      "accountDetails": {
+        "accountType": "cvu",
+        "cuit": "23112223339",
+        "routingInfo": {
+          "cvuRoutingInfoType": "cvu",
+          "cvu": "0004252627182736545234"
+        }
+      }
+    },
+    "createdAt": "2024-10-04T00:00:00Z",
+    "updatedAt": "2024-10-04T00:00:00Z"
+  }
+}`
+
+// upcastStateToStatus migrates the PaymentCreated events of a legacy schema,
+// which carried the status of the payment in a state field
+func upcastStateToStatus(envelope Envelope) (Envelope, error) {
+	var data map[string]json.RawMessage
+	err := json.Unmarshal(envelope.Data, &data)
+	if err != nil {
+		return Envelope{}, err
+	}
+	data["status"] = data["state"]
+	delete(data, "state")
+	envelope.Data, err = json.Marshal(data)
+	return envelope, err
+}
+
+func newTestDeserializer(registry *Registry) *Deserializer {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	return NewDeserializer(registry, paymentsevents.NewDeserializer(logger), logger)
+}
+
+func TestDeserializerUpcastsTheEventsWithAnOlderSchema(t *testing.T) {
+	registry := NewRegistry().Register(paymentsevents.PaymentCreatedType, InitialSchemaVersion, upcastStateToStatus)
+
+	event, err := newTestDeserializer(registry).Deserialize([]byte(legacyPaymentCreated))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	paymentCreated, ok := event.(paymentsevents.PaymentCreated)
+	if !ok {
+		t.Fatalf("expected a PaymentCreated event, but got %T", event)
+	}
+	if paymentCreated.Data.Status != "pending" {
+		t.Errorf("expected the upcasted payment to have status pending, but got %q", paymentCreated.Data.Status)
+	}
+}
+
+func TestDeserializerFailsOnTheEventsWithAnOlderSchemaWithoutUpcaster(t *testing.T) {
+	_, err := newTestDeserializer(NewRegistry()).Deserialize([]byte(legacyPaymentCreated))
+	if err == nil {
+		t.Fatal("expected the legacy event to fail deserializing without its upcaster")
+	}
+}
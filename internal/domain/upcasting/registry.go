@@ -0,0 +1,94 @@
+package upcasting
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InitialSchemaVersion is the schema version of the events whose envelope has no schemaVersion
+const InitialSchemaVersion = 1
+
+// Envelope is the envelope of a payment event as published by the Payments Service.
+// SchemaVersion identifies the shape of the envelope and its data for the event type.
+type Envelope struct {
+	Id               uuid.UUID       `json:"id"`
+	Type             string          `json:"type"`
+	SchemaVersion    int             `json:"schemaVersion,omitempty"`
+	AggregateVersion uint64          `json:"aggregateVersion"`
+	CorrelationId    string          `json:"correlationId"`
+	CreatedAt        time.Time       `json:"createdAt"`
+	Data             json.RawMessage `json:"data"`
+}
+
+// UpcastFunc migrates an event envelope to the next schema version of its type.
+// It can rewrite the data and any field of the envelope, including the type.
+type UpcastFunc func(envelope Envelope) (Envelope, error)
+
+type upcasterKey struct {
+	eventType   string
+	fromVersion int
+}
+
+// Registry holds the current schema version of every event type
+// and the upcasters migrating the older versions to it
+type Registry struct {
+	currentVersions map[string]int
+	upcasters       map[upcasterKey]UpcastFunc
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		currentVersions: make(map[string]int),
+		upcasters:       make(map[upcasterKey]UpcastFunc),
+	}
+}
+
+// Register adds the upcaster migrating the events of eventType from fromVersion to
+// fromVersion+1. The current version of the event type is raised accordingly.
+func (r *Registry) Register(eventType string, fromVersion int, upcast UpcastFunc) *Registry {
+	r.upcasters[upcasterKey{eventType: eventType, fromVersion: fromVersion}] = upcast
+	if r.CurrentVersion(eventType) < fromVersion+1 {
+		r.currentVersions[eventType] = fromVersion + 1
+	}
+	return r
+}
+
+// CurrentVersion returns the schema version of the eventType
+// understood by the deserializer the upcasted events are passed to
+func (r *Registry) CurrentVersion(eventType string) int {
+	version, found := r.currentVersions[eventType]
+	if !found {
+		return InitialSchemaVersion
+	}
+	return version
+}
+
+// Upcast applies, in order, the upcasters of the envelope type until it reaches the current version
+func (r *Registry) Upcast(envelope Envelope) (Envelope, error) {
+	if envelope.SchemaVersion == 0 {
+		envelope.SchemaVersion = InitialSchemaVersion
+	}
+	for envelope.SchemaVersion < r.CurrentVersion(envelope.Type) {
+		upcast, found := r.upcasters[upcasterKey{eventType: envelope.Type, fromVersion: envelope.SchemaVersion}]
+		if !found {
+			return Envelope{}, fmt.Errorf("no upcaster registered for %s events with schema version %d", envelope.Type, envelope.SchemaVersion)
+		}
+		fromVersion := envelope.SchemaVersion
+		upcasted, err := upcast(envelope)
+		if err != nil {
+			return Envelope{}, fmt.Errorf("failed upcasting %s event from schema version %d: %w", envelope.Type, fromVersion, err)
+		}
+		if upcasted.Type == envelope.Type && upcasted.SchemaVersion <= fromVersion {
+			// the upcasters don't need to keep track of the schema version
+			upcasted.SchemaVersion = fromVersion + 1
+		}
+		envelope = upcasted
+	}
+	if envelope.SchemaVersion > r.CurrentVersion(envelope.Type) {
+		return Envelope{}, fmt.Errorf("unsupported schema version %d for %s events", envelope.SchemaVersion, envelope.Type)
+	}
+	return envelope, nil
+}
@@ -0,0 +1,137 @@
+package upcasting
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const testEventType = "PaymentCreated"
+
+// appendStep returns an upcaster appending the step to the steps list of the data,
+// so the tests can check which upcasters were applied and in which order
+func appendStep(step string) UpcastFunc {
+	return func(envelope Envelope) (Envelope, error) {
+		var data struct {
+			Steps []string `json:"steps"`
+		}
+		err := json.Unmarshal(envelope.Data, &data)
+		if err != nil {
+			return Envelope{}, err
+		}
+		data.Steps = append(data.Steps, step)
+		envelope.Data, err = json.Marshal(data)
+		return envelope, err
+	}
+}
+
+func stepsOf(t *testing.T, envelope Envelope) string {
+	t.Helper()
+	var data struct {
+		Steps []string `json:"steps"`
+	}
+	err := json.Unmarshal(envelope.Data, &data)
+	if err != nil {
+		t.Fatalf("failed decoding upcasted data: %s", err.Error())
+	}
+	return strings.Join(data.Steps, ",")
+}
+
+func testEnvelope(schemaVersion int) Envelope {
+	return Envelope{
+		Id:            uuid.New(),
+		Type:          testEventType,
+		SchemaVersion: schemaVersion,
+		Data:          json.RawMessage(`{"steps":[]}`),
+	}
+}
+
+func TestRegistryUpcastChainsTheUpcastersUpToTheCurrentVersion(t *testing.T) {
+	registry := NewRegistry().
+		Register(testEventType, 2, appendStep("v2->v3")).
+		Register(testEventType, 1, appendStep("v1->v2"))
+
+	tests := []struct {
+		name          string
+		schemaVersion int
+		expectedSteps string
+	}{
+		{name: "without schema version", schemaVersion: 0, expectedSteps: "v1->v2,v2->v3"},
+		{name: "from the initial version", schemaVersion: 1, expectedSteps: "v1->v2,v2->v3"},
+		{name: "from an intermediate version", schemaVersion: 2, expectedSteps: "v2->v3"},
+		{name: "at the current version", schemaVersion: 3, expectedSteps: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upcasted, err := registry.Upcast(testEnvelope(tt.schemaVersion))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if upcasted.SchemaVersion != 3 {
+				t.Errorf("expected schema version 3, but got %d", upcasted.SchemaVersion)
+			}
+			if steps := stepsOf(t, upcasted); steps != tt.expectedSteps {
+				t.Errorf("expected the upcasters %q to be applied, but got %q", tt.expectedSteps, steps)
+			}
+		})
+	}
+}
+
+func TestRegistryUpcastRejectsTheVersionsNewerThanTheCurrentOne(t *testing.T) {
+	registry := NewRegistry().Register(testEventType, 1, appendStep("v1->v2"))
+
+	_, err := registry.Upcast(testEnvelope(3))
+	if err == nil || !strings.Contains(err.Error(), "unsupported schema version 3") {
+		t.Fatalf("expected an unsupported schema version error, but got %v", err)
+	}
+}
+
+func TestRegistryUpcastFailsWhenAnUpcasterOfTheChainIsMissing(t *testing.T) {
+	registry := NewRegistry().Register(testEventType, 2, appendStep("v2->v3"))
+
+	_, err := registry.Upcast(testEnvelope(1))
+	if err == nil || !strings.Contains(err.Error(), "no upcaster registered for PaymentCreated events with schema version 1") {
+		t.Fatalf("expected a missing upcaster error, but got %v", err)
+	}
+}
+
+func TestRegistryUpcastKeepsTheVersionSetByTheUpcaster(t *testing.T) {
+	registry := NewRegistry().
+		Register(testEventType, 1, func(envelope Envelope) (Envelope, error) {
+			// skips version 2, whose upcaster is never called
+			envelope.SchemaVersion = 3
+			return envelope, nil
+		}).
+		Register(testEventType, 2, appendStep("v2->v3"))
+
+	upcasted, err := registry.Upcast(testEnvelope(1))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if upcasted.SchemaVersion != 3 || stepsOf(t, upcasted) != "" {
+		t.Errorf("expected the envelope at version 3 without steps, but got version %d with steps %q", upcasted.SchemaVersion, stepsOf(t, upcasted))
+	}
+}
+
+func TestRegistryUpcastUsesTheCurrentVersionOfTheRenamedType(t *testing.T) {
+	registry := NewRegistry().
+		Register("PaymentRegistered", 1, func(envelope Envelope) (Envelope, error) {
+			envelope.Type = testEventType
+			envelope.SchemaVersion = InitialSchemaVersion
+			return envelope, nil
+		}).
+		Register(testEventType, 1, appendStep("v1->v2"))
+
+	envelope := testEnvelope(1)
+	envelope.Type = "PaymentRegistered"
+	upcasted, err := registry.Upcast(envelope)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if upcasted.Type != testEventType || upcasted.SchemaVersion != 2 || stepsOf(t, upcasted) != "v1->v2" {
+		t.Errorf("expected a %s event at version 2 upcasted by v1->v2, but got a %s event at version %d upcasted by %q",
+			testEventType, upcasted.Type, upcasted.SchemaVersion, stepsOf(t, upcasted))
+	}
+}
@@ -0,0 +1,68 @@
+package webhooks
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+)
+
+type DeliveryState string
+
+const (
+	// DeliveryStatePending deliveries are attempted once their NextAttemptAt is due
+	DeliveryStatePending   DeliveryState = "pending"
+	DeliveryStateDelivered DeliveryState = "delivered"
+	// DeliveryStateFailed deliveries ran out of attempts, they're only retried on demand
+	DeliveryStateFailed DeliveryState = "failed"
+)
+
+// Delivery is the notification of a payment status change to a subscription
+type Delivery struct {
+	ID             uuid.UUID
+	SubscriptionId uuid.UUID
+	CustomerId     uuid.UUID
+	PaymentId      uuid.UUID
+	// EventId is the id of the event that changed the status of the payment
+	EventId       uuid.UUID
+	URL           string
+	Payload       []byte
+	State         DeliveryState
+	Attempts      []DeliveryAttempt
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// DeliveryAttempt is the outcome of a request to the subscription URL
+type DeliveryAttempt struct {
+	AttemptedAt time.Time
+	Duration    time.Duration
+	// StatusCode is 0 when no response was received
+	StatusCode int
+	Error      string
+}
+
+// DeliveriesFilter zero values match any delivery
+type DeliveriesFilter struct {
+	SubscriptionId uuid.UUID
+	PaymentId      uuid.UUID
+	State          DeliveryState
+}
+
+type DeliveriesRepository interface {
+	// AddDelivery stores the delivery. Adding a delivery already present (same id) is a no-op.
+	AddDelivery(ctx context.Context, delivery Delivery) werrors.WError
+	GetDelivery(ctx context.Context, id uuid.UUID) (Delivery, werrors.WError)
+	SearchDeliveries(ctx context.Context, filter DeliveriesFilter) ([]Delivery, werrors.WError)
+	// ClaimDueDelivery returns the pending delivery with the oldest NextAttemptAt before now,
+	// of a subscription not in excludedSubscriptions, postponing its NextAttemptAt by lease
+	// so it isn't claimed again while being attempted. It returns a ResourceNotFound error
+	// when no delivery is due.
+	ClaimDueDelivery(ctx context.Context, now time.Time, lease time.Duration, excludedSubscriptions []uuid.UUID) (Delivery, werrors.WError)
+	// RecordAttempt appends the attempt to the delivery and sets its state and next attempt time
+	RecordAttempt(ctx context.Context, id uuid.UUID, attempt DeliveryAttempt, state DeliveryState, nextAttemptAt time.Time) werrors.WError
+	// ScheduleDelivery moves the delivery back to pending, to be attempted at nextAttemptAt
+	ScheduleDelivery(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time) werrors.WError
+}
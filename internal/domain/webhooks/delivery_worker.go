@@ -0,0 +1,276 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/walletera/payments-read-model/pkg/logattr"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	DefaultMaxAttempts    = 8
+	DefaultInitialBackoff = 10 * time.Second
+	DefaultMaxBackoff     = time.Hour
+	DefaultRequestTimeout = 10 * time.Second
+	DefaultPollInterval   = time.Second
+	DefaultWorkers        = 8
+	// maxResponseBodyBytes bounds what is read from the responses, which are discarded
+	maxResponseBodyBytes = 4 << 10
+)
+
+type DeliveryConfig struct {
+	// MaxAttempts is the number of attempts after which a delivery fails
+	MaxAttempts int
+	// InitialBackoff is the delay after the first failed attempt, doubled
+	// after every following one up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	RequestTimeout time.Duration
+	// PollInterval is how often the due deliveries are looked for
+	PollInterval time.Duration
+	// Workers is how many deliveries are attempted concurrently. A subscription has one
+	// delivery attempted at a time, so a slow subscription only holds one worker.
+	Workers int
+	// AllowPrivateTargets lets the subscriptions target private, loopback and link-local
+	// addresses, for the deployments delivering to their own network
+	AllowPrivateTargets bool
+}
+
+func DefaultDeliveryConfig() DeliveryConfig {
+	return DeliveryConfig{
+		MaxAttempts:    DefaultMaxAttempts,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		RequestTimeout: DefaultRequestTimeout,
+		PollInterval:   DefaultPollInterval,
+		Workers:        DefaultWorkers,
+	}
+}
+
+// DeliveryWorker attempts the due deliveries, POSTing their signed payload to the
+// subscription URL. Every attempt is recorded in the delivery. The ones failing are
+// retried with an exponential backoff until they run out of attempts. Deliveries are
+// claimed before being attempted, so several instances can run the worker.
+type DeliveryWorker struct {
+	subscriptions SubscriptionsRepository
+	deliveries    DeliveriesRepository
+	config        DeliveryConfig
+	client        *http.Client
+	logger        *slog.Logger
+	metrics       metrics
+	// workers bounds the deliveries attempted concurrently
+	workers chan struct{}
+	// inFlight holds the subscriptions with a delivery being attempted
+	inFlight   map[uuid.UUID]struct{}
+	inFlightMu sync.Mutex
+	attempts   sync.WaitGroup
+}
+
+func NewDeliveryWorker(
+	subscriptions SubscriptionsRepository,
+	deliveries DeliveriesRepository,
+	config DeliveryConfig,
+	logger *slog.Logger,
+) *DeliveryWorker {
+	return &DeliveryWorker{
+		subscriptions: subscriptions,
+		deliveries:    deliveries,
+		config:        config,
+		client:        newDeliveryClient(config.RequestTimeout, config.AllowPrivateTargets),
+		logger:        logger,
+		metrics:       newMetrics(),
+		workers:       make(chan struct{}, config.Workers),
+		inFlight:      make(map[uuid.UUID]struct{}),
+	}
+}
+
+// Run blocks until ctx is done and the attempts in flight, interrupted, return
+func (w *DeliveryWorker) Run(ctx context.Context) {
+	defer w.attempts.Wait()
+	ticker := time.NewTicker(w.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.attemptDueDeliveries(ctx)
+		}
+	}
+}
+
+// attemptDueDeliveries claims the due deliveries while a worker is free, skipping the
+// subscriptions with a delivery in flight, and attempts each one in its own goroutine
+func (w *DeliveryWorker) attemptDueDeliveries(ctx context.Context) {
+	// a claimed delivery is left alone until the request times out
+	lease := 2 * w.config.RequestTimeout
+	for ctx.Err() == nil {
+		select {
+		case w.workers <- struct{}{}:
+		default:
+			// every worker is busy
+			return
+		}
+		delivery, werr := w.deliveries.ClaimDueDelivery(ctx, time.Now(), lease, w.inFlightSubscriptions())
+		if werr != nil {
+			<-w.workers
+			if werr.Code() != werrors.ResourceNotFoundErrorCode {
+				w.logger.Error("failed claiming webhook delivery", logattr.Error(werr.Message()))
+			}
+			return
+		}
+		w.startAttempt(ctx, delivery)
+	}
+}
+
+func (w *DeliveryWorker) startAttempt(ctx context.Context, delivery Delivery) {
+	w.inFlightMu.Lock()
+	w.inFlight[delivery.SubscriptionId] = struct{}{}
+	w.inFlightMu.Unlock()
+	w.attempts.Add(1)
+	go func() {
+		defer func() {
+			w.inFlightMu.Lock()
+			delete(w.inFlight, delivery.SubscriptionId)
+			w.inFlightMu.Unlock()
+			<-w.workers
+			w.attempts.Done()
+		}()
+		w.attemptDelivery(ctx, delivery)
+	}()
+}
+
+func (w *DeliveryWorker) inFlightSubscriptions() []uuid.UUID {
+	w.inFlightMu.Lock()
+	defer w.inFlightMu.Unlock()
+	subscriptions := make([]uuid.UUID, 0, len(w.inFlight))
+	for subscriptionId := range w.inFlight {
+		subscriptions = append(subscriptions, subscriptionId)
+	}
+	return subscriptions
+}
+
+func (w *DeliveryWorker) attemptDelivery(ctx context.Context, delivery Delivery) {
+	subscription, werr := w.subscriptions.GetSubscription(ctx, delivery.SubscriptionId)
+	if werr != nil {
+		if werr.Code() != werrors.ResourceNotFoundErrorCode {
+			// the claim expires and the delivery is attempted again
+			w.logger.Error(
+				"failed retrieving webhook subscription",
+				logattr.Error(werr.Message()),
+				logattr.DeliveryId(delivery.ID.String()),
+				logattr.SubscriptionId(delivery.SubscriptionId.String()),
+			)
+			return
+		}
+		attempt := DeliveryAttempt{AttemptedAt: time.Now(), Error: "subscription deleted"}
+		w.recordAttempt(ctx, delivery, attempt, DeliveryStateFailed, attempt.AttemptedAt)
+		return
+	}
+
+	attempt := w.post(ctx, delivery, subscription.Secret)
+	if ctx.Err() != nil {
+		// interrupted by the shutdown, the claim expires and the delivery is attempted again
+		return
+	}
+	attemptsCount := len(delivery.Attempts) + 1
+	switch {
+	case attempt.Error == "":
+		w.recordAttempt(ctx, delivery, attempt, DeliveryStateDelivered, attempt.AttemptedAt)
+	case attemptsCount >= w.config.MaxAttempts:
+		w.recordAttempt(ctx, delivery, attempt, DeliveryStateFailed, attempt.AttemptedAt)
+	default:
+		nextAttemptAt := attempt.AttemptedAt.Add(w.backoff(attemptsCount))
+		w.recordAttempt(ctx, delivery, attempt, DeliveryStatePending, nextAttemptAt)
+	}
+}
+
+// post sends the payload, signed with the secret, to the delivery URL.
+// Only a 2xx response is a successful delivery.
+func (w *DeliveryWorker) post(ctx context.Context, delivery Delivery, secret string) DeliveryAttempt {
+	attempt := DeliveryAttempt{AttemptedAt: time.Now()}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = fmt.Sprintf("failed creating request: %s", err.Error())
+		return attempt
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(DeliveryIdHeader, delivery.ID.String())
+	request.Header.Set(SignatureHeader, Sign(secret, attempt.AttemptedAt, delivery.Payload))
+
+	response, err := w.client.Do(request)
+	attempt.Duration = time.Since(attempt.AttemptedAt)
+	w.metrics.deliveryDuration.Record(ctx, attempt.Duration.Milliseconds())
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxResponseBodyBytes))
+	attempt.StatusCode = response.StatusCode
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		attempt.Error = "unexpected response status " + strconv.Itoa(response.StatusCode)
+	}
+	return attempt
+}
+
+func (w *DeliveryWorker) recordAttempt(
+	ctx context.Context,
+	delivery Delivery,
+	attempt DeliveryAttempt,
+	state DeliveryState,
+	nextAttemptAt time.Time,
+) {
+	w.metrics.deliveryAttempts.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("state", string(state)),
+	))
+	logAttrs := []any{
+		logattr.DeliveryId(delivery.ID.String()),
+		logattr.SubscriptionId(delivery.SubscriptionId.String()),
+		logattr.PaymentId(delivery.PaymentId.String()),
+		logattr.Attempts(len(delivery.Attempts) + 1),
+		logattr.HTTPStatus(attempt.StatusCode),
+	}
+	switch state {
+	case DeliveryStateDelivered:
+		w.logger.Info("webhook delivered", logAttrs...)
+	case DeliveryStateFailed:
+		w.logger.Error("webhook delivery failed", append(logAttrs, logattr.Error(attempt.Error))...)
+	default:
+		w.logger.Warn(
+			"webhook delivery attempt failed",
+			append(logAttrs, logattr.Error(attempt.Error), logattr.RetryDelay(nextAttemptAt.Sub(attempt.AttemptedAt)))...,
+		)
+	}
+
+	werr := w.deliveries.RecordAttempt(ctx, delivery.ID, attempt, state, nextAttemptAt)
+	if werr != nil {
+		// the claim expires and the delivery is attempted again
+		w.logger.Error(
+			"failed recording webhook delivery attempt",
+			logattr.Error(werr.Message()),
+			logattr.DeliveryId(delivery.ID.String()),
+		)
+	}
+}
+
+// backoff returns the delay before the attempt following the given number of failed ones
+func (w *DeliveryWorker) backoff(failedAttempts int) time.Duration {
+	backoff := w.config.InitialBackoff
+	for i := 1; i < failedAttempts && backoff < w.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, w.config.MaxBackoff)
+}
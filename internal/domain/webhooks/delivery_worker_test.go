@@ -0,0 +1,324 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/walletera/werrors"
+)
+
+func TestDeliveryWorkerBackoffDoublesUpToTheMaxBackoff(t *testing.T) {
+	worker := newTestDeliveryWorker(nil, nil, DeliveryConfig{InitialBackoff: 10 * time.Second, MaxBackoff: time.Minute})
+
+	expectedBackoffs := map[int]time.Duration{
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		3:  40 * time.Second,
+		4:  time.Minute,
+		10: time.Minute,
+	}
+	for failedAttempts, expectedBackoff := range expectedBackoffs {
+		if backoff := worker.backoff(failedAttempts); backoff != expectedBackoff {
+			t.Errorf("expected a backoff of %s after %d failed attempts, but got %s", expectedBackoff, failedAttempts, backoff)
+		}
+	}
+}
+
+func TestDeliveryWorkerReschedulesAFailedAttemptWithBackoff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	subscriptions, deliveries := newFakeSubscriptions(), newFakeDeliveries()
+	subscription := subscriptions.add(server.URL)
+	delivery := deliveries.add(subscription, 1)
+	worker := newTestDeliveryWorker(subscriptions, deliveries, DeliveryConfig{InitialBackoff: 10 * time.Second, MaxBackoff: time.Minute})
+
+	worker.attemptDelivery(context.Background(), deliveries.get(delivery.ID))
+
+	recorded := deliveries.get(delivery.ID)
+	if recorded.State != DeliveryStatePending || len(recorded.Attempts) != 2 {
+		t.Fatalf("expected the delivery to stay pending with 2 attempts, but got %s with %d", recorded.State, len(recorded.Attempts))
+	}
+	attempt := recorded.Attempts[1]
+	if attempt.StatusCode != http.StatusServiceUnavailable || attempt.Error == "" {
+		t.Errorf("expected the attempt to record the 503 response, but got %+v", attempt)
+	}
+	// the second failed attempt doubles the initial backoff
+	if recorded.NextAttemptAt != attempt.AttemptedAt.Add(20*time.Second) {
+		t.Errorf("expected the next attempt 20s after the failed one, but got %s", recorded.NextAttemptAt.Sub(attempt.AttemptedAt))
+	}
+}
+
+func TestDeliveryWorkerFailsTheDeliveryRunningOutOfAttempts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	subscriptions, deliveries := newFakeSubscriptions(), newFakeDeliveries()
+	subscription := subscriptions.add(server.URL)
+	delivery := deliveries.add(subscription, 2)
+	worker := newTestDeliveryWorker(subscriptions, deliveries, DeliveryConfig{MaxAttempts: 3})
+
+	worker.attemptDelivery(context.Background(), deliveries.get(delivery.ID))
+
+	if recorded := deliveries.get(delivery.ID); recorded.State != DeliveryStateFailed || len(recorded.Attempts) != 3 {
+		t.Errorf("expected the delivery to fail after 3 attempts, but got %s with %d", recorded.State, len(recorded.Attempts))
+	}
+}
+
+func TestDeliveryWorkerDeliversTheSignedPayload(t *testing.T) {
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(SignatureHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	subscriptions, deliveries := newFakeSubscriptions(), newFakeDeliveries()
+	subscription := subscriptions.add(server.URL)
+	delivery := deliveries.add(subscription, 0)
+	worker := newTestDeliveryWorker(subscriptions, deliveries, DeliveryConfig{})
+
+	worker.attemptDelivery(context.Background(), deliveries.get(delivery.ID))
+
+	recorded := deliveries.get(delivery.ID)
+	if recorded.State != DeliveryStateDelivered {
+		t.Fatalf("expected the delivery to be delivered, but got %s", recorded.State)
+	}
+	expectedSignature := Sign(subscription.Secret, recorded.Attempts[0].AttemptedAt, delivery.Payload)
+	if signature != expectedSignature {
+		t.Errorf("expected the signature %s, but got %s", expectedSignature, signature)
+	}
+}
+
+func TestDeliveryWorkerDoesNotFollowRedirects(t *testing.T) {
+	redirected := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer server.Close()
+	subscriptions, deliveries := newFakeSubscriptions(), newFakeDeliveries()
+	delivery := deliveries.add(subscriptions.add(server.URL), 0)
+	worker := newTestDeliveryWorker(subscriptions, deliveries, DeliveryConfig{})
+
+	worker.attemptDelivery(context.Background(), deliveries.get(delivery.ID))
+
+	recorded := deliveries.get(delivery.ID)
+	if redirected || recorded.State != DeliveryStatePending || recorded.Attempts[0].StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("expected the redirect to be a failed attempt, but got %+v", recorded.Attempts)
+	}
+}
+
+func TestDeliveryWorkerRefusesToDialPrivateAddresses(t *testing.T) {
+	requested := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}))
+	defer server.Close()
+	subscriptions, deliveries := newFakeSubscriptions(), newFakeDeliveries()
+	delivery := deliveries.add(subscriptions.add(server.URL), 0)
+	config := testDeliveryConfig(DeliveryConfig{})
+	config.AllowPrivateTargets = false
+	worker := NewDeliveryWorker(subscriptions, deliveries, config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	worker.attemptDelivery(context.Background(), deliveries.get(delivery.ID))
+
+	recorded := deliveries.get(delivery.ID)
+	if requested || !strings.Contains(recorded.Attempts[0].Error, errForbiddenTarget.Error()) {
+		t.Errorf("expected the loopback target to be refused, but got %+v", recorded.Attempts)
+	}
+}
+
+func TestDeliveryWorkerAttemptsOneDeliveryOfASubscriptionAtATime(t *testing.T) {
+	release := make(chan struct{})
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slowServer.Close()
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	subscriptions, deliveries := newFakeSubscriptions(), newFakeDeliveries()
+	slowSubscription := subscriptions.add(slowServer.URL)
+	slowDelivery := deliveries.add(slowSubscription, 0)
+	nextSlowDelivery := deliveries.add(slowSubscription, 0)
+	delivery := deliveries.add(subscriptions.add(server.URL), 0)
+	worker := newTestDeliveryWorker(subscriptions, deliveries, DeliveryConfig{Workers: 2})
+
+	worker.attemptDueDeliveries(context.Background())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for deliveries.get(delivery.ID).State != DeliveryStateDelivered {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the delivery of the other subscription to be delivered while the slow one is attempted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if deliveries.get(slowDelivery.ID).NextAttemptAt.Before(time.Now()) {
+		t.Errorf("expected the first delivery of the slow subscription to be claimed")
+	}
+	if deliveries.get(nextSlowDelivery.ID).NextAttemptAt.After(time.Now()) {
+		t.Errorf("expected the next delivery of the slow subscription to be left due while the first one is attempted")
+	}
+}
+
+func testDeliveryConfig(config DeliveryConfig) DeliveryConfig {
+	defaults := DefaultDeliveryConfig()
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+	if config.InitialBackoff == 0 {
+		config.InitialBackoff = defaults.InitialBackoff
+	}
+	if config.MaxBackoff == 0 {
+		config.MaxBackoff = defaults.MaxBackoff
+	}
+	if config.Workers == 0 {
+		config.Workers = 1
+	}
+	config.RequestTimeout = 5 * time.Second
+	config.PollInterval = time.Hour
+	// the test servers listen on the loopback address
+	config.AllowPrivateTargets = true
+	return config
+}
+
+func newTestDeliveryWorker(subscriptions SubscriptionsRepository, deliveries DeliveriesRepository, config DeliveryConfig) *DeliveryWorker {
+	return NewDeliveryWorker(subscriptions, deliveries, testDeliveryConfig(config), slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+type fakeSubscriptions struct {
+	subscriptions map[uuid.UUID]Subscription
+}
+
+func newFakeSubscriptions() *fakeSubscriptions {
+	return &fakeSubscriptions{subscriptions: map[uuid.UUID]Subscription{}}
+}
+
+func (f *fakeSubscriptions) add(url string) Subscription {
+	subscription := Subscription{ID: uuid.New(), CustomerId: uuid.New(), URL: url, Secret: "a-secret"}
+	f.subscriptions[subscription.ID] = subscription
+	return subscription
+}
+
+func (f *fakeSubscriptions) SaveSubscription(_ context.Context, subscription Subscription) werrors.WError {
+	f.subscriptions[subscription.ID] = subscription
+	return nil
+}
+
+func (f *fakeSubscriptions) GetSubscription(_ context.Context, id uuid.UUID) (Subscription, werrors.WError) {
+	subscription, found := f.subscriptions[id]
+	if !found {
+		return Subscription{}, werrors.NewResourceNotFoundError("subscription not found")
+	}
+	return subscription, nil
+}
+
+func (f *fakeSubscriptions) SearchSubscriptions(context.Context, SubscriptionsFilter) ([]Subscription, werrors.WError) {
+	return nil, nil
+}
+
+func (f *fakeSubscriptions) DeleteSubscription(_ context.Context, id uuid.UUID) werrors.WError {
+	delete(f.subscriptions, id)
+	return nil
+}
+
+// fakeDeliveries claims the due deliveries in the order they were added
+type fakeDeliveries struct {
+	mu         sync.Mutex
+	deliveries []Delivery
+}
+
+func newFakeDeliveries() *fakeDeliveries {
+	return &fakeDeliveries{}
+}
+
+// add adds a due delivery to the subscription with the given number of failed attempts
+func (f *fakeDeliveries) add(subscription Subscription, failedAttempts int) Delivery {
+	delivery := Delivery{
+		ID:             uuid.New(),
+		SubscriptionId: subscription.ID,
+		URL:            subscription.URL,
+		Payload:        []byte(`{"type":"payment.status_changed"}`),
+		State:          DeliveryStatePending,
+		NextAttemptAt:  time.Now().Add(-time.Second),
+	}
+	for i := 0; i < failedAttempts; i++ {
+		delivery.Attempts = append(delivery.Attempts, DeliveryAttempt{StatusCode: http.StatusInternalServerError, Error: "failed"})
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deliveries = append(f.deliveries, delivery)
+	return delivery
+}
+
+func (f *fakeDeliveries) get(id uuid.UUID) Delivery {
+	delivery, _ := f.GetDelivery(context.Background(), id)
+	return delivery
+}
+
+func (f *fakeDeliveries) AddDelivery(_ context.Context, delivery Delivery) werrors.WError {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deliveries = append(f.deliveries, delivery)
+	return nil
+}
+
+func (f *fakeDeliveries) GetDelivery(_ context.Context, id uuid.UUID) (Delivery, werrors.WError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, delivery := range f.deliveries {
+		if delivery.ID == id {
+			return delivery, nil
+		}
+	}
+	return Delivery{}, werrors.NewResourceNotFoundError("delivery not found")
+}
+
+func (f *fakeDeliveries) SearchDeliveries(context.Context, DeliveriesFilter) ([]Delivery, werrors.WError) {
+	return nil, nil
+}
+
+func (f *fakeDeliveries) ClaimDueDelivery(_ context.Context, now time.Time, lease time.Duration, excludedSubscriptions []uuid.UUID) (Delivery, werrors.WError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, delivery := range f.deliveries {
+		excluded := false
+		for _, subscriptionId := range excludedSubscriptions {
+			excluded = excluded || subscriptionId == delivery.SubscriptionId
+		}
+		if delivery.State != DeliveryStatePending || delivery.NextAttemptAt.After(now) || excluded {
+			continue
+		}
+		f.deliveries[i].NextAttemptAt = now.Add(lease)
+		return delivery, nil
+	}
+	return Delivery{}, werrors.NewResourceNotFoundError("no due delivery")
+}
+
+func (f *fakeDeliveries) RecordAttempt(_ context.Context, id uuid.UUID, attempt DeliveryAttempt, state DeliveryState, nextAttemptAt time.Time) werrors.WError {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, delivery := range f.deliveries {
+		if delivery.ID == id {
+			f.deliveries[i].Attempts = append(delivery.Attempts, attempt)
+			f.deliveries[i].State = state
+			f.deliveries[i].NextAttemptAt = nextAttemptAt
+		}
+	}
+	return nil
+}
+
+func (f *fakeDeliveries) ScheduleDelivery(context.Context, uuid.UUID, time.Time) werrors.WError {
+	return nil
+}
@@ -0,0 +1,36 @@
+package webhooks
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/walletera/payments-read-model/internal/domain/webhooks"
+
+type metrics struct {
+	deliveryAttempts metric.Int64Counter
+	deliveryDuration metric.Int64Histogram
+}
+
+func newMetrics() metrics {
+	meter := otel.Meter(meterName)
+	deliveryAttempts, err := meter.Int64Counter(
+		"payments_read_model.webhooks.delivery_attempts",
+		metric.WithDescription("Webhook delivery attempts, by outcome"),
+	)
+	if err != nil {
+		panic("failed creating webhooks delivery attempts counter: " + err.Error())
+	}
+	deliveryDuration, err := meter.Int64Histogram(
+		"payments_read_model.webhooks.delivery_duration",
+		metric.WithDescription("Duration of the requests to the webhook subscriptions URLs"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		panic("failed creating webhooks delivery duration histogram: " + err.Error())
+	}
+	return metrics{
+		deliveryAttempts: deliveryAttempts,
+		deliveryDuration: deliveryDuration,
+	}
+}
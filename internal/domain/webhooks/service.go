@@ -0,0 +1,211 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/walletera/payments-read-model/internal/domain/payments"
+	"github.com/walletera/payments-read-model/pkg/logattr"
+	"github.com/walletera/payments-read-model/pkg/wuuid"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+)
+
+// PaymentStatusChangedType is the type of the payload delivered to the subscriptions
+const PaymentStatusChangedType = "payment.status_changed"
+
+// Service manages the webhook subscriptions and turns the payments status
+// changes into deliveries, attempted later by the DeliveryWorker
+type Service struct {
+	subscriptions SubscriptionsRepository
+	deliveries    DeliveriesRepository
+	// allowPrivateTargets lets the subscriptions target the internal network
+	allowPrivateTargets bool
+	logger              *slog.Logger
+}
+
+var _ payments.StatusChangeNotifier = (*Service)(nil)
+
+func NewService(
+	subscriptions SubscriptionsRepository,
+	deliveries DeliveriesRepository,
+	config DeliveryConfig,
+	logger *slog.Logger,
+) *Service {
+	return &Service{
+		subscriptions:       subscriptions,
+		deliveries:          deliveries,
+		allowPrivateTargets: config.AllowPrivateTargets,
+		logger:              logger,
+	}
+}
+
+type paymentStatusChanged struct {
+	ID        uuid.UUID                `json:"id"`
+	Type      string                   `json:"type"`
+	CreatedAt time.Time                `json:"createdAt"`
+	Data      paymentStatusChangedData `json:"data"`
+}
+
+type paymentStatusChangedData struct {
+	PaymentId        uuid.UUID                `json:"paymentId"`
+	CustomerId       uuid.UUID                `json:"customerId"`
+	AggregateVersion uint64                   `json:"aggregateVersion"`
+	PreviousStatus   privateapi.PaymentStatus `json:"previousStatus"`
+	Status           privateapi.PaymentStatus `json:"status"`
+	ExternalId       string                   `json:"externalId,omitempty"`
+	EventId          uuid.UUID                `json:"eventId"`
+	ChangedAt        time.Time                `json:"changedAt"`
+}
+
+// NotifyStatusChange adds a delivery for every subscription of the customer matching the
+// new status, attempted later by the DeliveryWorker. The id of a delivery is derived from
+// the subscription and the event ids, so notifying the same change again doesn't add new
+// deliveries.
+func (s *Service) NotifyStatusChange(ctx context.Context, change payments.StatusChange) werrors.WError {
+	subscriptions, werr := s.subscriptions.SearchSubscriptions(ctx, SubscriptionsFilter{CustomerId: change.CustomerId})
+	if werr != nil {
+		return werr
+	}
+	now := time.Now()
+	for _, subscription := range subscriptions {
+		if !subscription.Matches(change.Status) {
+			continue
+		}
+		deliveryId := uuid.NewSHA1(subscription.ID, change.EventId[:])
+		payload, err := json.Marshal(paymentStatusChanged{
+			ID:        deliveryId,
+			Type:      PaymentStatusChangedType,
+			CreatedAt: now,
+			Data: paymentStatusChangedData{
+				PaymentId:        change.PaymentId,
+				CustomerId:       change.CustomerId,
+				AggregateVersion: change.AggregateVersion,
+				PreviousStatus:   change.PreviousStatus,
+				Status:           change.Status,
+				ExternalId:       change.ExternalId.Value,
+				EventId:          change.EventId,
+				ChangedAt:        change.ChangedAt,
+			},
+		})
+		if err != nil {
+			return werrors.NewNonRetryableInternalError("failed serializing webhook payload: %s", err.Error())
+		}
+		werr = s.deliveries.AddDelivery(ctx, Delivery{
+			ID:             deliveryId,
+			SubscriptionId: subscription.ID,
+			CustomerId:     change.CustomerId,
+			PaymentId:      change.PaymentId,
+			EventId:        change.EventId,
+			URL:            subscription.URL,
+			Payload:        payload,
+			State:          DeliveryStatePending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		})
+		if werr != nil {
+			return werr
+		}
+		s.logger.Info(
+			"webhook delivery added",
+			logattr.DeliveryId(deliveryId.String()),
+			logattr.SubscriptionId(subscription.ID.String()),
+			logattr.PaymentId(change.PaymentId.String()),
+			logattr.StatusTransition(string(change.PreviousStatus), string(change.Status)),
+			logattr.CorrelationId(change.CorrelationId),
+		)
+	}
+	return nil
+}
+
+// CreateSubscription validates and stores the subscription. A secret is generated when none is given.
+func (s *Service) CreateSubscription(ctx context.Context, subscription Subscription) (Subscription, werrors.WError) {
+	werr := s.validateSubscription(ctx, subscription)
+	if werr != nil {
+		return Subscription{}, werr
+	}
+	if subscription.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			return Subscription{}, werrors.NewNonRetryableInternalError("failed generating subscription secret: %s", err.Error())
+		}
+		subscription.Secret = secret
+	}
+	subscription.ID = wuuid.NewUUID()
+	subscription.CreatedAt = time.Now()
+	werr = s.subscriptions.SaveSubscription(ctx, subscription)
+	if werr != nil {
+		return Subscription{}, werr
+	}
+	s.logger.Info(
+		"webhook subscription created",
+		logattr.SubscriptionId(subscription.ID.String()),
+	)
+	return subscription, nil
+}
+
+func (s *Service) GetSubscription(ctx context.Context, id uuid.UUID) (Subscription, werrors.WError) {
+	return s.subscriptions.GetSubscription(ctx, id)
+}
+
+func (s *Service) SearchSubscriptions(ctx context.Context, filter SubscriptionsFilter) ([]Subscription, werrors.WError) {
+	return s.subscriptions.SearchSubscriptions(ctx, filter)
+}
+
+// DeleteSubscription deletes the subscription. Its pending deliveries fail when attempted.
+func (s *Service) DeleteSubscription(ctx context.Context, id uuid.UUID) werrors.WError {
+	_, werr := s.subscriptions.GetSubscription(ctx, id)
+	if werr != nil {
+		return werr
+	}
+	werr = s.subscriptions.DeleteSubscription(ctx, id)
+	if werr != nil {
+		return werr
+	}
+	s.logger.Info("webhook subscription deleted", logattr.SubscriptionId(id.String()))
+	return nil
+}
+
+func (s *Service) GetDelivery(ctx context.Context, id uuid.UUID) (Delivery, werrors.WError) {
+	return s.deliveries.GetDelivery(ctx, id)
+}
+
+func (s *Service) SearchDeliveries(ctx context.Context, filter DeliveriesFilter) ([]Delivery, werrors.WError) {
+	return s.deliveries.SearchDeliveries(ctx, filter)
+}
+
+// RetryDelivery schedules the delivery to be attempted right away, whatever its state
+func (s *Service) RetryDelivery(ctx context.Context, id uuid.UUID) werrors.WError {
+	_, werr := s.deliveries.GetDelivery(ctx, id)
+	if werr != nil {
+		return werr
+	}
+	werr = s.deliveries.ScheduleDelivery(ctx, id, time.Now())
+	if werr != nil {
+		return werr
+	}
+	s.logger.Info("webhook delivery scheduled for retry", logattr.DeliveryId(id.String()))
+	return nil
+}
+
+func (s *Service) validateSubscription(ctx context.Context, subscription Subscription) werrors.WError {
+	if subscription.CustomerId == uuid.Nil {
+		return werrors.NewValidationError("customerId is required")
+	}
+	werr := validateTarget(ctx, subscription.URL, s.allowPrivateTargets)
+	if werr != nil {
+		return werr
+	}
+	for _, status := range subscription.Statuses {
+		if status.Validate() != nil {
+			return werrors.NewValidationError(fmt.Sprintf("invalid status %s", status))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// SignatureHeader carries the timestamp and the signature of the delivery, as t=<unix seconds>,v1=<hex HMAC>
+	SignatureHeader = "X-Webhook-Signature"
+	// DeliveryIdHeader carries the id of the delivery, the same on every attempt
+	DeliveryIdHeader = "X-Webhook-Id"
+	secretPrefix     = "whsec_"
+	secretBytes      = 32
+)
+
+// Sign returns the value of the SignatureHeader: the hex encoded HMAC-SHA256, keyed with
+// the subscription secret, of the unix timestamp and the request body joined with a dot.
+// Receivers recompute it to authenticate the delivery, and reject old timestamps to
+// prevent replays.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unixTimestamp := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unixTimestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%s,v1=%s", unixTimestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func newSecret() (string, error) {
+	secret := make([]byte, secretBytes)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return secretPrefix + hex.EncodeToString(secret), nil
+}
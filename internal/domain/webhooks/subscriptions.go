@@ -0,0 +1,40 @@
+package webhooks
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/walletera/payments-types/privateapi"
+	"github.com/walletera/werrors"
+)
+
+// Subscription registers the URL the status changes of the payments of a customer are delivered to
+type Subscription struct {
+	ID         uuid.UUID
+	CustomerId uuid.UUID
+	URL        string
+	// Statuses restricts the deliveries to the changes to one of these statuses. Empty matches any status.
+	Statuses []privateapi.PaymentStatus
+	// Secret is the key the deliveries are signed with
+	Secret    string
+	CreatedAt time.Time
+}
+
+// Matches reports whether a change to the given status is delivered to the subscription
+func (s Subscription) Matches(status privateapi.PaymentStatus) bool {
+	return len(s.Statuses) == 0 || slices.Contains(s.Statuses, status)
+}
+
+// SubscriptionsFilter zero values match any subscription
+type SubscriptionsFilter struct {
+	CustomerId uuid.UUID
+}
+
+type SubscriptionsRepository interface {
+	SaveSubscription(ctx context.Context, subscription Subscription) werrors.WError
+	GetSubscription(ctx context.Context, id uuid.UUID) (Subscription, werrors.WError)
+	SearchSubscriptions(ctx context.Context, filter SubscriptionsFilter) ([]Subscription, werrors.WError)
+	DeleteSubscription(ctx context.Context, id uuid.UUID) werrors.WError
+}
@@ -0,0 +1,114 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/walletera/werrors"
+)
+
+// errForbiddenTarget is returned when dialing an address the deliveries can't be sent to
+var errForbiddenTarget = errors.New("forbidden webhook target address")
+
+// forbiddenTargetPrefixes are the special purpose ranges not covered by the net.IP
+// predicates checked by allowedTargetIP, like the carrier-grade NAT shared space
+var forbiddenTargetPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+// allowedTargetIP reports whether the deliveries can be sent to the ip. The loopback,
+// private, link-local (cloud metadata endpoints), multicast and unspecified addresses
+// are refused, so the subscriptions can't reach the internal network.
+func allowedTargetIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range forbiddenTargetPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateTarget checks the subscription URL is an absolute http or https URL and, unless
+// allowPrivateTargets, that its host doesn't resolve to an address refused by allowedTargetIP.
+// The addresses are checked again when dialing, as the host may resolve differently later.
+func validateTarget(ctx context.Context, rawURL string, allowPrivateTargets bool) werrors.WError {
+	targetURL, err := url.Parse(rawURL)
+	if err != nil || (targetURL.Scheme != "http" && targetURL.Scheme != "https") || targetURL.Hostname() == "" {
+		return werrors.NewValidationError("url must be an absolute http or https URL")
+	}
+	if allowPrivateTargets {
+		return nil
+	}
+	host := targetURL.Hostname()
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return werrors.NewValidationError(fmt.Sprintf("url host %s can't be resolved", host))
+		}
+		ips = ips[:0]
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		if !allowedTargetIP(ip) {
+			return werrors.NewValidationError(fmt.Sprintf("url host %s resolves to a private, loopback or link-local address", host))
+		}
+	}
+	return nil
+}
+
+// newDeliveryClient returns the client the deliveries are sent with. It doesn't follow
+// redirects, a redirect response is a failed attempt, and unless allowPrivateTargets it
+// refuses to connect to the addresses refused by allowedTargetIP, whatever the host
+// resolves to at the time of the attempt. No proxy is used, so the dialed address is the target.
+func newDeliveryClient(timeout time.Duration, allowPrivateTargets bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivateTargets {
+		dialer.Control = func(_ string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !allowedTargetIP(ip) {
+				return fmt.Errorf("%w %s", errForbiddenTarget, host)
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 2,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,67 @@
+package webhooks
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/walletera/werrors"
+)
+
+func TestAllowedTargetIP(t *testing.T) {
+	tests := []struct {
+		ip      string
+		allowed bool
+	}{
+		{ip: "93.184.216.34", allowed: true},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", allowed: true},
+		{ip: "127.0.0.1", allowed: false},
+		{ip: "::1", allowed: false},
+		{ip: "10.1.2.3", allowed: false},
+		{ip: "172.16.0.1", allowed: false},
+		{ip: "192.168.1.1", allowed: false},
+		{ip: "169.254.169.254", allowed: false},
+		{ip: "fe80::1", allowed: false},
+		{ip: "fd00::1", allowed: false},
+		{ip: "0.0.0.0", allowed: false},
+		{ip: "100.64.0.1", allowed: false},
+		{ip: "::ffff:127.0.0.1", allowed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if allowed := allowedTargetIP(net.ParseIP(tt.ip)); allowed != tt.allowed {
+				t.Errorf("expected %s to be allowed %t, but got %t", tt.ip, tt.allowed, allowed)
+			}
+		})
+	}
+}
+
+func TestValidateTargetRefusesTheInternalAddresses(t *testing.T) {
+	for _, targetURL := range []string{
+		"http://127.0.0.1:8080/webhooks",
+		"https://[::1]/webhooks",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.12/webhooks",
+		"ftp://93.184.216.34/webhooks",
+		"/webhooks",
+	} {
+		werr := validateTarget(context.Background(), targetURL, false)
+		if werr == nil || werr.Code() != werrors.ValidationErrorCode {
+			t.Errorf("expected %s to be refused with a validation error, but got %v", targetURL, werr)
+		}
+	}
+}
+
+func TestValidateTargetAcceptsThePublicAddresses(t *testing.T) {
+	werr := validateTarget(context.Background(), "https://93.184.216.34/webhooks", false)
+	if werr != nil {
+		t.Errorf("unexpected error %s", werr.Message())
+	}
+}
+
+func TestValidateTargetAcceptsTheInternalAddressesWhenAllowed(t *testing.T) {
+	werr := validateTarget(context.Background(), "http://127.0.0.1:8080/webhooks", true)
+	if werr != nil {
+		t.Errorf("unexpected error %s", werr.Message())
+	}
+}
@@ -0,0 +1,134 @@
+package tests
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "testing"
+    "time"
+
+    "github.com/cucumber/godog"
+    "github.com/google/uuid"
+    "github.com/walletera/eventskit/events"
+    "github.com/walletera/eventskit/rabbitmq"
+    "github.com/walletera/payments-read-model/internal/app"
+    "go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// batchedPaymentIdsKey holds the ids of the payments created at once
+const batchedPaymentIdsKey = "batchedPaymentIds"
+
+func TestBatchedWrites(t *testing.T) {
+
+    suite := godog.TestSuite{
+        ScenarioInitializer: InitializeBatchedWritesFeature,
+        Options: &godog.Options{
+            Format:   "pretty",
+            Paths:    []string{"features/batched_writes.feature"},
+            TestingT: t, // Testing instance that will run subtests.
+        },
+    }
+
+    if suite.Run() != 0 {
+        t.Fatal("non-zero status returned, failed to run feature tests")
+    }
+}
+
+func InitializeBatchedWritesFeature(ctx *godog.ScenarioContext) {
+    ctx.Before(beforeScenarioHook)
+    ctx.Given(`^a running payments-read-model with batched writes of up to (\d+) payments$`, aRunningPaymentsReadModelWithBatchedWrites)
+    ctx.Given(`^a PaymentCreated event:$`, anEvent)
+    ctx.Given(`^a PaymentUpdated event:$`, anEvent)
+    ctx.Given(`^the event is published$`, theEventIsPublished)
+    ctx.Given(`^the payments-read-model produces the following log:$`, thePaymentsRMProducesTheFollowingLog)
+    ctx.When(`^the event is published$`, theEventIsPublished)
+    ctx.Then(`^the payments-read-model produces the following log:$`, thePaymentsRMProducesTheFollowingLog)
+    ctx.Then(`^the payment (\S+) in the payments-read-model has status (\w+)$`, thePaymentInThePaymentsReadModelHasStatus)
+    ctx.When(`^(\d+) copies of the event with new payment ids are published twice each at once$`, copiesOfTheEventArePublishedTwiceEachAtOnce)
+    ctx.Then(`^the payments-read-model holds the (\d+) payments created at once$`, thePaymentsRMHoldsThePaymentsCreatedAtOnce)
+    ctx.Then(`^the payments-read-model holds no dead letter$`, thePaymentsRMHoldsNoDeadLetter)
+    ctx.After(afterScenarioHook)
+}
+
+func aRunningPaymentsReadModelWithBatchedWrites(ctx context.Context, maxBatchSize int) (context.Context, error) {
+    return aRunningPaymentsReadModelWithOptions(ctx, app.WithBatchWrites(app.BatchWritesConfig{
+        MaxBatchSize: maxBatchSize,
+        Window:       20 * time.Millisecond,
+    }))
+}
+
+// copiesOfTheEventArePublishedTwiceEachAtOnce publishes copies of the PaymentCreated event in
+// the context, with new ids, without waiting for them to be handled, so their writes share the
+// batches. Each copy is published twice, as a redelivery would, so the batches also hold the
+// duplicate key errors of the second deliveries.
+func copiesOfTheEventArePublishedTwiceEachAtOnce(ctx context.Context, copies int) (context.Context, error) {
+    publisher, err := rabbitmq.NewClient(
+        rabbitmq.WithExchangeName(app.RabbitMQPaymentsExchangeName),
+        rabbitmq.WithExchangeType(app.RabbitMQExchangeType),
+    )
+    if err != nil {
+        return ctx, fmt.Errorf("error creating rabbitmq client: %s", err.Error())
+    }
+    var event map[string]any
+    err = json.Unmarshal(ctx.Value(rawEventKey).([]byte), &event)
+    if err != nil {
+        return ctx, fmt.Errorf("failed decoding event: %w", err)
+    }
+
+    paymentIds := make([]uuid.UUID, 0, copies)
+    for i := 0; i < copies; i++ {
+        paymentId := uuid.New()
+        paymentIds = append(paymentIds, paymentId)
+        event["id"] = uuid.NewString()
+        event["data"].(map[string]any)["id"] = paymentId.String()
+        rawEvent, err := json.Marshal(event)
+        if err != nil {
+            return ctx, err
+        }
+        for delivery := 0; delivery < 2; delivery++ {
+            err = publisher.Publish(ctx, publishable{rawEvent: rawEvent}, events.RoutingInfo{
+                Topic:      app.RabbitMQPaymentsExchangeName,
+                RoutingKey: app.RabbitMQPaymentCreatedRoutingKey,
+            })
+            if err != nil {
+                return ctx, fmt.Errorf("error publishing PaymentCreated event to rabbitmq: %w", err)
+            }
+        }
+    }
+    return context.WithValue(ctx, batchedPaymentIdsKey, paymentIds), nil
+}
+
+func thePaymentsRMHoldsThePaymentsCreatedAtOnce(ctx context.Context, expectedCount int) (context.Context, error) {
+    paymentIds := ctx.Value(batchedPaymentIdsKey).([]uuid.UUID)
+    client, err := getMongodbClient()
+    if err != nil {
+        return ctx, fmt.Errorf("failed connecting to mongodb: %w", err)
+    }
+    db := client.Database(app.MongoDBDatabaseName)
+    return eventually(ctx, func(ctx context.Context) (context.Context, error) {
+        count, err := db.Collection(app.MongoDBPaymentsCollectionName).CountDocuments(ctx, bson.M{"_id": bson.M{"$in": paymentIds}})
+        if err != nil {
+            return ctx, fmt.Errorf("failed counting payments: %w", err)
+        }
+        if count != int64(expectedCount) {
+            return ctx, fmt.Errorf("expected %d payments, but got %d", expectedCount, count)
+        }
+        return ctx, nil
+    })
+}
+
+func thePaymentsRMHoldsNoDeadLetter(ctx context.Context) (context.Context, error) {
+    client, err := getMongodbClient()
+    if err != nil {
+        return ctx, fmt.Errorf("failed connecting to mongodb: %w", err)
+    }
+    db := client.Database(app.MongoDBDatabaseName)
+    count, err := db.Collection(app.MongoDBDeadLettersCollectionName).CountDocuments(ctx, bson.M{})
+    if err != nil {
+        return ctx, fmt.Errorf("failed counting dead letters: %w", err)
+    }
+    if count != 0 {
+        return ctx, fmt.Errorf("expected no dead letter, but got %d", count)
+    }
+    return ctx, nil
+}
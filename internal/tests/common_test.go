@@ -2,8 +2,11 @@ package tests
 
 import (
     "context"
+    "encoding/json"
     "fmt"
+    "io"
     "log/slog"
+    "net/http"
     "os"
     "time"
 
@@ -24,14 +27,17 @@ import (
 )
 
 const (
-    appKey                    = "app"
-    appCtxCancelFuncKey       = "appCtxCancelFuncKey"
-    logsWatcherKey            = "logsWatcher"
-    rawEventKey               = "rawEvent"
-    deserializedEventKey      = "deserializedEvent"
-    logsWatcherWaitForTimeout = 5 * time.Second
-    publicApiHttpServerPort   = 8484
-    mongodbURL                = "mongodb://localhost:27017/?retryWrites=true&w=majority"
+    appKey                     = "app"
+    appCtxCancelFuncKey        = "appCtxCancelFuncKey"
+    logsWatcherKey             = "logsWatcher"
+    rawEventKey                = "rawEvent"
+    deserializedEventKey       = "deserializedEvent"
+    logsWatcherWaitForTimeout  = 5 * time.Second
+    publicApiHttpServerPort    = 8484
+    adminApiHttpServerPort     = 8485
+    ingestionApiHttpServerPort = 8486
+    adminAPIAuthToken          = "anadminapitoken"
+    mongodbURL                 = "mongodb://localhost:27017/?retryWrites=true&w=majority"
 )
 
 var mongodbClient *mongo.Client
@@ -50,9 +56,23 @@ func beforeScenarioHook(ctx context.Context, _ *godog.Scenario) (context.Context
     }
 
     // cleanup database before each scenario
-    err = client.Database("payments").Collection("payments").Drop(ctx)
-    if err != nil {
-        return nil, err
+    for _, collectionName := range []string{
+        app.MongoDBPaymentsCollectionName,
+        app.MongoDBPendingUpdatesCollectionName,
+        app.MongoDBDeadLettersCollectionName,
+        app.MongoDBEventLogCollectionName,
+        app.MongoDBHistoryCollectionName,
+        app.MongoDBProjectionsCollectionName,
+        app.MongoDBCheckpointsCollectionName,
+        app.MongoDBStatusViolationsCollectionName,
+        app.MongoDBWebhooksCollectionName,
+        app.MongoDBWebhookDeliveriesCollectionName,
+        app.MongoDBLeasesCollectionName,
+    } {
+        err = client.Database(app.MongoDBDatabaseName).Collection(collectionName).Drop(ctx)
+        if err != nil {
+            return nil, err
+        }
     }
 
     return ctx, nil
@@ -76,21 +96,30 @@ func afterScenarioHook(ctx context.Context, _ *godog.Scenario, err error) (conte
 }
 
 func aRunningPaymentsReadModel(ctx context.Context) (context.Context, error) {
+    return aRunningPaymentsReadModelWithOptions(ctx)
+}
+
+func aRunningPaymentsReadModelWithOptions(ctx context.Context, extraOpts ...app.Option) (context.Context, error) {
     logHandler := logsWatcherFromCtx(ctx).DecoratedHandler()
 
     appCtx, appCtxCancelFunc := context.WithCancel(ctx)
 
-    paymentsRMApp, err := app.NewApp(
+    opts := []app.Option{
         app.WithPublicAPIConfig(app.PublicAPIConfig{
             PublicAPIHttpServerPort: publicApiHttpServerPort,
         }),
+        app.WithAdminAPIConfig(app.AdminAPIConfig{
+            AdminAPIHttpServerPort: adminApiHttpServerPort,
+            AuthToken:              adminAPIAuthToken,
+        }),
         app.WithRabbitmqHost(rabbitmq.DefaultHost),
         app.WithRabbitmqPort(rabbitmq.DefaultPort),
         app.WithRabbitmqUser(rabbitmq.DefaultUser),
         app.WithRabbitmqPassword(rabbitmq.DefaultPassword),
         app.WithMongoDBURL(mongodbURL),
         app.WithLogHandler(logHandler),
-    )
+    }
+    paymentsRMApp, err := app.NewApp(append(opts, extraOpts...)...)
     if err != nil {
         appCtxCancelFunc()
         return ctx, fmt.Errorf("failed initializing paymentsRMApp: " + err.Error())
@@ -137,6 +166,30 @@ func deserializeAndAddtoContext(ctx context.Context, rawEvent []byte) (context.C
     return context.WithValue(ctx, rawEventKey, rawEvent), nil
 }
 
+// theRawEventIsPublishedWithRoutingKey publishes the event without deserializing it,
+// so events of a type the payments-read-model doesn't handle can be published
+func theRawEventIsPublishedWithRoutingKey(ctx context.Context, eventJsonFilePath string, routingKey string) (context.Context, error) {
+    rawEvent, err := os.ReadFile(eventJsonFilePath)
+    if err != nil {
+        return ctx, fmt.Errorf("error reading event JSON file: %w", err)
+    }
+    publisher, err := rabbitmq.NewClient(
+        rabbitmq.WithExchangeName(app.RabbitMQPaymentsExchangeName),
+        rabbitmq.WithExchangeType(app.RabbitMQExchangeType),
+    )
+    if err != nil {
+        return ctx, fmt.Errorf("error creating rabbitmq client: %s", err.Error())
+    }
+    err = publisher.Publish(ctx, publishable{rawEvent: rawEvent}, events.RoutingInfo{
+        Topic:      app.RabbitMQPaymentsExchangeName,
+        RoutingKey: routingKey,
+    })
+    if err != nil {
+        return ctx, fmt.Errorf("error publishing raw event to rabbitmq: %s", err.Error())
+    }
+    return ctx, nil
+}
+
 func theEventIsPublished(ctx context.Context) (context.Context, error) {
     publisher, err := rabbitmq.NewClient(
         rabbitmq.WithExchangeName(app.RabbitMQPaymentsExchangeName),
@@ -191,6 +244,38 @@ func retrievePayments(ctx context.Context, params publicapi.ListPaymentsParams)
     return listPaymentsOk, nil
 }
 
+func adminAPIGet(url string, responseBody any) error {
+    resp, err := adminAPIRequest(http.MethodGet, url, nil)
+    if err != nil {
+        return fmt.Errorf("failed to send admin api request: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("admin api responded with status code %d", resp.StatusCode)
+    }
+
+    err = json.NewDecoder(resp.Body).Decode(responseBody)
+    if err != nil {
+        return fmt.Errorf("failed to decode admin api response: %w", err)
+    }
+
+    return nil
+}
+
+// adminAPIRequest sends a request carrying the admin api bearer token
+func adminAPIRequest(method string, url string, body io.Reader) (*http.Response, error) {
+    request, err := http.NewRequest(method, url, body)
+    if err != nil {
+        return nil, err
+    }
+    if body != nil {
+        request.Header.Set("Content-Type", "application/json")
+    }
+    request.Header.Set("Authorization", "Bearer "+adminAPIAuthToken)
+    return http.DefaultClient.Do(request)
+}
+
 func logsWatcherFromCtx(ctx context.Context) *slogwatcher.Watcher {
     value := ctx.Value(logsWatcherKey)
     if value == nil {
@@ -0,0 +1,57 @@
+package tests
+
+import (
+    "context"
+    "encoding/json"
+    "testing"
+
+    "github.com/cucumber/godog"
+    "github.com/walletera/payments-read-model/internal/app"
+    "github.com/walletera/payments-read-model/internal/domain/upcasting"
+)
+
+func TestEventUpcasting(t *testing.T) {
+
+    suite := godog.TestSuite{
+        ScenarioInitializer: InitializeEventUpcastingFeature,
+        Options: &godog.Options{
+            Format:   "pretty",
+            Paths:    []string{"features/event_upcasting.feature"},
+            TestingT: t, // Testing instance that will run subtests.
+        },
+    }
+
+    if suite.Run() != 0 {
+        t.Fatal("non-zero status returned, failed to run feature tests")
+    }
+}
+
+func InitializeEventUpcastingFeature(ctx *godog.ScenarioContext) {
+    ctx.Before(beforeScenarioHook)
+    ctx.Given(`^a running payments-read-model with the legacy PaymentCreated upcaster$`, aRunningPaymentsReadModelWithTheLegacyPaymentCreatedUpcaster)
+    ctx.When(`^the raw event (\S+) is published with routing key (\S+)$`, theRawEventIsPublishedWithRoutingKey)
+    ctx.Then(`^the payments-read-model produces the following log:$`, thePaymentsRMProducesTheFollowingLog)
+    ctx.Then(`^the payment (\S+) in the payments-read-model has status (\w+) and version (\d+)$`, thePaymentInThePaymentsReadModelHasStatusAndVersion)
+    ctx.After(afterScenarioHook)
+}
+
+func aRunningPaymentsReadModelWithTheLegacyPaymentCreatedUpcaster(ctx context.Context) (context.Context, error) {
+    registry := upcasting.NewRegistry().Register("PaymentCreated", upcasting.InitialSchemaVersion, upcastLegacyPaymentCreated)
+    return aRunningPaymentsReadModelWithOptions(ctx, app.WithEventUpcasters(registry))
+}
+
+// upcastLegacyPaymentCreated migrates the PaymentCreated events of the test legacy schema,
+// which carried the status of the payment in a state field, to the current schema
+func upcastLegacyPaymentCreated(envelope upcasting.Envelope) (upcasting.Envelope, error) {
+    var data map[string]json.RawMessage
+    err := json.Unmarshal(envelope.Data, &data)
+    if err != nil {
+        return upcasting.Envelope{}, err
+    }
+    if state, found := data["state"]; found {
+        data["status"] = state
+        delete(data, "state")
+    }
+    envelope.Data, err = json.Marshal(data)
+    return envelope, err
+}
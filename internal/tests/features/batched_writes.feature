@@ -0,0 +1,64 @@
+Feature: apply the payment writes in batches
+
+  Background: the payments-read-model is up and running with batched writes
+    Given a running payments-read-model with batched writes of up to 4 payments
+
+  Scenario: the payments created and updated with batched writes are projected
+    Given a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    And a PaymentUpdated event:
+    """
+    data/payment_updated.json
+    """
+    When the event is published
+    Then the payments-read-model produces the following log:
+    """
+    payment updated
+    """
+    And the payment 0ae1733e-7538-4908-b90a-5721670cb093 in the payments-read-model has status confirmed
+
+  Scenario: an update arriving before the update preceding it is parked with batched writes
+    Given a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    And a PaymentUpdated event:
+    """
+    data/payment_updated_v2_confirmed.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment update parked
+    """
+    And a PaymentUpdated event:
+    """
+    data/payment_updated_v1_delivered.json
+    """
+    When the event is published
+    Then the payments-read-model produces the following log:
+    """
+    parked payment update applied
+    """
+    And the payment 0ae1733e-7538-4908-b90a-5721670cb093 in the payments-read-model has status confirmed
+
+  Scenario: the payments created at once are projected in batches holding several writes
+    Given a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    When 20 copies of the event with new payment ids are published twice each at once
+    Then the payments-read-model holds the 20 payments created at once
+    And the payments-read-model holds no dead letter
@@ -0,0 +1,20 @@
+Feature: upcast the events published with an older schema before handling them
+
+  Background: the payments-read-model is running with the upcasters of the legacy PaymentCreated schema
+    Given a running payments-read-model with the legacy PaymentCreated upcaster
+
+  Scenario: a PaymentCreated event with the legacy schema is upcasted and saved
+    When the raw event data/payment_created_legacy_schema.json is published with routing key payment.created
+    Then the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    And the payment 7b2e4f1a-3c5d-4a6b-9e8f-1a2b3c4d5e6f in the payments-read-model has status pending and version 0
+
+  Scenario: a PaymentCreated event with the current schema is not upcasted again
+    When the raw event data/payment_created_unsupported_schema.json is published with routing key payment.created
+    Then the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    And the payment 0ae1733e-7538-4908-b90a-5721670cb093 in the payments-read-model has status pending and version 0
@@ -0,0 +1,17 @@
+Feature: consume the payments events from an NDJSON file
+
+  Scenario: the events of an NDJSON file are projected and its failed lines reported
+    Given an NDJSON events file with the lines:
+    """
+    data/payment_created.json
+    not a json event
+    data/payment_updated.json
+    """
+    When the payments-read-model consumes the NDJSON events file
+    Then the payments-read-model produces the following log:
+    """
+    events source fully consumed
+    """
+    And the payment 0ae1733e-7538-4908-b90a-5721670cb093 in the payments-read-model has status confirmed
+    And the NDJSON report lists the line 2 with error code 1006
+    And the NDJSON checkpoint is at line 3
@@ -14,6 +14,7 @@ Feature: Get Payment by Id
     And external id <externalId>
     And status <status>
     And customer id <customerId>
+    And the response has a projection lag header
 
     Examples:
       | paymentId                            | statusCode | responsePaymentId                    | externalId     | status   | customerId                           |
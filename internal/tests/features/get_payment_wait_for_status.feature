@@ -0,0 +1,58 @@
+Feature: Get Payment by Id waiting for a status
+
+  Background: the payments-read-model is up and running
+    Given a running payments-read-model
+
+  Scenario: a request waiting for a status is answered once the payment reaches it
+    Given a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    And a GET request on payment 0ae1733e-7538-4908-b90a-5721670cb093 waiting for status confirmed with timeout 20s
+    And a PaymentUpdated event:
+    """
+    data/payment_updated.json
+    """
+    When the event is published
+    Then the waiting request is answered with status code 200 and payment status confirmed within 10s
+
+  Scenario: a request waiting for a status is answered once another instance applies it
+    Given a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    And a GET request on payment 0ae1733e-7538-4908-b90a-5721670cb093 waiting for status confirmed with timeout 20s
+    When another instance updates payment 0ae1733e-7538-4908-b90a-5721670cb093 to status confirmed
+    Then the waiting request is answered with status code 200 and payment status confirmed within 5s
+
+  Scenario: a request waiting for a payment not created yet is answered once it's created
+    Given a GET request on payment 0ae1733e-7538-4908-b90a-5721670cb093 waiting for status confirmed with timeout 20s
+    And a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    When the event is published
+    Then the waiting request is answered with status code 200 and payment status pending within 10s
+
+  Scenario: a request waiting for a status is answered with the current state when the timeout expires
+    Given a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    When a GET request on payment 0ae1733e-7538-4908-b90a-5721670cb093 waiting for status confirmed with timeout 1s
+    Then the waiting request is answered with status code 200 and payment status pending within 5s
@@ -0,0 +1,33 @@
+Feature: push the payments events to the ingestion API
+
+  Background: the payments-read-model is up and running with the ingestion API
+    Given a running payments-read-model with the ingestion API
+
+  Scenario: a batch of events pushed to the ingestion API is applied
+    When the events are pushed to the ingestion API:
+    """
+    data/payment_created.json
+    data/payment_updated.json
+    """
+    Then the ingestion API responds with status 200
+    And the ingestion API result 0 has status 200
+    And the ingestion API result 1 has status 200
+    And the payment 0ae1733e-7538-4908-b90a-5721670cb093 in the payments-read-model has status confirmed
+
+  Scenario: a batch with an event that can't be deserialized is partially applied
+    When the events are pushed to the ingestion API:
+    """
+    data/payment_created.json
+    data/payment_created_unsupported_schema.json
+    """
+    Then the ingestion API responds with status 207
+    And the ingestion API result 0 has status 200
+    And the ingestion API result 1 has status 422 and error code 1006
+    And the payment 0ae1733e-7538-4908-b90a-5721670cb093 in the payments-read-model has status pending
+
+  Scenario: the events pushed with an invalid bearer token are rejected
+    When the events are pushed to the ingestion API with the bearer token invalid-token:
+    """
+    data/payment_created.json
+    """
+    Then the ingestion API responds with status 401
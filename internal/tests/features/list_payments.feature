@@ -15,4 +15,24 @@ Feature: list payments
       | filters                     | expectedPaymentIds                                                                                                      |
       | ?status=confirmed           | ["0ae1733e-7538-4908-b90a-5721670cb000","0ae1733e-7538-4908-b90a-5721670cb001", "0ae1733e-7538-4908-b90a-5721670cb002"] |
       | ?status=rejected&amount=101 | ["0ae1733e-7538-4908-b90a-5721670cb004"]                                                                                |
-      | ?externalId=EXTERNAL-ID-03  | ["0ae1733e-7538-4908-b90a-5721670cb003"]                                                                                |
\ No newline at end of file
+      | ?externalId=EXTERNAL-ID-03  | ["0ae1733e-7538-4908-b90a-5721670cb003"]                                                                                |
+
+  Scenario: a page of payments skipped with an offset is sorted from the newest to the oldest
+    When the payments-read-model receives a GET request on endpoint /payments with filters ?limit=3&offset=2
+    Then the returned payments ids are, in order, ["0ae1733e-7538-4908-b90a-5721670cb007","0ae1733e-7538-4908-b90a-5721670cb006","0ae1733e-7538-4908-b90a-5721670cb005"]
+
+  Scenario: the payments are paged back and forth with cursors
+    When the first page of 4 payments with filters &customerId=2432318c-4ff3-4ac0-b734-9b61779e2e46 is requested
+    Then the page holds, in order, the payments ["0ae1733e-7538-4908-b90a-5721670cb009","0ae1733e-7538-4908-b90a-5721670cb008","0ae1733e-7538-4908-b90a-5721670cb007","0ae1733e-7538-4908-b90a-5721670cb006"] with a next cursor and without a previous cursor
+    When the next page is requested
+    Then the page holds, in order, the payments ["0ae1733e-7538-4908-b90a-5721670cb005","0ae1733e-7538-4908-b90a-5721670cb004","0ae1733e-7538-4908-b90a-5721670cb003","0ae1733e-7538-4908-b90a-5721670cb002"] with a next cursor and with a previous cursor
+    When the next page is requested
+    Then the page holds, in order, the payments ["0ae1733e-7538-4908-b90a-5721670cb001","0ae1733e-7538-4908-b90a-5721670cb000"] without a next cursor and with a previous cursor
+    When the previous page is requested
+    Then the page holds, in order, the payments ["0ae1733e-7538-4908-b90a-5721670cb005","0ae1733e-7538-4908-b90a-5721670cb004","0ae1733e-7538-4908-b90a-5721670cb003","0ae1733e-7538-4908-b90a-5721670cb002"] with a next cursor and with a previous cursor
+    When the previous page is requested
+    Then the page holds, in order, the payments ["0ae1733e-7538-4908-b90a-5721670cb009","0ae1733e-7538-4908-b90a-5721670cb008","0ae1733e-7538-4908-b90a-5721670cb007","0ae1733e-7538-4908-b90a-5721670cb006"] with a next cursor and without a previous cursor
+
+  Scenario: a cursor is refused with other filters than the ones it was handed out with
+    When the first page of 4 payments with filters &customerId=2432318c-4ff3-4ac0-b734-9b61779e2e46 is requested
+    Then the next page is requested with filters limit=4&status=confirmed and is refused
@@ -0,0 +1,64 @@
+Feature: stream the payments changes as server-sent events
+
+  Background: the payments-read-model is up and running with an open payments stream
+    Given a running payments-read-model with a payments stream heartbeat every 1s
+    And a payments stream of customer 2432318c-4ff3-4ac0-b734-9b61779e2e46
+
+  Scenario: the creation and the updates of a payment are streamed
+    Given a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments stream gets a payment.created event with id d6d01cf2-628b-4742-8dc8-6b578fe1815a for payment 0ae1733e-7538-4908-b90a-5721670cb093
+    And a PaymentUpdated event:
+    """
+    data/payment_updated.json
+    """
+    When the event is published
+    Then the payments stream gets a payment.updated event with id 65aec719-5a2c-4600-8511-cb6962efda21 for payment 0ae1733e-7538-4908-b90a-5721670cb093
+
+  Scenario: a reconnected payments stream resumes after the last event received
+    Given a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments stream gets a payment.created event with id d6d01cf2-628b-4742-8dc8-6b578fe1815a for payment 0ae1733e-7538-4908-b90a-5721670cb093
+    And the payments stream is closed
+    And a PaymentUpdated event:
+    """
+    data/payment_updated.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment updated
+    """
+    When the payments stream of customer 2432318c-4ff3-4ac0-b734-9b61779e2e46 is reopened with the last event id received
+    Then the payments stream gets a payment.updated event with id 65aec719-5a2c-4600-8511-cb6962efda21 for payment 0ae1733e-7538-4908-b90a-5721670cb093
+
+  Scenario: the payments of other customers are not streamed
+    Given a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    When the payments stream of customer 11111111-1111-4111-8111-111111111111 is opened
+    And a PaymentUpdated event:
+    """
+    data/payment_updated.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment updated
+    """
+    Then the payments stream gets only heartbeats
+
+  Scenario: a payments stream without customer is refused
+    Then a payments stream without customer is refused
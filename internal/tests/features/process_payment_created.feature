@@ -28,6 +28,48 @@ Feature: process PaymentCreated event
     When the same PaymentCreated event is published again
     Then the payments-read-model produces the following log:
     """
-    failed saving payment
+    payment already saved, duplicated event ignored
     """
     And only one payment with the given id exists in the payments-read-model
+
+  Scenario: a PaymentCreated event for an existing payment with different content is flagged as a conflict
+    Given a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    And a PaymentCreated event:
+    """
+    data/payment_created_conflicting.json
+    """
+    When the event is published
+    Then the payments-read-model produces the following log:
+    """
+    conflicting PaymentCreated event
+    """
+    And only one payment with the given id exists in the payments-read-model
+    And the payments-read-model produces the following log:
+    """
+    event sent to dead letter store
+    """
+    And the admin API shows a dead letter for event 6f4c1f0e-2d0b-4b7e-9a57-3c1d2f0a8b11 with error code 2000
+    And the RabbitMQ dead letter queue holds no message
+
+  Scenario: an event of an unknown type is acknowledged and skipped
+    When the raw event data/payment_refunded.json is published with routing key payment.created
+    Then the payments-read-model produces the following log:
+    """
+    unknown event type received
+    """
+
+  Scenario: an event with a schema version the payments-read-model can't upcast is sent to the dead letter store
+    When the raw event data/payment_created_unsupported_schema.json is published with routing key payment.created
+    Then the payments-read-model produces the following log:
+    """
+    event sent to dead letter store
+    """
+    And the admin API shows a dead letter for event 9c1e5a3b-7f2d-4e8a-b6c4-1d2e3f4a5b60 with error code 1006
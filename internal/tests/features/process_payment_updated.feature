@@ -22,4 +22,91 @@ Feature: process PaymentUpdated event
     """
     payment updated
     """
-    And the payment in the payments-read-model has the expected new values in the updated fields
\ No newline at end of file
+    And the payment in the payments-read-model has the expected new values in the updated fields
+    And the admin API shows payment 0ae1733e-7538-4908-b90a-5721670cb093 with last event 65aec719-5a2c-4600-8511-cb6962efda21
+    And the admin API reports the service as healthy
+    And a PaymentProjectionUpdated event for event 65aec719-5a2c-4600-8511-cb6962efda21 is published with version 1 and status confirmed
+
+  Scenario: an update arriving before the update preceding it is parked and applied once the gap is filled
+    Given a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    And a PaymentUpdated event:
+    """
+    data/payment_updated_v2_confirmed.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment update parked
+    """
+    And a PaymentUpdated event:
+    """
+    data/payment_updated_v1_delivered.json
+    """
+    When the event is published
+    Then the payments-read-model produces the following log:
+    """
+    parked payment update applied
+    """
+    And the payment 0ae1733e-7538-4908-b90a-5721670cb093 in the payments-read-model has status confirmed
+    And the event log of payment 0ae1733e-7538-4908-b90a-5721670cb093 has 3 events
+    And the history of payment 0ae1733e-7538-4908-b90a-5721670cb093 has statuses pending,delivered,confirmed
+
+  Scenario: an update arriving before the PaymentCreated event is parked and applied once the payment is created
+    Given a PaymentUpdated event:
+    """
+    data/payment_updated.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment_not_created
+    """
+    And the admin API lists a pending update for payment 0ae1733e-7538-4908-b90a-5721670cb093 with reason payment_not_created
+    And a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    When the event is published
+    Then the payments-read-model produces the following log:
+    """
+    parked payment update applied
+    """
+    And the payment 0ae1733e-7538-4908-b90a-5721670cb093 in the payments-read-model has status confirmed
+
+  Scenario: an update making an illegal status transition is recorded as a status violation
+    Given a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    And a PaymentUpdated event:
+    """
+    data/payment_updated.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment updated
+    """
+    And a PaymentUpdated event:
+    """
+    data/payment_updated_v2_delivered.json
+    """
+    When the event is published
+    Then the payments-read-model produces the following log:
+    """
+    illegal payment status transition
+    """
+    And the admin API lists a status violation for payment 0ae1733e-7538-4908-b90a-5721670cb093 from confirmed to delivered
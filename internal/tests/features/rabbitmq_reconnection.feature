@@ -0,0 +1,25 @@
+Feature: resume consuming the payments events after the connection to RabbitMQ is lost
+
+  Background: the payments-read-model is up and running with a short reconnection backoff
+    Given a running payments-read-model with a short rabbitmq reconnection backoff
+
+  Scenario: the payments-read-model reconnects and resumes consuming after a RabbitMQ restart
+    Given the admin API reports the service as healthy
+    When the RabbitMQ broker is stopped
+    Then the admin API reports the rabbitmq connection as disconnected
+    When the RabbitMQ broker is started again
+    Then the payments-read-model produces the following log:
+    """
+    rabbitmq connection restored
+    """
+    And the admin API reports the service as healthy
+    Given a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    When the event is published
+    Then the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    And the payment exist in the payments-read-model
@@ -0,0 +1,47 @@
+Feature: rebuild the payments projection
+
+  Background: the payments-read-model is up and running
+    Given a running payments-read-model
+
+  Scenario: the payments projection is rebuilt from the event log into a new active collection
+    Given a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    And a PaymentUpdated event:
+    """
+    data/payment_updated.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment updated
+    """
+    When the admin API starts a projection rebuild
+    Then the projection rebuild completes
+    And the rebuilt collection holds 1 payments
+    And the payment 0ae1733e-7538-4908-b90a-5721670cb093 in the payments-read-model has status confirmed
+
+  Scenario: the events published during the rebuild are kept in the rebuilt collection
+    Given a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    When the admin API starts a projection rebuild while 100 payments are created
+    Then the projection rebuild completes
+    And the rebuilt collection holds 101 payments
+
+  Scenario: the rebuild is refused when the projection holds payments missing from the event log
+    Given a payment projected before the event log was introduced
+    When the admin API is asked to start a projection rebuild
+    Then the payments-read-model respond with status code 422
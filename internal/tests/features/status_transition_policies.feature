@@ -0,0 +1,103 @@
+Feature: handle the updates making an illegal status transition according to the policy
+
+  Scenario: an illegal status transition is rejected with the reject policy
+    Given a running payments-read-model with the reject status transition policy
+    And a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    And a PaymentUpdated event:
+    """
+    data/payment_updated.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment updated
+    """
+    And a PaymentUpdated event:
+    """
+    data/payment_updated_v2_delivered.json
+    """
+    When the event is published
+    Then the payments-read-model produces the following log:
+    """
+    illegal payment status transition
+    """
+    And the admin API shows a dead letter for event 3b6f0f4e-8f0a-4c64-9e8e-6a7d5d1e2c03 with error code 2004
+    And the payment 0ae1733e-7538-4908-b90a-5721670cb093 in the payments-read-model has status confirmed and version 1
+    And the admin API lists a status violation for payment 0ae1733e-7538-4908-b90a-5721670cb093 from confirmed to delivered with action reject
+
+  Scenario: an illegal status transition is applied keeping the current status with the quarantine policy
+    Given a running payments-read-model with the quarantine status transition policy
+    And a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    And a PaymentUpdated event:
+    """
+    data/payment_updated.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment updated
+    """
+    And a PaymentUpdated event:
+    """
+    data/payment_updated_v2_delivered.json
+    """
+    When the event is published
+    Then the payments-read-model produces the following log:
+    """
+    illegal payment status transition
+    """
+    And the payment 0ae1733e-7538-4908-b90a-5721670cb093 in the payments-read-model has status confirmed and version 2
+    And the admin API lists a status violation for payment 0ae1733e-7538-4908-b90a-5721670cb093 from confirmed to delivered with action quarantine
+
+  Scenario: a redelivered update quarantined with the quarantine policy is recognized as applied
+    Given a running payments-read-model with the quarantine status transition policy
+    And a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    And a PaymentUpdated event:
+    """
+    data/payment_updated.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment updated
+    """
+    And a PaymentUpdated event:
+    """
+    data/payment_updated_v2_delivered.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    illegal payment status transition
+    """
+    When the same event is published again
+    Then the payments-read-model produces the following log:
+    """
+    payment update already applied
+    """
+    And the payment 0ae1733e-7538-4908-b90a-5721670cb093 in the payments-read-model has status confirmed and version 2
+    And the payments-read-model holds no dead letter
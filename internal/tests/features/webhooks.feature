@@ -0,0 +1,24 @@
+Feature: deliver the payments status changes to the webhook subscriptions
+
+  Background: the payments-read-model is up and running with a webhook subscription
+    Given a running payments-read-model
+    And a webhook receiver
+    And a webhook subscription of customer 2432318c-4ff3-4ac0-b734-9b61779e2e46 for statuses confirmed
+
+  Scenario: a payment status change is delivered signed to the subscription
+    Given a PaymentCreated event:
+    """
+    data/payment_created.json
+    """
+    And the event is published
+    And the payments-read-model produces the following log:
+    """
+    payment saved
+    """
+    And a PaymentUpdated event:
+    """
+    data/payment_updated.json
+    """
+    When the event is published
+    Then the webhook receiver gets a signed status change of payment 0ae1733e-7538-4908-b90a-5721670cb093 from pending to confirmed
+    And the admin API lists a delivered webhook delivery for payment 0ae1733e-7538-4908-b90a-5721670cb093
@@ -0,0 +1,136 @@
+package tests
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/cucumber/godog"
+    "github.com/walletera/payments-read-model/internal/adapters/ndjson"
+    "github.com/walletera/payments-read-model/internal/app"
+)
+
+const ndjsonDirKey = "ndjsonDir"
+
+func TestFileEventsSource(t *testing.T) {
+
+    suite := godog.TestSuite{
+        ScenarioInitializer: InitializeFileEventsSourceFeature,
+        Options: &godog.Options{
+            Format:   "pretty",
+            Paths:    []string{"features/file_events_source.feature"},
+            TestingT: t, // Testing instance that will run subtests.
+        },
+    }
+
+    if suite.Run() != 0 {
+        t.Fatal("non-zero status returned, failed to run feature tests")
+    }
+}
+
+func InitializeFileEventsSourceFeature(ctx *godog.ScenarioContext) {
+    ctx.Before(beforeScenarioHook)
+    ctx.Given(`^an NDJSON events file with the lines:$`, anNDJSONEventsFileWithTheLines)
+    ctx.When(`^the payments-read-model consumes the NDJSON events file$`, thePaymentsReadModelConsumesTheNDJSONEventsFile)
+    ctx.Then(`^the payments-read-model produces the following log:$`, thePaymentsRMProducesTheFollowingLog)
+    ctx.Then(`^the payment (\S+) in the payments-read-model has status (\w+)$`, thePaymentInThePaymentsReadModelHasStatus)
+    ctx.Then(`^the NDJSON report lists the line (\d+) with error code (\d+)$`, theNDJSONReportListsTheLine)
+    ctx.Then(`^the NDJSON checkpoint is at line (\d+)$`, theNDJSONCheckpointIsAtLine)
+    ctx.After(afterScenarioHook)
+}
+
+// anNDJSONEventsFileWithTheLines writes the events file, every line of the doc string
+// is either the path of an event JSON file, compacted into a line, or the line itself
+func anNDJSONEventsFileWithTheLines(ctx context.Context, lines *godog.DocString) (context.Context, error) {
+    dir, err := os.MkdirTemp("", "payments-read-model-ndjson")
+    if err != nil {
+        return ctx, fmt.Errorf("failed creating ndjson dir: %w", err)
+    }
+    var content bytes.Buffer
+    for _, line := range strings.Split(lines.Content, "\n") {
+        if strings.HasPrefix(line, "data/") {
+            rawEvent, err := os.ReadFile(line)
+            if err != nil {
+                return ctx, fmt.Errorf("error reading event JSON file: %w", err)
+            }
+            err = json.Compact(&content, rawEvent)
+            if err != nil {
+                return ctx, fmt.Errorf("error compacting event JSON file: %w", err)
+            }
+        } else {
+            content.WriteString(line)
+        }
+        content.WriteString("\n")
+    }
+    err = os.WriteFile(filepath.Join(dir, "events.ndjson"), content.Bytes(), 0o644)
+    if err != nil {
+        return ctx, fmt.Errorf("failed writing ndjson file: %w", err)
+    }
+    return context.WithValue(ctx, ndjsonDirKey, dir), nil
+}
+
+func thePaymentsReadModelConsumesTheNDJSONEventsFile(ctx context.Context) (context.Context, error) {
+    dir := ctx.Value(ndjsonDirKey).(string)
+    return aRunningPaymentsReadModelWithOptions(ctx, app.WithFileEventsSource(ndjson.Config{
+        Path:           filepath.Join(dir, "events.ndjson"),
+        CheckpointPath: filepath.Join(dir, "checkpoint.json"),
+        ReportPath:     filepath.Join(dir, "report.ndjson"),
+    }))
+}
+
+func theNDJSONReportListsTheLine(ctx context.Context, line int, errorCode int) (context.Context, error) {
+    dir := ctx.Value(ndjsonDirKey).(string)
+    report, err := os.Open(filepath.Join(dir, "report.ndjson"))
+    if err != nil {
+        return ctx, fmt.Errorf("failed opening ndjson report: %w", err)
+    }
+    defer report.Close()
+
+    type failedLine struct {
+        Line      int `json:"line"`
+        ErrorCode int `json:"errorCode"`
+    }
+    var failedLines []failedLine
+    scanner := bufio.NewScanner(report)
+    for scanner.Scan() {
+        var failedLine failedLine
+        err = json.Unmarshal(scanner.Bytes(), &failedLine)
+        if err != nil {
+            return ctx, fmt.Errorf("failed decoding ndjson report: %w", err)
+        }
+        failedLines = append(failedLines, failedLine)
+    }
+    if len(failedLines) != 1 {
+        return ctx, fmt.Errorf("expected exactly one failed line in the report, but found %d", len(failedLines))
+    }
+    if failedLines[0].Line != line || failedLines[0].ErrorCode != errorCode {
+        return ctx, fmt.Errorf("expected line %d with error code %d in the report, but got line %d with error code %d", line, errorCode, failedLines[0].Line, failedLines[0].ErrorCode)
+    }
+    return ctx, nil
+}
+
+func theNDJSONCheckpointIsAtLine(ctx context.Context, line int) (context.Context, error) {
+    dir := ctx.Value(ndjsonDirKey).(string)
+    content, err := os.ReadFile(filepath.Join(dir, "checkpoint.json"))
+    if err != nil {
+        return ctx, fmt.Errorf("failed reading ndjson checkpoint: %w", err)
+    }
+    var checkpoint struct {
+        Lines map[string]int `json:"lines"`
+    }
+    err = json.Unmarshal(content, &checkpoint)
+    if err != nil {
+        return ctx, fmt.Errorf("failed decoding ndjson checkpoint: %w", err)
+    }
+    eventsFile := filepath.Join(dir, "events.ndjson")
+    if checkpoint.Lines[eventsFile] != line {
+        return ctx, fmt.Errorf("expected the checkpoint at line %d, but got %d", line, checkpoint.Lines[eventsFile])
+    }
+    return ctx, nil
+}
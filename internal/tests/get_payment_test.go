@@ -6,6 +6,7 @@ import (
     "fmt"
     "io"
     "net/http"
+    "strconv"
     "testing"
 
     "github.com/cucumber/godog"
@@ -14,6 +15,8 @@ import (
 
 const (
     responseStatusCodeKey = "responseStatusCode"
+    projectionLagKey      = "projectionLag"
+    projectionIdleKey     = "projectionIdle"
     getPaymentOkKey       = "getPayment"
 )
 
@@ -43,6 +46,7 @@ func InitializeGetPaymentFeature(ctx *godog.ScenarioContext) {
     ctx.Then(`^external id (.+)$`, theReturnedPaymentExternalIdIs)
     ctx.Then(`^status (.+)$`, theReturnedPaymentStatusIs)
     ctx.Then(`^customer id (.+)$`, theReturnedCustomerIdIs)
+    ctx.Then(`^the response has a projection lag header$`, theResponseHasAProjectionLagHeader)
     ctx.After(afterScenarioHook)
 }
 
@@ -66,6 +70,8 @@ func thePaymentsRMReceivesAGETRequestOnEndpointPaymentsId(ctx context.Context, p
     }(resp.Body)
 
     ctx = context.WithValue(ctx, responseStatusCodeKey, resp.StatusCode)
+    ctx = context.WithValue(ctx, projectionLagKey, resp.Header.Get("X-Projection-Lag"))
+    ctx = context.WithValue(ctx, projectionIdleKey, resp.Header.Get("X-Projection-Idle"))
 
     if resp.StatusCode == http.StatusOK {
         var payment publicapi.Payment
@@ -155,3 +161,20 @@ func getPaymentFromCtx(ctx context.Context) publicapi.Payment {
     }
     return getPaymentOk
 }
+
+func theResponseHasAProjectionLagHeader(ctx context.Context) (context.Context, error) {
+    projectionLag, _ := ctx.Value(projectionLagKey).(string)
+    if projectionLag == "" {
+        return ctx, fmt.Errorf("expected the response to have a X-Projection-Lag header")
+    }
+    _, err := strconv.ParseInt(projectionLag, 10, 64)
+    if err != nil {
+        return ctx, fmt.Errorf("expected the X-Projection-Lag header to be a number of milliseconds, but got %s", projectionLag)
+    }
+    projectionIdle, _ := ctx.Value(projectionIdleKey).(string)
+    _, err = strconv.ParseInt(projectionIdle, 10, 64)
+    if err != nil {
+        return ctx, fmt.Errorf("expected the X-Projection-Idle header to be a number of milliseconds, but got %s", projectionIdle)
+    }
+    return ctx, nil
+}
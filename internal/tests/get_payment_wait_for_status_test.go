@@ -0,0 +1,163 @@
+package tests
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/cucumber/godog"
+    "github.com/google/uuid"
+    "github.com/walletera/payments-read-model/internal/adapters/mongodb"
+    "github.com/walletera/payments-read-model/internal/app"
+    "github.com/walletera/payments-read-model/internal/domain/payments"
+    "github.com/walletera/payments-types/privateapi"
+    "github.com/walletera/payments-types/publicapi"
+    "go.mongodb.org/mongo-driver/v2/bson"
+    "go.mongodb.org/mongo-driver/v2/mongo"
+    "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const waitingRequestKey = "waitingRequest"
+
+type waitingRequestResponse struct {
+    statusCode int
+    payment    publicapi.Payment
+    err        error
+}
+
+func TestGetPaymentWaitForStatus(t *testing.T) {
+
+    suite := godog.TestSuite{
+        ScenarioInitializer: InitializeGetPaymentWaitForStatusFeature,
+        Options: &godog.Options{
+            Format:   "pretty",
+            Paths:    []string{"features/get_payment_wait_for_status.feature"},
+            TestingT: t, // Testing instance that will run subtests.
+        },
+    }
+
+    if suite.Run() != 0 {
+        t.Fatal("non-zero status returned, failed to run feature tests")
+    }
+}
+
+func InitializeGetPaymentWaitForStatusFeature(ctx *godog.ScenarioContext) {
+    ctx.Before(beforeScenarioHook)
+    ctx.Given(`^a running payments-read-model$`, aRunningPaymentsReadModel)
+    ctx.Given(`^a PaymentCreated event:$`, anEvent)
+    ctx.Given(`^a PaymentUpdated event:$`, anEvent)
+    ctx.Given(`^the event is published$`, theEventIsPublished)
+    ctx.Given(`^the payments-read-model produces the following log:$`, thePaymentsRMProducesTheFollowingLog)
+    ctx.Given(`^a GET request on payment (\S+) waiting for status (\S+) with timeout (\S+)$`, aGETRequestWaitingForStatus)
+    ctx.When(`^another instance updates payment (\S+) to status (\w+)$`, anotherInstanceUpdatesThePayment)
+    ctx.Then(`^the waiting request is answered with status code (\d+) and payment status (\w+) within (\S+)$`, theWaitingRequestIsAnswered)
+    ctx.After(afterScenarioHook)
+}
+
+// aGETRequestWaitingForStatus sends the request in the background, it's answered once the wait is over
+func aGETRequestWaitingForStatus(ctx context.Context, paymentId string, status string, timeout string) (context.Context, error) {
+    url := fmt.Sprintf("http://127.0.0.1:%d/payments/%s?waitForStatus=%s&timeout=%s", publicApiHttpServerPort, paymentId, status, timeout)
+    request, err := http.NewRequest(http.MethodGet, url, nil)
+    if err != nil {
+        return ctx, fmt.Errorf("failed to create request: %w", err)
+    }
+    request.Header.Set("Authorization", "Bearer ajsonwebtoken")
+
+    responses := make(chan waitingRequestResponse, 1)
+    go func() {
+        resp, err := http.DefaultClient.Do(request)
+        if err != nil {
+            responses <- waitingRequestResponse{err: fmt.Errorf("failed to send request: %w", err)}
+            return
+        }
+        defer resp.Body.Close()
+        response := waitingRequestResponse{statusCode: resp.StatusCode}
+        if resp.StatusCode == http.StatusOK {
+            err = json.NewDecoder(resp.Body).Decode(&response.payment)
+            if err != nil {
+                response.err = fmt.Errorf("failed to decode response: %w", err)
+            }
+        }
+        responses <- response
+    }()
+    return context.WithValue(ctx, waitingRequestKey, responses), nil
+}
+
+// anotherInstanceUpdatesThePayment updates the payment straight in mongodb and logs the event, like
+// another instance applying it, so the change doesn't wake up the waiting requests in process
+func anotherInstanceUpdatesThePayment(ctx context.Context, paymentId string, status string) (context.Context, error) {
+    id, err := uuid.Parse(paymentId)
+    if err != nil {
+        return ctx, fmt.Errorf("invalid payment id %s: %w", paymentId, err)
+    }
+
+    client, err := mongo.Connect(options.Client().ApplyURI(mongodbURL))
+    if err != nil {
+        return ctx, fmt.Errorf("failed connecting to mongodb: %w", err)
+    }
+    defer client.Disconnect(context.Background())
+
+    coll := client.Database(app.MongoDBDatabaseName).Collection(app.MongoDBPaymentsCollectionName)
+    var payment struct {
+        AggregateVersion uint64 `bson:"version"`
+    }
+    err = coll.FindOneAndUpdate(
+        ctx,
+        bson.M{"_id": id},
+        bson.M{"$set": bson.M{"data.status": status}, "$inc": bson.M{"version": 1}},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&payment)
+    if err != nil {
+        return ctx, fmt.Errorf("failed updating payment %s: %w", paymentId, err)
+    }
+
+    data, err := json.Marshal(privateapi.PaymentUpdate{PaymentId: id, Status: privateapi.PaymentStatus(status)})
+    if err != nil {
+        return ctx, fmt.Errorf("failed serializing payment update: %w", err)
+    }
+    eventLog := mongodb.NewEventLogRepository(client, app.MongoDBDatabaseName, app.MongoDBEventLogCollectionName)
+    werr := eventLog.AppendEvent(ctx, payments.LoggedEvent{
+        ID:               uuid.New(),
+        Type:             "PaymentUpdated",
+        AggregateVersion: payment.AggregateVersion,
+        CorrelationId:    uuid.NewString(),
+        CreatedAt:        time.Now(),
+        PaymentId:        id,
+        Data:             data,
+        Status:           privateapi.PaymentStatus(status),
+    })
+    if werr != nil {
+        return ctx, fmt.Errorf("failed logging payment event: %s", werr.Message())
+    }
+    return ctx, nil
+}
+
+func theWaitingRequestIsAnswered(ctx context.Context, statusCode int, status string, rawWithin string) (context.Context, error) {
+    within, err := time.ParseDuration(rawWithin)
+    if err != nil {
+        return ctx, fmt.Errorf("invalid duration %s: %w", rawWithin, err)
+    }
+    responses, ok := ctx.Value(waitingRequestKey).(chan waitingRequestResponse)
+    if !ok {
+        panic("waitingRequest not found in context")
+    }
+    var response waitingRequestResponse
+    select {
+    case response = <-responses:
+    case <-time.After(within):
+        return ctx, fmt.Errorf("the waiting request wasn't answered within %s", within)
+    }
+    if response.err != nil {
+        return ctx, response.err
+    }
+    if response.statusCode != statusCode {
+        return ctx, fmt.Errorf("expected response status code to be %d, but got %d", statusCode, response.statusCode)
+    }
+    if string(response.payment.Status) != status {
+        return ctx, fmt.Errorf("expected payment status to be %s, but got %s", status, response.payment.Status)
+    }
+    return ctx, nil
+}
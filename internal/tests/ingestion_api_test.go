@@ -0,0 +1,143 @@
+package tests
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "strings"
+    "testing"
+
+    "github.com/cucumber/godog"
+    "github.com/walletera/payments-read-model/internal/app"
+)
+
+const (
+    ingestionAPIAuthToken       = "ingestion-token"
+    ingestionResponseStatusKey  = "ingestionResponseStatus"
+    ingestionResponseResultsKey = "ingestionResponseResults"
+)
+
+type ingestionResult struct {
+    Status    int `json:"status"`
+    ErrorCode int `json:"errorCode"`
+}
+
+func TestIngestionAPI(t *testing.T) {
+
+    suite := godog.TestSuite{
+        ScenarioInitializer: InitializeIngestionAPIFeature,
+        Options: &godog.Options{
+            Format:   "pretty",
+            Paths:    []string{"features/ingestion_api.feature"},
+            TestingT: t, // Testing instance that will run subtests.
+        },
+    }
+
+    if suite.Run() != 0 {
+        t.Fatal("non-zero status returned, failed to run feature tests")
+    }
+}
+
+func InitializeIngestionAPIFeature(ctx *godog.ScenarioContext) {
+    ctx.Before(beforeScenarioHook)
+    ctx.Given(`^a running payments-read-model with the ingestion API$`, aRunningPaymentsReadModelWithTheIngestionAPI)
+    ctx.When(`^the events are pushed to the ingestion API:$`, theEventsArePushedToTheIngestionAPI)
+    ctx.When(`^the events are pushed to the ingestion API with the bearer token (\S+):$`, theEventsArePushedToTheIngestionAPIWithTheBearerToken)
+    ctx.Then(`^the ingestion API responds with status (\d+)$`, theIngestionAPIRespondsWithStatus)
+    ctx.Then(`^the ingestion API result (\d+) has status (\d+)$`, theIngestionAPIResultHasStatus)
+    ctx.Then(`^the ingestion API result (\d+) has status (\d+) and error code (\d+)$`, theIngestionAPIResultHasStatusAndErrorCode)
+    ctx.Then(`^the payment (\S+) in the payments-read-model has status (\w+)$`, thePaymentInThePaymentsReadModelHasStatus)
+    ctx.After(afterScenarioHook)
+}
+
+func aRunningPaymentsReadModelWithTheIngestionAPI(ctx context.Context) (context.Context, error) {
+    return aRunningPaymentsReadModelWithOptions(ctx, app.WithIngestionAPIConfig(app.IngestionAPIConfig{
+        IngestionAPIHttpServerPort: ingestionApiHttpServerPort,
+        AuthToken:                  ingestionAPIAuthToken,
+    }))
+}
+
+func theEventsArePushedToTheIngestionAPI(ctx context.Context, eventJsonFilePaths *godog.DocString) (context.Context, error) {
+    return theEventsArePushedToTheIngestionAPIWithTheBearerToken(ctx, ingestionAPIAuthToken, eventJsonFilePaths)
+}
+
+func theEventsArePushedToTheIngestionAPIWithTheBearerToken(ctx context.Context, token string, eventJsonFilePaths *godog.DocString) (context.Context, error) {
+    var rawEvents []json.RawMessage
+    for _, eventJsonFilePath := range strings.Split(eventJsonFilePaths.Content, "\n") {
+        rawEvent, err := os.ReadFile(eventJsonFilePath)
+        if err != nil {
+            return ctx, fmt.Errorf("error reading event JSON file: %w", err)
+        }
+        rawEvents = append(rawEvents, rawEvent)
+    }
+    body, err := json.Marshal(rawEvents)
+    if err != nil {
+        return ctx, fmt.Errorf("failed encoding the events: %w", err)
+    }
+
+    url := fmt.Sprintf("http://127.0.0.1:%d/events", ingestionApiHttpServerPort)
+    req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+    if err != nil {
+        return ctx, fmt.Errorf("failed to create ingestion api request: %w", err)
+    }
+    req.Header.Set("Authorization", "Bearer "+token)
+    req.Header.Set("Content-Type", "application/json")
+
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return ctx, fmt.Errorf("failed to send ingestion api request: %w", err)
+    }
+    defer resp.Body.Close()
+
+    var results struct {
+        Results []ingestionResult `json:"results"`
+    }
+    err = json.NewDecoder(resp.Body).Decode(&results)
+    if err != nil {
+        return ctx, fmt.Errorf("failed to decode ingestion api response: %w", err)
+    }
+
+    ctx = context.WithValue(ctx, ingestionResponseStatusKey, resp.StatusCode)
+    return context.WithValue(ctx, ingestionResponseResultsKey, results.Results), nil
+}
+
+func theIngestionAPIRespondsWithStatus(ctx context.Context, status int) (context.Context, error) {
+    responseStatus := ctx.Value(ingestionResponseStatusKey).(int)
+    if responseStatus != status {
+        return ctx, fmt.Errorf("expected the ingestion api to respond with status %d, but got %d", status, responseStatus)
+    }
+    return ctx, nil
+}
+
+func theIngestionAPIResultHasStatus(ctx context.Context, index int, status int) (context.Context, error) {
+    result, err := ingestionResultFromCtx(ctx, index)
+    if err != nil {
+        return ctx, err
+    }
+    if result.Status != status {
+        return ctx, fmt.Errorf("expected the result %d to have status %d, but got %d", index, status, result.Status)
+    }
+    return ctx, nil
+}
+
+func theIngestionAPIResultHasStatusAndErrorCode(ctx context.Context, index int, status int, errorCode int) (context.Context, error) {
+    result, err := ingestionResultFromCtx(ctx, index)
+    if err != nil {
+        return ctx, err
+    }
+    if result.Status != status || result.ErrorCode != errorCode {
+        return ctx, fmt.Errorf("expected the result %d to have status %d and error code %d, but got %d and %d", index, status, errorCode, result.Status, result.ErrorCode)
+    }
+    return ctx, nil
+}
+
+func ingestionResultFromCtx(ctx context.Context, index int) (ingestionResult, error) {
+    results := ctx.Value(ingestionResponseResultsKey).([]ingestionResult)
+    if index >= len(results) {
+        return ingestionResult{}, fmt.Errorf("expected at least %d ingestion results, but got %d", index+1, len(results))
+    }
+    return results[index], nil
+}
@@ -14,7 +14,18 @@ import (
 	"github.com/walletera/payments-types/publicapi"
 )
 
-const listPaymentsOkKey = "listPaymentsOkKey"
+const (
+	listPaymentsOkKey = "listPaymentsOkKey"
+	paymentsPageKey   = "paymentsPage"
+)
+
+// requestedPaymentsPage is a page of payments paged with a cursor and the query it was requested with
+type requestedPaymentsPage struct {
+	query      string
+	Items      []publicapi.Payment `json:"items"`
+	NextCursor string              `json:"nextCursor"`
+	PrevCursor string              `json:"prevCursor"`
+}
 
 func TestListPayments(t *testing.T) {
 
@@ -38,6 +49,11 @@ func InitializeListPaymentsFeature(ctx *godog.ScenarioContext) {
 	ctx.Step(`^a list of payment created events is published and processed successfully by the payments-read-model:$`, aListOfPaymentCreatedEvents)
 	ctx.Step(`^the payments-read-model receives a GET request on endpoint \/payments with filters (.+)$`, thePaymentsRMReceivesAGETRequestOnEndpointPaymentsWithFilters)
 	ctx.Step(`^the returned payments ids match (.+)$`, theReturnedPaymentsIdsMatch)
+	ctx.Step(`^the returned payments ids are, in order, (.+)$`, theReturnedPaymentsIdsAreInOrder)
+	ctx.Step(`^the first page of (\d+) payments with filters (\S*) is requested$`, theFirstPageOfPaymentsIsRequested)
+	ctx.Step(`^the (next|previous) page is requested$`, theAdjacentPageIsRequested)
+	ctx.Step(`^the next page is requested with filters (\S+) and is refused$`, theNextPageIsRequestedWithOtherFilters)
+	ctx.Step(`^the page holds, in order, the payments (\S+) (with|without) a next cursor and (with|without) a previous cursor$`, thePageHoldsThePayments)
 	ctx.After(afterScenarioHook)
 }
 
@@ -132,6 +148,112 @@ func theReturnedPaymentsIdsMatch(ctx context.Context, paymentIdsJson string) err
 	return nil
 }
 
+func theReturnedPaymentsIdsAreInOrder(ctx context.Context, paymentIdsJson string) error {
+	return paymentIdsMatchInOrder(listPaymentsOkFromCtx(ctx).Items, paymentIdsJson)
+}
+
+func theFirstPageOfPaymentsIsRequested(ctx context.Context, limit int, filters string) (context.Context, error) {
+	return requestPaymentsPage(ctx, fmt.Sprintf("limit=%d%s", limit, filters), "")
+}
+
+func theAdjacentPageIsRequested(ctx context.Context, direction string) (context.Context, error) {
+	page := paymentsPageFromCtx(ctx)
+	cursor := page.NextCursor
+	if direction == "previous" {
+		cursor = page.PrevCursor
+	}
+	if cursor == "" {
+		return ctx, fmt.Errorf("the page has no %s cursor", direction)
+	}
+	return requestPaymentsPage(ctx, page.query, cursor)
+}
+
+// theNextPageIsRequestedWithOtherFilters sends the next cursor along with other filters than the ones it was handed out with
+func theNextPageIsRequestedWithOtherFilters(ctx context.Context, filters string) (context.Context, error) {
+	page := paymentsPageFromCtx(ctx)
+	url := fmt.Sprintf("http://127.0.0.1:%d/payments?%s&cursor=%s", publicApiHttpServerPort, filters, page.NextCursor)
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return ctx, fmt.Errorf("failed to create request: %w", err)
+	}
+	request.Header.Set("Authorization", "Bearer ajsonwebtoken")
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return ctx, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		return ctx, fmt.Errorf("expected the payments page request to be refused with a 400, but got %d", resp.StatusCode)
+	}
+	return ctx, nil
+}
+
+// requestPaymentsPage sends the query, without the cursor, along with the given cursor
+func requestPaymentsPage(ctx context.Context, query string, cursor string) (context.Context, error) {
+	url := fmt.Sprintf("http://127.0.0.1:%d/payments?%s&cursor=%s", publicApiHttpServerPort, query, cursor)
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return ctx, fmt.Errorf("failed to create request: %w", err)
+	}
+	request.Header.Set("Authorization", "Bearer ajsonwebtoken")
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return ctx, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ctx, fmt.Errorf("payments page request responded with status code %d", resp.StatusCode)
+	}
+
+	page := requestedPaymentsPage{query: query}
+	err = json.NewDecoder(resp.Body).Decode(&page)
+	if err != nil {
+		return ctx, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return context.WithValue(ctx, paymentsPageKey, page), nil
+}
+
+func thePageHoldsThePayments(ctx context.Context, paymentIdsJson string, nextCursor string, prevCursor string) error {
+	page := paymentsPageFromCtx(ctx)
+	err := paymentIdsMatchInOrder(page.Items, paymentIdsJson)
+	if err != nil {
+		return err
+	}
+	if (page.NextCursor != "") != (nextCursor == "with") {
+		return fmt.Errorf("expected the page %s a next cursor", nextCursor)
+	}
+	if (page.PrevCursor != "") != (prevCursor == "with") {
+		return fmt.Errorf("expected the page %s a previous cursor", prevCursor)
+	}
+	return nil
+}
+
+func paymentIdsMatchInOrder(items []publicapi.Payment, paymentIdsJson string) error {
+	var paymentIds []string
+	err := json.Unmarshal([]byte(paymentIdsJson), &paymentIds)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal paymentIdsJson: %w", err)
+	}
+	returnedIds := make([]string, len(items))
+	for i, payment := range items {
+		returnedIds[i] = payment.ID.String()
+	}
+	if !slices.Equal(paymentIds, returnedIds) {
+		return fmt.Errorf("returned payment IDs %v do not match, in order, expected IDs %v", returnedIds, paymentIds)
+	}
+	return nil
+}
+
+func paymentsPageFromCtx(ctx context.Context) requestedPaymentsPage {
+	value := ctx.Value(paymentsPageKey)
+	if value == nil {
+		panic("paymentsPage not found in context")
+	}
+	return value.(requestedPaymentsPage)
+}
+
 func listPaymentsOkFromCtx(ctx context.Context) publicapi.ListPaymentsOK {
 	value := ctx.Value(listPaymentsOkKey)
 	if value == nil {
@@ -15,6 +15,9 @@ const (
 	containersStartTimeout = 60 * time.Second
 )
 
+// rabbitmqContainer is restarted by the scenarios checking the consumer reconnects
+var rabbitmqContainer testcontainers.Container
+
 func TestMain(m *testing.M) {
 	ctx, cancelCtx := context.WithTimeout(context.Background(), containersStartTimeout)
 	defer cancelCtx()
@@ -95,6 +98,7 @@ func startRabbitMQContainer(ctx context.Context) (func() error, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error creating rabbitmq container: %w", err)
 	}
+	rabbitmqContainer = rabbitmqC
 
 	return func() error {
 		terminationCtx, terminationCtxCancel := context.WithTimeout(context.Background(), containersTerminationTimeout)
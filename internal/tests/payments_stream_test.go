@@ -0,0 +1,236 @@
+package tests
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/cucumber/godog"
+    "github.com/walletera/payments-read-model/internal/app"
+)
+
+const paymentsStreamKey = "paymentsStream"
+
+type streamedEvent struct {
+    id        string
+    event     string
+    data      string
+    heartbeat bool
+}
+
+type paymentsStream struct {
+    response    *http.Response
+    events      chan streamedEvent
+    lastEventId string
+}
+
+func TestPaymentsStream(t *testing.T) {
+
+    suite := godog.TestSuite{
+        ScenarioInitializer: InitializePaymentsStreamFeature,
+        Options: &godog.Options{
+            Format:   "pretty",
+            Paths:    []string{"features/payments_stream.feature"},
+            TestingT: t, // Testing instance that will run subtests.
+        },
+    }
+
+    if suite.Run() != 0 {
+        t.Fatal("non-zero status returned, failed to run feature tests")
+    }
+}
+
+func InitializePaymentsStreamFeature(ctx *godog.ScenarioContext) {
+    ctx.Before(beforeScenarioHook)
+    ctx.Given(`^a running payments-read-model with a payments stream heartbeat every (\S+)$`, aRunningPaymentsReadModelWithAStreamHeartbeat)
+    ctx.Given(`^a payments stream of customer (\S+)$`, aPaymentsStreamOfCustomer)
+    ctx.Given(`^a PaymentCreated event:$`, anEvent)
+    ctx.Given(`^a PaymentUpdated event:$`, anEvent)
+    ctx.Given(`^the event is published$`, theEventIsPublished)
+    ctx.Given(`^the payments-read-model produces the following log:$`, thePaymentsRMProducesTheFollowingLog)
+    ctx.Given(`^the payments stream is closed$`, thePaymentsStreamIsClosed)
+    ctx.When(`^the payments stream of customer (\S+) is opened$`, aPaymentsStreamOfCustomer)
+    ctx.When(`^the payments stream of customer (\S+) is reopened with the last event id received$`, thePaymentsStreamIsReopened)
+    ctx.Then(`^the payments stream gets a (\S+) event with id (\S+) for payment (\S+)$`, thePaymentsStreamGetsAnEvent)
+    ctx.Then(`^the payments stream gets only heartbeats$`, thePaymentsStreamGetsOnlyHeartbeats)
+    ctx.Then(`^a payments stream without customer is refused$`, aPaymentsStreamWithoutCustomerIsRefused)
+    ctx.After(closePaymentsStreamHook)
+    ctx.After(afterScenarioHook)
+}
+
+func aRunningPaymentsReadModelWithAStreamHeartbeat(ctx context.Context, rawInterval string) (context.Context, error) {
+    interval, err := time.ParseDuration(rawInterval)
+    if err != nil {
+        return ctx, fmt.Errorf("invalid heartbeat interval %s: %w", rawInterval, err)
+    }
+    return aRunningPaymentsReadModelWithOptions(ctx, app.WithPublicAPIConfig(app.PublicAPIConfig{
+        PublicAPIHttpServerPort: publicApiHttpServerPort,
+        StreamHeartbeatInterval: interval,
+    }))
+}
+
+func aPaymentsStreamOfCustomer(ctx context.Context, customerId string) (context.Context, error) {
+    return openPaymentsStream(ctx, customerId, "")
+}
+
+func thePaymentsStreamIsReopened(ctx context.Context, customerId string) (context.Context, error) {
+    return openPaymentsStream(ctx, customerId, paymentsStreamFromCtx(ctx).lastEventId)
+}
+
+func openPaymentsStream(ctx context.Context, customerId string, lastEventId string) (context.Context, error) {
+    closePaymentsStream(ctx)
+
+    url := fmt.Sprintf("http://127.0.0.1:%d/payments/stream?customerId=%s", publicApiHttpServerPort, customerId)
+    request, err := http.NewRequest(http.MethodGet, url, nil)
+    if err != nil {
+        return ctx, fmt.Errorf("failed creating payments stream request: %w", err)
+    }
+    request.Header.Set("Authorization", "Bearer ajsonwebtoken")
+    if lastEventId != "" {
+        request.Header.Set("Last-Event-ID", lastEventId)
+    }
+    response, err := http.DefaultClient.Do(request)
+    if err != nil {
+        return ctx, fmt.Errorf("failed opening payments stream: %w", err)
+    }
+    if response.StatusCode != http.StatusOK {
+        response.Body.Close()
+        return ctx, fmt.Errorf("payments stream responded with status code %d", response.StatusCode)
+    }
+
+    stream := &paymentsStream{
+        response:    response,
+        events:      make(chan streamedEvent, 100),
+        lastEventId: lastEventId,
+    }
+    go readStreamedEvents(stream)
+    return context.WithValue(ctx, paymentsStreamKey, stream), nil
+}
+
+// readStreamedEvents parses the stream until it's closed
+func readStreamedEvents(stream *paymentsStream) {
+    defer close(stream.events)
+    scanner := bufio.NewScanner(stream.response.Body)
+    var event streamedEvent
+    for scanner.Scan() {
+        line := scanner.Text()
+        switch {
+        case line == "":
+            if event.event != "" || event.heartbeat {
+                stream.events <- event
+            }
+            event = streamedEvent{}
+        case strings.HasPrefix(line, ":"):
+            event.heartbeat = true
+        case strings.HasPrefix(line, "id: "):
+            event.id = strings.TrimPrefix(line, "id: ")
+        case strings.HasPrefix(line, "event: "):
+            event.event = strings.TrimPrefix(line, "event: ")
+        case strings.HasPrefix(line, "data: "):
+            event.data = strings.TrimPrefix(line, "data: ")
+        }
+    }
+}
+
+func thePaymentsStreamGetsAnEvent(ctx context.Context, eventName string, eventId string, paymentId string) (context.Context, error) {
+    stream := paymentsStreamFromCtx(ctx)
+    timeout := time.After(logsWatcherWaitForTimeout)
+    for {
+        var event streamedEvent
+        var ok bool
+        select {
+        case event, ok = <-stream.events:
+            if !ok {
+                return ctx, fmt.Errorf("the payments stream was closed")
+            }
+        case <-timeout:
+            return ctx, fmt.Errorf("the payments stream didn't get a %s event", eventName)
+        }
+        if event.heartbeat {
+            continue
+        }
+        if event.event != eventName || event.id != eventId {
+            return ctx, fmt.Errorf("expected a %s event with id %s, but got a %s event with id %s", eventName, eventId, event.event, event.id)
+        }
+        var data struct {
+            EventId   string `json:"eventId"`
+            PaymentId string `json:"paymentId"`
+        }
+        err := json.Unmarshal([]byte(event.data), &data)
+        if err != nil {
+            return ctx, fmt.Errorf("failed decoding streamed event data: %w", err)
+        }
+        if data.EventId != eventId || data.PaymentId != paymentId {
+            return ctx, fmt.Errorf("unexpected streamed event data %s", event.data)
+        }
+        stream.lastEventId = event.id
+        return ctx, nil
+    }
+}
+
+func thePaymentsStreamGetsOnlyHeartbeats(ctx context.Context) (context.Context, error) {
+    stream := paymentsStreamFromCtx(ctx)
+    // the heartbeats are only sent when there are no events
+    for heartbeats := 0; heartbeats < 2; heartbeats++ {
+        select {
+        case event, ok := <-stream.events:
+            if !ok {
+                return ctx, fmt.Errorf("the payments stream was closed")
+            }
+            if !event.heartbeat {
+                return ctx, fmt.Errorf("unexpected %s event %s", event.event, event.data)
+            }
+        case <-time.After(logsWatcherWaitForTimeout):
+            return ctx, fmt.Errorf("the payments stream didn't get any heartbeat")
+        }
+    }
+    return ctx, nil
+}
+
+func aPaymentsStreamWithoutCustomerIsRefused(ctx context.Context) (context.Context, error) {
+    url := fmt.Sprintf("http://127.0.0.1:%d/payments/stream", publicApiHttpServerPort)
+    request, err := http.NewRequest(http.MethodGet, url, nil)
+    if err != nil {
+        return ctx, fmt.Errorf("failed creating payments stream request: %w", err)
+    }
+    request.Header.Set("Authorization", "Bearer ajsonwebtoken")
+    response, err := http.DefaultClient.Do(request)
+    if err != nil {
+        return ctx, fmt.Errorf("failed opening payments stream: %w", err)
+    }
+    defer response.Body.Close()
+    if response.StatusCode != http.StatusBadRequest {
+        return ctx, fmt.Errorf("expected the payments stream to be refused with a 400, but got %d", response.StatusCode)
+    }
+    return ctx, nil
+}
+
+func thePaymentsStreamIsClosed(ctx context.Context) (context.Context, error) {
+    closePaymentsStream(ctx)
+    return ctx, nil
+}
+
+func closePaymentsStreamHook(ctx context.Context, _ *godog.Scenario, _ error) (context.Context, error) {
+    closePaymentsStream(ctx)
+    return ctx, nil
+}
+
+func closePaymentsStream(ctx context.Context) {
+    stream, ok := ctx.Value(paymentsStreamKey).(*paymentsStream)
+    if ok {
+        stream.response.Body.Close()
+    }
+}
+
+func paymentsStreamFromCtx(ctx context.Context) *paymentsStream {
+    value := ctx.Value(paymentsStreamKey)
+    if value == nil {
+        panic("paymentsStream not found in context")
+    }
+    return value.(*paymentsStream)
+}
@@ -6,6 +6,9 @@ import (
     "testing"
 
     "github.com/cucumber/godog"
+    amqp "github.com/rabbitmq/amqp091-go"
+    "github.com/walletera/eventskit/rabbitmq"
+    "github.com/walletera/payments-read-model/internal/app"
     paymentsevents "github.com/walletera/payments-types/events"
     "github.com/walletera/payments-types/publicapi"
     "go.mongodb.org/mongo-driver/v2/bson"
@@ -37,9 +40,12 @@ func InitializeProcessPaymentCreatedFeature(ctx *godog.ScenarioContext) {
     ctx.Given(`^the payments-read-model produces the following log:$`, thePaymentsRMProducesTheFollowingLog)
     ctx.When(`^the event is published$`, theEventIsPublished)
     ctx.When(`^the same PaymentCreated event is published again$`, theSamePaymentCreatedEventIsPublishedAgain)
+    ctx.When(`^the raw event (\S+) is published with routing key (\S+)$`, theRawEventIsPublishedWithRoutingKey)
     ctx.Then(`^the payments-read-model produces the following log:$`, thePaymentsRMProducesTheFollowingLog)
     ctx.Then(`^the payment exist in the payments-read-model$`, thePaymentExistInThePaymentsReadModel)
     ctx.Then(`^only one payment with the given id exists in the payments-read-model$`, onlyOnePaymentExist)
+    ctx.Then(`^the admin API shows a dead letter for event (\S+) with error code (\d+)$`, theAdminAPIShowsADeadLetter)
+    ctx.Then(`^the RabbitMQ dead letter queue holds no message$`, theRabbitMQDeadLetterQueueHoldsNoMessage)
     ctx.After(afterScenarioHook)
 }
 
@@ -152,6 +158,22 @@ func thePaymentsRMProducesTheFollowingLog(ctx context.Context, logMsg string) (c
     return ctx, nil
 }
 
+func theAdminAPIShowsADeadLetter(ctx context.Context, eventId string, errorCode int) (context.Context, error) {
+    url := fmt.Sprintf("http://127.0.0.1:%d/dead-letters/%s", adminApiHttpServerPort, eventId)
+    var deadLetter struct {
+        EventType string `json:"eventType"`
+        ErrorCode int    `json:"errorCode"`
+    }
+    err := adminAPIGet(url, &deadLetter)
+    if err != nil {
+        return ctx, err
+    }
+    if deadLetter.ErrorCode != errorCode {
+        return ctx, fmt.Errorf("expected dead letter error code to be %d, but got %d", errorCode, deadLetter.ErrorCode)
+    }
+    return ctx, nil
+}
+
 func theSamePaymentCreatedEventIsPublishedAgain(ctx context.Context) (context.Context, error) {
     return theEventIsPublished(ctx)
 }
@@ -167,3 +189,26 @@ func paymentCreatedEventFromCtx(ctx context.Context) paymentsevents.PaymentCreat
     }
     return paymentCreatedEvent
 }
+
+// theRabbitMQDeadLetterQueueHoldsNoMessage checks the events stored in the dead letter
+// store are not dead lettered a second time by the broker
+func theRabbitMQDeadLetterQueueHoldsNoMessage(ctx context.Context) (context.Context, error) {
+    conn, err := amqp.Dial(fmt.Sprintf("amqp://%s:%s@%s:%d/", rabbitmq.DefaultUser, rabbitmq.DefaultPassword, rabbitmq.DefaultHost, rabbitmq.DefaultPort))
+    if err != nil {
+        return ctx, fmt.Errorf("failed connecting to rabbitmq: %w", err)
+    }
+    defer conn.Close()
+    channel, err := conn.Channel()
+    if err != nil {
+        return ctx, fmt.Errorf("failed opening rabbitmq channel: %w", err)
+    }
+    defer channel.Close()
+    queue, err := channel.QueueDeclarePassive(app.RabbitMQDeadLetterQueueName, true, false, false, false, nil)
+    if err != nil {
+        return ctx, fmt.Errorf("failed inspecting the dead letter queue: %w", err)
+    }
+    if queue.Messages != 0 {
+        return ctx, fmt.Errorf("expected the dead letter queue to be empty, but it holds %d messages", queue.Messages)
+    }
+    return ctx, nil
+}
@@ -2,12 +2,22 @@ package tests
 
 import (
     "context"
+    "encoding/json"
+    "errors"
     "fmt"
+    "net/http"
+    "strings"
     "testing"
+    "time"
 
     "github.com/cucumber/godog"
+    "github.com/google/uuid"
+    "github.com/walletera/payments-read-model/internal/app"
     paymentsevents "github.com/walletera/payments-types/events"
     "github.com/walletera/payments-types/publicapi"
+    "go.mongodb.org/mongo-driver/v2/bson"
+    "go.mongodb.org/mongo-driver/v2/mongo"
+    "go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 func TestPaymentUpdatedEventProcessing(t *testing.T) {
@@ -36,6 +46,14 @@ func InitializeProcessPaymentUpdatedFeature(ctx *godog.ScenarioContext) {
     ctx.When(`^the event is published$`, theEventIsPublished)
     ctx.Then(`^the payments-read-model produces the following log:$`, thePaymentsRMProducesTheFollowingLog)
     ctx.Then(`^the payment in the payments-read-model has the expected new values in the updated fields$`, thePaymentsReadModelHasTheExpectedNewValues)
+    ctx.Then(`^the payment (\S+) in the payments-read-model has status (\w+)$`, thePaymentInThePaymentsReadModelHasStatus)
+    ctx.Then(`^the event log of payment (\S+) has (\d+) events$`, theEventLogOfPaymentHasEvents)
+    ctx.Then(`^the history of payment (\S+) has statuses (\S+)$`, theHistoryOfPaymentHasStatuses)
+    ctx.Given(`^the admin API lists a pending update for payment (\S+) with reason (\w+)$`, theAdminAPIListsAPendingUpdate)
+    ctx.Then(`^the admin API shows payment (\S+) with last event (\S+)$`, theAdminAPIShowsPaymentWithLastEvent)
+    ctx.Then(`^the admin API reports the service as healthy$`, theAdminAPIReportsTheServiceAsHealthy)
+    ctx.Then(`^the admin API lists a status violation for payment (\S+) from (\w+) to (\w+)$`, theAdminAPIListsAStatusViolation)
+    ctx.Then(`^a PaymentProjectionUpdated event for event (\S+) is published with version (\d+) and status (\w+)$`, aPaymentProjectionUpdatedEventIsPublished)
     ctx.After(afterScenarioHook)
 }
 
@@ -60,6 +78,213 @@ func thePaymentsReadModelHasTheExpectedNewValues(ctx context.Context) (context.C
     return ctx, nil
 }
 
+func thePaymentInThePaymentsReadModelHasStatus(ctx context.Context, paymentId string, status string) (context.Context, error) {
+    id, err := uuid.Parse(paymentId)
+    if err != nil {
+        return ctx, fmt.Errorf("invalid payment id %s: %w", paymentId, err)
+    }
+
+    listPaymentsOk, err := retrievePayments(ctx, publicapi.ListPaymentsParams{ID: publicapi.NewOptUUID(id)})
+    if err != nil {
+        return ctx, err
+    }
+
+    if len(listPaymentsOk.Items) != 1 {
+        return ctx, fmt.Errorf("expected exactly one payment with ID %s, but found %d", paymentId, len(listPaymentsOk.Items))
+    }
+
+    if string(listPaymentsOk.Items[0].Status) != status {
+        return ctx, fmt.Errorf("expected payment status to be %s, but got %s", status, listPaymentsOk.Items[0].Status)
+    }
+
+    return ctx, nil
+}
+
+func theAdminAPIListsAPendingUpdate(ctx context.Context, paymentId string, reason string) (context.Context, error) {
+    url := fmt.Sprintf("http://127.0.0.1:%d/pending-updates?paymentId=%s&reason=%s", adminApiHttpServerPort, paymentId, reason)
+    var pendingUpdates struct {
+        Total int `json:"total"`
+    }
+    err := adminAPIGet(url, &pendingUpdates)
+    if err != nil {
+        return ctx, err
+    }
+    if pendingUpdates.Total != 1 {
+        return ctx, fmt.Errorf("expected exactly one pending update for payment %s, but found %d", paymentId, pendingUpdates.Total)
+    }
+    return ctx, nil
+}
+
+func theAdminAPIShowsPaymentWithLastEvent(ctx context.Context, paymentId string, eventId string) (context.Context, error) {
+    url := fmt.Sprintf("http://127.0.0.1:%d/payments/%s", adminApiHttpServerPort, paymentId)
+    var payment struct {
+        LastEventId string `json:"lastEventId"`
+    }
+    err := adminAPIGet(url, &payment)
+    if err != nil {
+        return ctx, err
+    }
+    if payment.LastEventId != eventId {
+        return ctx, fmt.Errorf("expected the last event of payment %s to be %s, but got %s", paymentId, eventId, payment.LastEventId)
+    }
+    return ctx, nil
+}
+
+func theAdminAPIReportsTheServiceAsHealthy(ctx context.Context) (context.Context, error) {
+    url := fmt.Sprintf("http://127.0.0.1:%d/health", adminApiHttpServerPort)
+    var health struct {
+        Status   string `json:"status"`
+        RabbitMQ string `json:"rabbitmq"`
+    }
+    err := adminAPIGet(url, &health)
+    if err != nil {
+        return ctx, err
+    }
+    if health.Status != "ok" || health.RabbitMQ != "connected" {
+        return ctx, fmt.Errorf("expected the service to be healthy, but got status %s and rabbitmq %s", health.Status, health.RabbitMQ)
+    }
+    return ctx, nil
+}
+
+func theAdminAPIListsAStatusViolation(ctx context.Context, paymentId string, from string, to string) (context.Context, error) {
+    url := fmt.Sprintf("http://127.0.0.1:%d/status-violations?paymentId=%s", adminApiHttpServerPort, paymentId)
+    var statusViolations struct {
+        Items []struct {
+            From string `json:"from"`
+            To   string `json:"to"`
+        } `json:"items"`
+    }
+    err := adminAPIGet(url, &statusViolations)
+    if err != nil {
+        return ctx, err
+    }
+    if len(statusViolations.Items) != 1 {
+        return ctx, fmt.Errorf("expected exactly one status violation for payment %s, but found %d", paymentId, len(statusViolations.Items))
+    }
+    if statusViolations.Items[0].From != from || statusViolations.Items[0].To != to {
+        return ctx, fmt.Errorf("expected a status violation from %s to %s, but got one from %s to %s", from, to, statusViolations.Items[0].From, statusViolations.Items[0].To)
+    }
+    return ctx, nil
+}
+
+func theEventLogOfPaymentHasEvents(ctx context.Context, paymentId string, expectedCount int) (context.Context, error) {
+    id, err := uuid.Parse(paymentId)
+    if err != nil {
+        return ctx, fmt.Errorf("invalid payment id %s: %w", paymentId, err)
+    }
+
+    client, err := mongo.Connect(options.Client().ApplyURI(mongodbURL))
+    if err != nil {
+        return ctx, fmt.Errorf("failed connecting to mongodb: %w", err)
+    }
+    defer client.Disconnect(context.Background())
+
+    coll := client.Database(app.MongoDBDatabaseName).Collection(app.MongoDBEventLogCollectionName)
+    // parked updates are logged right after being applied, asynchronously to the event publishing
+    var count int64
+    deadline := time.Now().Add(logsWatcherWaitForTimeout)
+    for time.Now().Before(deadline) {
+        count, err = coll.CountDocuments(ctx, bson.M{"paymentId": id})
+        if err != nil {
+            return ctx, fmt.Errorf("failed counting payment events: %w", err)
+        }
+        if count == int64(expectedCount) {
+            return ctx, nil
+        }
+        time.Sleep(100 * time.Millisecond)
+    }
+    return ctx, fmt.Errorf("expected %d events in the event log of payment %s, but found %d", expectedCount, paymentId, count)
+}
+
+func aPaymentProjectionUpdatedEventIsPublished(ctx context.Context, eventId string, version int, status string) (context.Context, error) {
+    id, err := uuid.Parse(eventId)
+    if err != nil {
+        return ctx, fmt.Errorf("invalid event id %s: %w", eventId, err)
+    }
+
+    client, err := mongo.Connect(options.Client().ApplyURI(mongodbURL))
+    if err != nil {
+        return ctx, fmt.Errorf("failed connecting to mongodb: %w", err)
+    }
+    defer client.Disconnect(context.Background())
+
+    coll := client.Database(app.MongoDBDatabaseName).Collection(app.MongoDBEventLogCollectionName)
+    // the updates are published from the event log outbox by the relay, asynchronously to the event processing
+    var loggedEvent struct {
+        AggregateVersion uint64               `bson:"aggregateVersion"`
+        Status           string               `bson:"status"`
+        PublishedAt      map[string]time.Time `bson:"publishedAt"`
+    }
+    deadline := time.Now().Add(logsWatcherWaitForTimeout)
+    for time.Now().Before(deadline) {
+        err = coll.FindOne(ctx, bson.M{"_id": id}).Decode(&loggedEvent)
+        if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+            return ctx, fmt.Errorf("failed finding logged event: %w", err)
+        }
+        if _, published := loggedEvent.PublishedAt["projectionUpdates"]; err == nil && published {
+            if loggedEvent.AggregateVersion != uint64(version) || loggedEvent.Status != status {
+                return ctx, fmt.Errorf("expected a projection update with version %d and status %s, but got version %d and status %s", version, status, loggedEvent.AggregateVersion, loggedEvent.Status)
+            }
+            return ctx, nil
+        }
+        time.Sleep(100 * time.Millisecond)
+    }
+    return ctx, fmt.Errorf("the projection update of event %s was not published", eventId)
+}
+
+func theHistoryOfPaymentHasStatuses(ctx context.Context, paymentId string, expectedStatuses string) (context.Context, error) {
+    url := fmt.Sprintf("http://127.0.0.1:%d/payments/%s/history", publicApiHttpServerPort, paymentId)
+    // parked updates are added to the history right after being applied, asynchronously to the event publishing
+    var statuses []string
+    deadline := time.Now().Add(logsWatcherWaitForTimeout)
+    for time.Now().Before(deadline) {
+        var err error
+        statuses, err = retrievePaymentHistoryStatuses(url)
+        if err != nil {
+            return ctx, err
+        }
+        if strings.Join(statuses, ",") == expectedStatuses {
+            return ctx, nil
+        }
+        time.Sleep(100 * time.Millisecond)
+    }
+    return ctx, fmt.Errorf("expected payment history statuses to be %s, but got %s", expectedStatuses, strings.Join(statuses, ","))
+}
+
+func retrievePaymentHistoryStatuses(url string) ([]string, error) {
+    request, err := http.NewRequest(http.MethodGet, url, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create request: %w", err)
+    }
+    request.Header.Set("Authorization", "Bearer ajsonwebtoken")
+
+    resp, err := http.DefaultClient.Do(request)
+    if err != nil {
+        return nil, fmt.Errorf("failed to send request: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("payment history endpoint responded with status code %d", resp.StatusCode)
+    }
+
+    var history struct {
+        Items []struct {
+            Status string `json:"status"`
+        } `json:"items"`
+    }
+    err = json.NewDecoder(resp.Body).Decode(&history)
+    if err != nil {
+        return nil, fmt.Errorf("failed to decode response: %w", err)
+    }
+
+    statuses := make([]string, 0, len(history.Items))
+    for _, item := range history.Items {
+        statuses = append(statuses, item.Status)
+    }
+    return statuses, nil
+}
+
 func paymentUpdatedEventFromCtx(ctx context.Context) paymentsevents.PaymentUpdated {
     value := ctx.Value(deserializedEventKey)
     if value == nil {
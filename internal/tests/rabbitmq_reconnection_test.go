@@ -0,0 +1,110 @@
+package tests
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/cucumber/godog"
+    "github.com/walletera/payments-read-model/internal/app"
+)
+
+const (
+    rabbitmqRestartTimeout = 30 * time.Second
+    // rabbitmqReconnectionMaxBackoff keeps the reconnection quick once the broker is back
+    rabbitmqReconnectionMaxBackoff = time.Second
+)
+
+func TestRabbitMQReconnection(t *testing.T) {
+
+    suite := godog.TestSuite{
+        ScenarioInitializer: InitializeRabbitMQReconnectionFeature,
+        Options: &godog.Options{
+            Format:   "pretty",
+            Paths:    []string{"features/rabbitmq_reconnection.feature"},
+            TestingT: t, // Testing instance that will run subtests.
+        },
+    }
+
+    if suite.Run() != 0 {
+        t.Fatal("non-zero status returned, failed to run feature tests")
+    }
+}
+
+func InitializeRabbitMQReconnectionFeature(ctx *godog.ScenarioContext) {
+    ctx.Before(beforeScenarioHook)
+    ctx.Given(`^a running payments-read-model with a short rabbitmq reconnection backoff$`, aRunningPaymentsReadModelWithAShortRabbitMQReconnectionBackoff)
+    ctx.Given(`^the admin API reports the service as healthy$`, theAdminAPIEventuallyReportsTheServiceAsHealthy)
+    ctx.When(`^the RabbitMQ broker is stopped$`, theRabbitMQBrokerIsStopped)
+    ctx.Then(`^the admin API reports the rabbitmq connection as disconnected$`, theAdminAPIReportsTheRabbitMQConnectionAsDisconnected)
+    ctx.When(`^the RabbitMQ broker is started again$`, theRabbitMQBrokerIsStartedAgain)
+    ctx.Then(`^the payments-read-model produces the following log:$`, thePaymentsRMProducesTheFollowingLog)
+    ctx.Given(`^a PaymentCreated event:$`, anEvent)
+    ctx.When(`^the event is published$`, theEventIsPublished)
+    ctx.Then(`^the payment exist in the payments-read-model$`, thePaymentExistInThePaymentsReadModel)
+    ctx.After(afterScenarioHook)
+}
+
+func aRunningPaymentsReadModelWithAShortRabbitMQReconnectionBackoff(ctx context.Context) (context.Context, error) {
+    return aRunningPaymentsReadModelWithOptions(
+        ctx,
+        app.WithRabbitMQReconnectBackoff(100*time.Millisecond, rabbitmqReconnectionMaxBackoff),
+    )
+}
+
+func theAdminAPIEventuallyReportsTheServiceAsHealthy(ctx context.Context) (context.Context, error) {
+    return eventually(ctx, theAdminAPIReportsTheServiceAsHealthy)
+}
+
+func theRabbitMQBrokerIsStopped(ctx context.Context) (context.Context, error) {
+    stopCtx, cancel := context.WithTimeout(ctx, rabbitmqRestartTimeout)
+    defer cancel()
+    timeout := 10 * time.Second
+    err := rabbitmqContainer.Stop(stopCtx, &timeout)
+    if err != nil {
+        return ctx, fmt.Errorf("failed stopping rabbitmq container: %w", err)
+    }
+    return ctx, nil
+}
+
+func theRabbitMQBrokerIsStartedAgain(ctx context.Context) (context.Context, error) {
+    startCtx, cancel := context.WithTimeout(ctx, rabbitmqRestartTimeout)
+    defer cancel()
+    // the container waiting strategy runs again, so it's started once the broker accepts connections
+    err := rabbitmqContainer.Start(startCtx)
+    if err != nil {
+        return ctx, fmt.Errorf("failed starting rabbitmq container: %w", err)
+    }
+    return ctx, nil
+}
+
+func theAdminAPIReportsTheRabbitMQConnectionAsDisconnected(ctx context.Context) (context.Context, error) {
+    url := fmt.Sprintf("http://127.0.0.1:%d/health", adminApiHttpServerPort)
+    return eventually(ctx, func(ctx context.Context) (context.Context, error) {
+        resp, err := adminAPIRequest(http.MethodGet, url, nil)
+        if err != nil {
+            return ctx, fmt.Errorf("failed to send admin api request: %w", err)
+        }
+        defer resp.Body.Close()
+        var health struct {
+            Status   string `json:"status"`
+            RabbitMQ string `json:"rabbitmq"`
+        }
+        err = json.NewDecoder(resp.Body).Decode(&health)
+        if err != nil {
+            return ctx, fmt.Errorf("failed to decode admin api response: %w", err)
+        }
+        if resp.StatusCode != http.StatusServiceUnavailable || health.Status != "degraded" || health.RabbitMQ != "disconnected" {
+            return ctx, fmt.Errorf(
+                "expected the service to be degraded with rabbitmq disconnected, but got status code %d, status %s and rabbitmq %s",
+                resp.StatusCode,
+                health.Status,
+                health.RabbitMQ,
+            )
+        }
+        return ctx, nil
+    })
+}
@@ -0,0 +1,222 @@
+package tests
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/cucumber/godog"
+    "github.com/google/uuid"
+    "github.com/walletera/eventskit/events"
+    "github.com/walletera/eventskit/rabbitmq"
+    "github.com/walletera/payments-read-model/internal/app"
+    "go.mongodb.org/mongo-driver/v2/bson"
+    "go.mongodb.org/mongo-driver/v2/mongo"
+    "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+    rebuildKey            = "rebuild"
+    rebuildCompletedAfter = 30 * time.Second
+    // the rebuild waits for the processing timeout once every instance switched
+    rebuildProcessingTimeout = 2 * time.Second
+)
+
+type rebuildResponse struct {
+    ID               string `json:"id"`
+    Status           string `json:"status"`
+    ShadowCollection string `json:"shadowCollection"`
+    Error            string `json:"error"`
+}
+
+func TestRebuildProjection(t *testing.T) {
+
+    suite := godog.TestSuite{
+        ScenarioInitializer: InitializeRebuildProjectionFeature,
+        Options: &godog.Options{
+            Format:   "pretty",
+            Paths:    []string{"features/rebuild_projection.feature"},
+            TestingT: t, // Testing instance that will run subtests.
+        },
+    }
+
+    if suite.Run() != 0 {
+        t.Fatal("non-zero status returned, failed to run feature tests")
+    }
+}
+
+func InitializeRebuildProjectionFeature(ctx *godog.ScenarioContext) {
+    ctx.Before(beforeScenarioHook)
+    ctx.Given(`^a running payments-read-model$`, aRunningPaymentsReadModelForRebuilds)
+    ctx.Given(`^a PaymentCreated event:$`, anEvent)
+    ctx.Given(`^a PaymentUpdated event:$`, anEvent)
+    ctx.Given(`^the event is published$`, theEventIsPublished)
+    ctx.Given(`^the payments-read-model produces the following log:$`, thePaymentsRMProducesTheFollowingLog)
+    ctx.Given(`^a payment projected before the event log was introduced$`, aPaymentProjectedBeforeTheEventLogWasIntroduced)
+    ctx.When(`^the admin API starts a projection rebuild$`, theAdminAPIStartsAProjectionRebuild)
+    ctx.When(`^the admin API starts a projection rebuild while (\d+) payments are created$`, theAdminAPIStartsAProjectionRebuildWhilePaymentsAreCreated)
+    ctx.When(`^the admin API is asked to start a projection rebuild$`, theAdminAPIIsAskedToStartAProjectionRebuild)
+    ctx.Then(`^the projection rebuild completes$`, theProjectionRebuildCompletes)
+    ctx.Then(`^the rebuilt collection holds (\d+) payments$`, theRebuiltCollectionHoldsPayments)
+    ctx.Then(`^the payment (\S+) in the payments-read-model has status (\w+)$`, thePaymentInThePaymentsReadModelHasStatus)
+    ctx.Then(`^the payments-read-model respond with status code (\d+)$`, thePaymentsRMRespondWithStatusCode)
+    ctx.After(afterScenarioHook)
+}
+
+func aRunningPaymentsReadModelForRebuilds(ctx context.Context) (context.Context, error) {
+    return aRunningPaymentsReadModelWithOptions(ctx, app.WithDispatcherProcessingTimeout(rebuildProcessingTimeout))
+}
+
+func aPaymentProjectedBeforeTheEventLogWasIntroduced(ctx context.Context) (context.Context, error) {
+    client, err := getMongodbClient()
+    if err != nil {
+        return ctx, err
+    }
+    defer client.Disconnect(context.Background())
+
+    coll := client.Database(app.MongoDBDatabaseName).Collection(app.MongoDBPaymentsCollectionName)
+    _, err = coll.InsertOne(ctx, bson.M{"_id": uuid.NewString(), "version": 0, "data": bson.M{"status": "pending"}})
+    if err != nil {
+        return ctx, fmt.Errorf("failed inserting payment: %w", err)
+    }
+    return ctx, nil
+}
+
+func theAdminAPIIsAskedToStartAProjectionRebuild(ctx context.Context) (context.Context, error) {
+    url := fmt.Sprintf("http://127.0.0.1:%d/rebuilds", adminApiHttpServerPort)
+    resp, err := adminAPIRequest(http.MethodPost, url, nil)
+    if err != nil {
+        return ctx, fmt.Errorf("failed to send admin api request: %w", err)
+    }
+    defer resp.Body.Close()
+
+    return context.WithValue(ctx, responseStatusCodeKey, resp.StatusCode), nil
+}
+
+// theAdminAPIStartsAProjectionRebuildWhilePaymentsAreCreated publishes copies of the
+// PaymentCreated event in the context, with new ids, while the rebuild starts
+func theAdminAPIStartsAProjectionRebuildWhilePaymentsAreCreated(ctx context.Context, paymentsCount int) (context.Context, error) {
+    publisher, err := rabbitmq.NewClient(
+        rabbitmq.WithExchangeName(app.RabbitMQPaymentsExchangeName),
+        rabbitmq.WithExchangeType(app.RabbitMQExchangeType),
+    )
+    if err != nil {
+        return ctx, fmt.Errorf("error creating rabbitmq client: %s", err.Error())
+    }
+    var event map[string]any
+    err = json.Unmarshal(ctx.Value(rawEventKey).([]byte), &event)
+    if err != nil {
+        return ctx, fmt.Errorf("failed decoding event: %w", err)
+    }
+
+    published := make(chan error, 1)
+    go func() {
+        for i := 0; i < paymentsCount; i++ {
+            event["id"] = uuid.NewString()
+            event["data"].(map[string]any)["id"] = uuid.NewString()
+            rawEvent, err := json.Marshal(event)
+            if err != nil {
+                published <- err
+                return
+            }
+            err = publisher.Publish(ctx, publishable{rawEvent: rawEvent}, events.RoutingInfo{
+                Topic:      app.RabbitMQPaymentsExchangeName,
+                RoutingKey: app.RabbitMQPaymentCreatedRoutingKey,
+            })
+            if err != nil {
+                published <- fmt.Errorf("error publishing PaymentCreated event to rabbitmq: %w", err)
+                return
+            }
+        }
+        published <- nil
+    }()
+
+    ctx, err = theAdminAPIStartsAProjectionRebuild(ctx)
+    if err != nil {
+        return ctx, err
+    }
+    return ctx, <-published
+}
+
+func theAdminAPIStartsAProjectionRebuild(ctx context.Context) (context.Context, error) {
+    url := fmt.Sprintf("http://127.0.0.1:%d/rebuilds", adminApiHttpServerPort)
+    resp, err := adminAPIRequest(http.MethodPost, url, nil)
+    if err != nil {
+        return ctx, fmt.Errorf("failed to send admin api request: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusAccepted {
+        return ctx, fmt.Errorf("admin api responded with status code %d", resp.StatusCode)
+    }
+
+    var rebuild rebuildResponse
+    err = json.NewDecoder(resp.Body).Decode(&rebuild)
+    if err != nil {
+        return ctx, fmt.Errorf("failed to decode admin api response: %w", err)
+    }
+
+    return context.WithValue(ctx, rebuildKey, rebuild), nil
+}
+
+func theProjectionRebuildCompletes(ctx context.Context) (context.Context, error) {
+    rebuild := ctx.Value(rebuildKey).(rebuildResponse)
+    url := fmt.Sprintf("http://127.0.0.1:%d/rebuilds/%s", adminApiHttpServerPort, rebuild.ID)
+    deadline := time.Now().Add(rebuildCompletedAfter)
+    for time.Now().Before(deadline) {
+        err := adminAPIGet(url, &rebuild)
+        if err != nil {
+            return ctx, err
+        }
+        switch rebuild.Status {
+        case "completed":
+            return context.WithValue(ctx, rebuildKey, rebuild), nil
+        case "failed":
+            return ctx, fmt.Errorf("projection rebuild failed: %s", rebuild.Error)
+        }
+        time.Sleep(200 * time.Millisecond)
+    }
+    return ctx, fmt.Errorf("projection rebuild didn't complete after %s", rebuildCompletedAfter)
+}
+
+func theRebuiltCollectionHoldsPayments(ctx context.Context, expectedCount int) (context.Context, error) {
+    rebuild := ctx.Value(rebuildKey).(rebuildResponse)
+
+    client, err := mongo.Connect(options.Client().ApplyURI(mongodbURL))
+    if err != nil {
+        return ctx, fmt.Errorf("failed connecting to mongodb: %w", err)
+    }
+    defer client.Disconnect(context.Background())
+
+    // the events published during the rebuild may still be consumed
+    db := client.Database(app.MongoDBDatabaseName)
+    deadline := time.Now().Add(logsWatcherWaitForTimeout)
+    for {
+        count, err := db.Collection(rebuild.ShadowCollection).CountDocuments(ctx, bson.M{})
+        if err != nil {
+            return ctx, fmt.Errorf("failed counting rebuilt payments: %w", err)
+        }
+        if count == int64(expectedCount) {
+            break
+        }
+        if time.Now().After(deadline) {
+            return ctx, fmt.Errorf("expected %d payments in the rebuilt collection, but found %d", expectedCount, count)
+        }
+        time.Sleep(100 * time.Millisecond)
+    }
+
+    var metadata struct {
+        ActiveCollection string `bson:"activeCollection"`
+    }
+    err = db.Collection(app.MongoDBProjectionsCollectionName).FindOne(ctx, bson.M{"_id": "payments"}).Decode(&metadata)
+    if err != nil {
+        return ctx, fmt.Errorf("failed finding projections metadata: %w", err)
+    }
+    if metadata.ActiveCollection != rebuild.ShadowCollection {
+        return ctx, fmt.Errorf("expected active collection to be %s, but got %s", rebuild.ShadowCollection, metadata.ActiveCollection)
+    }
+    return ctx, nil
+}
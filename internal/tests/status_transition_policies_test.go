@@ -0,0 +1,130 @@
+package tests
+
+import (
+    "context"
+    "fmt"
+    "testing"
+    "time"
+
+    "github.com/cucumber/godog"
+    "github.com/walletera/payments-read-model/internal/app"
+    "github.com/walletera/payments-read-model/internal/domain/payments"
+)
+
+// statusTransitionHandledAfter bounds the wait for the outcome of an illegal
+// status transition, which is recorded after the violation is logged
+const statusTransitionHandledAfter = 5 * time.Second
+
+func TestStatusTransitionPolicies(t *testing.T) {
+
+    suite := godog.TestSuite{
+        ScenarioInitializer: InitializeStatusTransitionPoliciesFeature,
+        Options: &godog.Options{
+            Format:   "pretty",
+            Paths:    []string{"features/status_transition_policies.feature"},
+            TestingT: t, // Testing instance that will run subtests.
+        },
+    }
+
+    if suite.Run() != 0 {
+        t.Fatal("non-zero status returned, failed to run feature tests")
+    }
+}
+
+func InitializeStatusTransitionPoliciesFeature(ctx *godog.ScenarioContext) {
+    ctx.Before(beforeScenarioHook)
+    ctx.Given(`^a running payments-read-model with the (\w+) status transition policy$`, aRunningPaymentsReadModelWithTheStatusTransitionPolicy)
+    ctx.Given(`^a PaymentCreated event:$`, anEvent)
+    ctx.Given(`^a PaymentUpdated event:$`, anEvent)
+    ctx.Given(`^the event is published$`, theEventIsPublished)
+    ctx.Given(`^the payments-read-model produces the following log:$`, thePaymentsRMProducesTheFollowingLog)
+    ctx.When(`^the same event is published again$`, theEventIsPublished)
+    ctx.Then(`^the payments-read-model produces the following log:$`, thePaymentsRMProducesTheFollowingLog)
+    ctx.Then(`^the admin API shows a dead letter for event (\S+) with error code (\d+)$`, theAdminAPIEventuallyShowsADeadLetter)
+    ctx.Then(`^the payment (\S+) in the payments-read-model has status (\w+) and version (\d+)$`, thePaymentInThePaymentsReadModelHasStatusAndVersion)
+    ctx.Then(`^the payments-read-model holds no dead letter$`, thePaymentsRMHoldsNoDeadLetter)
+    ctx.Then(`^the admin API lists a status violation for payment (\S+) from (\w+) to (\w+) with action (\w+)$`, theAdminAPIListsAStatusViolationWithAction)
+    ctx.After(afterScenarioHook)
+}
+
+func aRunningPaymentsReadModelWithTheStatusTransitionPolicy(ctx context.Context, policy string) (context.Context, error) {
+    statusTransitionPolicy, err := payments.ParseStatusTransitionPolicy(policy)
+    if err != nil {
+        return ctx, err
+    }
+    return aRunningPaymentsReadModelWithOptions(ctx, app.WithStatusTransitionPolicy(statusTransitionPolicy))
+}
+
+func theAdminAPIEventuallyShowsADeadLetter(ctx context.Context, eventId string, errorCode int) (context.Context, error) {
+    return eventually(ctx, func(ctx context.Context) (context.Context, error) {
+        return theAdminAPIShowsADeadLetter(ctx, eventId, errorCode)
+    })
+}
+
+func thePaymentInThePaymentsReadModelHasStatusAndVersion(ctx context.Context, paymentId string, status string, version int) (context.Context, error) {
+    url := fmt.Sprintf("http://127.0.0.1:%d/payments/%s", adminApiHttpServerPort, paymentId)
+    return eventually(ctx, func(ctx context.Context) (context.Context, error) {
+        var payment struct {
+            AggregateVersion int    `json:"aggregateVersion"`
+            Status           string `json:"status"`
+        }
+        err := adminAPIGet(url, &payment)
+        if err != nil {
+            return ctx, err
+        }
+        if payment.Status != status || payment.AggregateVersion != version {
+            return ctx, fmt.Errorf(
+                "expected payment %s with status %s and version %d, but got status %s and version %d",
+                paymentId,
+                status,
+                version,
+                payment.Status,
+                payment.AggregateVersion,
+            )
+        }
+        return ctx, nil
+    })
+}
+
+func theAdminAPIListsAStatusViolationWithAction(ctx context.Context, paymentId string, from string, to string, action string) (context.Context, error) {
+    url := fmt.Sprintf("http://127.0.0.1:%d/status-violations?paymentId=%s", adminApiHttpServerPort, paymentId)
+    var statusViolations struct {
+        Items []struct {
+            From   string `json:"from"`
+            To     string `json:"to"`
+            Action string `json:"action"`
+        } `json:"items"`
+    }
+    err := adminAPIGet(url, &statusViolations)
+    if err != nil {
+        return ctx, err
+    }
+    if len(statusViolations.Items) != 1 {
+        return ctx, fmt.Errorf("expected exactly one status violation for payment %s, but found %d", paymentId, len(statusViolations.Items))
+    }
+    violation := statusViolations.Items[0]
+    if violation.From != from || violation.To != to || violation.Action != action {
+        return ctx, fmt.Errorf(
+            "expected a status violation from %s to %s with action %s, but got one from %s to %s with action %s",
+            from,
+            to,
+            action,
+            violation.From,
+            violation.To,
+            violation.Action,
+        )
+    }
+    return ctx, nil
+}
+
+// eventually retries the step until it succeeds or statusTransitionHandledAfter elapses
+func eventually(ctx context.Context, step func(ctx context.Context) (context.Context, error)) (context.Context, error) {
+    deadline := time.Now().Add(statusTransitionHandledAfter)
+    for {
+        stepCtx, err := step(ctx)
+        if err == nil || time.Now().After(deadline) {
+            return stepCtx, err
+        }
+        time.Sleep(100 * time.Millisecond)
+    }
+}
@@ -0,0 +1,197 @@
+package tests
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/cucumber/godog"
+    "github.com/walletera/payments-read-model/internal/app"
+    "github.com/walletera/payments-read-model/internal/domain/webhooks"
+)
+
+const (
+    webhookSecret      = "whsec_test"
+    webhookReceiverKey = "webhookReceiver"
+)
+
+type receivedWebhook struct {
+    signature string
+    body      []byte
+}
+
+type webhookReceiver struct {
+    server   *httptest.Server
+    received chan receivedWebhook
+}
+
+func TestWebhooks(t *testing.T) {
+
+    suite := godog.TestSuite{
+        ScenarioInitializer: InitializeWebhooksFeature,
+        Options: &godog.Options{
+            Format:   "pretty",
+            Paths:    []string{"features/webhooks.feature"},
+            TestingT: t, // Testing instance that will run subtests.
+        },
+    }
+
+    if suite.Run() != 0 {
+        t.Fatal("non-zero status returned, failed to run feature tests")
+    }
+}
+
+func InitializeWebhooksFeature(ctx *godog.ScenarioContext) {
+    ctx.Before(beforeScenarioHook)
+    ctx.Given(`^a running payments-read-model$`, aRunningPaymentsReadModelDeliveringToTheLocalReceiver)
+    ctx.Given(`^a webhook receiver$`, aWebhookReceiver)
+    ctx.Given(`^a webhook subscription of customer (\S+) for statuses (\S+)$`, aWebhookSubscription)
+    ctx.Given(`^a PaymentCreated event:$`, anEvent)
+    ctx.Given(`^the event is published$`, theEventIsPublished)
+    ctx.Given(`^the payments-read-model produces the following log:$`, thePaymentsRMProducesTheFollowingLog)
+    ctx.Given(`^a PaymentUpdated event:$`, anEvent)
+    ctx.When(`^the event is published$`, theEventIsPublished)
+    ctx.Then(`^the webhook receiver gets a signed status change of payment (\S+) from (\w+) to (\w+)$`, theWebhookReceiverGetsASignedStatusChange)
+    ctx.Then(`^the admin API lists a delivered webhook delivery for payment (\S+)$`, theAdminAPIListsADeliveredWebhookDelivery)
+    ctx.After(closeWebhookReceiverHook)
+    ctx.After(afterScenarioHook)
+}
+
+// aRunningPaymentsReadModelDeliveringToTheLocalReceiver allows the private targets,
+// as the webhook receiver listens on the loopback address
+func aRunningPaymentsReadModelDeliveringToTheLocalReceiver(ctx context.Context) (context.Context, error) {
+    config := webhooks.DefaultDeliveryConfig()
+    config.AllowPrivateTargets = true
+    return aRunningPaymentsReadModelWithOptions(ctx, app.WithWebhookDeliveryConfig(config))
+}
+
+func aWebhookReceiver(ctx context.Context) (context.Context, error) {
+    receiver := &webhookReceiver{received: make(chan receivedWebhook, 10)}
+    receiver.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, err := io.ReadAll(r.Body)
+        if err != nil {
+            w.WriteHeader(http.StatusBadRequest)
+            return
+        }
+        receiver.received <- receivedWebhook{signature: r.Header.Get(webhooks.SignatureHeader), body: body}
+        w.WriteHeader(http.StatusNoContent)
+    }))
+    return context.WithValue(ctx, webhookReceiverKey, receiver), nil
+}
+
+func aWebhookSubscription(ctx context.Context, customerId string, statuses string) (context.Context, error) {
+    body, err := json.Marshal(map[string]any{
+        "customerId": customerId,
+        "url":        webhookReceiverFromCtx(ctx).server.URL,
+        "statuses":   strings.Split(statuses, ","),
+        "secret":     webhookSecret,
+    })
+    if err != nil {
+        return ctx, fmt.Errorf("failed encoding webhook subscription: %w", err)
+    }
+    url := fmt.Sprintf("http://127.0.0.1:%d/webhooks/subscriptions", adminApiHttpServerPort)
+    resp, err := adminAPIRequest(http.MethodPost, url, bytes.NewReader(body))
+    if err != nil {
+        return ctx, fmt.Errorf("failed to send admin api request: %w", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusCreated {
+        return ctx, fmt.Errorf("webhook subscription creation responded with status code %d", resp.StatusCode)
+    }
+    return ctx, nil
+}
+
+func theWebhookReceiverGetsASignedStatusChange(ctx context.Context, paymentId string, previousStatus string, status string) (context.Context, error) {
+    var webhook receivedWebhook
+    select {
+    case webhook = <-webhookReceiverFromCtx(ctx).received:
+    case <-time.After(logsWatcherWaitForTimeout):
+        return ctx, fmt.Errorf("the webhook receiver didn't get any webhook")
+    }
+
+    timestamp, found := strings.CutPrefix(strings.Split(webhook.signature, ",")[0], "t=")
+    if !found {
+        return ctx, fmt.Errorf("invalid webhook signature %s", webhook.signature)
+    }
+    unixTimestamp, err := strconv.ParseInt(timestamp, 10, 64)
+    if err != nil {
+        return ctx, fmt.Errorf("invalid webhook signature timestamp %s", timestamp)
+    }
+    expectedSignature := webhooks.Sign(webhookSecret, time.Unix(unixTimestamp, 0), webhook.body)
+    if webhook.signature != expectedSignature {
+        return ctx, fmt.Errorf("expected webhook signature %s, but got %s", expectedSignature, webhook.signature)
+    }
+
+    var payload struct {
+        Type string `json:"type"`
+        Data struct {
+            PaymentId      string `json:"paymentId"`
+            PreviousStatus string `json:"previousStatus"`
+            Status         string `json:"status"`
+        } `json:"data"`
+    }
+    err = json.Unmarshal(webhook.body, &payload)
+    if err != nil {
+        return ctx, fmt.Errorf("failed decoding webhook payload: %w", err)
+    }
+    if payload.Type != webhooks.PaymentStatusChangedType ||
+        payload.Data.PaymentId != paymentId ||
+        payload.Data.PreviousStatus != previousStatus ||
+        payload.Data.Status != status {
+        return ctx, fmt.Errorf("unexpected webhook payload %s", webhook.body)
+    }
+    return ctx, nil
+}
+
+func theAdminAPIListsADeliveredWebhookDelivery(ctx context.Context, paymentId string) (context.Context, error) {
+    url := fmt.Sprintf("http://127.0.0.1:%d/webhooks/deliveries?paymentId=%s", adminApiHttpServerPort, paymentId)
+    var deliveries struct {
+        Items []struct {
+            State    string `json:"state"`
+            Attempts []struct {
+                StatusCode int `json:"statusCode"`
+            } `json:"attempts"`
+        } `json:"items"`
+    }
+    // the attempt is recorded after the response is received
+    deadline := time.Now().Add(logsWatcherWaitForTimeout)
+    for time.Now().Before(deadline) {
+        err := adminAPIGet(url, &deliveries)
+        if err != nil {
+            return ctx, err
+        }
+        if len(deliveries.Items) == 1 && deliveries.Items[0].State == string(webhooks.DeliveryStateDelivered) {
+            attempts := deliveries.Items[0].Attempts
+            if len(attempts) != 1 || attempts[0].StatusCode != http.StatusNoContent {
+                return ctx, fmt.Errorf("expected a single attempt answered with status %d", http.StatusNoContent)
+            }
+            return ctx, nil
+        }
+        time.Sleep(100 * time.Millisecond)
+    }
+    return ctx, fmt.Errorf("expected a delivered webhook delivery for payment %s", paymentId)
+}
+
+func closeWebhookReceiverHook(ctx context.Context, _ *godog.Scenario, _ error) (context.Context, error) {
+    receiver, ok := ctx.Value(webhookReceiverKey).(*webhookReceiver)
+    if ok {
+        receiver.server.Close()
+    }
+    return ctx, nil
+}
+
+func webhookReceiverFromCtx(ctx context.Context) *webhookReceiver {
+    value := ctx.Value(webhookReceiverKey)
+    if value == nil {
+        panic("webhookReceiver not found in context")
+    }
+    return value.(*webhookReceiver)
+}
@@ -1,6 +1,10 @@
 package logattr
 
-import "log/slog"
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
 
 func ServiceName(serviceName string) slog.Attr {
 	return slog.String("service_name", serviceName)
@@ -22,6 +26,12 @@ func BindStatus(bindStatus int) slog.Attr {
 	return slog.Int("bind_status", bindStatus)
 }
 
+func EventId(eventId string) slog.Attr { return slog.String("event_id", eventId) }
+
+func AggregateVersion(aggregateVersion uint64) slog.Attr {
+	return slog.Uint64("aggregate_version", aggregateVersion)
+}
+
 func EventType(eventType string) slog.Attr {
 	return slog.String("event_type", eventType)
 }
@@ -37,3 +47,83 @@ func CorrelationId(correlationId string) slog.Attr {
 func StreamName(streamName string) slog.Attr {
 	return slog.String("stream_name", streamName)
 }
+
+func PendingReason(reason string) slog.Attr {
+	return slog.String("pending_reason", reason)
+}
+
+func ParkedAt(parkedAt time.Time) slog.Attr {
+	return slog.Time("parked_at", parkedAt)
+}
+
+func Attempts(attempts int) slog.Attr {
+	return slog.Int("attempts", attempts)
+}
+
+func RetryDelay(retryDelay time.Duration) slog.Attr {
+	return slog.Duration("retry_delay", retryDelay)
+}
+
+func UnknownEventsPolicy(policy string) slog.Attr {
+	return slog.String("unknown_events_policy", policy)
+}
+
+func Collection(collection string) slog.Attr {
+	return slog.String("collection", collection)
+}
+
+func RebuildId(rebuildId string) slog.Attr {
+	return slog.String("rebuild_id", rebuildId)
+}
+
+func ReplayedEvents(replayedEvents int) slog.Attr {
+	return slog.Int("replayed_events", replayedEvents)
+}
+
+func PreviousCount(previousCount int) slog.Attr {
+	return slog.Int("previous_count", previousCount)
+}
+
+func ShadowCount(shadowCount int) slog.Attr {
+	return slog.Int("shadow_count", shadowCount)
+}
+
+func MismatchedPayments(mismatchedPayments int) slog.Attr {
+	return slog.Int("mismatched_payments", mismatchedPayments)
+}
+
+func StatusTransition(from string, to string) slog.Attr {
+	return slog.String("status_transition", from+"->"+to)
+}
+
+func StatusTransitionPolicy(policy string) slog.Attr {
+	return slog.String("status_transition_policy", policy)
+}
+
+func SchemaVersion(from int, to int) slog.Attr {
+	return slog.String("schema_version", fmt.Sprintf("%d->%d", from, to))
+}
+
+func File(file string) slog.Attr {
+	return slog.String("file", file)
+}
+
+func Line(line int) slog.Attr {
+	return slog.Int("line", line)
+}
+
+func ErrorCode(errorCode int) slog.Attr {
+	return slog.Int("error_code", errorCode)
+}
+
+func SubscriptionId(subscriptionId string) slog.Attr {
+	return slog.String("subscription_id", subscriptionId)
+}
+
+func DeliveryId(deliveryId string) slog.Attr {
+	return slog.String("delivery_id", deliveryId)
+}
+
+func HTTPStatus(httpStatus int) slog.Attr {
+	return slog.Int("http_status", httpStatus)
+}